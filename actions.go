@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// slippages above this are warned about, past MAX_SLIPPAGE_BPS refused
+	HIGH_SLIPPAGE_BPS = 300
+	MAX_SLIPPAGE_BPS  = 5000
+)
+
+// actionsConfig is read from actions.json in the config directory: the
+// Uniswap V2 compatible router of swaps and the wrapped native token when the
+// network bundle has none
+type actionsConfig struct {
+	Router string `json:"router"`
+	WETH   string `json:"weth"`
+}
+
+func loadActionsConfig() (*actionsConfig, error) {
+	path := configPath("actions.json")
+	config := &actionsConfig{}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("invalid actions config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// wrappedNative returns the WETH of the network bundle, else the configured one
+func wrappedNative(config *actionsConfig) (common.Address, error) {
+	if config.WETH != "" {
+		return parseAddress(config.WETH)
+	}
+	chainID, err := serviceChain()
+	if err != nil {
+		return common.Address{}, err
+	}
+	for _, t := range currentNetwork().Tokens {
+		if t.Symbol == "WETH" {
+			return common.HexToAddress(t.Address), nil
+		}
+	}
+	return common.Address{}, fmt.Errorf("no WETH is known on chain %d, set weth in %s", chainID, configPath("actions.json"))
+}
+
+// buildWrap deposits amount of the safe's native balance into WETH
+func buildWrap(client EthClient, safe, weth common.Address, amount *big.Int) ([]multiSendTx, error) {
+	balance, err := client.BalanceAt(opCtx, safe, nil)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(amount) < 0 {
+		return nil, fmt.Errorf("the safe holds %s, less than %s", formatWei(balance), formatWei(amount))
+	}
+	data, err := encodeCall("deposit()")
+	if err != nil {
+		return nil, err
+	}
+	return []multiSendTx{{To: weth, Value: amount, Data: data}}, nil
+}
+
+// buildUnwrap withdraws amount of the safe's WETH to native
+func buildUnwrap(client EthClient, safe, weth common.Address, amount *big.Int) ([]multiSendTx, error) {
+	balance, err := callUint(client, weth, "balanceOf(address)", safe)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(amount) < 0 {
+		return nil, fmt.Errorf("the safe holds %s WETH, less than %s", formatUnits(balance, 18, display.Precision), formatUnits(amount, 18, display.Precision))
+	}
+	data, err := encodeCall("withdraw(uint256)", amount)
+	if err != nil {
+		return nil, err
+	}
+	return []multiSendTx{{To: weth, Value: new(big.Int), Data: data}}, nil
+}
+
+// swapQuote is an exact-in swap with the output the router quotes and the
+// minimum the swap accepts
+type swapQuote struct {
+	Router    common.Address
+	TokenIn   common.Address
+	TokenOut  common.Address
+	AmountIn  *big.Int
+	Quoted    *big.Int
+	MinOut    *big.Int
+	Slippage  uint64
+	Deadline  time.Time
+	Recipient common.Address
+}
+
+// quoteSwap asks the router for the output of amountIn and derives the
+// minimum output of the slippage in basis points
+func quoteSwap(client EthClient, router, tokenIn, tokenOut common.Address, amountIn *big.Int, slippage uint64) (*swapQuote, error) {
+	if tokenIn == tokenOut {
+		return nil, errors.New("the swap has the same token in and out")
+	}
+	if slippage > MAX_SLIPPAGE_BPS {
+		return nil, fmt.Errorf("slippage of %d bps is above the maximum of %d", slippage, MAX_SLIPPAGE_BPS)
+	}
+	values, err := callView(client, router, "getAmountsOut(uint256,address[])", "(uint256[])", amountIn, []common.Address{tokenIn, tokenOut})
+	if err != nil {
+		return nil, fmt.Errorf("quoting the swap on router %s failed: %w", router.Hex(), err)
+	}
+	amounts := values[0].([]*big.Int)
+	if len(amounts) != 2 || amounts[1].Sign() == 0 {
+		return nil, fmt.Errorf("router %s quotes no output, the pair may have no liquidity", router.Hex())
+	}
+
+	minOut := new(big.Int).Mul(amounts[1], new(big.Int).SetUint64(10000-slippage))
+	minOut.Div(minOut, big.NewInt(10000))
+	return &swapQuote{Router: router, TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: amountIn, Quoted: amounts[1], MinOut: minOut, Slippage: slippage}, nil
+}
+
+// buildSwap approves the router to pull the input and swaps it for at least
+// the minimum output, paid to the safe
+func buildSwap(client EthClient, safe common.Address, q *swapQuote) ([]multiSendTx, error) {
+	balance, err := callUint(client, q.TokenIn, "balanceOf(address)", safe)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(q.AmountIn) < 0 {
+		return nil, fmt.Errorf("the safe holds %s of %s, less than %s", balance, displayAddress(q.TokenIn), q.AmountIn)
+	}
+
+	approve, err := encodeCall("approve(address,uint256)", q.Router, q.AmountIn)
+	if err != nil {
+		return nil, err
+	}
+	swap, err := encodeCall("swapExactTokensForTokens(uint256,uint256,address[],address,uint256)",
+		q.AmountIn, q.MinOut, []common.Address{q.TokenIn, q.TokenOut}, safe, big.NewInt(q.Deadline.Unix()))
+	if err != nil {
+		return nil, err
+	}
+	q.Recipient = safe
+	return []multiSendTx{
+		{To: q.TokenIn, Value: new(big.Int), Data: approve},
+		{To: q.Router, Value: new(big.Int), Data: swap},
+	}, nil
+}
+
+// previewSwap prints what the swap gives at worst, warning about a high
+// slippage
+func previewSwap(client EthClient, q *swapQuote) error {
+	in, inDecimals, err := tokenDecimals(client, q.TokenIn)
+	if err != nil {
+		return err
+	}
+	out, outDecimals, err := tokenDecimals(client, q.TokenOut)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("swap", formatUnits(q.AmountIn, inDecimals, display.Precision), in, "for", out, "on router", displayAddress(q.Router))
+	fmt.Println("  quoted:", formatUnits(q.Quoted, outDecimals, display.Precision), out)
+	fmt.Printf("  minimum out: %s %s (slippage %d.%02d%%)\n", formatUnits(q.MinOut, outDecimals, display.Precision), out, q.Slippage/100, q.Slippage%100)
+	fmt.Println("  deadline:", q.Deadline.UTC().Format(time.RFC3339), "the swap reverts if executed later")
+	if q.Slippage > HIGH_SLIPPAGE_BPS {
+		logger.Warn("the slippage is high, the swap may execute far below the quote", "bps", q.Slippage)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestQuoteSwapMinOut(t *testing.T) {
+	router := common.HexToAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D")
+	in := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	out := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+	client := newTestRPC(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_call": func(params []json.RawMessage) (interface{}, error) {
+			args, err := methodArguments("(uint256[])")
+			if err != nil {
+				return nil, err
+			}
+			result, err := args.Pack([]*big.Int{big.NewInt(1000), big.NewInt(2000000)})
+			if err != nil {
+				return nil, err
+			}
+			return hexutil.Encode(result), nil
+		},
+	})
+
+	tests := []struct {
+		slippage uint64
+		minOut   string
+		err      bool
+	}{
+		{0, "2000000", false},
+		{50, "1990000", false},
+		{300, "1940000", false},
+		{MAX_SLIPPAGE_BPS + 1, "", true},
+	}
+	for _, tt := range tests {
+		q, err := quoteSwap(client, router, in, out, big.NewInt(1000), tt.slippage)
+		if tt.err {
+			if err == nil {
+				t.Errorf("quoteSwap(%d bps) = %s, want an error", tt.slippage, q.MinOut)
+			}
+			continue
+		}
+		if err != nil || q.MinOut.String() != tt.minOut || q.Quoted.String() != "2000000" {
+			t.Errorf("quoteSwap(%d bps) = %v, %v, want min out %s", tt.slippage, q, err, tt.minOut)
+		}
+	}
+
+	if _, err := quoteSwap(client, router, in, in, big.NewInt(1000), 50); err == nil {
+		t.Errorf("quoteSwap(same token) = nil error, want an error")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// skipChecksum is set by the global -no-checksum flag, for addresses copied
+// from tools that mangle their case
+var skipChecksum bool
+
+// checkAddress validates a supplied address: 0x followed by 40 hex digits and,
+// when in mixed case, a valid EIP-55 checksum; all lower or upper case
+// addresses carry no checksum and are accepted
+func checkAddress(s string) error {
+	if !strings.HasPrefix(s, "0x") || !common.IsHexAddress(s) {
+		return errors.New("not a 0x prefixed 20 byte hex address")
+	}
+	digits := s[2:]
+	if skipChecksum || digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+		return nil
+	}
+	if checksummed := common.HexToAddress(s).Hex(); checksummed != s {
+		return fmt.Errorf("fails the EIP-55 checksum (expected %s), check where it came from or pass -no-checksum", checksummed)
+	}
+	return nil
+}
+
+// parseAddress is the single entry point turning supplied addresses into
+// common.Address, which silently accepts malformed strings
+func parseAddress(s string) (common.Address, error) {
+	if err := checkAddress(s); err != nil {
+		return common.Address{}, err
+	}
+	return common.HexToAddress(s), nil
+}
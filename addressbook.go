@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// addressEntry is a labelled address of the address book, addressbook.json in
+// the config directory
+type addressEntry struct {
+	Address string `json:"address"`
+	Label   string `json:"label"`
+}
+
+var addressBook map[common.Address]string
+
+func loadAddressBook() ([]addressEntry, error) {
+	content, err := ioutil.ReadFile(configPath("addressbook.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []addressEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("invalid address book: %w", err)
+	}
+	for _, e := range entries {
+		if err := checkAddress(e.Address); err != nil {
+			return nil, fmt.Errorf("invalid address book: invalid address %q of %s: %w", e.Address, e.Label, err)
+		}
+	}
+	return entries, nil
+}
+
+func saveAddressBook(entries []addressEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return strings.ToLower(entries[i].Label) < strings.ToLower(entries[j].Label) })
+	encoded, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := configPath("addressbook.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0o644)
+}
+
+// setAddressBook loads the labels shown in previews
+func setAddressBook() error {
+	entries, err := loadAddressBook()
+	if err != nil {
+		return err
+	}
+	addressBook = map[common.Address]string{}
+	for _, e := range entries {
+		addressBook[common.HexToAddress(e.Address)] = e.Label
+	}
+	return nil
+}
+
+// addAddress labels an address, relabelling it if already in the book; a label
+// names a single address so they can't be confused
+func addAddress(entries []addressEntry, addr common.Address, label string) ([]addressEntry, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return nil, errors.New("a -label is required")
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Label, label) && common.HexToAddress(e.Address) != addr {
+			return nil, fmt.Errorf("%s already labels %s", e.Label, e.Address)
+		}
+	}
+
+	for i, e := range entries {
+		if common.HexToAddress(e.Address) == addr {
+			entries[i].Label = label
+			return entries, nil
+		}
+	}
+	return append(entries, addressEntry{Address: addr.Hex(), Label: label}), nil
+}
+
+func removeAddress(entries []addressEntry, addr common.Address) ([]addressEntry, error) {
+	for i, e := range entries {
+		if common.HexToAddress(e.Address) == addr {
+			return append(entries[:i], entries[i+1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in the address book", addr.Hex())
+}
+
+// displayAddress shows the label of a known address with an abbreviation of
+// the address, or the full address if it isn't in the book
+func displayAddress(addr common.Address) string {
+	label, ok := addressBook[addr]
+	if !ok {
+		return addr.Hex()
+	}
+	hex := addr.Hex()
+	return fmt.Sprintf("%s (%s…%s)", label, hex[:6], hex[len(hex)-4:])
+}
+
+// checkAddressBook warns about counterparties of the calls that aren't in the
+// address book, other than the safe itself and the canonical safe contracts
+func checkAddressBook(allowUnknown bool, safe, to common.Address, value *big.Int, data []byte, operation uint8) error {
+	if allowUnknown {
+		return nil
+	}
+	calls, err := flattenTx(to, value, data, operation)
+	if err != nil {
+		return err
+	}
+
+	seen := map[common.Address]bool{safe: true}
+	for _, call := range calls {
+		for _, party := range counterparties(call) {
+			if seen[party] || isCanonicalContract(party) {
+				continue
+			}
+			seen[party] = true
+			if _, ok := addressBook[party]; !ok {
+				fmt.Println("WARNING:", party.Hex(), "IS NOT IN THE ADDRESS BOOK, verify it out of band and add it with address add, or pass -allow-unknown")
+			}
+		}
+	}
+	return nil
+}
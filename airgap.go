@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// an airgap payload too large for one QR code is split into frames of
+// "GTX:<index>/<count>:<base64 chunk>", shown one after the other and
+// scanned in any order
+const (
+	AIRGAP_FRAME_PREFIX = "GTX:"
+	// base64 characters of a frame, small enough for a terminal QR code
+	AIRGAP_FRAME_SIZE = 200
+	AIRGAP_VERSION    = 1
+)
+
+// airgapBundle is the unsigned transaction taken to the air-gapped machine;
+// the service decoding and the confirmations are left out, the preview is
+// decoded offline from the transaction fields and the safe version the hash
+// depends on is recorded with them
+type airgapBundle struct {
+	Version int                 `json:"version"`
+	ChainID int                 `json:"chainId"`
+	Tx      *multisigTxResponse `json:"tx"`
+}
+
+func newAirgapBundle(tx *multisigTxResponse, chainID int64, version string) *airgapBundle {
+	stripped := *tx
+	stripped.DataDecoded = nil
+	stripped.Confirmations = nil
+	stripped.SafeVersion = version
+	return &airgapBundle{Version: AIRGAP_VERSION, ChainID: int(chainID), Tx: &stripped}
+}
+
+// check verifies the bundle is for this chain and its fields hash to its
+// safeTxHash; the air-gapped machine knows no chain, its signer confirms the
+// one of the bundle with checkChain
+func (b *airgapBundle) check() (common.Hash, error) {
+	if b.Version != AIRGAP_VERSION {
+		return common.Hash{}, fmt.Errorf("unsupported airgap bundle version %d", b.Version)
+	}
+	if b.ChainID == 0 {
+		return common.Hash{}, errors.New("airgap bundle records no chain")
+	}
+	if serviceChainID != 0 && int64(b.ChainID) != serviceChainID {
+		return common.Hash{}, fmt.Errorf("airgap bundle is for chain %d, not %d", b.ChainID, serviceChainID)
+	}
+	if b.Tx == nil {
+		return common.Hash{}, errors.New("airgap bundle holds no transaction")
+	}
+	if b.Tx.SafeVersion == "" {
+		return common.Hash{}, errors.New("airgap bundle records no safe version, export it again")
+	}
+	hash, err := b.Tx.hash(int64(b.ChainID), b.Tx.SafeVersion)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if common.HexToHash(b.Tx.SafeTxHash) != hash {
+		return common.Hash{}, fmt.Errorf("airgap bundle declares hash %s but its fields hash to %s", b.Tx.SafeTxHash, hash.Hex())
+	}
+	return hash, nil
+}
+
+// checkChain refuses a bundle for another chain than the one the signer
+// confirmed, the same safe address may exist on several chains and a
+// signature for one of them is no signature for the others
+func (b *airgapBundle) checkChain(chainID int64) error {
+	if chainID == 0 {
+		return fmt.Errorf("confirm the chain of the transaction with -chain-id, the bundle is for %s (chainId %d)", networkName(int64(b.ChainID)), b.ChainID)
+	}
+	if int64(b.ChainID) != chainID {
+		return fmt.Errorf("airgap bundle is for %s (chainId %d), not chainId %d", networkName(int64(b.ChainID)), b.ChainID, chainID)
+	}
+	return nil
+}
+
+// airgapFrames splits payload into QR frames
+func airgapFrames(payload []byte) []string {
+	encoded := base64.StdEncoding.EncodeToString(payload)
+	count := (len(encoded) + AIRGAP_FRAME_SIZE - 1) / AIRGAP_FRAME_SIZE
+	frames := make([]string, count)
+	for i := range frames {
+		end := (i + 1) * AIRGAP_FRAME_SIZE
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		frames[i] = fmt.Sprintf("%s%d/%d:%s", AIRGAP_FRAME_PREFIX, i+1, count, encoded[i*AIRGAP_FRAME_SIZE:end])
+	}
+	return frames
+}
+
+// frameAssembler collects scanned frames until every one of the payload is in,
+// repeated frames are ignored as an animated code is scanned several times over
+type frameAssembler struct {
+	chunks []string
+	seen   int
+}
+
+func (a *frameAssembler) add(frame string) error {
+	header := strings.SplitN(strings.TrimPrefix(frame, AIRGAP_FRAME_PREFIX), ":", 2)
+	position := strings.SplitN(header[0], "/", 2)
+	if !strings.HasPrefix(frame, AIRGAP_FRAME_PREFIX) || len(header) != 2 || len(position) != 2 {
+		return fmt.Errorf("invalid frame %q", frame)
+	}
+	index, err := strconv.Atoi(position[0])
+	if err != nil {
+		return fmt.Errorf("invalid frame %q", frame)
+	}
+	count, err := strconv.Atoi(position[1])
+	if err != nil || count < 1 || index < 1 || index > count {
+		return fmt.Errorf("invalid frame %q", frame)
+	}
+
+	if a.chunks == nil {
+		a.chunks = make([]string, count)
+	}
+	if count != len(a.chunks) {
+		return fmt.Errorf("frame %d/%d is not part of the %d frames scanned so far", index, count, len(a.chunks))
+	}
+	if a.chunks[index-1] == "" {
+		a.chunks[index-1] = header[1]
+		a.seen++
+	}
+	return nil
+}
+
+func (a *frameAssembler) complete() bool {
+	return a.chunks != nil && a.seen == len(a.chunks)
+}
+
+func (a *frameAssembler) payload() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(a.chunks, ""))
+}
+
+// readAirgapPayload reads a payload as plain json or as scanned frames, one
+// per line, stopping as soon as every frame is in so in can be read on
+func readAirgapPayload(in *bufio.Reader) ([]byte, error) {
+	var plain strings.Builder
+	assembler := &frameAssembler{}
+	for {
+		line, err := in.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case plain.Len() > 0 || strings.HasPrefix(trimmed, "{"):
+			plain.WriteString(line)
+		case strings.HasPrefix(trimmed, AIRGAP_FRAME_PREFIX):
+			if err := assembler.add(trimmed); err != nil {
+				return nil, err
+			}
+			if assembler.complete() {
+				return assembler.payload()
+			}
+		case trimmed != "":
+			return nil, fmt.Errorf("expected json or %s frames, got %q", AIRGAP_FRAME_PREFIX, trimmed)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if plain.Len() > 0 {
+		return []byte(plain.String()), nil
+	}
+	if assembler.chunks != nil {
+		return nil, fmt.Errorf("only %d of %d frames were scanned", assembler.seen, len(assembler.chunks))
+	}
+	return nil, errors.New("no airgap payload in the input")
+}
+
+// openAirgapInput reads path, or stdin for "-" where a QR scanner types its
+// frames
+func openAirgapInput(path string) (*bufio.Reader, func(), error) {
+	if path == "-" {
+		fmt.Fprintln(os.Stderr, "scan the frames, a bundle file is read with -in <FILE>")
+		return bufio.NewReader(os.Stdin), func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bufio.NewReader(f), func() { f.Close() }, nil
+}
+
+// showFrames displays the payload as QR codes in the terminal, a single code
+// when it fits one frame and otherwise every frame in turn until interrupted
+func showFrames(payload []byte, interval time.Duration) error {
+	frames := airgapFrames(payload)
+	codes := make([]string, len(frames))
+	for i, frame := range frames {
+		qr, err := encodeQR(frame)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", i+1, err)
+		}
+		codes[i] = qr.terminal()
+	}
+
+	if len(codes) == 1 {
+		fmt.Print(codes[0])
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "showing %d frames, interrupt once every one was scanned\n", len(codes))
+	for i := 0; ; i = (i + 1) % len(codes) {
+		// clear the screen so every frame is drawn at the same place
+		fmt.Print("\x1b[H\x1b[2J", codes[i])
+		fmt.Printf("frame %d/%d\n", i+1, len(codes))
+		if err := sleep(interval); err != nil {
+			return nil
+		}
+	}
+}
+
+// printAirgapPreview shows what the air-gapped machine is asked to sign, and
+// the chain and safe version its hash is for
+func printAirgapPreview(tx *multisigTxResponse, chainID int64) {
+	fmt.Printf("chain: %s (chainId %d)\n", networkName(chainID), chainID)
+	fmt.Println("safe:", displayAddress(common.HexToAddress(tx.Safe)))
+	fmt.Println("safe version:", tx.SafeVersion)
+	fmt.Println("nonce:", tx.Nonce)
+	fmt.Println("safeTxHash:", tx.SafeTxHash)
+	if origin := describeOrigin(tx.Origin); origin != "" {
+		fmt.Println("origin:", origin)
+	}
+	for _, intent := range newWatchEvent(EVENT_PROPOSED, tx).Intent {
+		fmt.Println("  -", intent)
+	}
+	if refund := txRefund(nil, tx); refund != "" {
+		fmt.Println("refund:", refund)
+	}
+}
+
+// checkDetachedSignature checks a signature brought back from the air-gapped
+// machine is over hash and, for owner keys, made by its owner
+func checkDetachedSignature(sig *detachedSignature, hash common.Hash) error {
+	if common.HexToHash(sig.SafeTxHash) != hash {
+		return fmt.Errorf("signature is over %s, not %s", sig.SafeTxHash, hash.Hex())
+	}
+	signature, err := hexutil.Decode(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if len(signature) < 65 {
+		return fmt.Errorf("invalid signature length %d", len(signature))
+	}
+	typ, err := signatureType(signature[64])
+	if err != nil {
+		return err
+	}
+	if typ != SIG_ECDSA && typ != SIG_ETH_SIGN {
+		// contract signatures are checked by the service against the owner
+		return nil
+	}
+	signer, err := recoverSigner(hash, signature)
+	if err != nil {
+		return err
+	}
+	if signer != common.HexToAddress(sig.Owner) {
+		return fmt.Errorf("signature is made by %s, not the owner %s", signer.Hex(), sig.Owner)
+	}
+	return nil
+}
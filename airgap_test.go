@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAirgapFrames(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"safeTxHash":"0x00"}`), 40)
+	frames := airgapFrames(payload)
+	if len(frames) < 2 {
+		t.Fatalf("airgapFrames(%d bytes) = %d frames, want several", len(payload), len(frames))
+	}
+
+	// scanned out of order and repeated, as from an animated code
+	scanned := append([]string{frames[len(frames)-1]}, frames...)
+	got, err := readAirgapPayload(bufio.NewReader(strings.NewReader(strings.Join(scanned, "\n") + "\nleft for the prompt\n")))
+	if err != nil {
+		t.Fatalf("readAirgapPayload() error = %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("readAirgapPayload() = %q, want %q", got, payload)
+	}
+
+	_, err = readAirgapPayload(bufio.NewReader(strings.NewReader(strings.Join(frames[1:], "\n"))))
+	if err == nil || !strings.Contains(err.Error(), "frames were scanned") {
+		t.Errorf("readAirgapPayload(missing frame) error = %v, want missing frames", err)
+	}
+
+	plain := "{\n  \"owner\": \"0x01\"\n}\n"
+	got, err = readAirgapPayload(bufio.NewReader(strings.NewReader(plain)))
+	if err != nil || string(got) != plain {
+		t.Errorf("readAirgapPayload(json) = %q, %v, want %q", got, err, plain)
+	}
+}
+
+func TestFrameAssembler(t *testing.T) {
+	tests := []struct {
+		frames []string
+		err    string
+	}{
+		{[]string{"GTX:1/2:YQ==", "GTX:2/3:YQ=="}, "not part of the 2 frames"},
+		{[]string{"GTX:3/2:YQ=="}, "invalid frame"},
+		{[]string{"GTX:1:YQ=="}, "invalid frame"},
+		{[]string{"XYZ:1/1:YQ=="}, "invalid frame"},
+	}
+	for _, tt := range tests {
+		a := &frameAssembler{}
+		var err error
+		for _, frame := range tt.frames {
+			if err = a.add(frame); err != nil {
+				break
+			}
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("add(%v) error = %v, want %q", tt.frames, err, tt.err)
+		}
+	}
+}
+
+func TestAirgapBundleChain(t *testing.T) {
+	defer func(previous int64) { serviceChainID = previous }(serviceChainID)
+	tx := &multisigTxResponse{Safe: testSafe, To: testRecipient, Value: "1", GasPrice: "0", GasToken: ZERO_ADDR, RefundReceiver: ZERO_ADDR}
+	hash, err := tx.hash(100, "1.3.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SafeTxHash = hash.Hex()
+	bundle := newAirgapBundle(tx, 100, "1.3.0")
+
+	// the air-gapped machine knows no chain, the signer has to name it
+	serviceChainID = 0
+	if _, err := bundle.check(); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	tests := []struct {
+		chainID int64
+		err     string
+	}{
+		{0, "confirm the chain"},
+		{1, "not chainId 1"},
+		{100, ""},
+	}
+	for _, tt := range tests {
+		err := bundle.checkChain(tt.chainID)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("checkChain(%d) = %v, want %q", tt.chainID, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// allowances are capped at uint96 by the module
+var maxAllowance = new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 96), common.Big1)
+
+// tokenAllowance is a spending limit of a delegate of the allowance module,
+// times are in minutes since the epoch
+type tokenAllowance struct {
+	Token        common.Address
+	Amount       *big.Int
+	Spent        *big.Int
+	ResetTimeMin uint64
+	LastResetMin uint64
+	Nonce        uint64
+}
+
+// remaining is what the delegate can still transfer, a periodic allowance
+// whose period has elapsed is reset by the next transfer
+func (a *tokenAllowance) remaining(now time.Time) *big.Int {
+	spent := a.Spent
+	if a.ResetTimeMin > 0 && uint64(now.Unix()/60) >= a.LastResetMin+a.ResetTimeMin {
+		spent = new(big.Int)
+	}
+	if spent.Cmp(a.Amount) >= 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Sub(a.Amount, spent)
+}
+
+func (a *tokenAllowance) String() string {
+	s := fmt.Sprintf("%s: %s of %s spent, %s left", tokenName(a.Token), allowanceAmount(a.Token, a.Spent),
+		allowanceAmount(a.Token, a.Amount), allowanceAmount(a.Token, a.remaining(time.Now())))
+	if a.ResetTimeMin > 0 {
+		next := time.Unix(int64(a.LastResetMin+a.ResetTimeMin)*60, 0)
+		s += fmt.Sprintf(", resets every %s, next at %s", time.Duration(a.ResetTimeMin)*time.Minute, formatTime(next))
+	}
+	return s
+}
+
+func allowanceAmount(token common.Address, amount *big.Int) string {
+	if token == (common.Address{}) {
+		return formatWei(amount)
+	}
+	return formatTokenAmount(token, amount)
+}
+
+func tokenName(token common.Address) string {
+	if token == (common.Address{}) {
+		return "native"
+	}
+	return displayAddress(token)
+}
+
+// callView calls a view method and decodes its outputs, a tuple signature
+func callView(client EthClient, to common.Address, signature, outputs string, values ...interface{}) ([]interface{}, error) {
+	call, err := encodeCall(signature, values...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := callContract(client, to, call)
+	if err != nil {
+		return nil, err
+	}
+	args, err := methodArguments(outputs)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := args.UnpackValues(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s response from %s: %w", signature, to.Hex(), err)
+	}
+	return decoded, nil
+}
+
+func readAllowance(client EthClient, module, safe, delegate, token common.Address) (*tokenAllowance, error) {
+	values, err := callView(client, module, "getTokenAllowance(address,address,address)", "(uint256[5])", safe, delegate, token)
+	if err != nil {
+		return nil, err
+	}
+	fields := values[0].([5]*big.Int)
+	return &tokenAllowance{
+		Token:        token,
+		Amount:       fields[0],
+		Spent:        fields[1],
+		ResetTimeMin: fields[2].Uint64(),
+		LastResetMin: fields[3].Uint64(),
+		Nonce:        fields[4].Uint64(),
+	}, nil
+}
+
+// readDelegates walks the delegates of the safe page by page
+func readDelegates(client EthClient, module, safe common.Address) ([]common.Address, error) {
+	var delegates []common.Address
+	start := new(big.Int)
+	for {
+		values, err := callView(client, module, "getDelegates(address,uint48,uint8)", "(address[],uint48)", safe, start, uint8(50))
+		if err != nil {
+			return nil, err
+		}
+		delegates = append(delegates, values[0].([]common.Address)...)
+		if start = values[1].(*big.Int); start.Sign() == 0 {
+			return delegates, nil
+		}
+	}
+}
+
+func readDelegateTokens(client EthClient, module, safe, delegate common.Address) ([]common.Address, error) {
+	values, err := callView(client, module, "getTokens(address,address)", "(address[])", safe, delegate)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].([]common.Address), nil
+}
+
+func isModuleEnabled(client EthClient, safe, module common.Address) (bool, error) {
+	values, err := callView(client, safe, "isModuleEnabled(address)", "(bool)", module)
+	if err != nil {
+		return false, err
+	}
+	return values[0].(bool), nil
+}
+
+// buildSetAllowance returns the calls giving delegate an allowance of amount
+// token, enabling the module and adding the delegate first as needed; a
+// resetMinutes period refills the allowance from resetBaseMin on
+func buildSetAllowance(client EthClient, module, safe, delegate, token common.Address, amount *big.Int, resetMinutes, resetBaseMin uint64) ([]multiSendTx, error) {
+	if amount.Sign() < 0 || amount.Cmp(maxAllowance) > 0 {
+		return nil, fmt.Errorf("allowance %s out of range for uint96", amount)
+	}
+	if resetMinutes > 1<<16-1 {
+		return nil, fmt.Errorf("reset period of %d minutes is above the module's maximum of %d", resetMinutes, 1<<16-1)
+	}
+
+	var txs []multiSendTx
+	enabled, err := isModuleEnabled(client, safe, module)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		fmt.Println("enabling the allowance module", module.Hex(), "- it can move funds within the allowances set")
+		data, err := encodeCall("enableModule(address)", module)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, multiSendTx{To: safe, Value: new(big.Int), Data: data})
+	}
+
+	// adding a delegate twice is a no-op of the module
+	addDelegate, err := encodeCall("addDelegate(address)", delegate)
+	if err != nil {
+		return nil, err
+	}
+	setAllowance, err := encodeCall("setAllowance(address,address,uint96,uint16,uint32)", delegate, token, amount, uint16(resetMinutes), uint32(resetBaseMin))
+	if err != nil {
+		return nil, err
+	}
+	return append(txs,
+		multiSendTx{To: module, Value: new(big.Int), Data: addDelegate},
+		multiSendTx{To: module, Value: new(big.Int), Data: setAllowance},
+	), nil
+}
+
+// allowanceTransfer transfers amount token of the safe to recipient within the
+// allowance of the delegate key, which signs and pays for the transaction; no
+// owner confirmations are involved
+func allowanceTransfer(rpc string, key *ecdsa.PrivateKey, module, safe, token, to common.Address, amount *big.Int, fees *feeOptions) error {
+	if amount.Sign() <= 0 || amount.Cmp(maxAllowance) > 0 {
+		return fmt.Errorf("amount %s out of range for uint96", amount)
+	}
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	delegate := crypto.PubkeyToAddress(key.PublicKey)
+	allowance, err := readAllowance(client, module, safe, delegate, token)
+	if err != nil {
+		return err
+	}
+	if allowance.Nonce == 0 {
+		return fmt.Errorf("%s has no %s allowance on %s", delegate.Hex(), tokenName(token), safe.Hex())
+	}
+	if left := allowance.remaining(time.Now()); left.Cmp(amount) < 0 {
+		return fmt.Errorf("amount %s exceeds the allowance left of %s", allowanceAmount(token, amount), allowanceAmount(token, left))
+	}
+	fmt.Println("allowance:", allowance)
+
+	// no refund payment, the delegate pays the gas itself
+	zero := common.Address{}
+	values, err := callView(client, module, "generateTransferHash(address,address,address,uint96,address,uint96,uint16)", "(bytes32)",
+		safe, token, to, amount, zero, new(big.Int), uint16(allowance.Nonce))
+	if err != nil {
+		return err
+	}
+	hash := common.Hash(values[0].([32]byte))
+	signature, err := signSafeTxHash(hash, key)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeCall("executeAllowanceTransfer(address,address,address,uint96,address,uint96,address,bytes)",
+		safe, token, to, amount, zero, new(big.Int), delegate, signature)
+	if err != nil {
+		return err
+	}
+	suggested, err := suggestFees(rpc, fees)
+	if err != nil {
+		return err
+	}
+	if _, err := sendEthTransaction(client, key, module, common.Big0, data, suggested); err != nil {
+		return explainRevert(err, nil)
+	}
+
+	fmt.Println("transferred", allowanceAmount(token, amount), "to", displayAddress(to))
+	return nil
+}
+
+// showAllowances prints the allowances of the delegates of the safe, or of a
+// single delegate
+func showAllowances(rpc string, module, safe common.Address, delegate *common.Address) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	enabled, err := isModuleEnabled(client, safe, module)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return fmt.Errorf("the allowance module %s is not enabled on %s", module.Hex(), safe.Hex())
+	}
+
+	var delegates []common.Address
+	if delegate != nil {
+		delegates = []common.Address{*delegate}
+	} else if delegates, err = readDelegates(client, module, safe); err != nil {
+		return err
+	}
+	if len(delegates) == 0 {
+		return errors.New("no delegates have allowances")
+	}
+
+	for _, d := range delegates {
+		fmt.Println("delegate", displayAddress(d))
+		tokens, err := readDelegateTokens(client, module, safe, d)
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			allowance, err := readAllowance(client, module, safe, d, token)
+			if err != nil {
+				return err
+			}
+			fmt.Println(" ", allowance)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+func formatAllowance(token common.Address, allowance *big.Int) string {
+	if allowance.Cmp(math.MaxBig256) == 0 {
+		return "unlimited"
+	}
+	return formatTokenAmount(token, allowance)
+}
+
+// buildApprove shows the current allowance of spender over the safe's tokens
+// and returns the approve call setting it to amount
+func buildApprove(rpc string, safe, token, spender common.Address, amount *big.Int) ([]byte, error) {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	current, err := callUint(client, token, "allowance(address,address)", safe, spender)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("allowance of %s on %s: %s -> %s\n", spender.Hex(), token.Hex(), formatAllowance(token, current), formatAllowance(token, amount))
+
+	if current.Cmp(amount) == 0 {
+		return nil, errors.New("the allowance is already set to this amount")
+	}
+	// tokens like USDT refuse to change a non zero allowance to another non zero value
+	if current.Sign() > 0 && amount.Sign() > 0 {
+		fmt.Println("note: some tokens require revoking a non zero allowance before setting a new one")
+	}
+
+	return encodeCall("approve(address,uint256)", spender, amount)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// enclave attestation documents, obtained from the platform by a command as
+// the tool can't talk to the attestation devices itself
+const (
+	ATTESTATION_NITRO = "nitro" // AWS Nitro Enclaves COSE_Sign1 document, e.g. from /dev/nsm
+	ATTESTATION_SEV   = "sev"   // AMD SEV-SNP attestation report, e.g. from /dev/sev-guest
+)
+
+// attester runs the attestation command with the user data to embed in
+// $ATTESTATION_USER_DATA (hex) and reads the document from its stdout, raw
+// or base64
+type attester struct {
+	kind    string
+	command string
+}
+
+func newAttester(kind, command string) (*attester, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case ATTESTATION_NITRO, ATTESTATION_SEV:
+	default:
+		return nil, fmt.Errorf("unknown attestation %q, expected %s or %s", kind, ATTESTATION_NITRO, ATTESTATION_SEV)
+	}
+	if command == "" {
+		return nil, fmt.Errorf("a %s attestation needs the -attestation-cmd printing the document", kind)
+	}
+	return &attester{kind: kind, command: command}, nil
+}
+
+// attestation binds a document of the signing environment to one signature:
+// its user data is keccak256(signer ‖ safeTxHash)
+type attestation struct {
+	Kind       string `json:"kind"`
+	Signer     string `json:"signer"`
+	SafeTxHash string `json:"safeTxHash"`
+	UserData   string `json:"userData"`
+	Document   string `json:"document"`
+	Hash       string `json:"hash"`
+}
+
+func attestationUserData(signer common.Address, safeTxHash common.Hash) []byte {
+	return crypto.Keccak256(signer.Bytes(), safeTxHash.Bytes())
+}
+
+func (a *attester) attest(signer common.Address, safeTxHash common.Hash) (*attestation, error) {
+	userData := attestationUserData(signer, safeTxHash)
+
+	cmd := exec.CommandContext(opCtx, "sh", "-c", a.command)
+	cmd.Env = append(os.Environ(), "ATTESTATION_USER_DATA="+hexutil.Encode(userData)[2:], "ATTESTATION_KIND="+a.kind)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("attestation command failed: %w", err)
+	}
+
+	document := output
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(output))); err == nil {
+		document = decoded
+	}
+	if len(document) == 0 {
+		return nil, fmt.Errorf("attestation command printed no document")
+	}
+
+	return &attestation{
+		Kind:       a.kind,
+		Signer:     signer.Hex(),
+		SafeTxHash: safeTxHash.Hex(),
+		UserData:   hexutil.Encode(userData),
+		Document:   base64.StdEncoding.EncodeToString(document),
+		Hash:       crypto.Keccak256Hash(document).Hex(),
+	}, nil
+}
+
+// writeAttestation stores the document for publishing next to the proposal
+func writeAttestation(dir string, att *attestation) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	encoded, err := json.MarshalIndent(att, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, att.SafeTxHash+".attestation.json")
+	return path, ioutil.WriteFile(path, encoded, 0o644)
+}
+
+// appendAuditLog appends entry as a json line
+func appendAuditLog(path string, entry interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	log, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	encoded, err := json.Marshal(struct {
+		Time  string      `json:"time"`
+		Entry interface{} `json:"entry"`
+	}{formatTime(time.Now()), entry})
+	if err != nil {
+		return err
+	}
+	if _, err := log.Write(append(encoded, '\n')); err != nil {
+		return err
+	}
+	return log.Sync()
+}
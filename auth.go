@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// endpointAuth adds headers to the requests to every url under URL, ${NAME}
+// in a header value is read from the environment so keys stay out of the
+// config file
+type endpointAuth struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// the headers of each configured endpoint, resolved by setServiceAuth
+var endpointAuths []endpointAuth
+
+// setServiceAuth loads auth.json from the config directory; without an entry
+// for the transaction service, $GNOSIS_TX_API_KEY is sent to it as a bearer
+// token
+func setServiceAuth() error {
+	path := configPath("auth.json")
+	var config []endpointAuth
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(content, &config); err != nil {
+			return fmt.Errorf("invalid auth config %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	endpointAuths = nil
+	service := false
+	for _, auth := range config {
+		if !strings.HasPrefix(auth.URL, "https://") && !strings.HasPrefix(auth.URL, "http://") {
+			return fmt.Errorf("invalid auth config %s: invalid url %q", path, auth.URL)
+		}
+		resolved := endpointAuth{URL: strings.TrimSuffix(auth.URL, "/"), Headers: map[string]string{}}
+		for name, value := range auth.Headers {
+			var missing []string
+			value = os.Expand(value, func(env string) string {
+				v, ok := os.LookupEnv(env)
+				if !ok {
+					missing = append(missing, env)
+				}
+				return v
+			})
+			if len(missing) > 0 {
+				return fmt.Errorf("auth config %s: header %s of %s needs $%s", path, name, auth.URL, strings.Join(missing, ", $"))
+			}
+			resolved.Headers[http.CanonicalHeaderKey(name)] = value
+			secretHeaders[http.CanonicalHeaderKey(name)] = true
+		}
+		endpointAuths = append(endpointAuths, resolved)
+		service = service || underEndpoint(serviceURL, resolved.URL)
+	}
+
+	if key := os.Getenv("GNOSIS_TX_API_KEY"); key != "" && !service {
+		endpointAuths = append(endpointAuths, endpointAuth{URL: serviceURL, Headers: map[string]string{"Authorization": "Bearer " + key}})
+	}
+	return nil
+}
+
+// underEndpoint reports whether url is endpoint or a path below it, so a
+// prefix never matches another host such as endpoint.attacker.com
+func underEndpoint(url, endpoint string) bool {
+	if !strings.HasPrefix(url, endpoint) {
+		return false
+	}
+	rest := url[len(endpoint):]
+	return rest == "" || rest[0] == '/' || rest[0] == '?'
+}
+
+// authHeaders returns the headers of the most specific endpoint of url
+func authHeaders(url string) map[string]string {
+	var match *endpointAuth
+	for i := range endpointAuths {
+		auth := &endpointAuths[i]
+		if underEndpoint(url, auth.URL) && (match == nil || len(auth.URL) > len(match.URL)) {
+			match = auth
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	return match.Headers
+}
+
+// authHint explains the authentication and rate limit responses of the
+// transaction service and other endpoints
+func authHint(err error) *remediationError {
+	var service *serviceError
+	if !errors.As(err, &service) {
+		return nil
+	}
+	switch service.Code {
+	case http.StatusUnauthorized:
+		return &remediationError{Code: "DRF_AUTH", Hint: "the endpoint requires an API key, set $GNOSIS_TX_API_KEY or add its headers to " + configPath("auth.json"), Err: err}
+	case http.StatusForbidden:
+		return &remediationError{Code: "DRF_FORBIDDEN", Hint: "the API key was refused or lacks access to this endpoint or chain, check the key configured for it", Err: err}
+	case http.StatusTooManyRequests:
+		return &remediationError{Code: "DRF_RATE_LIMIT", Hint: "the endpoint rate limits this address, retry later or use an API key for a higher limit", Err: err}
+	}
+	return nil
+}
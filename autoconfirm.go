@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// autoConfirmer confirms the pending transactions of its safes that satisfy
+// the policy with an owner key, and alerts about every other one
+type autoConfirmer struct {
+	policy     *policy
+	signer     signer
+	notifier   *watchNotifier
+	rpc        string
+	quorumRPCs string
+	// attests each confirmation, if set
+	attester *attester
+	auditLog string
+	// safeTxHashes already confirmed or refused, each is alerted about once
+	evaluated map[string]bool
+}
+
+// review returns why the transaction may not be confirmed automatically
+func (a *autoConfirmer) review(tx *multisigTxResponse) error {
+	// the hash, recipient acknowledgment, quorum and pre-sign hook checks of a manual confirmation
+	if _, _, _, err := prepareConfirmation(tx.SafeTxHash, a.signer.Address(), a.rpc, a.quorumRPCs, "", nil); err != nil {
+		return err
+	}
+	if tx.GasPrice != "0" || common.HexToAddress(tx.RefundReceiver) != (common.Address{}) {
+		return errors.New("the transaction pays a gas refund")
+	}
+
+	if violations := a.policy.originViolations(tx.Origin); len(violations) > 0 {
+		return errors.New("policy violation: " + strings.Join(violations, "; "))
+	}
+	if err := checkTxPolicy(a.policy, tx); err != nil {
+		return errors.New(strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+	return nil
+}
+
+func (a *autoConfirmer) confirm(tx *multisigTxResponse) (*attestation, error) {
+	var att *attestation
+	if a.attester != nil {
+		var err error
+		if att, err = a.attester.attest(a.signer.Address(), common.HexToHash(tx.SafeTxHash)); err != nil {
+			return nil, err
+		}
+	}
+
+	chainID, version, err := txDomain(tx, nil)
+	if err != nil {
+		return nil, err
+	}
+	typedData, err := tx.typedData(chainID, version)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := a.signer.SignTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+	return att, submitConfirmation(tx.SafeTxHash, hexutil.Encode(signature))
+}
+
+func (a *autoConfirmer) poll(safe string) error {
+	info, err := getSafeInfo(safe)
+	if err != nil {
+		return err
+	}
+	pending, err := getPendingTransactions(safe, info.Nonce)
+	if err != nil {
+		return err
+	}
+
+	owner := a.signer.Address()
+	for i := len(pending) - 1; i >= 0; i-- {
+		tx := &pending[i]
+		if a.evaluated[tx.SafeTxHash] {
+			continue
+		}
+		confirmed := false
+		for _, c := range tx.Confirmations {
+			confirmed = confirmed || common.HexToAddress(c.Owner) == owner
+		}
+		if confirmed {
+			a.evaluated[tx.SafeTxHash] = true
+			continue
+		}
+
+		e := newWatchEvent(EVENT_REFUSED, tx)
+		var att *attestation
+		if err := a.review(tx); err != nil {
+			e.Reason = err.Error()
+		} else if att, err = a.confirm(tx); err != nil {
+			// retried on the next poll
+			fmt.Fprintf(os.Stderr, "warning: confirming %s failed: %v\n", tx.SafeTxHash, err)
+			continue
+		} else {
+			e.Type, e.Owner = EVENT_AUTO_CONFIRMED, owner.Hex()
+			e.Confirmations++
+		}
+		a.evaluated[tx.SafeTxHash] = true
+		a.notifier.notify(e)
+
+		entry := struct {
+			*watchEvent
+			Attestation *attestation `json:"attestation,omitempty"`
+		}{e, att}
+		if err := appendAuditLog(a.auditLog, entry); err != nil {
+			return fmt.Errorf("writing the audit log failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// run polls the queues of the safes until the operation deadline or an
+// interrupt
+func (a *autoConfirmer) run(safes []string, interval time.Duration) error {
+	owner := a.signer.Address()
+	for i, safe := range safes {
+		if err := checkAddress(safe); err != nil {
+			return fmt.Errorf("invalid safe address %q: %w", safe, err)
+		}
+		safes[i] = common.HexToAddress(safe).Hex()
+
+		info, err := getSafeInfo(safes[i])
+		if err != nil {
+			return fmt.Errorf("safe %s: %w", safe, err)
+		}
+		isOwner := false
+		for _, o := range info.Owners {
+			isOwner = isOwner || common.HexToAddress(o) == owner
+		}
+		if !isOwner {
+			return fmt.Errorf("%s is not an owner of %s", owner.Hex(), safes[i])
+		}
+		fmt.Printf("auto-confirming for %s as %s\n", safes[i], owner.Hex())
+	}
+
+	for {
+		for _, safe := range safes {
+			if err := a.poll(safe); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: polling %s failed: %v\n", safe, err)
+			}
+		}
+		if err := sleep(interval); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type tokenInfo struct {
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// a nil token address is the native balance
+type tokenBalance struct {
+	TokenAddress   *string    `json:"tokenAddress"`
+	Token          *tokenInfo `json:"token"`
+	Balance        string     `json:"balance"`
+	FiatBalance    string     `json:"fiatBalance,omitempty"`
+	FiatConversion string     `json:"fiatConversion,omitempty"`
+}
+
+type collectible struct {
+	Address     string `json:"address"`
+	TokenName   string `json:"tokenName"`
+	TokenSymbol string `json:"tokenSymbol"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+}
+
+type safeAssets struct {
+	Balances     []tokenBalance `json:"balances"`
+	Collectibles []collectible  `json:"collectibles"`
+}
+
+func getSafeAssets(safe string) (*safeAssets, error) {
+	base := serviceEndpoint("/safes/") + common.HexToAddress(safe).Hex()
+
+	assets := &safeAssets{}
+	if err := getJSON(base+"/balances/usd/", &assets.Balances); err != nil {
+		return nil, err
+	}
+	if err := getJSON(base+"/collectibles/", &assets.Collectibles); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// parseDecimal converts a decimal string such as "12.345" to base units with
+// decimals, dropping further fraction digits
+func parseDecimal(s string, decimals int) (*big.Int, bool) {
+	parts := strings.SplitN(s, ".", 2)
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+	if len(fraction) > decimals {
+		fraction = fraction[:decimals]
+	}
+	return new(big.Int).SetString(parts[0]+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+}
+
+// formatFiat renders an amount of cents, raw mode keeps a plain decimal
+func formatFiat(cents *big.Int) string {
+	if display.Numbers == NUMBERS_RAW {
+		return new(big.Float).Quo(new(big.Float).SetInt(cents), big.NewFloat(100)).Text('f', 2) + " USD"
+	}
+	return formatUnits(cents, 2, 2) + " USD"
+}
+
+func printAssets(assets *safeAssets) {
+	var total *big.Int
+	for _, b := range assets.Balances {
+		amount, ok := new(big.Int).SetString(b.Balance, 10)
+		if !ok {
+			amount = new(big.Int)
+		}
+
+		var name, formatted string
+		if b.TokenAddress == nil || b.Token == nil {
+			name, formatted = "ETH", formatWei(amount)
+		} else {
+			name = fmt.Sprintf("%s (%s)", b.Token.Name, *b.TokenAddress)
+			if display.Numbers == NUMBERS_RAW {
+				formatted = amount.String() + " " + b.Token.Symbol
+			} else {
+				formatted = formatUnits(amount, b.Token.Decimals, display.Precision) + " " + b.Token.Symbol
+			}
+		}
+
+		fiat := ""
+		if cents, ok := parseDecimal(b.FiatBalance, 2); ok && b.FiatBalance != "" {
+			fiat = formatFiat(cents)
+			if total == nil {
+				total = new(big.Int)
+			}
+			total.Add(total, cents)
+		}
+		fmt.Printf("%-60s %28s %20s\n", name, formatted, fiat)
+	}
+	if total != nil {
+		fmt.Printf("%-60s %28s %20s\n", "total", "", formatFiat(total))
+	}
+
+	if len(assets.Collectibles) > 0 {
+		fmt.Println("collectibles:")
+	}
+	for _, c := range assets.Collectibles {
+		fmt.Printf("  %s (%s) #%s %s\n", c.TokenName, c.Address, c.ID, c.Name)
+	}
+}
+
+func printAssetsJSON(assets interface{}) error {
+	encoded, err := json.MarshalIndent(assets, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"gopkg.in/yaml.v2"
+)
+
+// batchCall is one call of a batch file, either a method with arguments or
+// raw data; every field may reference ${VARIABLES}
+type batchCall struct {
+	To     string   `json:"to"`
+	Value  string   `json:"value,omitempty"`
+	Method string   `json:"method,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	// names of the method arguments, only used in Transaction Builder exports
+	Inputs []string `json:"inputs,omitempty"`
+	Data   string   `json:"data,omitempty"`
+	// the call is left out of the batch unless the condition holds
+	If *batchCondition `json:"if,omitempty"`
+}
+
+// batchFile is the json batch format, YAML batch files use the same keys
+type batchFile struct {
+	Description string `json:"description,omitempty"`
+	// the safe the batch was made for, if any
+	Safe  string      `json:"safe,omitempty"`
+	Calls []batchCall `json:"calls"`
+}
+
+// loadBatchFile reads a json or YAML (.yaml, .yml) batch file or a Safe
+// Transaction Builder export
+func loadBatchFile(path string) (*batchFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch *batchFile
+	switch {
+	case strings.HasSuffix(path, ".yaml"), strings.HasSuffix(path, ".yml"):
+		batch = &batchFile{}
+		err = yaml.UnmarshalStrict(content, batch)
+	case isTxBuilderFile(content):
+		batch, err = parseTxBuilderFile(content)
+	default:
+		batch = &batchFile{}
+		err = json.Unmarshal(content, batch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid batch file %s: %w", path, err)
+	}
+	if len(batch.Calls) == 0 {
+		return nil, fmt.Errorf("batch file %s has no calls", path)
+	}
+	return batch, nil
+}
+
+func (c batchCall) build(vars *variables) (multiSendTx, error) {
+	to, err := vars.interpolate(c.To)
+	if err != nil {
+		return multiSendTx{}, err
+	}
+	if err := checkAddress(to); err != nil {
+		return multiSendTx{}, fmt.Errorf("invalid to address %s: %w", quote(c.To, to), err)
+	}
+	tx := multiSendTx{To: common.HexToAddress(to), Value: new(big.Int)}
+
+	if c.Value != "" {
+		value, err := vars.interpolate(c.Value)
+		if err != nil {
+			return multiSendTx{}, err
+		}
+		var ok bool
+		if tx.Value, ok = new(big.Int).SetString(value, 10); !ok || tx.Value.Sign() < 0 {
+			return multiSendTx{}, fmt.Errorf("invalid value %s, expected wei", quote(c.Value, value))
+		}
+	}
+
+	switch {
+	case c.Method != "" && c.Data != "":
+		return multiSendTx{}, errors.New("a call has either a method or data, not both")
+	case c.Method != "":
+		args := make([]string, len(c.Args))
+		for i, arg := range c.Args {
+			if args[i], err = vars.interpolate(arg); err != nil {
+				return multiSendTx{}, err
+			}
+		}
+		if tx.Data, err = encodeCallArgs(c.Method, args); err != nil {
+			for _, arg := range c.Args {
+				if hasSecret(arg) {
+					return multiSendTx{}, fmt.Errorf("invalid arguments for %s, details hidden as they contain secrets", c.Method)
+				}
+			}
+			return multiSendTx{}, err
+		}
+	case c.Data != "":
+		data, err := vars.interpolate(c.Data)
+		if err != nil {
+			return multiSendTx{}, err
+		}
+		if tx.Data, err = hexutil.Decode(data); err != nil {
+			return multiSendTx{}, fmt.Errorf("invalid data %s: %w", quote(c.Data, data), err)
+		}
+	}
+	return tx, nil
+}
+
+// buildCalls resolves the variables and conditions of the batch and returns
+// the calls to make along with their entries in the batch; client is only
+// needed for conditions
+func buildCalls(batch *batchFile, vars *variables, client EthClient) ([]multiSendTx, []batchCall, error) {
+	var txs []multiSendTx
+	var included []batchCall
+	for i, call := range batch.Calls {
+		tx, err := call.build(vars)
+		if err != nil {
+			return nil, nil, fmt.Errorf("call %d: %w", i+1, err)
+		}
+
+		if call.If != nil {
+			holds, actual, err := call.If.eval(client, tx.To, vars)
+			if err != nil {
+				return nil, nil, fmt.Errorf("call %d condition: %w", i+1, err)
+			}
+			if !holds {
+				fmt.Printf("skipping call %d: %s is %s, not %s %s\n", i+1, call.If.Read, actual, call.If.Op, call.If.Value)
+				continue
+			}
+			fmt.Printf("including call %d: %s is %s\n", i+1, call.If.Read, actual)
+		}
+		txs = append(txs, tx)
+		included = append(included, call)
+	}
+
+	if len(txs) == 0 {
+		return nil, nil, errors.New("every call of the batch was skipped, nothing to propose")
+	}
+	return txs, included, nil
+}
+
+// buildBatch returns the safe transaction of the batch, a multiSend for more
+// than one call
+func buildBatch(batch *batchFile, vars *variables, client EthClient) (to common.Address, value *big.Int, data []byte, operation uint8, err error) {
+	txs, _, err := buildCalls(batch, vars, client)
+	if err != nil {
+		return common.Address{}, nil, nil, 0, err
+	}
+	to, value, data, operation = batchTransaction(txs)
+	return to, value, data, operation, nil
+}
+
+// batchTransaction returns the call itself for a single call, otherwise a
+// MultiSendCallOnly delegatecall
+func batchTransaction(txs []multiSendTx) (to common.Address, value *big.Int, data []byte, operation uint8) {
+	if len(txs) == 1 {
+		return txs[0].To, txs[0].Value, txs[0].Data, 0
+	}
+	// the multiSend runs as a delegatecall, the values are sent from the safe's balance
+	return contractAddress(CONTRACT_MULTI_SEND_CALL_ONLY), new(big.Int), encodeMultiSend(txs), 1
+}
+
+// multiSendTransaction is batchTransaction for a proposal of no value of its
+// own: a single call with a value goes through the multiSend too, as the value
+// may not fit the int64 amount of a plain proposal
+func multiSendTransaction(txs []multiSendTx) (to common.Address, data []byte, operation uint8) {
+	if len(txs) == 1 && txs[0].Value.Sign() == 0 {
+		return txs[0].To, txs[0].Data, 0
+	}
+	return contractAddress(CONTRACT_MULTI_SEND_CALL_ONLY), encodeMultiSend(txs), 1
+}
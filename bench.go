@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// benchStats collects the latencies and errors of one kind of request
+type benchStats struct {
+	name      string
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    map[string]int
+	elapsed   time.Duration
+}
+
+func (s *benchStats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if s.errors == nil {
+			s.errors = map[string]int{}
+		}
+		// the first line is enough to tell errors apart
+		s.errors[strings.SplitN(err.Error(), "\n", 2)[0]]++
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+// percentile returns the nearest rank percentile of the successful requests
+func (s *benchStats) percentile(p int) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted)+99)/100 - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func (s *benchStats) print() {
+	failed := 0
+	for _, n := range s.errors {
+		failed += n
+	}
+	total := len(s.latencies) + failed
+	if total == 0 {
+		return
+	}
+
+	fmt.Printf("%s: %d requests in %s, %.1f/s, %d failed (%.1f%%)\n", s.name, total, s.elapsed.Round(time.Millisecond),
+		float64(total)/s.elapsed.Seconds(), failed, 100*float64(failed)/float64(total))
+	if len(s.latencies) > 0 {
+		fmt.Printf("  latency p50 %s p90 %s p99 %s max %s\n", s.percentile(50).Round(time.Millisecond), s.percentile(90).Round(time.Millisecond),
+			s.percentile(99).Round(time.Millisecond), s.percentile(100).Round(time.Millisecond))
+	}
+
+	var messages []string
+	for message := range s.errors {
+		messages = append(messages, message)
+	}
+	sort.Strings(messages)
+	for _, message := range messages {
+		fmt.Printf("  %dx %s\n", s.errors[message], message)
+	}
+}
+
+// run times a request for each safeTxHash with the given concurrency
+func (s *benchStats) run(hashes []string, concurrency int, fn func(i int, hash string) error) []error {
+	start := time.Now()
+	errs := forEachSafe(hashes, concurrency, func(i int, hash string) error {
+		requestStart := time.Now()
+		err := fn(i, hash)
+		s.record(time.Since(requestStart), err)
+		return err
+	})
+	s.elapsed = time.Since(start)
+	return errs
+}
+
+// benchProposal builds a signed proposal of an empty call of the safe to
+// itself, which moves nothing if it is ever executed
+func benchProposal(safe common.Address, nonce, chainID int64, version string, key *ecdsa.PrivateKey) (*gnosisTxRequest, error) {
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gnosisSafeTx := core.GnosisSafeTx{
+		Sender:         common.NewMixedcaseAddress(sender),
+		Safe:           common.NewMixedcaseAddress(safe),
+		To:             common.NewMixedcaseAddress(safe),
+		Value:          *math.NewDecimal256(0),
+		GasPrice:       *math.NewDecimal256(0),
+		Data:           &hexutil.Bytes{},
+		GasToken:       common.HexToAddress(ZERO_ADDR),
+		RefundReceiver: common.HexToAddress(ZERO_ADDR),
+		Nonce:          *big.NewInt(nonce),
+	}
+	hash, err := safeTxHash(&gnosisSafeTx, chainID, version)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signSafeTxHash(hash, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gnosisTxRequest{
+		To:                      safe.Hex(),
+		GasToken:                ZERO_ADDR,
+		RefundReceiver:          ZERO_ADDR,
+		Nonce:                   nonce,
+		ContractTransactionHash: hash.Hex(),
+		Sender:                  sender.Hex(),
+		Signature:               hexutil.Encode(signature),
+	}, nil
+}
+
+// runBench proposes n synthetic transactions from nonceOffset past the safe
+// nonce, reads each back and, with a confirming owner key, confirms them
+func runBench(safe common.Address, proposer, confirmer *ecdsa.PrivateKey, n, concurrency int, nonceOffset int64) error {
+	if n < 1 {
+		return errors.New("-requests must be positive")
+	}
+	nonce, err := getSafeNonce(safe.Hex())
+	if err != nil {
+		return err
+	}
+	base := *nonce + nonceOffset
+	chainID, version, err := safeTxDomain(safe.Hex(), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("benchmarking %s with %d requests, %d at a time, proposing at nonces %d to %d\n", serviceURL, n, concurrency, base, base+int64(n)-1)
+
+	proposals := make([]*gnosisTxRequest, n)
+	for i := range proposals {
+		if proposals[i], err = benchProposal(safe, base+int64(i), chainID, version, proposer); err != nil {
+			return err
+		}
+	}
+
+	hashes := make([]string, n)
+	for i, p := range proposals {
+		hashes[i] = p.ContractTransactionHash
+	}
+
+	propose := &benchStats{name: "propose"}
+	errs := propose.run(hashes, concurrency, func(i int, _ string) error {
+		return postGnosisTx(safe.Hex(), proposals[i])
+	})
+	var proposed []string
+	for i, err := range errs {
+		if err == nil {
+			proposed = append(proposed, hashes[i])
+		}
+	}
+
+	read := &benchStats{name: "read"}
+	read.run(proposed, concurrency, func(_ int, hash string) error {
+		_, err := getMultisigTransaction(hash)
+		return err
+	})
+
+	confirm := &benchStats{name: "confirm"}
+	if confirmer != nil {
+		confirm.run(proposed, concurrency, func(_ int, hash string) error {
+			signature, err := signSafeTxHash(common.HexToHash(hash), confirmer)
+			if err != nil {
+				return err
+			}
+			return submitConfirmation(hash, hexutil.Encode(signature))
+		})
+	}
+
+	for _, s := range []*benchStats{propose, read, confirm} {
+		s.print()
+	}
+	fmt.Printf("the synthetic proposals stay queued at nonces %d to %d, they are empty self calls\n", base, base+int64(n)-1)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// how long cached lookups are used before being fetched again
+const (
+	// owners and threshold, not for nonces which are always fetched
+	CACHE_TTL_SAFE_INFO = time.Minute
+	// symbol and decimals of a token contract never change in practice
+	CACHE_TTL_TOKEN    = 7 * 24 * time.Hour
+	CACHE_TTL_SELECTOR = 24 * time.Hour
+	// only verified sources are cached, unverified ones may be verified any time
+	CACHE_TTL_VERIFIED = 30 * 24 * time.Hour
+)
+
+// kinds of cached lookups, a directory each
+const (
+	CACHE_SAFES     = "safes"
+	CACHE_TOKENS    = "tokens"
+	CACHE_SELECTORS = "selectors"
+	CACHE_SOURCES   = "sources"
+)
+
+// cacheDisabled is set with the global -no-cache flag or $GNOSIS_TX_NO_CACHE,
+// every lookup is fetched then but still stored for later runs
+var cacheDisabled = os.Getenv("GNOSIS_TX_NO_CACHE") != ""
+
+type cacheEntry struct {
+	StoredAt time.Time       `json:"storedAt"`
+	Value    json.RawMessage `json:"value"`
+}
+
+func cacheDir() string {
+	return configPath("cache")
+}
+
+// cachePath keys entries by chain as the same address differs across chains
+func cachePath(kind, key string) string {
+	name := fmt.Sprintf("%d-%s.json", serviceChainID, strings.ToLower(key))
+	return filepath.Join(cacheDir(), kind, filepath.Base(name))
+}
+
+// cacheGet decodes the cached value of key into v unless it is older than ttl
+func cacheGet(kind, key string, ttl time.Duration, v interface{}) bool {
+	if cacheDisabled {
+		return false
+	}
+	content, err := ioutil.ReadFile(cachePath(kind, key))
+	if err != nil {
+		return false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil || time.Since(entry.StoredAt) > ttl {
+		return false
+	}
+	if err := json.Unmarshal(entry.Value, v); err != nil {
+		return false
+	}
+	logger.Debug("cache hit", "kind", kind, "key", key, "age", time.Since(entry.StoredAt).Round(time.Second))
+	return true
+}
+
+// cachePut stores v for key, a cache that can't be written only costs the
+// next lookup
+func cachePut(kind, key string, v interface{}) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	encoded, err := json.Marshal(cacheEntry{StoredAt: time.Now().UTC(), Value: value})
+	if err != nil {
+		return
+	}
+	path := cachePath(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		logger.Debug("cache not written", "err", err)
+		return
+	}
+	if err := ioutil.WriteFile(path, encoded, 0o600); err != nil {
+		logger.Debug("cache not written", "err", err)
+	}
+}
+
+// cachedSafeInfo is getSafeInfo for owners, threshold and version; its nonce
+// may be stale so proposals use getSafeInfo, and so is every lookup with
+// -verify-onchain
+func cachedSafeInfo(safe string) (*safeNonceResponse, error) {
+	var info safeNonceResponse
+	if verifyOnchainRPC == "" && cacheGet(CACHE_SAFES, safe, CACHE_TTL_SAFE_INFO, &info) {
+		return &info, nil
+	}
+	fetched, err := getSafeInfo(safe)
+	if err != nil {
+		return nil, err
+	}
+	cachePut(CACHE_SAFES, safe, fetched)
+	return fetched, nil
+}
+
+// cacheSummary counts the cached entries of each kind
+func cacheSummary() (map[string]int, error) {
+	counts := map[string]int{}
+	for _, kind := range []string{CACHE_SAFES, CACHE_TOKENS, CACHE_SELECTORS, CACHE_SOURCES} {
+		entries, err := ioutil.ReadDir(filepath.Join(cacheDir(), kind))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		counts[kind] = len(entries)
+	}
+	return counts, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	defer func(disabled bool) { cacheDisabled = disabled }(cacheDisabled)
+	cacheDisabled = false
+
+	var got []string
+	if cacheGet(CACHE_SELECTORS, "0xa9059cbb", time.Hour, &got) {
+		t.Fatalf("cacheGet of an empty cache = %v, want a miss", got)
+	}
+	cachePut(CACHE_SELECTORS, "0xa9059cbb", []string{"transfer(address,uint256)"})
+	if !cacheGet(CACHE_SELECTORS, "0xa9059cbb", time.Hour, &got) || len(got) != 1 || got[0] != "transfer(address,uint256)" {
+		t.Errorf("cacheGet = %v, want the stored signature", got)
+	}
+	if cacheGet(CACHE_SELECTORS, "0xa9059cbb", 0, &got) {
+		t.Errorf("cacheGet past its ttl = hit, want a miss")
+	}
+
+	cacheDisabled = true
+	if cacheGet(CACHE_SELECTORS, "0xa9059cbb", time.Hour, &got) {
+		t.Errorf("cacheGet with the cache disabled = hit, want a miss")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+type auditEntry struct {
+	Time     string `json:"time"`
+	Operator string `json:"operator,omitempty"`
+	Step     string `json:"step"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// ceremony walks the operators through the signing runbook, every step is
+// appended to the audit log as it happens
+type ceremony struct {
+	tx        *multisigTxResponse
+	hash      common.Hash
+	value     *big.Int
+	intent    []string
+	operators []string
+	entries   []auditEntry
+	in        *bufio.Reader
+	audit     *os.File
+}
+
+func newCeremony(tx *multisigTxResponse, hash common.Hash, auditPath string, in io.Reader) (*ceremony, error) {
+	if err := os.MkdirAll(filepath.Dir(auditPath), 0700); err != nil {
+		return nil, err
+	}
+	audit, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if tx.Data != nil {
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return nil, err
+		}
+	}
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %q", tx.Value)
+	}
+
+	return &ceremony{
+		tx:     tx,
+		hash:   hash,
+		value:  value,
+		intent: describeTx(common.HexToAddress(tx.To), value, data, tx.Operation),
+		in:     bufio.NewReader(in),
+		audit:  audit,
+	}, nil
+}
+
+func (c *ceremony) log(operator, step, detail string) error {
+	entry := auditEntry{Time: formatTime(time.Now()), Operator: operator, Step: step, Detail: detail}
+	c.entries = append(c.entries, entry)
+
+	encoded, err := json.Marshal(struct {
+		SafeTxHash string `json:"safeTxHash"`
+		auditEntry
+	}{c.hash.Hex(), entry})
+	if err != nil {
+		return err
+	}
+	if _, err := c.audit.Write(append(encoded, '\n')); err != nil {
+		return err
+	}
+	return c.audit.Sync()
+}
+
+func (c *ceremony) ask(question string) (string, error) {
+	fmt.Print(question, " ")
+	answer, err := c.in.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", fmt.Errorf("ceremony aborted: %w", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// expect asks until the operator gives the expected answer, aborting the
+// ceremony after three wrong ones
+func (c *ceremony) expect(operator, step, question, expected string) error {
+	for attempt := 1; attempt <= 3; attempt++ {
+		answer, err := c.ask(question)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(answer, expected) {
+			return c.log(operator, step, "confirmed")
+		}
+		if err := c.log(operator, step, fmt.Sprintf("wrong answer %q (attempt %d)", answer, attempt)); err != nil {
+			return err
+		}
+		fmt.Println("that doesn't match")
+	}
+	return fmt.Errorf("ceremony aborted at %q", step)
+}
+
+func (c *ceremony) operator(prompt string) (string, error) {
+	name, err := c.ask(prompt)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("ceremony aborted: %s", "an operator name is required")
+	}
+	for _, existing := range c.operators {
+		if strings.EqualFold(existing, name) {
+			return "", fmt.Errorf("ceremony aborted: %s already acted as operator, a different person is required", name)
+		}
+	}
+	c.operators = append(c.operators, name)
+	return name, c.log(name, "operator joined", "")
+}
+
+// run performs the checklist, returning once both operators approved signing
+func (c *ceremony) run() error {
+	hex := strings.ToLower(c.hash.Hex())
+
+	fmt.Println("=== signing ceremony ===")
+	fmt.Println("safe:      ", c.tx.Safe)
+	fmt.Println("nonce:     ", c.tx.Nonce)
+	fmt.Println("safeTxHash:", c.hash.Hex())
+	if submitted, err := parseServiceTime(c.tx.SubmissionDate); err == nil && !submitted.IsZero() {
+		fmt.Println("proposed:  ", formatAge(submitted))
+	}
+	fmt.Println("intent:")
+	for _, line := range c.intent {
+		fmt.Println("  -", line)
+	}
+	if err := c.log("", "ceremony started", strings.Join(c.intent, "; ")); err != nil {
+		return err
+	}
+
+	first, err := c.operator("operator 1, your name:")
+	if err != nil {
+		return err
+	}
+	if err := c.expect(first, "hash verified on second device", "verify the safeTxHash on a second device (hardware wallet screen or an independent machine) and type its last 8 characters:", hex[len(hex)-8:]); err != nil {
+		return err
+	}
+	if err := c.expect(first, "intent read aloud", "read the intent above aloud to the second operator, then type 'read':", "read"); err != nil {
+		return err
+	}
+
+	second, err := c.operator("operator 2, your name:")
+	if err != nil {
+		return err
+	}
+	if err := c.expect(second, "hash cross-checked", "operator 2, type the first 8 characters after 0x of the safeTxHash from your own screen:", hex[2:10]); err != nil {
+		return err
+	}
+	if err := c.expect(second, "intent agreed", "operator 2, type 'agree' if the intent read aloud matches what you expect:", "agree"); err != nil {
+		return err
+	}
+
+	return c.expect(first, "signing approved", "operator 1, type 'sign' to sign:", "sign")
+}
+
+func (c *ceremony) report() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Signing ceremony for %s\n\n", c.hash.Hex())
+	fmt.Fprintf(&b, "| Field | Value |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Safe | `%s` |\n", c.tx.Safe)
+	fmt.Fprintf(&b, "| Nonce | %d |\n", c.tx.Nonce)
+	if submitted, err := parseServiceTime(c.tx.SubmissionDate); err == nil && !submitted.IsZero() {
+		fmt.Fprintf(&b, "| Proposed | %s |\n", formatTime(submitted))
+	}
+	fmt.Fprintf(&b, "| To | `%s` |\n", c.tx.To)
+	fmt.Fprintf(&b, "| Value | %s |\n", formatWei(c.value))
+	fmt.Fprintf(&b, "| Operation | %d |\n", c.tx.Operation)
+	fmt.Fprintf(&b, "| Operators | %s |\n\n", strings.Join(c.operators, ", "))
+
+	fmt.Fprintf(&b, "## Intent\n\n")
+	for _, line := range c.intent {
+		fmt.Fprintf(&b, "- %s\n", line)
+	}
+
+	fmt.Fprintf(&b, "\n## Log\n\n| Time | Operator | Step | Detail |\n|---|---|---|---|\n")
+	for _, entry := range c.entries {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", entry.Time, entry.Operator, entry.Step, entry.Detail)
+	}
+	return b.String()
+}
+
+// runCeremony guides the operators through the checklist and only then signs
+// and submits the confirmation, writing the ceremony report either way
+func runCeremony(tx *multisigTxResponse, typedData apitypes.TypedData, hash common.Hash, key *ecdsa.PrivateKey, contractOwner, rpc, auditPath, reportPath string) error {
+	c, err := newCeremony(tx, hash, auditPath, os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer c.audit.Close()
+
+	result := c.run()
+	if result == nil {
+		owner, signature, err := signTransaction(typedData, key, contractOwner, rpc)
+		if err == nil {
+			err = submitConfirmation(hash.Hex(), hexutil.Encode(signature))
+		}
+		if err != nil {
+			result = err
+			c.log("", "signing failed", err.Error())
+		} else {
+			fmt.Println("confirmed", hash.Hex(), "as", owner.Hex())
+			c.log("", "signed", owner.Hex())
+		}
+	} else {
+		c.log("", "aborted", result.Error())
+	}
+
+	if err := ioutil.WriteFile(reportPath, []byte(c.report()), 0o644); err != nil {
+		return err
+	}
+	fmt.Println("ceremony report written to", reportPath)
+	return result
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// chain-only mode works without the transaction service: the nonce comes from
+// the chain, the proposal and its signatures are files passed between owners
+// with sign and aggregate, and execute -tx sends it once enough are gathered
+
+// serviceUnreachable tells a failed connection to the service apart from an
+// error answer
+func serviceUnreachable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// chainOnlyHint points at chain-only mode when the service can't be reached
+func chainOnlyHint(err error) error {
+	if !serviceUnreachable(err) {
+		return err
+	}
+	return fmt.Errorf("%w\nthe transaction service at %s is unreachable, pass -chain-only with -rpc to sign locally and execute with the signature files", err, serviceURL)
+}
+
+// resolveNonceOnchain picks the nonce to propose at from the safe contract,
+// the queue lives in the service so only explicit nonces can be checked
+func resolveNonceOnchain(rpc, safe, strategy string, replace int64) (*int64, error) {
+	if rpc == "" {
+		return nil, errors.New("-chain-only needs -rpc to read the safe nonce")
+	}
+	if strategy == NONCE_NEXT_QUEUED || replace >= 0 {
+		return nil, fmt.Errorf("-nonce %s and -replace need the transaction service queue, give the nonce explicitly", NONCE_NEXT_QUEUED)
+	}
+
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	state, err := readSafeState(client, common.HexToAddress(safe), nil)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == "" {
+		return &state.Nonce, nil
+	}
+
+	nonce, err := strconv.ParseInt(strategy, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce %q, expected a number", strategy)
+	}
+	if nonce < state.Nonce {
+		return nil, fmt.Errorf("nonce %d is already executed, current nonce is %d", nonce, state.Nonce)
+	}
+	if nonce > state.Nonce {
+		logger.Warn("nonce can't be executed before the current nonce", "nonce", nonce, "current", state.Nonce)
+	}
+	return &nonce, nil
+}
+
+func writeDetachedSignature(path string, sig *detachedSignature) error {
+	encoded, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0o644)
+}
+
+// writeChainOnlyProposal stores a signed proposal in dir instead of posting
+// it, as <safeTxHash>.tx.json and the detached signature of its proposer
+func writeChainOnlyProposal(dir string, tx *multisigTxResponse, owner common.Address, signature []byte) error {
+	encoded, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return err
+	}
+	txFile := filepath.Join(dir, tx.SafeTxHash+".tx.json")
+	if err := ioutil.WriteFile(txFile, encoded, 0o644); err != nil {
+		return err
+	}
+
+	sigFile := filepath.Join(dir, tx.SafeTxHash+"."+owner.Hex()+".json")
+	sig := &detachedSignature{SafeTxHash: tx.SafeTxHash, Owner: owner.Hex(), Signature: hexutil.Encode(signature)}
+	if err := writeDetachedSignature(sigFile, sig); err != nil {
+		return err
+	}
+
+	fmt.Println("transaction written to", txFile)
+	fmt.Println("signature written to", sigFile)
+	fmt.Println("the other owners sign it with sign -tx", txFile, "and it executes with execute -tx", txFile, "-rpc <RPC> <signature files>")
+	return nil
+}
+
+// loadSignedTxFile loads a transaction file with its detached signatures,
+// checking the file's declared hash against its fields
+func loadSignedTxFile(txFile string, sigFiles []string, rpc string) (*multisigTxResponse, []*detachedSignature, error) {
+	tx, err := loadSafeTxFile(txFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, hash, err := fileTypedData(tx, rpc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tx.SafeTxHash != "" && common.HexToHash(tx.SafeTxHash) != hash {
+		return nil, nil, fmt.Errorf("transaction file declares hash %s but its fields hash to %s", tx.SafeTxHash, hash.Hex())
+	}
+	tx.SafeTxHash = hash.Hex()
+
+	if len(sigFiles) == 0 {
+		return nil, nil, errors.New("no signature files given")
+	}
+	var sigs []*detachedSignature
+	for _, path := range sigFiles {
+		sig, err := loadDetachedSignature(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	return tx, sigs, nil
+}
+
+// bundleSignatures encodes the detached signatures of a transaction, checked
+// against the owners and threshold read from the chain
+func bundleSignatures(tx *multisigTxResponse, sigs []*detachedSignature, client EthClient) ([]byte, int64, error) {
+	state, err := readSafeState(client, common.HexToAddress(tx.Safe), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if state.Nonce != tx.Nonce {
+		return nil, 0, fmt.Errorf("transaction is at nonce %d but the safe is at nonce %d", tx.Nonce, state.Nonce)
+	}
+	signatures, count, err := aggregateSignatures(tx, sigs, state.Owners, int(state.Threshold), client)
+	if err != nil {
+		return nil, 0, err
+	}
+	return signatures, int64(count), nil
+}
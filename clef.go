@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const SIGNER_CLEF = "clef"
+
+// clefSigner delegates signing to a running clef over its external API, so
+// its rules and UI approve every signature
+type clefSigner struct {
+	client  *rpc.Client
+	account common.Address
+}
+
+// openClef connects to clef over http or IPC, the account may be omitted when
+// clef manages a single one
+func openClef(endpoint, account string) (signer, error) {
+	if endpoint == "" {
+		return nil, errors.New("clef signers need the endpoint of the external API, e.g. ~/.clef/clef.ipc")
+	}
+
+	client, err := rpc.DialContext(opCtx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &clefSigner{client: client}
+	if account != "" {
+		if !common.IsHexAddress(account) {
+			client.Close()
+			return nil, fmt.Errorf("invalid clef account %q", account)
+		}
+		s.account = common.HexToAddress(account)
+		return s, nil
+	}
+
+	var accounts []common.Address
+	if err := client.CallContext(opCtx, &accounts, "account_list"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("listing clef accounts failed: %w", err)
+	}
+	if len(accounts) != 1 {
+		client.Close()
+		return nil, fmt.Errorf("clef offers %d accounts, set the account to sign with", len(accounts))
+	}
+	s.account = accounts[0]
+	return s, nil
+}
+
+func (s *clefSigner) Address() common.Address {
+	return s.account
+}
+
+func (s *clefSigner) SignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	encoded, err := encodeTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("approve the signature request in clef")
+	var signature hexutil.Bytes
+	if err := s.client.CallContext(opCtx, &signature, "account_signTypedData", s.account.Hex(), typedData); err != nil {
+		return nil, fmt.Errorf("clef refused to sign: %w", err)
+	}
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("clef returned a signature of %d bytes", len(signature))
+	}
+	if signature, err = normalizeECDSA(signature); err != nil {
+		return nil, err
+	}
+
+	signer, err := recoverSigner(crypto.Keccak256Hash(encoded), signature)
+	if err != nil {
+		return nil, err
+	}
+	if signer != s.account {
+		return nil, fmt.Errorf("clef signature recovers to %s, not %s", signer.Hex(), s.account.Hex())
+	}
+	return signature, nil
+}
+
+func (s *clefSigner) Close() {
+	s.client.Close()
+}
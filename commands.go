@@ -0,0 +1,3395 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+var commands = map[string]func(args []string) error{
+	"send":                 sendCommand,
+	"send-nft":             sendNFTCommand,
+	"batch":                batchCommand,
+	"export":               exportCommand,
+	"watch":                watchCommand,
+	"auto-confirm":         autoConfirmCommand,
+	"ack-request":          ackRequestCommand,
+	"approve":              approveCommand,
+	"set-guard":            setGuardCommand,
+	"set-fallback-handler": setFallbackHandlerCommand,
+	"verify-review":        verifyReviewCommand,
+	"verify":               verifyCommand,
+	"deploy":               deployCommand,
+	"manifest":             manifestCommand,
+	"execute":              executeCommand,
+	"receipt":              receiptCommand,
+	"speedup":              speedupCommand,
+	"sign":                 signCommand,
+	"aggregate":            aggregateCommand,
+	"confirm":              confirmCommand,
+	"gas-advice":           gasAdviceCommand,
+	"approve-hash":         approveHashCommand,
+	"safe-info":            safeInfoCommand,
+	"balances":             balancesCommand,
+	"pending":              pendingCommand,
+	"queue":                queueCommand,
+	"delegates":            delegatesCommand,
+	"keys":                 keysCommand,
+	"selftest":             selfTestCommand,
+	"sign-message":         signMessageCommand,
+	"ceremony":             ceremonyCommand,
+	"proxies":              proxiesCommand,
+	"networks":             networksCommand,
+	"address":              addressCommand,
+	"bench":                benchCommand,
+	"allowance":            allowanceCommand,
+	"recovery":             recoveryCommand,
+	"zodiac":               zodiacCommand,
+	"sweep":                sweepCommand,
+	"upgrade":              upgradeCommand,
+	"stream":               streamCommand,
+	"action":               actionCommand,
+	"run":                  runCommand,
+	"cache":                cacheCommand,
+	"airgap":               airgapCommand,
+	"export-typed-data":    exportTypedDataCommand,
+	"submit-signature":     submitSignatureCommand,
+	"gas-tokens":           gasTokensCommand,
+	"rotate-owner":         rotateOwnerCommand,
+	"draft":                draftCommand,
+}
+
+type commonFlags struct {
+	safe         *string
+	from         *string
+	privKey      *string
+	policyFile   *string
+	rpc          *string
+	reviewDir    *string
+	manifest     *string
+	quorumRPCs   *string
+	trustedBlock *string
+	nonce        *string
+	replace      *int64
+	estimate     *string
+	noEstimate   *bool
+	simulate     *bool
+	asDelegate   *bool
+	signer       *string
+	signersFile  *string
+	lint         *string
+	verification *string
+	proxies      *string
+	ackNew       *string
+	allowUnknown *bool
+	chainOnly    *bool
+	bundleDir    *string
+	hooks        *string
+	attestation  *string
+	attestCmd    *string
+	gasToken     *string
+	gasPrice     *string
+	refund       *string
+	onNonceRace  *string
+	safeTxGas    *int64
+	origin       *originFlags
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	return &commonFlags{
+		safe:         fs.String("safe", "<SAFE_ADDRESS>", "safe address"),
+		from:         fs.String("from", "<SIGNER_ADDRESS>", "signer address"),
+		privKey:      secretFlag(fs, "key", "<SIGNER_PRIVATE_KEY>", "signer private key"),
+		policyFile:   fs.String("policy", "", "policy file (json)"),
+		rpc:          fs.String("rpc", "", "ethereum RPC endpoint"),
+		reviewDir:    fs.String("review-dir", "", "directory to write signed review artifacts to"),
+		manifest:     fs.String("manifest", "", "batch manifest file to record the proposal in"),
+		quorumRPCs:   fs.String("quorum-rpcs", "", "comma separated independent RPC endpoints that must agree on the safe state before signing"),
+		trustedBlock: fs.String("trusted-block-hash", "", "hash of a recent block obtained independently, the safe state is proven against it via -rpc before signing"),
+		nonce:        fs.String("nonce", "", "nonce to propose at, a number or "+NONCE_NEXT_QUEUED+" (default: current safe nonce)"),
+		replace:      fs.Int64("replace", -1, "propose a competing transaction at this occupied nonce"),
+		estimate:     fs.String("estimate", "", "gas estimation: "+ESTIMATE_RELAY+" service, "+ESTIMATE_LOCAL+" simulation against -rpc or "+ESTIMATE_NONE+" for safeTxGas 0 (default: "+ESTIMATE_NONE+" for safes from 1.3.0 without a refund, "+ESTIMATE_RELAY+" otherwise)"),
+		noEstimate:   fs.Bool("no-gas-estimation", false, "propose with safeTxGas 0 without calling the relay, same as -estimate "+ESTIMATE_NONE),
+		simulate:     fs.Bool("simulate", false, "simulate the execution against -rpc (or tenderly if configured) and refuse to propose if it would fail"),
+		asDelegate:   fs.Bool("as-delegate", false, "propose with a registered delegate key, the proposal still needs threshold owner confirmations"),
+		signer:       fs.String("signer", "", "configured signer to propose with instead of -key, e.g. a kms signer"),
+		signersFile:  fs.String("signers", "", "signers config (default: signers.json in the config directory)"),
+		verification: fs.String("verification", CHECK_WARN, "source verification check of called contracts (sourcify, etherscan with $ETHERSCAN_API_KEY): "+CHECK_WARN+", "+CHECK_STRICT+" to refuse unverified ones, or "+CHECK_OFF),
+		proxies:      fs.String("proxies", CHECK_WARN, "implementation check of proxy destinations against the one recorded on first use: "+CHECK_WARN+", "+CHECK_STRICT+" to refuse upgraded proxies, or "+CHECK_OFF),
+		ackNew:       fs.String("ack-new", "", "comma separated addresses acknowledged as first interactions of the safe"),
+		allowUnknown: fs.Bool("allow-unknown", false, "don't warn about counterparties missing from the address book"),
+		chainOnly:    fs.Bool("chain-only", false, "work without the transaction service: read the nonce via -rpc and write the signed proposal to -bundle-dir"),
+		bundleDir:    fs.String("bundle-dir", ".", "with -chain-only, directory to write the transaction and signature files to"),
+		hooks:        fs.String("hooks", "", "hooks config (default: hooks.json in the config dir)"),
+		attestation:  fs.String("attestation", "", "reference an enclave attestation of the signer in the proposal origin: "+ATTESTATION_NITRO+" or "+ATTESTATION_SEV),
+		attestCmd:    fs.String("attestation-cmd", "", "command printing the attestation document for the user data in $ATTESTATION_USER_DATA"),
+		lint:         fs.String("lint", CHECK_WARN, "red flag checks before signing: "+CHECK_WARN+", "+CHECK_STRICT+" to refuse on findings, or "+CHECK_OFF),
+		gasToken:     fs.String("gas-token", "", "token the executor is refunded in (default: the native token), with -gas-price"),
+		gasPrice:     fs.String("gas-price", "", "refund the executor this amount of the gas token per gas, or "+REFUND_GAS_PRICE_RELAY+" for the relay quote (default: no refund)"),
+		refund:       fs.String("refund-receiver", "", "address receiving the refund instead of the executor, with -gas-price"),
+		onNonceRace:  fs.String("on-nonce-race", NONCE_RACE_ABORT, "when the nonce is taken while signing: "+NONCE_RACE_ABORT+" with a conflict report, or "+NONCE_RACE_BUMP+" to sign again at the next free nonce"),
+		safeTxGas:    fs.Int64("safe-tx-gas", -1, "safeTxGas to propose with when the relay, service and local (with -rpc) estimations all fail"),
+		origin:       addOriginFlags(fs),
+	}
+}
+
+func (c *commonFlags) options() (*proposalOptions, error) {
+	opts := &proposalOptions{
+		reviewDir:    *c.reviewDir,
+		manifestFile: *c.manifest,
+		quorumRPCs:   splitList(*c.quorumRPCs),
+		rpc:          *c.rpc,
+		nonce:        *c.nonce,
+		replace:      *c.replace,
+		estimate:     *c.estimate,
+		simulate:     *c.simulate,
+		asDelegate:   *c.asDelegate,
+		signer:       *c.signer,
+		signersFile:  *c.signersFile,
+		lint:         *c.lint,
+		verification: *c.verification,
+		proxies:      *c.proxies,
+		ackNew:       splitList(*c.ackNew),
+		allowUnknown: *c.allowUnknown,
+		chainOnly:    *c.chainOnly,
+		bundleDir:    *c.bundleDir,
+		onNonceRace:  *c.onNonceRace,
+	}
+
+	if *c.noEstimate {
+		if opts.estimate != "" && opts.estimate != ESTIMATE_NONE {
+			return nil, fmt.Errorf("-no-gas-estimation and -estimate %s can't be used together", opts.estimate)
+		}
+		opts.estimate = ESTIMATE_NONE
+	}
+	if *c.safeTxGas >= 0 {
+		opts.safeTxGas = c.safeTxGas
+	}
+	if opts.onNonceRace != NONCE_RACE_ABORT && opts.onNonceRace != NONCE_RACE_BUMP {
+		return nil, fmt.Errorf("invalid -on-nonce-race %q, expected %s or %s", opts.onNonceRace, NONCE_RACE_ABORT, NONCE_RACE_BUMP)
+	}
+
+	if *c.trustedBlock != "" {
+		hash, err := hexutil.Decode(*c.trustedBlock)
+		if err != nil || len(hash) != 32 {
+			return nil, fmt.Errorf("invalid -trusted-block-hash %q", *c.trustedBlock)
+		}
+		opts.trustedBlock = common.BytesToHash(hash)
+	}
+
+	origin, err := c.origin.originFields()
+	if err != nil {
+		return nil, err
+	}
+	opts.origin = origin
+
+	hooks, err := loadHooksConfig(*c.hooks)
+	if err != nil {
+		return nil, err
+	}
+	opts.hooks = hooks
+
+	if opts.attester, err = newAttester(*c.attestation, *c.attestCmd); err != nil {
+		return nil, err
+	}
+
+	if opts.refund, err = parseRefund(*c.gasToken, *c.gasPrice, *c.refund); err != nil {
+		return nil, err
+	}
+
+	if *c.policyFile != "" {
+		pol, err := loadPolicy(*c.policyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.policy = pol
+	}
+
+	return opts, nil
+}
+
+func sendCommand(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	to := fs.String("to", "<RECEIVER_ADDRESS>", "receiver address")
+	amount := fs.Int64("amount", 1000000, "amount in wei")
+	testFirst := fs.Bool("test-first", false, "propose a small test transfer first, the payment follows with -follow-up once it is received")
+	testAmount := fs.Int64("test-amount", 1000, "amount of the test transfer in wei")
+	followUp := fs.String("follow-up", "", "safeTxHash of an executed test transfer to propose the payment for")
+	received := fs.Bool("received", false, "confirm the recipient received the test transfer")
+	receiptSignature := fs.String("receipt-signature", "", "signature of the recipient acknowledging the test transfer")
+	ackChallenge := fs.String("recipient-challenge", "", "challenge of the acknowledgment request from ack-request")
+	ackSignature := fs.String("recipient-signature", "", "recipient signature of the acknowledgment, attached to the proposal")
+	fs.Parse(args)
+
+	safe, err := parseAddress(*flags.safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	if *ackSignature != "" {
+		if *ackChallenge == "" {
+			return errors.New("-recipient-signature needs the -recipient-challenge it signed")
+		}
+		recipient, err := verifyAck(safe, common.HexToAddress(*to), big.NewInt(*amount), nil, *ackChallenge, *ackSignature)
+		if err != nil {
+			return err
+		}
+		fmt.Println("recipient", recipient.Hex(), "proved control of the destination address")
+		opts.origin["recipientAck"], opts.origin["recipientChallenge"] = *ackSignature, *ackChallenge
+	}
+
+	if *followUp != "" {
+		return proposeFollowUp(*followUp, *received, *receiptSignature, *flags.from, *flags.privKey, opts)
+	}
+	if *testFirst {
+		return proposeTestTransfer(*flags.from, *to, *flags.safe, *amount, *testAmount, *flags.privKey, opts)
+	}
+
+	// on rinkeby network
+	return sendTransaction(*flags.from, *to, *flags.safe, *amount, nil, 0, *flags.privKey, opts)
+}
+
+func batchCommand(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	file := fs.String("file", "", "batch file (json, yaml or a Transaction Builder export) of the calls to propose")
+	draft := fs.String("draft", "", "name of a draft to propose instead of a batch file")
+	draftDir := fs.String("draft-dir", "", "drafts directory (default: $GNOSIS_TX_DRAFTS_DIR or drafts in the config directory)")
+	vars := varFlags{}
+	fs.Var(vars, "var", "NAME=value of a ${NAME} variable referenced in the batch file, repeatable")
+	payouts := fs.String("csv", "", "csv of address,token,amount payouts to batch instead of a batch file, as used by CSV Airdrop")
+	allowDuplicates := fs.Bool("allow-duplicates", false, "with -csv, allow paying a receiver the same token more than once")
+	fs.Parse(args)
+
+	if (*payouts != "" && *file != "") || (*draft != "" && (*payouts != "" || *file != "")) {
+		return errors.New("usage: batch -file <batch file>|-draft <name>|-csv <payouts> [flags]")
+	}
+	if *payouts != "" {
+		return batchPayouts(flags, *payouts, *allowDuplicates)
+	}
+	if *draft != "" {
+		path, err := draftPath(*draftDir, *draft)
+		if err != nil {
+			return err
+		}
+		*file = path
+	}
+	batch, err := loadBatchFile(*file)
+	if err != nil {
+		return err
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	resolver, err := newVariables(vars)
+	if err != nil {
+		return err
+	}
+	if batch.Safe != "" && !strings.EqualFold(batch.Safe, *flags.safe) {
+		return fmt.Errorf("the batch was made for safe %s, not %s", batch.Safe, *flags.safe)
+	}
+	resolver.builtin["SAFE"] = common.HexToAddress(*flags.safe).Hex()
+
+	var client EthClient
+	if *flags.rpc != "" {
+		if client, err = dialRPC(*flags.rpc); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+	to, value, data, operation, err := buildBatch(batch, resolver, client)
+	if err != nil {
+		return err
+	}
+	if !value.IsInt64() {
+		return fmt.Errorf("value %s wei is too large", value)
+	}
+
+	if batch.Description != "" {
+		fmt.Println(batch.Description)
+	}
+	opts.variables = resolver.summary()
+	for _, line := range opts.variables {
+		fmt.Println("variable", line)
+	}
+	for _, line := range describeTx(to, value, data, operation) {
+		fmt.Println("-", line)
+	}
+
+	return sendTransaction(*flags.from, to.Hex(), *flags.safe, value.Int64(), data, operation, *flags.privKey, opts)
+}
+
+// batchPayouts proposes the transfers of a payout csv as one multiSend,
+// printing the outflow per token before signing
+func batchPayouts(flags *commonFlags, path string, allowDuplicates bool) error {
+	rows, err := loadPayoutCSV(path)
+	if err != nil {
+		return err
+	}
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	var client EthClient
+	if *flags.rpc != "" {
+		if client, err = dialRPC(*flags.rpc); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+	txs, totals, err := buildPayouts(rows, client, allowDuplicates)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d payouts from %s\n", len(txs), path)
+	for _, t := range totals {
+		fmt.Println("- total", t)
+	}
+
+	to, data, operation := multiSendTransaction(txs)
+	return sendTransaction(*flags.from, to.Hex(), *flags.safe, 0, data, operation, *flags.privKey, opts)
+}
+
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	hash := fs.String("hash", "", "safeTxHash of a proposed transaction to export")
+	file := fs.String("file", "", "batch file to export instead of a proposed transaction")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint, for the conditions of the batch file")
+	format := fs.String("format", EXPORT_TXBUILDER, "export format: "+EXPORT_TXBUILDER+" json, or a "+EXPORT_SAFE_ETH_PY+" or "+EXPORT_SAFE_SDK+" fixture")
+	name := fs.String("name", "", "name of the batch in the Transaction Builder")
+	nonce := fs.Int64("nonce", 0, "nonce of the batch file transaction in fixtures")
+	version := fs.String("safe-version", "", "safe version the fixture is hashed for (default: the version of the safe)")
+	out := fs.String("out", "", "file to write the export to")
+	vars := varFlags{}
+	fs.Var(vars, "var", "NAME=value of a ${NAME} variable referenced in the batch file, repeatable")
+	fs.Parse(args)
+
+	if (*hash == "") == (*file == "") || *out == "" {
+		return errors.New("usage: export -hash <safeTxHash>|-file <batch file> -out <file> [flags]")
+	}
+	if *format != EXPORT_TXBUILDER && *format != EXPORT_SAFE_ETH_PY && *format != EXPORT_SAFE_SDK {
+		return fmt.Errorf("unknown -format %q, expected %s, %s or %s", *format, EXPORT_TXBUILDER, EXPORT_SAFE_ETH_PY, EXPORT_SAFE_SDK)
+	}
+
+	safeAddr, err := parseAddress(*safe)
+	if err != nil {
+		return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+	}
+
+	var tx *multisigTxResponse
+	var txs []txBuilderTx
+	var description string
+	if *hash != "" {
+		if tx, err = getMultisigTransaction(*hash); err != nil {
+			return err
+		}
+		if !strings.EqualFold(tx.Safe, *safe) {
+			return fmt.Errorf("transaction %s belongs to safe %s, not %s", *hash, tx.Safe, *safe)
+		}
+		if *format == EXPORT_TXBUILDER {
+			if txs, err = exportProposal(tx); err != nil {
+				return err
+			}
+		}
+		description = fmt.Sprintf("proposal %s at nonce %d", tx.SafeTxHash, tx.Nonce)
+	} else {
+		batch, err := loadBatchFile(*file)
+		if err != nil {
+			return err
+		}
+		if batch.Safe != "" && !strings.EqualFold(batch.Safe, *safe) {
+			return fmt.Errorf("the batch was made for safe %s, not %s", batch.Safe, *safe)
+		}
+
+		resolver, err := newVariables(vars)
+		if err != nil {
+			return err
+		}
+		resolver.builtin["SAFE"] = safeAddr.Hex()
+
+		var client EthClient
+		if *rpc != "" {
+			if client, err = dialRPC(*rpc); err != nil {
+				return err
+			}
+			defer client.Close()
+		}
+		calls, entries, err := buildCalls(batch, resolver, client)
+		if err != nil {
+			return err
+		}
+		if *format == EXPORT_TXBUILDER {
+			if txs, err = exportBatch(calls, entries); err != nil {
+				return err
+			}
+		} else {
+			tx = newBatchTx(safeAddr, calls, *nonce)
+		}
+		description = batch.Description
+	}
+
+	if *format != EXPORT_TXBUILDER {
+		encoded, err := exportFixture(tx, *format, *version)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*out, encoded, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("exported a %s fixture to %s\n", *format, *out)
+		return nil
+	}
+
+	if *name == "" {
+		*name = "Transactions Batch"
+	}
+	chainID, err := serviceChain()
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(newTxBuilderFile(safeAddr, chainID, *name, description, txs), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*out, encoded, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("exported %d transactions to %s\n", len(txs), *out)
+	return nil
+}
+
+type notifierFlags struct {
+	webhook          *string
+	slack            *string
+	telegramTokenEnv *string
+	telegramChat     *string
+}
+
+func addNotifierFlags(fs *flag.FlagSet) *notifierFlags {
+	return &notifierFlags{
+		webhook:          secretFlag(fs, "webhook", "", "url to POST each event to as json"),
+		slack:            secretFlag(fs, "slack-webhook", "", "slack incoming webhook url"),
+		telegramTokenEnv: fs.String("telegram-token-env", "TELEGRAM_BOT_TOKEN", "environment variable holding the telegram bot token"),
+		telegramChat:     fs.String("telegram-chat", "", "telegram chat id to notify"),
+	}
+}
+
+func (f *notifierFlags) notifier() (*watchNotifier, error) {
+	n := &watchNotifier{webhook: *f.webhook, slackWebhook: *f.slack, telegramChat: *f.telegramChat}
+	if *f.telegramChat != "" {
+		if n.telegramToken = os.Getenv(*f.telegramTokenEnv); n.telegramToken == "" {
+			return nil, fmt.Errorf("-telegram-chat needs the bot token in $%s", *f.telegramTokenEnv)
+		}
+	}
+	return n, nil
+}
+
+func watchCommand(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	safes := fs.String("safes", "", "comma separated safe addresses to watch")
+	safesFile := fs.String("safes-file", "", "file of safe addresses to watch, one per line")
+	workers := fs.Int("workers", DEFAULT_WORKERS, "safes polled concurrently")
+	interval := fs.Duration("interval", 30*time.Second, "polling interval")
+	notify := addNotifierFlags(fs)
+	fs.Parse(args)
+
+	if *safes == "" && *safesFile == "" {
+		return errors.New("usage: watch -safes <SAFE_ADDRESS>[,...]|-safes-file <file> [flags]")
+	}
+	list, err := loadSafeList(*safes, *safesFile)
+	if err != nil {
+		return err
+	}
+	if *interval < time.Second {
+		return errors.New("the -interval must be at least a second")
+	}
+
+	n, err := notify.notifier()
+	if err != nil {
+		return err
+	}
+	return watchSafes(list, *workers, *interval, n)
+}
+
+func autoConfirmCommand(args []string) error {
+	fs := flag.NewFlagSet("auto-confirm", flag.ExitOnError)
+	safes := fs.String("safes", "", "comma separated safe addresses to confirm for")
+	policyFile := fs.String("policy", "", "policy file (json or yaml) every confirmed transaction must satisfy")
+	privKey := secretFlag(fs, "key", "", "owner private key")
+	signerName := fs.String("signer", "", "configured signer to confirm with instead of -key, e.g. a kms signer")
+	signersFile := fs.String("signers", "", "signers config (default: signers.json in the config directory)")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	quorumRPCs := fs.String("quorum-rpcs", "", "comma separated independent RPC endpoints that must agree on the safe state before signing")
+	interval := fs.Duration("interval", 30*time.Second, "polling interval")
+	auditLog := fs.String("audit-log", "", "file every decision is appended to (default: auto-confirm.log in the config directory)")
+	attestationKind := fs.String("attestation", "", "attach an enclave attestation of each confirmation to the audit log: "+ATTESTATION_NITRO+" or "+ATTESTATION_SEV)
+	attestationCmd := fs.String("attestation-cmd", "", "command printing the attestation document for the user data in $ATTESTATION_USER_DATA")
+	notify := addNotifierFlags(fs)
+	fs.Parse(args)
+
+	if *safes == "" || *policyFile == "" || (*privKey == "") == (*signerName == "") {
+		return errors.New("usage: auto-confirm -safes <SAFE_ADDRESS>[,...] -policy <file> -key <KEY>|-signer <name> [flags]")
+	}
+	if *interval < time.Second {
+		return errors.New("the -interval must be at least a second")
+	}
+
+	pol, err := loadPolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+	// without an allowlist any transaction would be signed
+	if len(pol.AllowedDestinations) == 0 {
+		return fmt.Errorf("policy %s has no allowedDestinations, auto-confirm only signs for an allowlist", *policyFile)
+	}
+	n, err := notify.notifier()
+	if err != nil {
+		return err
+	}
+	att, err := newAttester(*attestationKind, *attestationCmd)
+	if err != nil {
+		return err
+	}
+	if *auditLog == "" {
+		*auditLog = configPath("auto-confirm.log")
+	}
+
+	var s signer
+	if *signerName != "" {
+		if s, err = findSigner(*signersFile, *signerName); err != nil {
+			return err
+		}
+	} else {
+		key, err := crypto.HexToECDSA(*privKey)
+		if err != nil {
+			return err
+		}
+		s = &keySigner{key: key}
+	}
+	defer s.Close()
+
+	a := &autoConfirmer{policy: pol, signer: s, notifier: n, rpc: *rpc, quorumRPCs: *quorumRPCs, attester: att, auditLog: *auditLog, evaluated: map[string]bool{}}
+	return a.run(splitList(*safes), *interval)
+}
+
+func ackRequestCommand(args []string) error {
+	fs := flag.NewFlagSet("ack-request", flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	to := fs.String("to", "<RECEIVER_ADDRESS>", "recipient address")
+	amount := fs.String("amount", "", "amount in wei, or in token base units with -token")
+	token := fs.String("token", "", "ERC-20 token of the transfer (default: ETH)")
+	fs.Parse(args)
+
+	if err := checkAddress(*safe); err != nil {
+		return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+	}
+	if err := checkAddress(*to); err != nil {
+		return fmt.Errorf("a valid -to address is required: %w", err)
+	}
+	value, ok := new(big.Int).SetString(*amount, 10)
+	if !ok {
+		return fmt.Errorf("invalid -amount %q", *amount)
+	}
+	var tokenAddr common.Address
+	if *token != "" {
+		if err := checkAddress(*token); err != nil {
+			return fmt.Errorf("invalid -token %q: %w", *token, err)
+		}
+		tokenAddr = common.HexToAddress(*token)
+	}
+
+	chainID, err := serviceChain()
+	if err != nil {
+		return err
+	}
+	challenge := newAckChallenge()
+	fmt.Println("ask the recipient to sign this message (personal_sign) with the key of", common.HexToAddress(*to).Hex()+":")
+	fmt.Println()
+	fmt.Println(ackMessage(common.HexToAddress(*safe), common.HexToAddress(*to), tokenAddr, value, chainID, challenge))
+	fmt.Println()
+	fmt.Println("then propose with -recipient-challenge", challenge, "-recipient-signature <signature>")
+	return nil
+}
+
+func sendNFTCommand(args []string) error {
+	fs := flag.NewFlagSet("send-nft", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	token := fs.String("token", "", "ERC-721 or ERC-1155 token contract")
+	to := fs.String("to", "<RECEIVER_ADDRESS>", "receiver address")
+	id := fs.String("id", "", "token id")
+	amount := fs.String("amount", "1", "number of tokens to transfer (ERC-1155)")
+	standard := fs.String("standard", NFT_AUTO, "token standard: "+NFT_AUTO+" (erc165 detection), "+NFT_ERC721+" or "+NFT_ERC1155)
+	fs.Parse(args)
+
+	safe, err := parseAddress(*flags.safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+	if err := checkAddress(*token); err != nil {
+		return fmt.Errorf("a valid -token address is required: %w", err)
+	}
+	if err := checkAddress(*to); err != nil {
+		return fmt.Errorf("a valid -to address is required: %w", err)
+	}
+	tokenID, ok := new(big.Int).SetString(*id, 0)
+	if !ok {
+		return fmt.Errorf("invalid -id %q", *id)
+	}
+	count, ok := new(big.Int).SetString(*amount, 10)
+	if !ok {
+		return fmt.Errorf("invalid -amount %q", *amount)
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	data, err := buildNFTTransfer(*flags.rpc, safe, common.HexToAddress(*token), common.HexToAddress(*to), tokenID, count, *standard)
+	if err != nil {
+		return err
+	}
+
+	return sendTransaction(*flags.from, *token, *flags.safe, 0, data, 0, *flags.privKey, opts)
+}
+
+func approveCommand(args []string) error {
+	fs := flag.NewFlagSet("approve", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	token := fs.String("token", "", "ERC-20 token contract")
+	spender := fs.String("spender", "", "address allowed to spend the safe's tokens")
+	amount := fs.String("amount", "", "allowance in token base units")
+	unlimited := fs.Bool("unlimited", false, "approve the maximum amount")
+	revoke := fs.Bool("revoke", false, "set the allowance to zero")
+	fs.Parse(args)
+
+	safe, err := parseAddress(*flags.safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+	if err := checkAddress(*token); err != nil {
+		return fmt.Errorf("a valid -token address is required: %w", err)
+	}
+	if err := checkAddress(*spender); err != nil {
+		return fmt.Errorf("a valid -spender address is required: %w", err)
+	}
+
+	var allowance *big.Int
+	switch {
+	case *unlimited && *revoke, (*unlimited || *revoke) && *amount != "":
+		return errors.New("-amount, -unlimited and -revoke are mutually exclusive")
+	case *unlimited:
+		allowance = math.MaxBig256
+	case *revoke:
+		allowance = new(big.Int)
+	default:
+		var ok bool
+		if allowance, ok = new(big.Int).SetString(*amount, 10); !ok || allowance.Sign() < 0 {
+			return fmt.Errorf("invalid -amount %q, or use -unlimited or -revoke", *amount)
+		}
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	data, err := buildApprove(*flags.rpc, safe, common.HexToAddress(*token), common.HexToAddress(*spender), allowance)
+	if err != nil {
+		return err
+	}
+
+	return sendTransaction(*flags.from, *token, *flags.safe, 0, data, 0, *flags.privKey, opts)
+}
+
+func setGuardCommand(args []string) error {
+	fs := flag.NewFlagSet("set-guard", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	guard := fs.String("guard", "", "guard address (zero address removes the guard)")
+	fs.Parse(args)
+
+	if err := checkAddress(*guard); err != nil {
+		return fmt.Errorf("a valid -guard address is required: %w", err)
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	data, err := buildSetGuard(*flags.safe, *flags.rpc, common.HexToAddress(*guard))
+	if err != nil {
+		return err
+	}
+
+	return sendTransaction(*flags.from, *flags.safe, *flags.safe, 0, data, 0, *flags.privKey, opts)
+}
+
+func setFallbackHandlerCommand(args []string) error {
+	fs := flag.NewFlagSet("set-fallback-handler", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	handler := fs.String("handler", "", "fallback handler address (zero address removes the handler)")
+	fs.Parse(args)
+
+	if err := checkAddress(*handler); err != nil {
+		return fmt.Errorf("a valid -handler address is required: %w", err)
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	data, err := buildSetFallbackHandler(*flags.safe, *flags.rpc, common.HexToAddress(*handler))
+	if err != nil {
+		return err
+	}
+
+	return sendTransaction(*flags.from, *flags.safe, *flags.safe, 0, data, 0, *flags.privKey, opts)
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseAddressList(list string) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if err := checkAddress(item); err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", item, err)
+		}
+		addresses = append(addresses, common.HexToAddress(item))
+	}
+	return addresses, nil
+}
+
+func deployCommand(args []string) error {
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+	privKey := secretFlag(fs, "key", "<DEPLOYER_PRIVATE_KEY>", "deployer private key")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	owners := fs.String("owners", "", "comma separated owner addresses")
+	threshold := fs.Int64("threshold", 1, "number of required confirmations")
+	fallbackHandler := fs.String("fallback-handler", ZERO_ADDR, "fallback handler address (canonical: "+contractAddress(CONTRACT_FALLBACK_HANDLER).Hex()+")")
+	saltNonce := fs.String("salt-nonce", "0", "salt nonce for the CREATE2 address")
+	factory := fs.String("factory", contractAddress(CONTRACT_PROXY_FACTORY).Hex(), "safe proxy factory address")
+	singleton := fs.String("singleton", contractAddress(CONTRACT_SAFE).Hex(), "safe singleton address")
+	l2 := fs.Bool("l2", false, "use the L2 singleton ("+contractAddress(CONTRACT_SAFE_L2).Hex()+")")
+	modules := fs.String("modules", "", "comma separated modules enabled during setup")
+	guard := fs.String("guard", "", "guard set during setup")
+	setupMultiSend := fs.String("setup-multisend", SETUP_MULTI_SEND, "MultiSend (1.4.1 or later) delegatecalled by setup to enable the modules and set the guard")
+	fund := fs.String("fund", "", "amount in wei the deployer sends to the safe once deployed")
+	indexTimeout := fs.Duration("index-timeout", 5*time.Minute, "how long to wait for the transaction service to index the safe")
+	feeFlags := addFeeFlags(fs)
+	fs.Parse(args)
+
+	fees, err := feeFlags.options()
+	if err != nil {
+		return err
+	}
+
+	ownerList, err := parseAddressList(*owners)
+	if err != nil {
+		return err
+	}
+
+	salt, ok := new(big.Int).SetString(*saltNonce, 10)
+	if !ok || salt.Sign() < 0 {
+		return fmt.Errorf("invalid salt nonce %q", *saltNonce)
+	}
+
+	for _, addr := range []string{*fallbackHandler, *factory, *singleton, *setupMultiSend} {
+		if err := checkAddress(addr); err != nil {
+			return fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+	}
+
+	moduleList, err := parseAddressList(*modules)
+	if err != nil {
+		return fmt.Errorf("invalid -modules: %w", err)
+	}
+	var guardAddr common.Address
+	if *guard != "" {
+		if guardAddr, err = parseAddress(*guard); err != nil {
+			return fmt.Errorf("invalid -guard: %w", err)
+		}
+	}
+	var funding *big.Int
+	if *fund != "" {
+		if funding, ok = new(big.Int).SetString(*fund, 10); !ok || funding.Sign() < 0 {
+			return fmt.Errorf("invalid -fund %q, expected an amount in wei", *fund)
+		}
+	}
+
+	d := &safeDeployment{
+		Factory:         common.HexToAddress(*factory),
+		Singleton:       common.HexToAddress(*singleton),
+		Owners:          ownerList,
+		Threshold:       *threshold,
+		FallbackHandler: common.HexToAddress(*fallbackHandler),
+		SaltNonce:       salt,
+		Modules:         moduleList,
+		Guard:           guardAddr,
+		SetupMultiSend:  common.HexToAddress(*setupMultiSend),
+		Funding:         funding,
+	}
+	if *l2 {
+		d.Singleton = contractAddress(CONTRACT_SAFE_L2)
+	}
+
+	return deploySafe(*rpc, *privKey, d, *indexTimeout, fees)
+}
+
+func executeCommand(args []string) error {
+	fs := flag.NewFlagSet("execute", flag.ExitOnError)
+	safeTxHash := fs.String("safe-tx-hash", "", "hash of the transaction to execute")
+	txFile := fs.String("tx", "", "execute this transaction file with the signature files given as arguments, without the transaction service")
+	privKey := secretFlag(fs, "key", "<EXECUTOR_PRIVATE_KEY>", "executor private key")
+	relay := fs.String("relay", "", "execute through a relay instead of the -key account: "+RELAY_SAFE+" (sponsored, limited per safe) or "+RELAY_GELATO+" (1Balance, $GELATO_API_KEY)")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	confirmationsFile := fs.String("confirmations", "", "confirmation depth config (default: confirmations.json in the config dir)")
+	usdValue := fs.Float64("usd-value", -1, "usd value of the transaction, used to pick the confirmation depth (default: native value)")
+	usdPrice := fs.Float64("usd-price", 0, "usd price of the native coin (default: from the confirmations config)")
+	schedule := fs.Bool("schedule", false, "wait for a cheap base fee before executing")
+	gasPercentile := fs.Float64("gas-percentile", 25, "with -schedule, target base fee percentile of recent history")
+	maxWait := fs.Duration("max-wait", 6*time.Hour, "with -schedule, execute anyway after this long")
+	historyBlocks := fs.Uint64("history-blocks", 7200, "with -schedule, number of blocks of fee history to analyze")
+	hooksFile := fs.String("hooks", "", "hooks config (default: hooks.json in the config dir)")
+	wait := fs.Bool("wait", true, "wait for the receipt and report the execution event, gas used and any revert reason; -wait=false returns once sent")
+	feeFlags := addFeeFlags(fs)
+	fs.Parse(args)
+
+	fees, err := feeFlags.options()
+	if err != nil {
+		return err
+	}
+	confirmations, err := loadConfirmationsConfig(*confirmationsFile)
+	if err != nil {
+		return err
+	}
+	hooks, err := loadHooksConfig(*hooksFile)
+	if err != nil {
+		return err
+	}
+
+	if *schedule {
+		if err := waitForGasWindow(*rpc, *historyBlocks, *gasPercentile, *maxWait); err != nil {
+			return err
+		}
+	}
+
+	opts := &executeOptions{
+		rpc:           *rpc,
+		privKey:       *privKey,
+		relay:         *relay,
+		confirmations: confirmations,
+		usdValue:      *usdValue,
+		usdPrice:      *usdPrice,
+		hooks:         hooks,
+		fees:          fees,
+		wait:          *wait,
+	}
+	if *txFile != "" {
+		return executeTransactionFile(*txFile, fs.Args(), opts)
+	}
+	return executeTransaction(*safeTxHash, opts)
+}
+
+func receiptCommand(args []string) error {
+	fs := flag.NewFlagSet("receipt", flag.ExitOnError)
+	txHash := fs.String("tx-hash", "", "hash of the execution transaction")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	fs.Parse(args)
+
+	hash, err := hexutil.Decode(*txHash)
+	if err != nil || len(hash) != 32 {
+		return fmt.Errorf("invalid -tx-hash %q", *txHash)
+	}
+	return showReceipt(*rpc, common.BytesToHash(hash))
+}
+
+func speedupCommand(args []string) error {
+	fs := flag.NewFlagSet("speedup", flag.ExitOnError)
+	txHash := fs.String("tx-hash", "", "hash of the pending transaction to replace")
+	privKey := secretFlag(fs, "key", "<SENDER_PRIVATE_KEY>", "private key of the pending transaction's sender")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	bump := fs.Float64("bump", 12.5, "percent to raise the fees by, at least the current suggestion")
+	wait := fs.Bool("wait", true, "wait for the original or its replacement to be mined")
+	feeFlags := addFeeFlags(fs)
+	fs.Parse(args)
+
+	hash, err := hexutil.Decode(*txHash)
+	if err != nil || len(hash) != 32 {
+		return fmt.Errorf("invalid -tx-hash %q", *txHash)
+	}
+	fees, err := feeFlags.options()
+	if err != nil {
+		return err
+	}
+	key, err := crypto.HexToECDSA(*privKey)
+	if err != nil {
+		return err
+	}
+	return speedUp(*rpc, key, common.BytesToHash(hash), *bump, fees, *wait)
+}
+
+func verifyReviewCommand(args []string) error {
+	fs := flag.NewFlagSet("verify-review", flag.ExitOnError)
+	file := fs.String("file", "", "review artifact json file")
+	fs.Parse(args)
+
+	reviewer, err := verifyReviewArtifact(*file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("review artifact is valid, signed by", reviewer.Hex())
+	return nil
+}
+
+func manifestCommand(args []string) error {
+	fs := flag.NewFlagSet("manifest", flag.ExitOnError)
+	file := fs.String("file", "", "batch manifest file")
+	root := fs.String("root", "", "expected merkle root, as published by the coordinator")
+	safeTxHash := fs.String("safe-tx-hash", "", "print the inclusion proof of this proposal")
+	fs.Parse(args)
+
+	m, err := loadManifest(*file)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyManifest(m, *root); err != nil {
+		return err
+	}
+
+	fmt.Println("manifest is valid:", len(m.Entries), "proposals, root", m.MerkleRoot)
+	for _, entry := range m.Entries {
+		fmt.Println(" ", entry.Safe, entry.Nonce, entry.SafeTxHash)
+	}
+
+	if *safeTxHash != "" {
+		proof, err := manifestProof(m, common.HexToHash(*safeTxHash))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("inclusion proof:")
+		for _, node := range proof {
+			fmt.Println(" ", hexutil.Encode(node))
+		}
+	}
+
+	return nil
+}
+
+func signCommand(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	txFile := fs.String("tx", "", "transaction file (transaction service json format)")
+	privKey := secretFlag(fs, "key", "<SIGNER_PRIVATE_KEY>", "signer private key")
+	out := fs.String("out", "", "signature file to write (default: <safeTxHash>.<owner>.json)")
+	contractOwner := fs.String("contract-owner", "", "sign on behalf of this contract owner (a safe the key owns)")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint, required with -contract-owner")
+	policyFile := fs.String("policy", "", "policy file (json or yaml) the transaction must satisfy before it is signed")
+	fs.Parse(args)
+
+	tx, err := loadSafeTxFile(*txFile)
+	if err != nil {
+		return err
+	}
+
+	typedData, hash, err := fileTypedData(tx, *rpc)
+	if err != nil {
+		return err
+	}
+
+	if tx.SafeTxHash != "" && common.HexToHash(tx.SafeTxHash) != hash {
+		return fmt.Errorf("transaction file declares hash %s but its fields hash to %s", tx.SafeTxHash, hash.Hex())
+	}
+	pol, err := loadPolicyFlag(*policyFile)
+	if err != nil {
+		return err
+	}
+	if err := checkTxPolicy(pol, tx); err != nil {
+		return err
+	}
+
+	key, err := crypto.HexToECDSA(*privKey)
+	if err != nil {
+		return err
+	}
+
+	owner, signature, err := signTransaction(typedData, key, *contractOwner, *rpc)
+	if err != nil {
+		return err
+	}
+
+	sig := detachedSignature{
+		SafeTxHash: hash.Hex(),
+		Owner:      owner.Hex(),
+		Signature:  hexutil.Encode(signature),
+	}
+
+	if *out == "" {
+		*out = sig.SafeTxHash + "." + sig.Owner + ".json"
+	}
+
+	fmt.Println("safeTxHash:", sig.SafeTxHash)
+	fmt.Println("signature written to", *out)
+	return writeDetachedSignature(*out, &sig)
+}
+
+func aggregateCommand(args []string) error {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	txFile := fs.String("tx", "", "transaction file (transaction service json format)")
+	owners := fs.String("owners", "", "comma separated owner addresses (default: read via -rpc, or fetched from the transaction service)")
+	threshold := fs.Int("threshold", 0, "required number of signatures (default: read with the owners)")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint, used to read the owners and verify contract signatures")
+	fs.Parse(args)
+
+	tx, err := loadSafeTxFile(*txFile)
+	if err != nil {
+		return err
+	}
+
+	ownerList, err := parseAddressList(*owners)
+	if err != nil {
+		return err
+	}
+
+	var client EthClient
+	if *rpc != "" {
+		if client, err = dialRPC(*rpc); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+
+	// the chain is authoritative for the owners, the service only when there is no rpc
+	if len(ownerList) == 0 && client != nil {
+		state, err := readSafeState(client, common.HexToAddress(tx.Safe), nil)
+		if err != nil {
+			return err
+		}
+		ownerList = state.Owners
+		if *threshold == 0 {
+			*threshold = int(state.Threshold)
+		}
+	} else if len(ownerList) == 0 {
+		info, err := cachedSafeInfo(tx.Safe)
+		if err != nil {
+			return fmt.Errorf("%w, pass -rpc to read the owners from the chain", err)
+		}
+		if ownerList, err = parseAddressList(strings.Join(info.Owners, ",")); err != nil {
+			return err
+		}
+		if *threshold == 0 {
+			*threshold = int(info.Threshold)
+		}
+	}
+
+	var sigs []*detachedSignature
+	for _, path := range fs.Args() {
+		sig, err := loadDetachedSignature(path)
+		if err != nil {
+			return err
+		}
+		sigs = append(sigs, sig)
+	}
+
+	blob, _, err := aggregateSignatures(tx, sigs, ownerList, *threshold, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(hexutil.Encode(blob))
+	return nil
+}
+
+// prepareConfirmation fetches the transaction to confirm and checks it
+// against its hash and the policy and, when asked, the signer against the
+// chain state, returning the typed data to sign
+func prepareConfirmation(safeTxHash string, signer common.Address, rpc, quorumRPCs, trustedBlock string, pol *policy) (*multisigTxResponse, apitypes.TypedData, common.Hash, error) {
+	tx, err := getMultisigTransaction(safeTxHash)
+	if err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+
+	chainID, version, err := txDomain(tx, nil)
+	if err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+	typedData, err := tx.typedData(chainID, version)
+	if err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+	hash, err := tx.hash(chainID, version)
+	if err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+	if hash != common.HexToHash(safeTxHash) {
+		return nil, apitypes.TypedData{}, common.Hash{}, fmt.Errorf("transaction returned by the service hashes to %s, not %s", hash.Hex(), safeTxHash)
+	}
+	if err := checkTxPolicy(pol, tx); err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+	if err := checkRecipientAck(tx); err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+	hooks, err := loadHooksConfig("")
+	if err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+
+	if rpcs := splitList(quorumRPCs); len(rpcs) > 0 {
+		if err := checkSignerQuorum(rpcs, common.HexToAddress(tx.Safe), signer, tx.Nonce, false); err != nil {
+			return nil, apitypes.TypedData{}, common.Hash{}, err
+		}
+	}
+
+	if trustedBlock != "" {
+		if err := checkSignerVerified(rpc, common.HexToHash(trustedBlock), common.HexToAddress(tx.Safe), signer, tx.Nonce, false); err != nil {
+			return nil, apitypes.TypedData{}, common.Hash{}, err
+		}
+	}
+
+	if err := checkPreSignHooks(hooks.PreSign, "confirm", tx, signer); err != nil {
+		return nil, apitypes.TypedData{}, common.Hash{}, err
+	}
+	return tx, typedData, hash, nil
+}
+
+// confirmingOwner is the owner a confirmation is made as, the contract owner
+// when signing on its behalf
+func confirmingOwner(key *ecdsa.PrivateKey, contractOwner string) common.Address {
+	if contractOwner != "" {
+		return common.HexToAddress(contractOwner)
+	}
+	return crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func confirmCommand(args []string) error {
+	fs := flag.NewFlagSet("confirm", flag.ExitOnError)
+	safeTxHash := fs.String("safe-tx-hash", "", "hash of the transaction to confirm")
+	privKey := secretFlag(fs, "key", "<SIGNER_PRIVATE_KEY>", "signer private key")
+	contractOwner := fs.String("contract-owner", "", "confirm on behalf of this contract owner (a safe the key owns)")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint, required with -contract-owner")
+	quorumRPCs := fs.String("quorum-rpcs", "", "comma separated independent RPC endpoints that must agree on the safe state before signing")
+	trustedBlock := fs.String("trusted-block-hash", "", "hash of a recent block obtained independently, the safe state is proven against it via -rpc before signing")
+	signerName := fs.String("signer", "", "configured signer to confirm with instead of -key, e.g. a walletconnect signer")
+	signersFile := fs.String("signers", "", "signers config (default: signers.json in the config directory)")
+	all := fs.Bool("all", false, "go through every pending transaction of -safe awaiting the signer's confirmation")
+	safe := fs.String("safe", "", "safe address, with -all")
+	fromNonce := fs.Int64("from-nonce", -1, "with -all, only transactions from this nonce on")
+	toNonce := fs.Int64("to-nonce", -1, "with -all, only transactions up to this nonce")
+	proposer := fs.String("proposer", "", "with -all, only transactions proposed by this address")
+	policyFile := fs.String("policy", "", "policy file (json or yaml) the transaction must satisfy before it is signed")
+	fs.Parse(args)
+
+	if *all == (*safeTxHash != "") {
+		return errors.New("usage: confirm -safe-tx-hash <HASH>|-all -safe <SAFE_ADDRESS> [-from-nonce N] [-to-nonce N] [-proposer ADDRESS] [flags]")
+	}
+	pol, err := loadPolicyFlag(*policyFile)
+	if err != nil {
+		return err
+	}
+
+	var owner common.Address
+	var confirm func(safeTxHash string) error
+	if *signerName != "" {
+		if *contractOwner != "" {
+			return errors.New("-contract-owner can't be combined with -signer")
+		}
+		s, err := findSigner(*signersFile, *signerName)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		owner = s.Address()
+		confirm = func(safeTxHash string) error {
+			_, typedData, hash, err := prepareConfirmation(safeTxHash, owner, *rpc, *quorumRPCs, *trustedBlock, pol)
+			if err != nil {
+				return err
+			}
+			signature, err := s.SignTypedData(typedData)
+			if err != nil {
+				return err
+			}
+			return submitConfirmation(hash.Hex(), hexutil.Encode(signature))
+		}
+	} else {
+		key, err := crypto.HexToECDSA(*privKey)
+		if err != nil {
+			return err
+		}
+
+		owner = confirmingOwner(key, *contractOwner)
+		confirm = func(safeTxHash string) error {
+			_, typedData, hash, err := prepareConfirmation(safeTxHash, owner, *rpc, *quorumRPCs, *trustedBlock, pol)
+			if err != nil {
+				return err
+			}
+			_, signature, err := signTransaction(typedData, key, *contractOwner, *rpc)
+			if err != nil {
+				return err
+			}
+			return submitConfirmation(hash.Hex(), hexutil.Encode(signature))
+		}
+	}
+
+	if *all {
+		if err := checkAddress(*safe); err != nil {
+			return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+		}
+		filter := &confirmFilter{fromNonce: *fromNonce, toNonce: *toNonce}
+		if *proposer != "" {
+			addr, err := parseAddress(*proposer)
+			if err != nil {
+				return fmt.Errorf("invalid -proposer: %w", err)
+			}
+			filter.proposer = &addr
+		}
+		return confirmAll(*safe, owner, filter, os.Stdin, confirm)
+	}
+
+	if err := confirm(*safeTxHash); err != nil {
+		return err
+	}
+
+	fmt.Println("confirmed", *safeTxHash, "as", owner.Hex())
+	return nil
+}
+
+func gasAdviceCommand(args []string) error {
+	fs := flag.NewFlagSet("gas-advice", flag.ExitOnError)
+	rpcURL := fs.String("rpc", "", "ethereum RPC endpoint")
+	blocks := fs.Uint64("blocks", 7200, "number of blocks of fee history to analyze")
+	fs.Parse(args)
+
+	if *rpcURL == "" {
+		return errors.New("an -rpc endpoint is required")
+	}
+
+	client, err := dialRawRPC(*rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	history, err := fetchGasHistory(client, *blocks)
+	if err != nil {
+		return err
+	}
+
+	latest, err := getHeader(client, "latest")
+	if err != nil {
+		return err
+	}
+
+	printGasAdvice(history, latest.BaseFee.ToInt())
+	return nil
+}
+
+func approveHashCommand(args []string) error {
+	fs := flag.NewFlagSet("approve-hash", flag.ExitOnError)
+	safeTxHash := fs.String("safe-tx-hash", "", "hash of the transaction to approve, fetched from the transaction service")
+	txFile := fs.String("tx", "", "transaction file (transaction service json format), instead of -safe-tx-hash")
+	privKey := secretFlag(fs, "key", "<OWNER_PRIVATE_KEY>", "owner private key, also pays for the transaction")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	feeFlags := addFeeFlags(fs)
+	fs.Parse(args)
+
+	fees, err := feeFlags.options()
+	if err != nil {
+		return err
+	}
+
+	var tx *multisigTxResponse
+	if *txFile != "" {
+		tx, err = loadSafeTxFile(*txFile)
+	} else {
+		tx, err = getMultisigTransaction(*safeTxHash)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, hash, err := fileTypedData(tx, *rpc)
+	if err != nil {
+		return err
+	}
+	if *safeTxHash != "" && hash != common.HexToHash(*safeTxHash) {
+		return fmt.Errorf("transaction hashes to %s, not %s", hash.Hex(), *safeTxHash)
+	}
+
+	return approveHash(*rpc, *privKey, common.HexToAddress(tx.Safe), hash, fees)
+}
+
+// registered separately as resuming dispatches through commands
+func init() {
+	commands["resume"] = resumeCommand
+}
+
+func resumeCommand(args []string) error {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	privKey := secretFlag(fs, "key", "", "signer private key, only needed if the operation had not signed yet")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: resume [-key <SIGNER_PRIVATE_KEY>] <operation id>")
+	}
+
+	state, err := loadOperationState(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return resumeOperation(state, *privKey)
+}
+
+func safeInfoCommand(args []string) error {
+	fs := flag.NewFlagSet("safe-info", flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint to cross-check the service data against")
+	fs.Parse(args)
+
+	if err := checkAddress(*safe); err != nil {
+		return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+	}
+	info, err := getSafeInfo(*safe)
+	if err != nil {
+		return err
+	}
+
+	var onchain *onchainSafeInfo
+	if *rpc != "" {
+		client, err := dialRPC(*rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if onchain, err = readSafeInfoOnchain(client, common.HexToAddress(*safe)); err != nil {
+			return err
+		}
+	}
+
+	if mismatches := printSafeInfo(info, onchain); mismatches > 0 {
+		return fmt.Errorf("%d fields of the transaction service differ from the onchain state", mismatches)
+	}
+	return nil
+}
+
+func verifyCommand(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint to read the owners from and check contract and approved-hash signatures")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: verify [-rpc <RPC>] <safeTxHash>")
+	}
+
+	mismatches, err := verifyProposal(fs.Arg(0), *rpc)
+	if err != nil {
+		return err
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d checks failed, the transaction service data can't be trusted", mismatches)
+	}
+	return nil
+}
+
+func balancesCommand(args []string) error {
+	fs := flag.NewFlagSet("balances", flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	safes := fs.String("safes", "", "comma separated safe addresses, instead of -safe")
+	safesFile := fs.String("safes-file", "", "file of safe addresses, one per line")
+	workers := fs.Int("workers", DEFAULT_WORKERS, "safes queried concurrently")
+	asJSON := fs.Bool("json", false, "print the balances and collectibles as json")
+	fs.Parse(args)
+
+	if *safes == "" && *safesFile == "" {
+		assets, err := getSafeAssets(*safe)
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			return printAssetsJSON(assets)
+		}
+		printAssets(assets)
+		return nil
+	}
+
+	list, err := loadSafeList(*safes, *safesFile)
+	if err != nil {
+		return err
+	}
+	assets := make([]*safeAssets, len(list))
+	errs := forEachSafe(list, *workers, func(i int, safe string) error {
+		var err error
+		assets[i], err = getSafeAssets(safe)
+		return err
+	})
+
+	if *asJSON {
+		bySafe := map[string]*safeAssets{}
+		for i, safe := range list {
+			if errs[i] == nil {
+				bySafe[safe] = assets[i]
+			}
+		}
+		if err := printAssetsJSON(bySafe); err != nil {
+			return err
+		}
+	} else {
+		for i, safe := range list {
+			if errs[i] == nil {
+				fmt.Println(safe + ":")
+				printAssets(assets[i])
+			}
+		}
+	}
+	return safeErrors(list, errs)
+}
+
+func pendingCommand(args []string) error {
+	fs := flag.NewFlagSet("pending", flag.ExitOnError)
+	safes := fs.String("safes", "", "comma separated safe addresses")
+	safesFile := fs.String("safes-file", "", "file of safe addresses, one per line")
+	workers := fs.Int("workers", DEFAULT_WORKERS, "safes queried concurrently")
+	fs.Parse(args)
+
+	if *safes == "" && *safesFile == "" {
+		return errors.New("usage: pending -safes <SAFE_ADDRESS>[,...]|-safes-file <file> [-workers N]")
+	}
+	list, err := loadSafeList(*safes, *safesFile)
+	if err != nil {
+		return err
+	}
+
+	nonces := make([]int64, len(list))
+	pending := make([][]multisigTxResponse, len(list))
+	errs := forEachSafe(list, *workers, func(i int, safe string) error {
+		nonce, err := getSafeNonce(safe)
+		if err != nil {
+			return err
+		}
+		nonces[i] = *nonce
+		pending[i], err = getPendingTransactions(safe, *nonce)
+		return err
+	})
+
+	for i, safe := range list {
+		if errs[i] == nil {
+			printPending(safe, nonces[i], pending[i])
+		}
+	}
+	return safeErrors(list, errs)
+}
+
+func queueCommand(args []string) error {
+	fs := flag.NewFlagSet("queue", flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	fs.Parse(args)
+
+	if err := checkAddress(*safe); err != nil {
+		return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+	}
+	info, err := getSafeInfo(*safe)
+	if err != nil {
+		return err
+	}
+	pending, err := getPendingTransactions(*safe, info.Nonce)
+	if err != nil {
+		return err
+	}
+
+	printQueue(info, buildQueue(info.Nonce, pending))
+	return nil
+}
+
+func delegatesCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "add" && args[0] != "remove") {
+		return errors.New("usage: delegates list|add|remove [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("delegates "+action, flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	delegateAddr := fs.String("delegate", "", "delegate address")
+	label := fs.String("label", "", "label of the delegate")
+	privKey := secretFlag(fs, "key", "<OWNER_PRIVATE_KEY>", "owner private key signing the delegate message (or the delegate key to remove itself)")
+	fs.Parse(args[1:])
+
+	if err := checkAddress(*safe); err != nil {
+		return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+	}
+	if action == "list" {
+		delegates, err := listDelegates(*safe)
+		if err != nil {
+			return err
+		}
+		for _, d := range delegates {
+			fmt.Println(d.Delegate, "delegator", d.Delegator, d.Label)
+		}
+		return nil
+	}
+
+	if err := checkAddress(*delegateAddr); err != nil {
+		return fmt.Errorf("invalid -delegate %q: %w", *delegateAddr, err)
+	}
+
+	key, err := crypto.HexToECDSA(*privKey)
+	if err != nil {
+		return err
+	}
+
+	if action == "add" {
+		if err := addDelegate(*safe, common.HexToAddress(*delegateAddr), *label, key); err != nil {
+			return err
+		}
+		fmt.Println("added delegate", common.HexToAddress(*delegateAddr).Hex())
+		return nil
+	}
+
+	if err := removeDelegate(*safe, common.HexToAddress(*delegateAddr), key); err != nil {
+		return err
+	}
+	fmt.Println("removed delegate", common.HexToAddress(*delegateAddr).Hex())
+	return nil
+}
+
+func keysCommand(args []string) error {
+	if len(args) > 0 && args[0] == "derive" {
+		return keysDeriveCommand(args[1:])
+	}
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: keys check|derive [flags]")
+	}
+
+	fs := flag.NewFlagSet("keys check", flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	signersFile := fs.String("signers", "", "signers config (default: signers.json in the config directory)")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint to read the owners from (default: transaction service)")
+	fs.Parse(args[1:])
+
+	if err := checkAddress(*safe); err != nil {
+		return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+	}
+	configs, err := loadSignersConfig(*signersFile)
+	if err != nil {
+		return err
+	}
+	if len(configs) == 0 {
+		return fmt.Errorf("no signers configured in %s", configPath("signers.json"))
+	}
+
+	var owners []common.Address
+	if *rpc != "" {
+		client, err := dialRPC(*rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		state, err := readSafeState(client, common.HexToAddress(*safe), nil)
+		if err != nil {
+			return err
+		}
+		owners = state.Owners
+	} else {
+		info, err := cachedSafeInfo(*safe)
+		if err != nil {
+			return err
+		}
+		owners = checksummed(info.Owners)
+	}
+
+	if failed := checkSigners(configs, owners); failed > 0 {
+		return fmt.Errorf("%d of %d signers failed the check", failed, len(configs))
+	}
+	return nil
+}
+
+func keysDeriveCommand(args []string) error {
+	fs := flag.NewFlagSet("keys derive", flag.ExitOnError)
+	mnemonicEnv := fs.String("mnemonic-env", "", "environment variable holding the mnemonic (default: prompt for it)")
+	passphraseEnv := fs.String("passphrase-env", "", "environment variable holding the BIP-39 passphrase, if any")
+	path := fs.String("path", DEFAULT_HD_PATH, "derivation path of the first account")
+	count := fs.Int("count", 5, "number of accounts to list")
+	fs.Parse(args)
+
+	return listDerivedAddresses(*mnemonicEnv, *path, *passphraseEnv, *count)
+}
+
+func proxiesCommand(args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		records, err := loadProxyRecords()
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			fmt.Printf("%s %s proxy, implementation %s, code hash %s, recorded %s\n", r.Proxy, r.Kind, r.Implementation, r.CodeHash, r.RecordedAt)
+		}
+		return nil
+	}
+	if len(args) == 0 || args[0] != "pin" {
+		return errors.New("usage: proxies list|pin [flags]")
+	}
+
+	fs := flag.NewFlagSet("proxies pin", flag.ExitOnError)
+	address := fs.String("address", "", "proxy address")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	fs.Parse(args[1:])
+
+	if err := checkAddress(*address); err != nil {
+		return fmt.Errorf("a valid -address is required: %w", err)
+	}
+	proxy := common.HexToAddress(*address)
+
+	client, err := dialRPC(*rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	impl, err := resolveProxy(client, proxy)
+	if err != nil {
+		return err
+	}
+	if impl == nil {
+		return fmt.Errorf("%s is not a recognized proxy", proxy.Hex())
+	}
+
+	records, err := loadProxyRecords()
+	if err != nil {
+		return err
+	}
+	if err := saveProxyRecords(recordProxy(records, proxy, impl)); err != nil {
+		return err
+	}
+	fmt.Printf("recorded %s as the implementation of %s proxy %s\n", impl.Implementation.Hex(), impl.Kind, proxy.Hex())
+	return nil
+}
+
+func selfTestCommand(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	opts := &selfTestOptions{}
+	fs.StringVar(&opts.safe, "safe", "<SAFE_ADDRESS>", "safe address")
+	fs.StringVar(&opts.rpc, "rpc", "", "ethereum RPC endpoint")
+	fs.StringVar(&opts.signersFile, "signers", "", "signers config (default: signers.json in the config directory)")
+	fs.StringVar(&opts.policyFile, "policy", "", "policy file (json)")
+	fs.Parse(args)
+
+	checks := runSelfTest(opts)
+	if failed := printSelfTest(checks); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+func signMessageCommand(args []string) error {
+	fs := flag.NewFlagSet("sign-message", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	text := fs.String("message", "", "text message to sign (EIP-191)")
+	typedDataFile := fs.String("typed-data", "", "EIP-712 typed data file to sign, instead of -message")
+	onchain := fs.Bool("onchain", false, "propose a SignMessageLib delegatecall marking the message as signed onchain, instead of collecting offchain signatures")
+	fs.Parse(args)
+
+	message := &dappMessage{Text: *text}
+	if *typedDataFile != "" {
+		typedData, err := loadTypedData(*typedDataFile)
+		if err != nil {
+			return err
+		}
+		message.TypedData = typedData
+	} else if *text == "" {
+		return errors.New("either -message or -typed-data is required")
+	}
+
+	if *onchain {
+		opts, err := flags.options()
+		if err != nil {
+			return err
+		}
+		data, err := signMessageCall(message)
+		if err != nil {
+			return err
+		}
+		return sendTransaction(*flags.from, contractAddress(CONTRACT_SIGN_MESSAGE_LIB).Hex(), *flags.safe, 0, data, 1, *flags.privKey, opts)
+	}
+
+	key, err := crypto.HexToECDSA(*flags.privKey)
+	if err != nil {
+		return err
+	}
+	return signSafeMessageOffchain(*flags.rpc, *flags.safe, message, key)
+}
+
+func ceremonyCommand(args []string) error {
+	fs := flag.NewFlagSet("ceremony", flag.ExitOnError)
+	safeTxHash := fs.String("safe-tx-hash", "", "hash of the transaction to confirm")
+	privKey := secretFlag(fs, "key", "<SIGNER_PRIVATE_KEY>", "signer private key")
+	contractOwner := fs.String("contract-owner", "", "confirm on behalf of this contract owner (a safe the key owns)")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint, required with -contract-owner")
+	quorumRPCs := fs.String("quorum-rpcs", "", "comma separated independent RPC endpoints that must agree on the safe state before signing")
+	trustedBlock := fs.String("trusted-block-hash", "", "hash of a recent block obtained independently, the safe state is proven against it via -rpc before signing")
+	auditLog := fs.String("audit-log", "", "file the ceremony steps are appended to (default: audit.log in the config directory)")
+	report := fs.String("report", "", "ceremony report file (default: ceremony-<safeTxHash>.md)")
+	policyFile := fs.String("policy", "", "policy file (json or yaml) the transaction must satisfy before it is signed")
+	fs.Parse(args)
+
+	key, err := crypto.HexToECDSA(*privKey)
+	if err != nil {
+		return err
+	}
+	pol, err := loadPolicyFlag(*policyFile)
+	if err != nil {
+		return err
+	}
+
+	tx, typedData, hash, err := prepareConfirmation(*safeTxHash, confirmingOwner(key, *contractOwner), *rpc, *quorumRPCs, *trustedBlock, pol)
+	if err != nil {
+		return err
+	}
+
+	if *auditLog == "" {
+		*auditLog = configPath("audit.log")
+	}
+	if *report == "" {
+		*report = "ceremony-" + hash.Hex() + ".md"
+	}
+	return runCeremony(tx, typedData, hash, key, *contractOwner, *rpc, *auditLog, *report)
+}
+
+func networksCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "show" && args[0] != "update") {
+		return errors.New("usage: networks show|update [flags]")
+	}
+
+	fs := flag.NewFlagSet("networks "+args[0], flag.ExitOnError)
+	if args[0] == "show" {
+		chainID := fs.Int64("chain", 0, "only show this chain id")
+		fs.Parse(args[1:])
+		return printNetworks(*chainID)
+	}
+
+	tokenList := fs.String("token-list", TOKEN_LIST_URL, "token list to take the tokens of each network from")
+	selectors := fs.String("selectors", "", "comma separated method selectors to add to the 4byte snapshot")
+	out := fs.String("out", "", "file to write the bundle to, for copying to an air-gapped machine (default: networks.json in the config directory)")
+	fs.Parse(args[1:])
+
+	var extra []string
+	if *selectors != "" {
+		extra = strings.Split(*selectors, ",")
+	}
+	return updateNetworks(*tokenList, extra, *out)
+}
+
+func addressCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "add" && args[0] != "list" && args[0] != "remove") {
+		return errors.New("usage: address add|list|remove [flags]")
+	}
+
+	entries, err := loadAddressBook()
+	if err != nil {
+		return err
+	}
+	if args[0] == "list" {
+		for _, e := range entries {
+			fmt.Println(e.Address, e.Label)
+		}
+		return nil
+	}
+
+	fs := flag.NewFlagSet("address "+args[0], flag.ExitOnError)
+	address := fs.String("address", "", "address to add or remove")
+	label := fs.String("label", "", "label shown instead of the address")
+	fs.Parse(args[1:])
+
+	if err := checkAddress(*address); err != nil {
+		return fmt.Errorf("a valid -address is required: %w", err)
+	}
+	addr := common.HexToAddress(*address)
+
+	if args[0] == "add" {
+		entries, err = addAddress(entries, addr, *label)
+	} else {
+		entries, err = removeAddress(entries, addr)
+	}
+	if err != nil {
+		return err
+	}
+	return saveAddressBook(entries)
+}
+
+func benchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "test safe to queue the synthetic proposals on")
+	privKey := secretFlag(fs, "key", "<PROPOSER_PRIVATE_KEY>", "owner or delegate key proposing the synthetic transactions")
+	confirmKey := secretFlag(fs, "confirm-key", "", "key of another owner confirming each proposal, to load the confirmation endpoint too")
+	requests := fs.Int("requests", 100, "number of proposals")
+	concurrency := fs.Int("concurrency", DEFAULT_WORKERS, "number of requests in flight")
+	nonceOffset := fs.Int64("nonce-offset", 1000, "propose from this many nonces past the safe nonce, away from real transactions")
+	allowDefault := fs.Bool("allow-default-service", false, "allow loading the public transaction service, rather than the -service of a staging deployment")
+	fs.Parse(args)
+
+	if serviceURL == DEFAULT_SERVICE_URL && !*allowDefault {
+		return fmt.Errorf("refusing to load %s, point -service at a staging deployment", serviceURL)
+	}
+	if err := checkAddress(*safe); err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+
+	proposer, err := crypto.HexToECDSA(*privKey)
+	if err != nil {
+		return err
+	}
+	var confirmer *ecdsa.PrivateKey
+	if *confirmKey != "" {
+		if confirmer, err = crypto.HexToECDSA(*confirmKey); err != nil {
+			return err
+		}
+	}
+	return runBench(common.HexToAddress(*safe), proposer, confirmer, *requests, *concurrency, *nonceOffset)
+}
+
+func allowanceCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: allowance set|reset|remove|show|transfer [flags]")
+	}
+
+	fs := flag.NewFlagSet("allowance "+args[0], flag.ExitOnError)
+	module := fs.String("module", contractAddress(CONTRACT_ALLOWANCE_MODULE).Hex(), "allowance module address")
+	delegate := fs.String("delegate", "", "delegate spending within the allowance")
+	token := fs.String("token", ZERO_ADDR, "token of the allowance, the zero address for the native coin")
+
+	switch args[0] {
+	case "set", "reset", "remove":
+		flags := addCommonFlags(fs)
+		amount := fs.String("amount", "", "with set, allowance in token base units")
+		resetMinutes := fs.Uint64("reset-minutes", 0, "with set, refill the allowance every this many minutes (default: one-off)")
+		resetBase := fs.Uint64("reset-base", 0, "with set, start of the first period in minutes since the epoch (default: now)")
+		allTokens := fs.Bool("all-tokens", false, "with remove, remove the delegate with all its allowances")
+		fs.Parse(args[1:])
+
+		moduleAddr, err := parseAddress(*module)
+		if err != nil {
+			return fmt.Errorf("invalid -module: %w", err)
+		}
+		safeAddr, err := parseAddress(*flags.safe)
+		if err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+		delegateAddr, err := parseAddress(*delegate)
+		if err != nil {
+			return fmt.Errorf("a valid -delegate is required: %w", err)
+		}
+		tokenAddr, err := parseAddress(*token)
+		if err != nil {
+			return fmt.Errorf("invalid -token: %w", err)
+		}
+		opts, err := flags.options()
+		if err != nil {
+			return err
+		}
+
+		var txs []multiSendTx
+		switch {
+		case args[0] == "set":
+			value, ok := new(big.Int).SetString(*amount, 10)
+			if !ok {
+				return fmt.Errorf("invalid -amount %q", *amount)
+			}
+			client, err := dialRPC(*flags.rpc)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+			if *resetMinutes > 0 && *resetBase == 0 {
+				*resetBase = uint64(time.Now().Unix() / 60)
+			}
+			if txs, err = buildSetAllowance(client, moduleAddr, safeAddr, delegateAddr, tokenAddr, value, *resetMinutes, *resetBase); err != nil {
+				return err
+			}
+		case args[0] == "reset":
+			data, err := encodeCall("resetAllowance(address,address)", delegateAddr, tokenAddr)
+			if err != nil {
+				return err
+			}
+			txs = []multiSendTx{{To: moduleAddr, Value: new(big.Int), Data: data}}
+		case *allTokens:
+			data, err := encodeCall("removeDelegate(address,bool)", delegateAddr, true)
+			if err != nil {
+				return err
+			}
+			txs = []multiSendTx{{To: moduleAddr, Value: new(big.Int), Data: data}}
+		default:
+			data, err := encodeCall("deleteAllowance(address,address)", delegateAddr, tokenAddr)
+			if err != nil {
+				return err
+			}
+			txs = []multiSendTx{{To: moduleAddr, Value: new(big.Int), Data: data}}
+		}
+
+		to, _, data, operation := batchTransaction(txs)
+		return sendTransaction(*flags.from, to.Hex(), *flags.safe, 0, data, operation, *flags.privKey, opts)
+
+	case "show":
+		safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+		fs.Parse(args[1:])
+
+		moduleAddr, err := parseAddress(*module)
+		if err != nil {
+			return fmt.Errorf("invalid -module: %w", err)
+		}
+		safeAddr, err := parseAddress(*safe)
+		if err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+		var delegateAddr *common.Address
+		if *delegate != "" {
+			addr, err := parseAddress(*delegate)
+			if err != nil {
+				return fmt.Errorf("invalid -delegate: %w", err)
+			}
+			delegateAddr = &addr
+		}
+		return showAllowances(*rpc, moduleAddr, safeAddr, delegateAddr)
+
+	case "transfer":
+		safe := fs.String("safe", "<SAFE_ADDRESS>", "safe to transfer from")
+		privKey := secretFlag(fs, "key", "<DELEGATE_PRIVATE_KEY>", "delegate private key, signs and pays for the transfer")
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+		to := fs.String("to", "", "recipient address")
+		amount := fs.String("amount", "", "amount in token base units")
+		feeFlags := addFeeFlags(fs)
+		fs.Parse(args[1:])
+
+		addrs := map[string]*common.Address{}
+		for _, f := range []struct{ name, value string }{{"-module", *module}, {"-safe", *safe}, {"-token", *token}, {"-to", *to}} {
+			addr, err := parseAddress(f.value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", f.name, err)
+			}
+			addrs[f.name] = &addr
+		}
+		value, ok := new(big.Int).SetString(*amount, 10)
+		if !ok {
+			return fmt.Errorf("invalid -amount %q", *amount)
+		}
+		fees, err := feeFlags.options()
+		if err != nil {
+			return err
+		}
+		key, err := crypto.HexToECDSA(*privKey)
+		if err != nil {
+			return err
+		}
+		return allowanceTransfer(*rpc, key, *addrs["-module"], *addrs["-safe"], *addrs["-token"], *addrs["-to"], value, fees)
+
+	default:
+		return errors.New("usage: allowance set|reset|remove|show|transfer [flags]")
+	}
+}
+
+func recoveryCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: recovery setup|cancel|execute|finalize|status [flags]")
+	}
+
+	fs := flag.NewFlagSet("recovery "+args[0], flag.ExitOnError)
+	delay := fs.String("delay", "", "delay modifier holding the recovery")
+
+	switch args[0] {
+	case "setup", "cancel":
+		flags := addCommonFlags(fs)
+		recoverers := fs.String("recoverers", "", "with setup, comma separated recoverer addresses")
+		cooldown := fs.Duration("cooldown", 0, "with setup, time the owners have to cancel a recovery (default: 24h for a new modifier, unchanged with -delay)")
+		expiration := fs.Duration("expiration", 0, "with setup, time a recovery stays executable after its cooldown (default: forever for a new modifier, unchanged with -delay)")
+		salt := fs.Int64("salt", 0, "with setup, salt nonce of a new delay modifier")
+		fs.Parse(args[1:])
+
+		safeAddr, err := parseAddress(*flags.safe)
+		if err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+		opts, err := flags.options()
+		if err != nil {
+			return err
+		}
+		client, err := dialRPC(*flags.rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if args[0] == "cancel" {
+			delayAddr, err := parseAddress(*delay)
+			if err != nil {
+				return fmt.Errorf("a valid -delay is required: %w", err)
+			}
+			data, err := buildCancelRecovery(client, delayAddr)
+			if err != nil {
+				return err
+			}
+			return sendTransaction(*flags.from, delayAddr.Hex(), *flags.safe, 0, data, 0, *flags.privKey, opts)
+		}
+
+		var delayAddr *common.Address
+		if *delay != "" {
+			addr, err := parseAddress(*delay)
+			if err != nil {
+				return fmt.Errorf("invalid -delay: %w", err)
+			}
+			delayAddr = &addr
+		}
+		var recovererAddrs []common.Address
+		if *recoverers != "" {
+			if recovererAddrs, err = parseAddressList(*recoverers); err != nil {
+				return fmt.Errorf("invalid -recoverers: %w", err)
+			}
+		} else if delayAddr == nil {
+			return errors.New("-recoverers is required to set up recovery")
+		}
+
+		txs, deployed, err := buildRecoverySetup(client, safeAddr, delayAddr, recovererAddrs, *cooldown, *expiration, big.NewInt(*salt))
+		if err != nil {
+			return err
+		}
+		fmt.Println("delay modifier:", deployed.Hex())
+		to, _, data, operation := batchTransaction(txs)
+		return sendTransaction(*flags.from, to.Hex(), *flags.safe, 0, data, operation, *flags.privKey, opts)
+
+	case "execute", "finalize":
+		safe := fs.String("safe", "<SAFE_ADDRESS>", "safe to recover")
+		privKey := secretFlag(fs, "key", "<PRIVATE_KEY>", "private key sending the transaction, a recoverer with execute")
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+		oldOwner := fs.String("old-owner", "", "with execute, owner to replace")
+		newOwner := fs.String("new-owner", "", "with execute, owner replacing it")
+		threshold := fs.Int64("threshold", 0, "with execute, new threshold (default: unchanged)")
+		skipExpired := fs.Bool("skip-expired", false, "with finalize, skip expired transactions queued ahead")
+		feeFlags := addFeeFlags(fs)
+		fs.Parse(args[1:])
+
+		delayAddr, err := parseAddress(*delay)
+		if err != nil {
+			return fmt.Errorf("a valid -delay is required: %w", err)
+		}
+		fees, err := feeFlags.options()
+		if err != nil {
+			return err
+		}
+		key, err := crypto.HexToECDSA(*privKey)
+		if err != nil {
+			return err
+		}
+		if args[0] == "finalize" {
+			return executeNextDelayed(*rpc, key, delayAddr, *skipExpired, fees)
+		}
+
+		safeAddr, err := parseAddress(*safe)
+		if err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+		oldAddr, err := parseAddress(*oldOwner)
+		if err != nil {
+			return fmt.Errorf("a valid -old-owner is required: %w", err)
+		}
+		newAddr, err := parseAddress(*newOwner)
+		if err != nil {
+			return fmt.Errorf("a valid -new-owner is required: %w", err)
+		}
+		return queueRecovery(*rpc, key, safeAddr, delayAddr, oldAddr, newAddr, *threshold, fees)
+
+	case "status":
+		safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+		fs.Parse(args[1:])
+
+		safeAddr, err := parseAddress(*safe)
+		if err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+		delayAddr, err := parseAddress(*delay)
+		if err != nil {
+			return fmt.Errorf("a valid -delay is required: %w", err)
+		}
+		return showRecovery(*rpc, safeAddr, delayAddr)
+
+	default:
+		return errors.New("usage: recovery setup|cancel|execute|finalize|status [flags]")
+	}
+}
+
+func zodiacCommand(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: zodiac delay queue|execute|status, zodiac roles exec|check [flags]")
+	}
+
+	fs := flag.NewFlagSet("zodiac "+args[0]+" "+args[1], flag.ExitOnError)
+	modifier := fs.String("modifier", "", "address of the delay or roles modifier")
+
+	switch args[0] + " " + args[1] {
+	case "delay status":
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+		fs.Parse(args[2:])
+		delay, err := parseAddress(*modifier)
+		if err != nil {
+			return fmt.Errorf("a valid -modifier is required: %w", err)
+		}
+		return showDelay(*rpc, delay)
+
+	case "delay execute":
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+		privKey := secretFlag(fs, "key", "<PRIVATE_KEY>", "private key sending the transaction, any key can")
+		skipExpired := fs.Bool("skip-expired", false, "skip expired transactions queued ahead")
+		feeFlags := addFeeFlags(fs)
+		fs.Parse(args[2:])
+		delay, err := parseAddress(*modifier)
+		if err != nil {
+			return fmt.Errorf("a valid -modifier is required: %w", err)
+		}
+		fees, err := feeFlags.options()
+		if err != nil {
+			return err
+		}
+		key, err := crypto.HexToECDSA(*privKey)
+		if err != nil {
+			return err
+		}
+		return executeNextDelayed(*rpc, key, delay, *skipExpired, fees)
+
+	case "delay queue", "roles exec", "roles check":
+		flags := addCommonFlags(fs)
+		direct := fs.Bool("direct", false, "call the modifier from the -key address, a member itself, instead of proposing from the member -safe")
+		to := fs.String("to", "", "address the safe calls through the modifier")
+		value := fs.String("value", "0", "value in wei")
+		data := fs.String("data", "0x", "calldata, hex")
+		delegateCall := fs.Bool("delegatecall", false, "delegatecall -to from the safe")
+		role := fs.Uint("role", 0, "with roles, role of the member to execute with")
+		feeFlags := addFeeFlags(fs)
+		fs.Parse(args[2:])
+
+		modifierAddr, err := parseAddress(*modifier)
+		if err != nil {
+			return fmt.Errorf("a valid -modifier is required: %w", err)
+		}
+		toAddr, err := parseAddress(*to)
+		if err != nil {
+			return fmt.Errorf("a valid -to is required: %w", err)
+		}
+		amount, ok := new(big.Int).SetString(*value, 10)
+		if !ok {
+			return fmt.Errorf("invalid -value %q", *value)
+		}
+		calldata, err := hexutil.Decode(*data)
+		if err != nil {
+			return fmt.Errorf("invalid -data: %w", err)
+		}
+		var operation uint8
+		if *delegateCall {
+			operation = 1
+		}
+		if *role > math.MaxUint16 {
+			return fmt.Errorf("-role %d is out of range", *role)
+		}
+
+		var key *ecdsa.PrivateKey
+		member := common.Address{}
+		if *direct {
+			if key, err = crypto.HexToECDSA(*flags.privKey); err != nil {
+				return err
+			}
+			member = crypto.PubkeyToAddress(key.PublicKey)
+		} else if member, err = parseAddress(*flags.safe); err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+
+		client, err := dialRPC(*flags.rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		var call []byte
+		if args[0] == "roles" {
+			if call, err = buildRoleCall(toAddr, amount, calldata, operation, uint16(*role)); err != nil {
+				return err
+			}
+			if err := checkRolePermission(client, modifierAddr, member, call); err != nil {
+				return err
+			}
+			fmt.Println("role", *role, "of", displayAddress(member), "permits the call")
+			if args[1] == "check" {
+				return nil
+			}
+		} else {
+			var d *delayState
+			if call, d, err = buildDelayQueue(client, modifierAddr, member, toAddr, amount, calldata, operation); err != nil {
+				return err
+			}
+			fmt.Println("the call queues at delay nonce", d.QueueNonce, "and becomes executable after the cooldown of", d.Cooldown)
+		}
+
+		if *direct {
+			fees, err := feeFlags.options()
+			if err != nil {
+				return err
+			}
+			return sendModuleCall(*flags.rpc, key, modifierAddr, call, fees)
+		}
+		opts, err := flags.options()
+		if err != nil {
+			return err
+		}
+		return sendTransaction(*flags.from, modifierAddr.Hex(), *flags.safe, 0, call, 0, *flags.privKey, opts)
+
+	default:
+		return errors.New("usage: zodiac delay queue|execute|status, zodiac roles exec|check [flags]")
+	}
+}
+
+func sweepCommand(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	dest := fs.String("to", "", "destination of all assets, e.g. the safe migrated to")
+	skipNative := fs.Bool("skip-native", false, "leave the native balance in the safe")
+	nfts := fs.Bool("nfts", false, "sweep the collectibles too, needs -rpc to detect their standard")
+	exclude := fs.String("exclude", "", "comma separated token addresses to leave behind")
+	fs.Parse(args)
+
+	safeAddr, err := parseAddress(*flags.safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+	destAddr, err := parseAddress(*dest)
+	if err != nil {
+		return fmt.Errorf("a valid -to is required: %w", err)
+	}
+	if destAddr == safeAddr {
+		return errors.New("-to is the safe itself")
+	}
+	excluded, err := parseAddressList(*exclude)
+	if err != nil {
+		return fmt.Errorf("invalid -exclude: %w", err)
+	}
+	excludeSet := map[common.Address]bool{}
+	for _, token := range excluded {
+		excludeSet[token] = true
+	}
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	assets, err := getSafeAssets(safeAddr.Hex())
+	if err != nil {
+		return err
+	}
+	txs, err := buildSweep(assets, destAddr, *skipNative, excludeSet)
+	if err != nil {
+		return err
+	}
+	if *nfts && len(assets.Collectibles) > 0 {
+		client, err := dialRPC(*flags.rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		transfers, err := buildNFTSweep(client, safeAddr, destAddr, assets.Collectibles, excludeSet)
+		if err != nil {
+			return err
+		}
+		txs = append(txs, transfers...)
+	}
+
+	to, data, operation, err := sweepTransaction(txs)
+	if err != nil {
+		return err
+	}
+	fmt.Println("sweeping", len(txs), "assets to", displayAddress(destAddr))
+	return sendTransaction(*flags.from, to.Hex(), *flags.safe, 0, data, operation, *flags.privKey, opts)
+}
+
+func upgradeCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "propose" && args[0] != "verify") {
+		return errors.New("usage: upgrade propose|verify [flags]")
+	}
+
+	fs := flag.NewFlagSet("upgrade "+args[0], flag.ExitOnError)
+	switch args[0] {
+	case "propose":
+		flags := addCommonFlags(fs)
+		migration := fs.String("migration", "", "SafeMigration contract upgrading 1.3.x safes, its singleton and handler are read from it")
+		l2 := fs.Bool("l2", false, "upgrade to the L2 singleton emitting events for indexers")
+		fs.Parse(args[1:])
+
+		safeAddr, err := parseAddress(*flags.safe)
+		if err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+		var migrationAddr *common.Address
+		if *migration != "" {
+			addr, err := parseAddress(*migration)
+			if err != nil {
+				return fmt.Errorf("invalid -migration: %w", err)
+			}
+			migrationAddr = &addr
+		}
+		opts, err := flags.options()
+		if err != nil {
+			return err
+		}
+
+		client, err := dialRPC(*flags.rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		plan, err := planUpgrade(client, safeAddr, migrationAddr, *l2)
+		if err != nil {
+			return err
+		}
+		fmt.Println("upgrading from", plan.From, "to", plan.To)
+		fmt.Println("singleton:", displayAddress(plan.Singleton))
+		fmt.Println("fallback handler:", displayAddress(plan.Handler))
+		if err := sendTransaction(*flags.from, plan.Target.Hex(), *flags.safe, 0, plan.Data, plan.Operation, *flags.privKey, opts); err != nil {
+			return err
+		}
+		fmt.Printf("once executed, check it with: upgrade verify -safe %s -version %s -singleton %s\n", safeAddr.Hex(), plan.To, plan.Singleton.Hex())
+		return nil
+	}
+
+	safe := fs.String("safe", "<SAFE_ADDRESS>", "safe address")
+	rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+	version := fs.String("version", "", "version the safe must report")
+	singleton := fs.String("singleton", "", "singleton the safe must use")
+	fs.Parse(args[1:])
+
+	safeAddr, err := parseAddress(*safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+	var singletonAddr *common.Address
+	if *singleton != "" {
+		addr, err := parseAddress(*singleton)
+		if err != nil {
+			return fmt.Errorf("invalid -singleton: %w", err)
+		}
+		singletonAddr = &addr
+	}
+	client, err := dialRPC(*rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return verifyUpgrade(client, safeAddr, *version, singletonAddr)
+}
+
+func streamCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "cancel" && args[0] != "preview") {
+		return errors.New("usage: stream create|cancel|preview -lockup <address> [flags]")
+	}
+
+	fs := flag.NewFlagSet("stream "+args[0], flag.ExitOnError)
+	lockup := fs.String("lockup", "", "Sablier v2.1 LockupLinear contract of the stream")
+	if args[0] == "preview" {
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint")
+		id := fs.String("id", "", "stream id")
+		fs.Parse(args[1:])
+
+		lockupAddr, err := parseAddress(*lockup)
+		if err != nil {
+			return fmt.Errorf("a valid -lockup is required: %w", err)
+		}
+		streamID, ok := new(big.Int).SetString(*id, 10)
+		if !ok {
+			return fmt.Errorf("a valid -id is required, got %q", *id)
+		}
+		client, err := dialRPC(*rpc)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		s, err := readStream(client, lockupAddr, streamID)
+		if err != nil {
+			return err
+		}
+		return printStream(client, streamID, s)
+	}
+
+	flags := addCommonFlags(fs)
+	id := fs.String("id", "", "with cancel, id of the stream")
+	asset := fs.String("asset", "", "with create, ERC-20 token streamed")
+	recipient := fs.String("recipient", "", "with create, recipient of the stream")
+	amount := fs.String("amount", "", "with create, deposit in token units, e.g. 1000.5")
+	duration := fs.String("duration", "", "with create, duration of the stream, e.g. 720h or 365d")
+	cliff := fs.String("cliff", "0s", "with create, cliff after the start before which nothing is withdrawable")
+	cancelable := fs.Bool("cancelable", true, "with create, the safe can cancel the stream and get the rest refunded")
+	transferable := fs.Bool("transferable", true, "with create, the recipient can transfer the stream NFT")
+	fs.Parse(args[1:])
+
+	safeAddr, err := parseAddress(*flags.safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+	lockupAddr, err := parseAddress(*lockup)
+	if err != nil {
+		return fmt.Errorf("a valid -lockup is required: %w", err)
+	}
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+	client, err := dialRPC(*flags.rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if args[0] == "cancel" {
+		streamID, ok := new(big.Int).SetString(*id, 10)
+		if !ok {
+			return fmt.Errorf("a valid -id is required, got %q", *id)
+		}
+		call, err := buildStreamCancel(client, safeAddr, lockupAddr, streamID)
+		if err != nil {
+			return err
+		}
+		return sendTransaction(*flags.from, lockupAddr.Hex(), *flags.safe, 0, call, 0, *flags.privKey, opts)
+	}
+
+	p := &streamParams{Lockup: lockupAddr, Cancelable: *cancelable, Transferable: *transferable}
+	if p.Asset, err = parseAddress(*asset); err != nil {
+		return fmt.Errorf("a valid -asset is required: %w", err)
+	}
+	if p.Recipient, err = parseAddress(*recipient); err != nil {
+		return fmt.Errorf("a valid -recipient is required: %w", err)
+	}
+	if p.Duration, err = parseStreamDuration(*duration); err != nil {
+		return fmt.Errorf("a valid -duration is required: %w", err)
+	}
+	if p.Cliff, err = parseStreamDuration(*cliff); err != nil {
+		return fmt.Errorf("invalid -cliff: %w", err)
+	}
+	symbol, decimals, err := tokenDecimals(client, p.Asset)
+	if err != nil {
+		return err
+	}
+	if p.Amount, err = parseTokenAmount(*amount, decimals); err != nil {
+		return fmt.Errorf("invalid -amount: %w", err)
+	}
+
+	txs, err := buildStreamCreate(client, safeAddr, p)
+	if err != nil {
+		return err
+	}
+	previewStreamCreate(p, symbol, decimals)
+	to, _, data, operation := batchTransaction(txs)
+	return sendTransaction(*flags.from, to.Hex(), *flags.safe, 0, data, operation, *flags.privKey, opts)
+}
+
+func actionCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "wrap" && args[0] != "unwrap" && args[0] != "swap") {
+		return errors.New("usage: action wrap|unwrap|swap -amount <amount> [flags]")
+	}
+
+	fs := flag.NewFlagSet("action "+args[0], flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	amount := fs.String("amount", "", "amount in token units, e.g. 1.5")
+	tokenIn := fs.String("token-in", "", "with swap, ERC-20 token sold")
+	tokenOut := fs.String("token-out", "", "with swap, ERC-20 token bought")
+	router := fs.String("router", "", "with swap, Uniswap V2 compatible router, defaults to the router of actions.json")
+	slippage := fs.Uint64("slippage-bps", 50, "with swap, accepted slippage below the quote in basis points")
+	deadline := fs.Duration("deadline", 24*time.Hour, "with swap, time from now the swap must execute within, leave room for the confirmations")
+	fs.Parse(args[1:])
+
+	safeAddr, err := parseAddress(*flags.safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+	config, err := loadActionsConfig()
+	if err != nil {
+		return err
+	}
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+	client, err := dialRPC(*flags.rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var txs []multiSendTx
+	switch args[0] {
+	case "wrap", "unwrap":
+		weth, err := wrappedNative(config)
+		if err != nil {
+			return err
+		}
+		value, err := parseTokenAmount(*amount, 18)
+		if err != nil {
+			return fmt.Errorf("invalid -amount: %w", err)
+		}
+		if args[0] == "wrap" {
+			txs, err = buildWrap(client, safeAddr, weth, value)
+			fmt.Println("wrap", formatWei(value), "into WETH", displayAddress(weth))
+		} else {
+			txs, err = buildUnwrap(client, safeAddr, weth, value)
+			fmt.Println("unwrap", formatUnits(value, 18, display.Precision), "WETH", displayAddress(weth))
+		}
+		if err != nil {
+			return err
+		}
+
+	case "swap":
+		if *router == "" {
+			*router = config.Router
+		}
+		routerAddr, err := parseAddress(*router)
+		if err != nil {
+			return fmt.Errorf("a valid -router or router in %s is required: %w", configPath("actions.json"), err)
+		}
+		in, err := parseAddress(*tokenIn)
+		if err != nil {
+			return fmt.Errorf("a valid -token-in is required: %w", err)
+		}
+		out, err := parseAddress(*tokenOut)
+		if err != nil {
+			return fmt.Errorf("a valid -token-out is required: %w", err)
+		}
+		_, decimals, err := tokenDecimals(client, in)
+		if err != nil {
+			return err
+		}
+		amountIn, err := parseTokenAmount(*amount, decimals)
+		if err != nil {
+			return fmt.Errorf("invalid -amount: %w", err)
+		}
+
+		q, err := quoteSwap(client, routerAddr, in, out, amountIn, *slippage)
+		if err != nil {
+			return err
+		}
+		q.Deadline = time.Now().Add(*deadline)
+		if txs, err = buildSwap(client, safeAddr, q); err != nil {
+			return err
+		}
+		if err := previewSwap(client, q); err != nil {
+			return err
+		}
+	}
+
+	to, data, operation := multiSendTransaction(txs)
+	return sendTransaction(*flags.from, to.Hex(), *flags.safe, 0, data, operation, *flags.privKey, opts)
+}
+
+func runCommand(args []string) error {
+	if len(args) == 0 || args[0] == "-list" {
+		templates, err := listTemplates()
+		if err != nil {
+			return err
+		}
+		if len(templates) == 0 {
+			fmt.Println("no templates in", templatesDir())
+		}
+		for _, t := range templates {
+			printTemplate(t)
+		}
+		return nil
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return errors.New("usage: run <template> [-param NAME=value ...] [flags], run -list")
+	}
+
+	t, err := loadTemplate(args[0])
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("run "+t.Name, flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	params := varFlags{}
+	fs.Var(params, "param", "NAME=value of a template parameter, repeatable")
+	show := fs.Bool("show", false, "print the parameters of the template instead of running it")
+	fs.Parse(args[1:])
+
+	if *show {
+		printTemplate(t)
+		return nil
+	}
+	resolver, err := templateVariables(t, params)
+	if err != nil {
+		return err
+	}
+	resolver.builtin["SAFE"] = common.HexToAddress(*flags.safe).Hex()
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	var client EthClient
+	if *flags.rpc != "" {
+		if client, err = dialRPC(*flags.rpc); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+	txs, _, err := buildCalls(t.batch(), resolver, client)
+	if err != nil {
+		return fmt.Errorf("template %s: %w", t.Name, err)
+	}
+	to, data, operation := multiSendTransaction(txs)
+
+	fmt.Println("template", t.Name+":", t.Description)
+	opts.variables = resolver.summary()
+	for _, line := range opts.variables {
+		fmt.Println("param", line)
+	}
+	for _, line := range describeTx(to, new(big.Int), data, operation) {
+		fmt.Println("-", line)
+	}
+	return sendTransaction(*flags.from, to.Hex(), *flags.safe, 0, data, operation, *flags.privKey, opts)
+}
+
+func cacheCommand(args []string) error {
+	if len(args) != 1 || (args[0] != "show" && args[0] != "clear") {
+		return errors.New("usage: cache show|clear")
+	}
+	if args[0] == "clear" {
+		if err := os.RemoveAll(cacheDir()); err != nil {
+			return err
+		}
+		fmt.Println("cleared", cacheDir())
+		return nil
+	}
+
+	counts, err := cacheSummary()
+	if err != nil {
+		return err
+	}
+	fmt.Println("cache:", cacheDir())
+	fmt.Printf("  %d safes (%s), %d tokens (%s), %d selectors (%s), %d verified sources (%s)\n",
+		counts[CACHE_SAFES], CACHE_TTL_SAFE_INFO, counts[CACHE_TOKENS], CACHE_TTL_TOKEN,
+		counts[CACHE_SELECTORS], CACHE_TTL_SELECTOR, counts[CACHE_SOURCES], CACHE_TTL_VERIFIED)
+	return nil
+}
+
+func airgapCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "sign" && args[0] != "submit") {
+		return errors.New("usage: airgap export -safe-tx-hash <HASH>|sign -chain-id <ID> -in <FILE|->|submit -in <FILE|-> [flags]")
+	}
+
+	fs := flag.NewFlagSet("airgap "+args[0], flag.ExitOnError)
+	out := fs.String("out", "", "file to write, instead of or with -qr")
+	qr := fs.Bool("qr", false, "show the output as QR codes in the terminal, animated over several frames when it doesn't fit one")
+	interval := fs.Duration("qr-interval", 800*time.Millisecond, "time each QR frame is shown")
+	switch args[0] {
+	case "export":
+		safeTxHash := fs.String("safe-tx-hash", "", "hash of the transaction to sign offline, fetched from the transaction service")
+		fs.Parse(args[1:])
+
+		if *out == "" && !*qr {
+			return errors.New("airgap export needs -out <FILE> or -qr")
+		}
+		tx, err := getMultisigTransaction(*safeTxHash)
+		if err != nil {
+			return err
+		}
+		chainID, version, err := txDomain(tx, nil)
+		if err != nil {
+			return err
+		}
+		bundle := newAirgapBundle(tx, chainID, version)
+		if _, err := bundle.check(); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(bundle)
+		if err != nil {
+			return err
+		}
+		if *out != "" {
+			if err := ioutil.WriteFile(*out, encoded, 0o644); err != nil {
+				return err
+			}
+			fmt.Println("unsigned transaction written to", *out)
+		}
+		if *qr {
+			return showFrames(encoded, *interval)
+		}
+		return nil
+
+	case "sign":
+		in := fs.String("in", "-", "airgap bundle file, - to scan its frames or paste it")
+		privKey := secretFlag(fs, "key", "<SIGNER_PRIVATE_KEY>", "signer private key")
+		contractOwner := fs.String("contract-owner", "", "sign on behalf of this contract owner (a safe the key owns)")
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint, required with -contract-owner")
+		chainID := fs.Int64("chain-id", 0, "chain the transaction is for, confirmed by the signer and checked against the bundle")
+		policyFile := fs.String("policy", "", "policy file (json or yaml) the transaction must satisfy before it is signed")
+		fs.Parse(args[1:])
+
+		reader, closeInput, err := openAirgapInput(*in)
+		if err != nil {
+			return err
+		}
+		defer closeInput()
+		payload, err := readAirgapPayload(reader)
+		if err != nil {
+			return err
+		}
+		var bundle airgapBundle
+		if err := json.Unmarshal(payload, &bundle); err != nil {
+			return fmt.Errorf("invalid airgap bundle: %w", err)
+		}
+		hash, err := bundle.check()
+		if err != nil {
+			return err
+		}
+		if err := bundle.checkChain(*chainID); err != nil {
+			return err
+		}
+		pol, err := loadPolicyFlag(*policyFile)
+		if err != nil {
+			return err
+		}
+		if err := checkTxPolicy(pol, bundle.Tx); err != nil {
+			return err
+		}
+		key, err := crypto.HexToECDSA(*privKey)
+		if err != nil {
+			return err
+		}
+
+		printAirgapPreview(bundle.Tx, *chainID)
+		// the answer is read after the frames, stdin stays a terminal then
+		if *in != "-" {
+			reader = bufio.NewReader(os.Stdin)
+		}
+		fmt.Print("sign? [y/N] ")
+		answer, _ := reader.ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return errors.New("not signed")
+		}
+
+		typedData, err := bundle.Tx.typedData(int64(bundle.ChainID), bundle.Tx.SafeVersion)
+		if err != nil {
+			return err
+		}
+		owner, signature, err := signTransaction(typedData, key, *contractOwner, *rpc)
+		if err != nil {
+			return err
+		}
+		sig := &detachedSignature{SafeTxHash: hash.Hex(), Owner: owner.Hex(), Signature: hexutil.Encode(signature)}
+		if *out == "" && !*qr {
+			*out = sig.SafeTxHash + "." + sig.Owner + ".json"
+		}
+		if *out != "" {
+			if err := writeDetachedSignature(*out, sig); err != nil {
+				return err
+			}
+			fmt.Println("signature written to", *out)
+		}
+		if *qr {
+			encoded, err := json.Marshal(sig)
+			if err != nil {
+				return err
+			}
+			return showFrames(encoded, *interval)
+		}
+		return nil
+	}
+
+	in := fs.String("in", "-", "signature file, - to scan its frames or paste it")
+	fs.Parse(args[1:])
+
+	reader, closeInput, err := openAirgapInput(*in)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+	payload, err := readAirgapPayload(reader)
+	if err != nil {
+		return err
+	}
+	var sig detachedSignature
+	if err := json.Unmarshal(payload, &sig); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	tx, err := getMultisigTransaction(sig.SafeTxHash)
+	if err != nil {
+		return err
+	}
+	chainID, version, err := txDomain(tx, nil)
+	if err != nil {
+		return err
+	}
+	hash, err := tx.hash(chainID, version)
+	if err != nil {
+		return err
+	}
+	if hash != common.HexToHash(sig.SafeTxHash) {
+		return fmt.Errorf("transaction returned by the service hashes to %s, not %s", hash.Hex(), sig.SafeTxHash)
+	}
+	if err := checkDetachedSignature(&sig, hash); err != nil {
+		return err
+	}
+	if err := submitConfirmation(hash.Hex(), sig.Signature); err != nil {
+		return err
+	}
+	fmt.Println("confirmed", hash.Hex(), "as", sig.Owner)
+	return nil
+}
+
+func exportTypedDataCommand(args []string) error {
+	fs := flag.NewFlagSet("export-typed-data", flag.ExitOnError)
+	out := fs.String("out", "", "file to write the typed data to (default: stdout)")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New("usage: export-typed-data <safeTxHash|transaction file> [-out <file>]")
+	}
+	fs.Parse(args[1:])
+
+	tx, err := loadTxArg(args[0])
+	if err != nil {
+		return err
+	}
+	chainID, version, err := txDomain(tx, nil)
+	if err != nil {
+		return err
+	}
+	hash, err := tx.hash(chainID, version)
+	if err != nil {
+		return err
+	}
+	if tx.SafeTxHash != "" && common.HexToHash(tx.SafeTxHash) != hash {
+		return fmt.Errorf("transaction declares hash %s but its fields hash to %s", tx.SafeTxHash, hash.Hex())
+	}
+
+	encoded, err := exportTypedData(tx, chainID, version)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Println(string(encoded))
+		return nil
+	}
+	if err := ioutil.WriteFile(*out, encoded, 0o644); err != nil {
+		return err
+	}
+	fmt.Println("safeTxHash:", hash.Hex())
+	fmt.Println("typed data for eth_signTypedData_v4 written to", *out)
+	fmt.Println("import the wallet's signature with submit-signature -safe-tx-hash", hash.Hex())
+	return nil
+}
+
+func submitSignatureCommand(args []string) error {
+	fs := flag.NewFlagSet("submit-signature", flag.ExitOnError)
+	safeTxHash := fs.String("safe-tx-hash", "", "hash of the signed transaction")
+	signature := fs.String("signature", "", "signature of the owner, from eth_signTypedData_v4 or personal_sign of the safeTxHash")
+	owner := fs.String("owner", "", "owner that made the signature")
+	fs.Parse(args)
+
+	if *safeTxHash == "" || *signature == "" || *owner == "" {
+		return errors.New("usage: submit-signature -safe-tx-hash <HASH> -signature <0x..> -owner <OWNER_ADDRESS>")
+	}
+	ownerAddr, err := parseAddress(*owner)
+	if err != nil {
+		return fmt.Errorf("invalid -owner %q: %w", *owner, err)
+	}
+	sig, err := hexutil.Decode(*signature)
+	if err != nil {
+		return fmt.Errorf("invalid -signature: %w", err)
+	}
+
+	_, _, hash, err := prepareConfirmation(*safeTxHash, ownerAddr, "", "", "", nil)
+	if err != nil {
+		return err
+	}
+	sig, err = importSignature(hash, ownerAddr, sig)
+	if err != nil {
+		return err
+	}
+	if sig[64] > 30 {
+		fmt.Println("personal_sign signature, submitted as eth_sign")
+	}
+	if err := submitConfirmation(hash.Hex(), hexutil.Encode(sig)); err != nil {
+		return err
+	}
+	fmt.Println("confirmed", hash.Hex(), "as", ownerAddr.Hex())
+	return nil
+}
+
+func gasTokensCommand(args []string) error {
+	fs := flag.NewFlagSet("gas-tokens", flag.ExitOnError)
+	fs.Parse(args)
+
+	tokens, err := relayGasTokens()
+	if err != nil {
+		return err
+	}
+	fmt.Println("the relay accepts refunds in the native token and", len(tokens), "tokens:")
+	for _, t := range tokens {
+		fmt.Printf("  %s %s (%s, %d decimals)\n", common.HexToAddress(t.Address).Hex(), t.Symbol, t.Name, t.Decimals)
+	}
+	return nil
+}
+
+func rotateOwnerCommand(args []string) error {
+	fs := flag.NewFlagSet("rotate-owner", flag.ExitOnError)
+	flags := addCommonFlags(fs)
+	oldOwner := fs.String("old", "", "owner to replace")
+	newOwner := fs.String("new", "", "address of the new owner key")
+	challenge := fs.String("challenge", "", "challenge of the rotation message printed by the first run")
+	newSignature := fs.String("new-signature", "", "signature of the rotation message by the new owner (personal_sign)")
+	track := fs.Bool("track", true, "follow the confirmations once proposed until the rotation is executed")
+	interval := fs.Duration("poll-interval", 15*time.Second, "with -track, how often the confirmations are checked")
+	fs.Parse(args)
+
+	safeAddr, err := parseAddress(*flags.safe)
+	if err != nil {
+		return fmt.Errorf("a valid -safe is required: %w", err)
+	}
+	oldAddr, err := parseAddress(*oldOwner)
+	if err != nil {
+		return fmt.Errorf("a valid -old owner is required: %w", err)
+	}
+	newAddr, err := parseAddress(*newOwner)
+	if err != nil {
+		return fmt.Errorf("a valid -new owner is required: %w", err)
+	}
+
+	// first run: the new key proves itself before anything is proposed
+	if *newSignature == "" {
+		chainID, err := serviceChain()
+		if err != nil {
+			return err
+		}
+		c := newAckChallenge()
+		fmt.Println("sign this message (personal_sign) with the new owner key", newAddr.Hex()+":")
+		fmt.Println()
+		fmt.Println(rotationMessage(safeAddr, oldAddr, newAddr, chainID, c))
+		fmt.Println()
+		fmt.Println("then run rotate-owner again with -challenge", c, "-new-signature <signature>")
+		return nil
+	}
+	if *challenge == "" {
+		return errors.New("-new-signature needs the -challenge it signed")
+	}
+	if err := verifyRotation(safeAddr, oldAddr, newAddr, *challenge, *newSignature); err != nil {
+		return err
+	}
+	fmt.Println("new owner", newAddr.Hex(), "controls its key")
+
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+	client, err := dialRPC(*flags.rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// prevOwner is read from the onchain owners list, the service order may differ
+	txs, err := buildOwnerSwap(client, safeAddr, oldAddr, newAddr, 0)
+	if err != nil {
+		return err
+	}
+	if opts.origin == nil {
+		opts.origin = map[string]string{}
+	}
+	opts.origin["newOwnerChallenge"] = *challenge
+	opts.origin["newOwnerSignature"] = *newSignature
+	if err := sendTransaction(*flags.from, safeAddr.Hex(), safeAddr.Hex(), 0, txs[0].Data, 0, *flags.privKey, opts); err != nil {
+		return err
+	}
+	safeTxHash := currentOperation.SafeTxHash
+	fmt.Println("rotation proposed:", safeTxHash)
+	if !*track || opts.chainOnly {
+		return nil
+	}
+
+	if _, err := trackProposal(safeTxHash, *interval); err != nil {
+		return err
+	}
+	return checkRotated(client, safeAddr, oldAddr, newAddr)
+}
+
+func draftCommand(args []string) error {
+	subcommands := map[string]bool{"save": true, "list": true, "edit": true, "delete": true, "freeze": true, "sign": true, "status": true}
+	if len(args) == 0 || !subcommands[args[0]] {
+		return errors.New("usage: draft save|list|edit|delete|freeze|sign|status [-name <name>] [flags]")
+	}
+
+	fs := flag.NewFlagSet("draft "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", "", "drafts directory (default: $GNOSIS_TX_DRAFTS_DIR or drafts in the config directory)")
+	if args[0] == "list" {
+		fs.Parse(args[1:])
+		drafts, err := listDrafts(*dir)
+		if err != nil {
+			return err
+		}
+		if len(drafts) == 0 {
+			fmt.Println("no drafts in", draftsDir(*dir))
+		}
+		for _, d := range drafts {
+			if d.Err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s: %v\n", d.Name, d.Err)
+				continue
+			}
+			safe := "any safe"
+			if d.Draft.Safe != "" {
+				safe = displayAddress(common.HexToAddress(d.Draft.Safe))
+			}
+			fmt.Printf("%s: %d calls for %s, %s\n", d.Name, len(d.Draft.Calls), safe, d.Path)
+			if d.Draft.Description != "" {
+				fmt.Println("  " + d.Draft.Description)
+			}
+		}
+		return nil
+	}
+
+	name := fs.String("name", "", "name of the draft")
+	draftFlags := func() (*string, *string) {
+		return fs.String("description", "", "description shown when the draft is proposed"),
+			fs.String("safe", "", "safe the draft is for, checked when it is proposed")
+	}
+	switch args[0] {
+	case "save":
+		description, safe := draftFlags()
+		file := fs.String("file", "", "batch file (json, yaml or a Transaction Builder export) whose calls are added, e.g. a draft shared by a colleague")
+		to := fs.String("to", "", "address of a call to add")
+		value := fs.String("value", "", "value in wei of the call")
+		method := fs.String("method", "", "method of the call, e.g. transfer(address,uint256)")
+		callArgs := &argFlags{}
+		fs.Var(callArgs, "arg", "argument of -method, repeatable")
+		data := fs.String("data", "", "raw data of the call instead of -method")
+		fs.Parse(args[1:])
+
+		if (*file == "") == (*to == "") {
+			return errors.New("usage: draft save -name <name> -file <batch file>|-to <address> [-value <wei>] [-method <signature> -arg <value>...|-data <hex>] [flags]")
+		}
+		draft, err := loadDraft(*dir, *name)
+		if err != nil {
+			return err
+		}
+		if draft == nil {
+			draft = &batchFile{}
+		}
+
+		var calls []batchCall
+		if *file != "" {
+			imported, err := loadBatchFile(*file)
+			if err != nil {
+				return err
+			}
+			if imported.Safe != "" && draft.Safe != "" && !strings.EqualFold(imported.Safe, draft.Safe) {
+				return fmt.Errorf("%s is for safe %s, the draft for %s", *file, imported.Safe, draft.Safe)
+			}
+			if draft.Safe == "" {
+				draft.Safe = imported.Safe
+			}
+			if draft.Description == "" {
+				draft.Description = imported.Description
+			}
+			calls = imported.Calls
+		} else {
+			calls = []batchCall{{To: *to, Value: *value, Method: *method, Args: *callArgs, Data: *data}}
+		}
+		for i, call := range calls {
+			if err := checkDraftCall(call); err != nil {
+				return fmt.Errorf("call %d: %w", i+1, err)
+			}
+		}
+		draft.Calls = append(draft.Calls, calls...)
+		if *description != "" {
+			draft.Description = *description
+		}
+		if *safe != "" {
+			if err := checkAddress(*safe); err != nil {
+				return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+			}
+			draft.Safe = common.HexToAddress(*safe).Hex()
+		}
+
+		path, err := saveDraft(*dir, *name, draft)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("draft %s: %d calls, written to %s\n", *name, len(draft.Calls), path)
+		return nil
+
+	case "edit":
+		description, safe := draftFlags()
+		remove := fs.Int("remove", 0, "remove the call at this position, 1 for the first")
+		fs.Parse(args[1:])
+
+		draft, err := loadDraft(*dir, *name)
+		if err != nil {
+			return err
+		}
+		if draft == nil {
+			return fmt.Errorf("no draft %q in %s", *name, draftsDir(*dir))
+		}
+		if *remove == 0 && *description == "" && *safe == "" {
+			path, _ := draftPath(*dir, *name)
+			if draft, err = editDraftFile(path); err != nil {
+				return err
+			}
+			for i, call := range draft.Calls {
+				if err := checkDraftCall(call); err != nil {
+					return fmt.Errorf("draft not saved, call %d: %w", i+1, err)
+				}
+			}
+		}
+		if *remove != 0 {
+			if err := removeDraftCall(draft, *remove); err != nil {
+				return err
+			}
+		}
+		if *description != "" {
+			draft.Description = *description
+		}
+		if *safe != "" {
+			if err := checkAddress(*safe); err != nil {
+				return fmt.Errorf("invalid -safe %q: %w", *safe, err)
+			}
+			draft.Safe = common.HexToAddress(*safe).Hex()
+		}
+
+		path, err := saveDraft(*dir, *name, draft)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("draft %s: %d calls, written to %s\n", *name, len(draft.Calls), path)
+		return nil
+
+	case "freeze":
+		safe := fs.String("safe", "", "safe to sign the draft for (default: the safe of the draft)")
+		nonce := fs.String("nonce", "", "nonce to sign at, a number or "+NONCE_NEXT_QUEUED+" (default: current safe nonce)")
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint, for the conditions of the draft and a local gas estimation")
+		safeTxGas := fs.Int64("safe-tx-gas", -1, "safeTxGas of the transaction (default: 0 for safes from 1.3.0, estimated otherwise)")
+		vars := varFlags{}
+		fs.Var(vars, "var", "NAME=value of a ${NAME} variable referenced in the draft, repeatable")
+		fs.Parse(args[1:])
+
+		draft, err := loadDraft(*dir, *name)
+		if err != nil {
+			return err
+		}
+		if draft == nil {
+			return fmt.Errorf("no draft %q in %s", *name, draftsDir(*dir))
+		}
+		if *safe == "" {
+			*safe = draft.Safe
+		}
+		if err := checkAddress(*safe); err != nil {
+			return fmt.Errorf("a valid -safe is required: %w", err)
+		}
+		if draft.Safe != "" && !strings.EqualFold(draft.Safe, *safe) {
+			return fmt.Errorf("the draft was made for safe %s, not %s", draft.Safe, *safe)
+		}
+		safeAddr := common.HexToAddress(*safe)
+
+		resolver, err := newVariables(vars)
+		if err != nil {
+			return err
+		}
+		resolver.builtin["SAFE"] = safeAddr.Hex()
+		var client EthClient
+		if *rpc != "" {
+			if client, err = dialRPC(*rpc); err != nil {
+				return err
+			}
+			defer client.Close()
+		}
+		to, value, data, operation, err := buildBatch(draft, resolver, client)
+		if err != nil {
+			return err
+		}
+		if !value.IsInt64() {
+			return fmt.Errorf("value %s wei is too large", value)
+		}
+
+		txNonce, err := resolveNonce(safeAddr.Hex(), *nonce, -1)
+		if err != nil {
+			return err
+		}
+		chainID, version, err := safeTxDomain(safeAddr.Hex(), client)
+		if err != nil {
+			return err
+		}
+		gas := &gasEstimate{SafeTxGas: *safeTxGas}
+		if *safeTxGas < 0 {
+			gas.SafeTxGas = 0
+			if defaultEstimation(version, false, false) != ESTIMATE_NONE {
+				if gas, err = getGasEstimation(to.Hex(), safeAddr.Hex(), value.Int64(), data, operation, *rpc, nil); err != nil {
+					return err
+				}
+			}
+		}
+		hash, err := draftHash(*dir, *name)
+		if err != nil {
+			return err
+		}
+		tx, err := newFrozenDraft(*name, hash, safeAddr, to, value, data, operation, gas.SafeTxGas, gas.BaseGas, *txNonce, chainID, version)
+		if err != nil {
+			return err
+		}
+		path, err := writeFrozenDraft(*dir, *name, tx)
+		if err != nil {
+			return err
+		}
+		printAirgapPreview(tx, chainID)
+		fmt.Println("transaction to sign written to", path)
+		return nil
+
+	case "sign":
+		privKey := secretFlag(fs, "key", "<SIGNER_PRIVATE_KEY>", "signer private key")
+		contractOwner := fs.String("contract-owner", "", "sign on behalf of this contract owner (a safe the key owns)")
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint, required with -contract-owner")
+		policyFile := fs.String("policy", "", "policy file (json or yaml) the transaction must satisfy before it is signed")
+		fs.Parse(args[1:])
+
+		signing, err := signingDir(*dir, *name)
+		if err != nil {
+			return err
+		}
+		tx, err := loadSafeTxFile(draftTxPath(signing))
+		if os.IsNotExist(err) {
+			return fmt.Errorf("draft %s is not frozen, freeze it with draft freeze -name %s", *name, *name)
+		}
+		if err != nil {
+			return err
+		}
+		typedData, hash, err := fileTypedData(tx, *rpc)
+		if err != nil {
+			return err
+		}
+		if common.HexToHash(tx.SafeTxHash) != hash {
+			return fmt.Errorf("the frozen transaction declares hash %s but its fields hash to %s", tx.SafeTxHash, hash.Hex())
+		}
+		current, err := draftHash(*dir, *name)
+		if err != nil {
+			return err
+		}
+		if current != frozenDraftHash(tx) {
+			return fmt.Errorf("draft %s changed since it was frozen, freeze it again before signing", *name)
+		}
+		pol, err := loadPolicyFlag(*policyFile)
+		if err != nil {
+			return err
+		}
+		if err := checkTxPolicy(pol, tx); err != nil {
+			return err
+		}
+
+		key, err := crypto.HexToECDSA(*privKey)
+		if err != nil {
+			return err
+		}
+		printAirgapPreview(tx, serviceChainID)
+		owner, signature, err := signTransaction(typedData, key, *contractOwner, *rpc)
+		if err != nil {
+			return err
+		}
+		sig := &detachedSignature{SafeTxHash: hash.Hex(), Owner: owner.Hex(), Signature: hexutil.Encode(signature)}
+		path := draftSignaturePath(signing, owner)
+		if err := writeDetachedSignature(path, sig); err != nil {
+			return err
+		}
+		fmt.Println("signature written to", path)
+		return nil
+
+	case "status":
+		rpc := fs.String("rpc", "", "ethereum RPC endpoint to read the owners from (default: the transaction service)")
+		fs.Parse(args[1:])
+
+		drafts, err := listDrafts(*dir)
+		if err != nil {
+			return err
+		}
+		var client EthClient
+		if *rpc != "" {
+			if client, err = dialRPC(*rpc); err != nil {
+				return err
+			}
+			defer client.Close()
+		}
+		shown := 0
+		for _, d := range drafts {
+			if *name != "" && d.Name != *name {
+				continue
+			}
+			if err := printDraftStatus(*dir, d, client); err != nil {
+				return fmt.Errorf("%s: %w", d.Name, err)
+			}
+			shown++
+		}
+		if shown == 0 && *name != "" {
+			return fmt.Errorf("no draft %q in %s", *name, draftsDir(*dir))
+		}
+		if shown == 0 {
+			fmt.Println("no drafts in", draftsDir(*dir))
+		}
+		return nil
+	}
+
+	fs.Parse(args[1:])
+	path, err := draftPath(*dir, *name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no draft %q in %s", *name, draftsDir(*dir))
+		}
+		return err
+	}
+	fmt.Println("deleted", path)
+	return nil
+}
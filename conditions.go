@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CONDITION_BALANCE reads the native balance of the address instead of calling it
+const CONDITION_BALANCE = "balance"
+
+// batchCondition includes a batch call only if a read at build time compares
+// to value as op, e.g. {"read": "allowance(address,address)", "args":
+// ["${SAFE}", "0x…"], "op": "lt", "value": "1000"}
+type batchCondition struct {
+	Read    string   `json:"read"`
+	To      string   `json:"to,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Returns string   `json:"returns,omitempty"`
+	Op      string   `json:"op"`
+	Value   string   `json:"value"`
+}
+
+func comparableInt(value interface{}) (*big.Int, bool) {
+	if n, ok := value.(*big.Int); ok {
+		return n, true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint()), true
+	}
+	return nil, false
+}
+
+func compareValues(op string, actual, expected interface{}) (bool, error) {
+	a, aInt := comparableInt(actual)
+	e, eInt := comparableInt(expected)
+	if aInt && eInt {
+		cmp := a.Cmp(e)
+		switch op {
+		case "lt":
+			return cmp < 0, nil
+		case "lte":
+			return cmp <= 0, nil
+		case "gt":
+			return cmp > 0, nil
+		case "gte":
+			return cmp >= 0, nil
+		}
+	}
+
+	switch op {
+	case "eq":
+		return reflect.DeepEqual(actual, expected), nil
+	case "ne":
+		return !reflect.DeepEqual(actual, expected), nil
+	case "lt", "lte", "gt", "gte":
+		return false, fmt.Errorf("%s only compares numbers", op)
+	}
+	return false, fmt.Errorf("unknown condition op %q, expected lt, lte, gt, gte, eq or ne", op)
+}
+
+// eval performs the read of the condition against the latest block and
+// returns whether it holds, along with the value read
+func (c *batchCondition) eval(client EthClient, callTo common.Address, vars *variables) (bool, string, error) {
+	if client == nil {
+		return false, "", errors.New("conditions read onchain, pass -rpc")
+	}
+
+	target := callTo
+	if c.To != "" {
+		to, err := vars.interpolate(c.To)
+		if err != nil {
+			return false, "", err
+		}
+		if err := checkAddress(to); err != nil {
+			return false, "", fmt.Errorf("invalid condition address %s: %w", quote(c.To, to), err)
+		}
+		target = common.HexToAddress(to)
+	}
+
+	returns := c.Returns
+	if returns == "" {
+		returns = "uint256"
+	}
+	if c.Read == CONDITION_BALANCE {
+		returns = "uint256"
+	}
+	out, err := methodArguments("(" + returns + ")")
+	if err != nil {
+		return false, "", err
+	}
+	if len(out) != 1 {
+		return false, "", fmt.Errorf("a condition compares a single return value, not %s", returns)
+	}
+
+	var actual interface{}
+	if c.Read == CONDITION_BALANCE {
+		if actual, err = client.BalanceAt(opCtx, target, nil); err != nil {
+			return false, "", err
+		}
+	} else {
+		args := make([]string, len(c.Args))
+		for i, arg := range c.Args {
+			if args[i], err = vars.interpolate(arg); err != nil {
+				return false, "", err
+			}
+		}
+		call, err := encodeCallArgs(c.Read, args)
+		if err != nil {
+			return false, "", err
+		}
+		result, err := callContract(client, target, call)
+		if err != nil {
+			return false, "", fmt.Errorf("%s on %s failed: %w", c.Read, target.Hex(), err)
+		}
+		values, err := out.UnpackValues(result)
+		if err != nil {
+			return false, "", fmt.Errorf("invalid %s response from %s: %w", c.Read, target.Hex(), err)
+		}
+		actual = values[0]
+	}
+
+	value, err := vars.interpolate(c.Value)
+	if err != nil {
+		return false, "", err
+	}
+	expected, err := parseArgument(out[0].Type, value)
+	if err != nil {
+		return false, "", fmt.Errorf("condition value: %w", err)
+	}
+
+	holds, err := compareValues(c.Op, actual, expected)
+	return holds, formatArgument(actual), err
+}
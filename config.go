@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// configDir returns the directory holding the tool's local configuration,
+// $GNOSIS_TX_CONFIG_DIR if set or gnosis-tx under the user config directory
+func configDir() string {
+	if dir := os.Getenv("GNOSIS_TX_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".gnosis-tx"
+	}
+	return filepath.Join(dir, "gnosis-tx")
+}
+
+func configPath(name string) string {
+	return filepath.Join(configDir(), name)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// confirmFilter narrows confirm -all to a nonce range or a proposer, negative
+// nonces are unbounded
+type confirmFilter struct {
+	fromNonce int64
+	toNonce   int64
+	proposer  *common.Address
+}
+
+func (f *confirmFilter) match(tx *multisigTxResponse) bool {
+	if f.fromNonce >= 0 && tx.Nonce < f.fromNonce {
+		return false
+	}
+	if f.toNonce >= 0 && tx.Nonce > f.toNonce {
+		return false
+	}
+	return f.proposer == nil || common.HexToAddress(tx.Proposer) == *f.proposer
+}
+
+// awaitingConfirmation returns the pending transactions matching the filter
+// that owner hasn't confirmed and that are still below their threshold,
+// lowest nonce and oldest proposal first
+func awaitingConfirmation(pending []multisigTxResponse, owner common.Address, filter *confirmFilter) []multisigTxResponse {
+	var txs []multisigTxResponse
+	for _, tx := range pending {
+		if !filter.match(&tx) || int64(len(tx.Confirmations)) >= tx.ConfirmationsRequired {
+			continue
+		}
+		confirmed := false
+		for _, c := range tx.Confirmations {
+			if common.HexToAddress(c.Owner) == owner {
+				confirmed = true
+				break
+			}
+		}
+		if !confirmed {
+			txs = append(txs, tx)
+		}
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].Nonce != txs[j].Nonce {
+			return txs[i].Nonce < txs[j].Nonce
+		}
+		return txs[i].SubmissionDate < txs[j].SubmissionDate
+	})
+	return txs
+}
+
+// confirmAll previews every transaction awaiting the owner's confirmation and
+// confirms those approved one by one, q ends the session
+func confirmAll(safe string, owner common.Address, filter *confirmFilter, in io.Reader, confirm func(safeTxHash string) error) error {
+	nonce, err := getSafeNonce(safe)
+	if err != nil {
+		return err
+	}
+	pending, err := getPendingTransactions(safe, *nonce)
+	if err != nil {
+		return err
+	}
+
+	txs := awaitingConfirmation(pending, owner, filter)
+	if len(txs) == 0 {
+		fmt.Println("no pending transactions await the confirmation of", displayAddress(owner))
+		return nil
+	}
+	fmt.Printf("%d transactions await the confirmation of %s\n", len(txs), displayAddress(owner))
+
+	reader := bufio.NewReader(in)
+	confirmed, failed := 0, 0
+	for i := range txs {
+		tx := &txs[i]
+		fmt.Printf("\n[%d/%d] nonce %d %s\n", i+1, len(txs), tx.Nonce, tx.SafeTxHash)
+		fmt.Println("  proposer:", displayAddress(common.HexToAddress(tx.Proposer)))
+		if origin := describeOrigin(tx.Origin); origin != "" {
+			fmt.Println("  origin:", origin)
+		}
+		for _, intent := range newWatchEvent(EVENT_PROPOSED, tx).Intent {
+			fmt.Println("  -", intent)
+		}
+		if refund := txRefund(nil, tx); refund != "" {
+			fmt.Println("  refund:", refund)
+		}
+		fmt.Println("  confirmations:", confirmationBar(int64(len(tx.Confirmations)), tx.ConfirmationsRequired))
+
+		fmt.Print("confirm? [y/N/q] ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			fmt.Println()
+			break
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer == "q" {
+			break
+		}
+		if answer != "y" && answer != "yes" {
+			fmt.Println("skipped")
+			continue
+		}
+
+		if err := confirm(tx.SafeTxHash); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", tx.SafeTxHash, err)
+			failed++
+			continue
+		}
+		fmt.Println("confirmed as", owner.Hex())
+		confirmed++
+	}
+
+	fmt.Printf("\nconfirmed %d of %d transactions\n", confirmed, len(txs))
+	if failed > 0 {
+		return fmt.Errorf("%d confirmations failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestAwaitingConfirmation(t *testing.T) {
+	proposer := common.HexToAddress(testRecipient)
+	pending := []multisigTxResponse{
+		{Nonce: 9, SafeTxHash: "later", ConfirmationsRequired: 2, Proposer: testRecipient},
+		{Nonce: 7, SafeTxHash: "mine", ConfirmationsRequired: 2, Confirmations: []multisigConfirmation{{Owner: testOwner.Hex()}}},
+		{Nonce: 7, SafeTxHash: "full", ConfirmationsRequired: 1, Confirmations: []multisigConfirmation{{Owner: testRecipient}}},
+		{Nonce: 8, SafeTxHash: "other", ConfirmationsRequired: 2, Proposer: ZERO_ADDR},
+		{Nonce: 7, SafeTxHash: "first", ConfirmationsRequired: 2, Proposer: testRecipient},
+	}
+	tests := []struct {
+		filter confirmFilter
+		want   string
+	}{
+		{confirmFilter{fromNonce: -1, toNonce: -1}, "first,other,later"},
+		{confirmFilter{fromNonce: 8, toNonce: -1}, "other,later"},
+		{confirmFilter{fromNonce: -1, toNonce: 8}, "first,other"},
+		{confirmFilter{fromNonce: -1, toNonce: -1, proposer: &proposer}, "first,later"},
+	}
+	for _, tt := range tests {
+		var hashes []string
+		for _, tx := range awaitingConfirmation(pending, testOwner, &tt.filter) {
+			hashes = append(hashes, tx.SafeTxHash)
+		}
+		if got := strings.Join(hashes, ","); got != tt.want {
+			t.Errorf("awaitingConfirmation(%+v) = %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmAll(t *testing.T) {
+	service := proposalService()
+	service.pending = []multisigTxResponse{
+		{Nonce: 7, SafeTxHash: "a", To: testRecipient, Value: "1", GasPrice: "0", ConfirmationsRequired: 2},
+		{Nonce: 8, SafeTxHash: "b", To: testRecipient, Value: "1", GasPrice: "0", ConfirmationsRequired: 2},
+		{Nonce: 9, SafeTxHash: "c", To: testRecipient, Value: "1", GasPrice: "0", ConfirmationsRequired: 2},
+		{Nonce: 10, SafeTxHash: "d", To: testRecipient, Value: "1", GasPrice: "0", ConfirmationsRequired: 2},
+	}
+	useService(t, service)
+
+	var confirmed []string
+	confirm := func(safeTxHash string) error {
+		if safeTxHash == "c" {
+			return errors.New("signer rejected")
+		}
+		confirmed = append(confirmed, safeTxHash)
+		return nil
+	}
+	// a confirmed, b skipped, c failing, then quit before d
+	err := confirmAll(testSafe, testOwner, &confirmFilter{fromNonce: -1, toNonce: -1}, strings.NewReader("y\nn\ny\nq\n"), confirm)
+	if err == nil || !strings.Contains(err.Error(), "1 confirmations failed") {
+		t.Errorf("confirmAll = %v, want one failed confirmation", err)
+	}
+	if strings.Join(confirmed, ",") != "a" {
+		t.Errorf("confirmed %v, want a only", confirmed)
+	}
+}
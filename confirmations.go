@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+type confirmationTier struct {
+	MinUsd float64 `json:"minUsd"`
+	Blocks uint64  `json:"blocks"`
+}
+
+type networkConfirmations struct {
+	NativeUsdPrice float64            `json:"nativeUsdPrice"`
+	Tiers          []confirmationTier `json:"tiers"`
+}
+
+// confirmationsConfig maps a chain id to its confirmation tiers
+type confirmationsConfig map[string]networkConfirmations
+
+func loadConfirmationsConfig(path string) (confirmationsConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		path = configPath("confirmations.json")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return confirmationsConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config confirmationsConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("invalid confirmations config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// weiToUsd converts a native amount to usd using the given price per whole coin
+func weiToUsd(wei *big.Int, price float64) float64 {
+	coins, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(params.Ether)).Float64()
+	return coins * price
+}
+
+// requiredConfirmations returns the block depth for a transaction worth usdValue on chainID
+func (c confirmationsConfig) requiredConfirmations(chainID *big.Int, usdValue float64) uint64 {
+	network, ok := c[chainID.String()]
+	if !ok || len(network.Tiers) == 0 {
+		return 1
+	}
+
+	tiers := append([]confirmationTier(nil), network.Tiers...)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinUsd < tiers[j].MinUsd })
+
+	var blocks uint64 = 1
+	for _, tier := range tiers {
+		if usdValue >= tier.MinUsd && tier.Blocks > blocks {
+			blocks = tier.Blocks
+		}
+	}
+	return blocks
+}
+
+// waitForConfirmations blocks until the receipt's block is buried under the
+// required number of blocks (counting its own), failing if it gets reorged out
+func waitForConfirmations(client EthClient, receipt *types.Receipt, blocks uint64) error {
+	ctx := opCtx
+	for {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+
+		var confirmed uint64
+		if mined := receipt.BlockNumber.Uint64(); head >= mined {
+			confirmed = head - mined + 1
+		}
+
+		if confirmed >= blocks {
+			current, err := client.TransactionReceipt(ctx, receipt.TxHash)
+			if err != nil {
+				return fmt.Errorf("transaction %s no longer found after waiting for confirmations: %w", receipt.TxHash.Hex(), err)
+			}
+			if current.BlockHash != receipt.BlockHash {
+				return fmt.Errorf("transaction %s was reorged from block %s", receipt.TxHash.Hex(), receipt.BlockHash.Hex())
+			}
+			return nil
+		}
+
+		fmt.Printf("confirmations: %d/%d\n", confirmed, blocks)
+		if err := sleep(4 * time.Second); err != nil {
+			return err
+		}
+	}
+}
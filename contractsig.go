@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	legacyEIP1271MagicValue = []byte{0x20, 0xc1, 0x3b, 0x0b}
+	eip1271MagicValue       = []byte{0x16, 0x26, 0xba, 0x7e}
+	safeMessageTypeHash     = crypto.Keccak256([]byte("SafeMessage(bytes message)"))
+)
+
+func isHashApproved(client EthClient, safe, owner common.Address, hash common.Hash) (bool, error) {
+	call, err := encodeCall("approvedHashes(address,bytes32)", owner, hash)
+	if err != nil {
+		return false, err
+	}
+	result, err := callContract(client, safe, call)
+	if err != nil {
+		return false, err
+	}
+	return new(big.Int).SetBytes(result).Sign() != 0, nil
+}
+
+// safeMessageHash is the hash a Safe owner signs to produce an EIP-1271
+// signature of message on behalf of that Safe
+func safeMessageHash(client EthClient, safe common.Address, message []byte) (common.Hash, error) {
+	domainSeparator, err := callContract(client, safe, crypto.Keccak256([]byte("domainSeparator()"))[:4])
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(domainSeparator) != 32 {
+		return common.Hash{}, fmt.Errorf("%s did not return a domain separator, is it a Safe?", safe.Hex())
+	}
+
+	structHash := crypto.Keccak256(safeMessageTypeHash, crypto.Keccak256(message))
+	return crypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator, structHash), nil
+}
+
+// signForContractOwner signs data on behalf of a Safe owner of which the key is
+// a (threshold one) owner, returning the standalone contract signature
+func signForContractOwner(client EthClient, owner common.Address, data []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	hash, err := safeMessageHash(client, owner, data)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := signSafeTxHash(hash, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeContractSignature(owner, inner), nil
+}
+
+// isValidContractSignature asks the owner contract whether it accepts the
+// signature, trying the legacy bytes variant used by Safe first
+func isValidContractSignature(client EthClient, owner common.Address, data []byte, signature []byte) (bool, error) {
+	call, err := encodeCall("isValidSignature(bytes,bytes)", data, signature)
+	if err != nil {
+		return false, err
+	}
+	if result, err := callContract(client, owner, call); err == nil && len(result) >= 4 && bytes.Equal(result[:4], legacyEIP1271MagicValue) {
+		return true, nil
+	}
+
+	call, err = encodeCall("isValidSignature(bytes32,bytes)", crypto.Keccak256Hash(data), signature)
+	if err != nil {
+		return false, err
+	}
+	result, err := callContract(client, owner, call)
+	if err != nil {
+		return false, nil
+	}
+	return len(result) >= 4 && bytes.Equal(result[:4], eip1271MagicValue), nil
+}
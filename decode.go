@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var knownMethods = []string{
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"increaseAllowance(address,uint256)",
+	"safeTransferFrom(address,address,uint256)",
+	"safeTransferFrom(address,address,uint256,uint256,bytes)",
+	"setGuard(address)",
+	"setFallbackHandler(address)",
+	"addOwnerWithThreshold(address,uint256)",
+	"removeOwner(address,address,uint256)",
+	"swapOwner(address,address,address)",
+	"changeThreshold(uint256)",
+	"enableModule(address)",
+	"disableModule(address,address)",
+	"multiSend(bytes)",
+}
+
+func isTokenMethod(method string) bool {
+	switch method {
+	case "transfer(address,uint256)", "transferFrom(address,address,uint256)", "approve(address,uint256)", "increaseAllowance(address,uint256)":
+		return true
+	}
+	return false
+}
+
+func lookupMethod(data []byte) (string, bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+	for _, method := range knownMethods {
+		if common.Bytes2Hex(crypto.Keccak256([]byte(method))[:4]) == common.Bytes2Hex(data[:4]) {
+			return method, true
+		}
+	}
+
+	// selectors collide, take the first snapshot signature the arguments decode with
+	for _, method := range lookupSelector(data[:4]) {
+		args, err := methodArguments(method)
+		if err != nil {
+			continue
+		}
+		if _, err := args.UnpackValues(data[4:]); err == nil {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+// methodArguments builds the abi arguments of a signature such as "transfer(address,uint256)"
+func methodArguments(signature string) (abi.Arguments, error) {
+	start, end := strings.Index(signature, "("), strings.LastIndex(signature, ")")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid method signature %q", signature)
+	}
+
+	var args abi.Arguments
+	if inner := signature[start+1 : end]; inner != "" {
+		for _, name := range strings.Split(inner, ",") {
+			typ, err := abi.NewType(strings.TrimSpace(name), "", nil)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, abi.Argument{Type: typ})
+		}
+	}
+	return args, nil
+}
+
+// encodeCall abi-encodes a call to signature with the given argument values
+func encodeCall(signature string, values ...interface{}) ([]byte, error) {
+	args, err := methodArguments(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := args.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(crypto.Keccak256([]byte(signature))[:4], packed...), nil
+}
+
+// parseArgument converts a command line or batch file value to the go type
+// the abi packs for typ
+func parseArgument(typ abi.Type, value string) (interface{}, error) {
+	v := reflect.New(typ.GetType()).Elem()
+
+	switch typ.T {
+	case abi.AddressTy:
+		if err := checkAddress(value); err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", value, err)
+		}
+		v.Set(reflect.ValueOf(common.HexToAddress(value)))
+
+	case abi.IntTy, abi.UintTy:
+		n, ok := new(big.Int).SetString(value, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q", typ, value)
+		}
+		min, max := new(big.Int), new(big.Int).Lsh(common.Big1, uint(typ.Size))
+		if typ.T == abi.IntTy {
+			max.Rsh(max, 1)
+			min.Neg(max)
+		}
+		if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+			return nil, fmt.Errorf("%s out of range for %s", value, typ)
+		}
+		switch {
+		case typ.Size > 64:
+			v.Set(reflect.ValueOf(n))
+		case typ.T == abi.IntTy:
+			v.SetInt(n.Int64())
+		default:
+			v.SetUint(n.Uint64())
+		}
+
+	case abi.BoolTy:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", value)
+		}
+		v.SetBool(b)
+
+	case abi.StringTy:
+		v.SetString(value)
+
+	case abi.BytesTy, abi.FixedBytesTy:
+		b, err := hexutil.Decode(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", typ, value, err)
+		}
+		if typ.T == abi.BytesTy {
+			v.SetBytes(b)
+			break
+		}
+		if len(b) != typ.Size {
+			return nil, fmt.Errorf("%s needs %d bytes, got %d", typ, typ.Size, len(b))
+		}
+		reflect.Copy(v, reflect.ValueOf(b))
+
+	default:
+		return nil, fmt.Errorf("arguments of type %s are not supported, pass the calldata instead", typ)
+	}
+
+	return v.Interface(), nil
+}
+
+// encodeCallArgs encodes a call of signature from string arguments
+func encodeCallArgs(signature string, values []string) ([]byte, error) {
+	args, err := methodArguments(signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(args) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", signature, len(args), len(values))
+	}
+
+	parsed := make([]interface{}, len(values))
+	for i, value := range values {
+		if parsed[i], err = parseArgument(args[i].Type, value); err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", i+1, signature, err)
+		}
+	}
+	return encodeCall(signature, parsed...)
+}
+
+func formatArgument(value interface{}) string {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case *big.Int:
+		return formatUnits(v, 0, 0)
+	case []byte:
+		return hexutil.Encode(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// describeCall returns a human readable description of a single call
+func describeCall(tx multiSendTx) string {
+	var op string
+	if tx.Operation == 1 {
+		op = "delegatecall "
+	}
+
+	value := tx.Value
+	if value == nil {
+		value = common.Big0
+	}
+
+	if len(tx.Data) == 0 {
+		return fmt.Sprintf("%ssend %s to %s", op, formatWei(value), displayAddress(tx.To))
+	}
+
+	method, ok := lookupMethod(tx.Data)
+	if !ok {
+		return fmt.Sprintf("%scall %s on %s with %d bytes of data and %s", op, hexutil.Encode(tx.Data[:4]), displayAddress(tx.To), len(tx.Data), formatWei(value))
+	}
+
+	args, err := methodArguments(method)
+	if err != nil {
+		return fmt.Sprintf("%scall %s on %s", op, method, displayAddress(tx.To))
+	}
+
+	values, err := args.UnpackValues(tx.Data[4:])
+	if err != nil {
+		return fmt.Sprintf("%scall %s on %s with undecodable arguments", op, method, displayAddress(tx.To))
+	}
+
+	formatted := make([]string, len(values))
+	for i, v := range values {
+		formatted[i] = formatArgument(v)
+		if addr, ok := v.(common.Address); ok {
+			formatted[i] = displayAddress(addr)
+		}
+	}
+	// the last argument of the erc20 methods is a token amount
+	if amount, ok := values[len(values)-1].(*big.Int); ok && isTokenMethod(method) {
+		formatted[len(values)-1] = formatTokenAmount(tx.To, amount)
+		if amount.Cmp(math.MaxBig256) == 0 {
+			formatted[len(values)-1] = "unlimited"
+		}
+	}
+
+	name := method[:strings.Index(method, "(")]
+	description := fmt.Sprintf("%s%s(%s) on %s", op, name, strings.Join(formatted, ", "), displayAddress(tx.To))
+	if value.Sign() > 0 {
+		description += fmt.Sprintf(" with %s", formatWei(value))
+	}
+	return description
+}
+
+// describeTx returns the decoded intent of a safe transaction, one line per call
+func describeTx(to common.Address, value *big.Int, data []byte, operation uint8) []string {
+	txs, err := flattenTx(to, value, data, operation)
+	if err != nil {
+		return []string{describeCall(multiSendTx{Operation: operation, To: to, Value: value, Data: data})}
+	}
+
+	intent := make([]string, len(txs))
+	for i, tx := range txs {
+		intent[i] = describeCall(tx)
+	}
+	if isMultiSendBatch(to, data, operation) {
+		intent = append([]string{fmt.Sprintf("multiSend batch of %d transactions via %s", len(txs), displayAddress(to))}, intent...)
+	}
+	return intent
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// delegate signatures are valid for the current hour (and the previous one)
+const DELEGATE_TOTP_PERIOD = 3600
+
+type delegate struct {
+	Safe      string `json:"safe"`
+	Delegate  string `json:"delegate"`
+	Delegator string `json:"delegator"`
+	Label     string `json:"label"`
+}
+
+type delegateListResponse struct {
+	Count   int        `json:"count"`
+	Next    *string    `json:"next"`
+	Results []delegate `json:"results"`
+}
+
+type delegateRequest struct {
+	Safe      string `json:"safe,omitempty"`
+	Delegate  string `json:"delegate,omitempty"`
+	Signature string `json:"signature"`
+	Label     string `json:"label,omitempty"`
+}
+
+// delegateSignature signs keccak256(checksummed delegate + totp) as required
+// by the transaction service delegates api
+func delegateSignature(delegateAddr common.Address, key *ecdsa.PrivateKey) (string, error) {
+	totp := time.Now().Unix() / DELEGATE_TOTP_PERIOD
+	hash := crypto.Keccak256Hash([]byte(delegateAddr.Hex() + strconv.FormatInt(totp, 10)))
+
+	signature, err := signSafeTxHash(hash, key)
+	if err != nil {
+		return "", err
+	}
+	return hexutil.Encode(signature), nil
+}
+
+func listDelegates(safe string) ([]delegate, error) {
+	url := serviceEndpoint("/safes/") + safe + "/delegates/"
+
+	var delegates []delegate
+	for url != "" {
+		resp, err := httpGet(url)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := serviceBody(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		var page delegateListResponse
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+
+		delegates = append(delegates, page.Results...)
+
+		url = ""
+		if page.Next != nil {
+			url = *page.Next
+		}
+	}
+
+	return delegates, nil
+}
+
+func addDelegate(safe string, delegateAddr common.Address, label string, key *ecdsa.PrivateKey) error {
+	signature, err := delegateSignature(delegateAddr, key)
+	if err != nil {
+		return err
+	}
+
+	req, err := json.Marshal(delegateRequest{
+		Safe:      common.HexToAddress(safe).Hex(),
+		Delegate:  delegateAddr.Hex(),
+		Signature: signature,
+		Label:     label,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpPost(serviceEndpoint("/safes/")+safe+"/delegates/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return err
+	}
+
+	if _, err := serviceBody(resp); err != nil {
+		return withHint(fmt.Errorf("adding delegate rejected: %w", err))
+	}
+	return nil
+}
+
+// removeDelegate deletes a delegate, signed by an owner or the delegate itself
+func removeDelegate(safe string, delegateAddr common.Address, key *ecdsa.PrivateKey) error {
+	signature, err := delegateSignature(delegateAddr, key)
+	if err != nil {
+		return err
+	}
+
+	req, err := json.Marshal(delegateRequest{Signature: signature})
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpDo(http.MethodDelete, serviceEndpoint("/safes/")+safe+"/delegates/"+delegateAddr.Hex()+"/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return err
+	}
+
+	if _, err := serviceBody(resp); err != nil {
+		return withHint(fmt.Errorf("removing delegate rejected: %w", err))
+	}
+	return nil
+}
+
+// checkDelegate fails unless addr is a registered delegate of safe
+func checkDelegate(safe string, addr common.Address) error {
+	delegates, err := listDelegates(safe)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range delegates {
+		if common.HexToAddress(d.Delegate) == addr {
+			fmt.Println("proposing as delegate of", d.Delegator)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a delegate of %s, register it with: delegates add -delegate %s", addr.Hex(), safe, addr.Hex())
+}
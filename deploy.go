@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SETUP_MULTI_SEND is the MultiSend of Safe 1.4.1, which calls the safe
+// itself for the zero address: the calls of the setup delegatecall can't name
+// the safe, its address depends on them
+const SETUP_MULTI_SEND = "0x38869bf66a61cF6bDB996A6aE40D5853Fd43B526"
+
+type safeDeployment struct {
+	Factory         common.Address
+	Singleton       common.Address
+	Owners          []common.Address
+	Threshold       int64
+	FallbackHandler common.Address
+	SaltNonce       *big.Int
+	// enabled and set by the setup delegatecall through SetupMultiSend
+	Modules        []common.Address
+	Guard          common.Address
+	SetupMultiSend common.Address
+	// sent by the deployer to the safe once deployed
+	Funding *big.Int
+}
+
+// setupCalls are the calls the safe makes to itself during setup
+func (d *safeDeployment) setupCalls() []multiSendTx {
+	var txs []multiSendTx
+	seen := map[common.Address]bool{}
+	for _, module := range d.Modules {
+		if seen[module] {
+			continue
+		}
+		seen[module] = true
+		txs = append(txs, multiSendTx{Data: encodeAddressCall(enableModuleSelector, module)})
+	}
+	if d.Guard != (common.Address{}) {
+		txs = append(txs, multiSendTx{Data: encodeAddressCall(setGuardSelector, d.Guard)})
+	}
+	return txs
+}
+
+func (d *safeDeployment) initializer() ([]byte, error) {
+	if len(d.Owners) == 0 {
+		return nil, errors.New("at least one owner is required")
+	}
+	if d.Threshold < 1 || d.Threshold > int64(len(d.Owners)) {
+		return nil, fmt.Errorf("threshold must be between 1 and %d", len(d.Owners))
+	}
+
+	seen := map[common.Address]bool{}
+	for _, owner := range d.Owners {
+		if owner == (common.Address{}) || seen[owner] {
+			return nil, fmt.Errorf("invalid or duplicate owner %s", owner.Hex())
+		}
+		seen[owner] = true
+	}
+
+	for _, module := range d.Modules {
+		if module == (common.Address{}) || module == sentinelOwner {
+			return nil, fmt.Errorf("invalid module %s", module.Hex())
+		}
+	}
+
+	zero := common.HexToAddress(ZERO_ADDR)
+	to, data := zero, []byte{}
+	if txs := d.setupCalls(); len(txs) > 0 {
+		to, data = d.SetupMultiSend, encodeMultiSend(txs)
+	}
+	return encodeCall("setup(address[],uint256,address,bytes,address,address,uint256,address)",
+		d.Owners, big.NewInt(d.Threshold), to, data, d.FallbackHandler, zero, common.Big0, zero)
+}
+
+// predictAddress computes the CREATE2 address of the proxy deployed by createProxyWithNonce
+func (d *safeDeployment) predictAddress(client EthClient) (common.Address, error) {
+	initializer, err := d.initializer()
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	creationCode, err := callContract(client, d.Factory, crypto.Keccak256([]byte("proxyCreationCode()"))[:4])
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	args, err := methodArguments("(bytes)")
+	if err != nil {
+		return common.Address{}, err
+	}
+	values, err := args.UnpackValues(creationCode)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid proxyCreationCode response: %w", err)
+	}
+
+	deploymentData := append(common.CopyBytes(values[0].([]byte)), common.LeftPadBytes(d.Singleton.Bytes(), 32)...)
+	salt := crypto.Keccak256(crypto.Keccak256(initializer), common.LeftPadBytes(d.SaltNonce.Bytes(), 32))
+
+	return crypto.CreateAddress2(d.Factory, common.BytesToHash(salt), crypto.Keccak256(deploymentData)), nil
+}
+
+func (d *safeDeployment) calldata() ([]byte, error) {
+	initializer, err := d.initializer()
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeCall("createProxyWithNonce(address,bytes,uint256)", d.Singleton, initializer, d.SaltNonce)
+}
+
+func waitForIndexing(safe common.Address, timeout time.Duration) (*safeNonceResponse, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := getSafeInfo(safe.Hex())
+		if err == nil {
+			return info, nil
+		}
+		if err != errSafeNotFound {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("safe %s was not indexed by the transaction service within %s", safe.Hex(), timeout)
+		}
+		if err := sleep(5 * time.Second); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func deploySafe(rpc, privKey string, d *safeDeployment, indexTimeout time.Duration, fees *feeOptions) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	address, err := d.predictAddress(client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("safe address:", address.Hex())
+
+	code, err := client.CodeAt(opCtx, address, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) > 0 {
+		return fmt.Errorf("safe %s is already deployed, use a different salt nonce", address.Hex())
+	}
+
+	data, err := d.calldata()
+	if err != nil {
+		return err
+	}
+
+	key, err := crypto.HexToECDSA(privKey)
+	if err != nil {
+		return err
+	}
+
+	if len(d.setupCalls()) > 0 {
+		code, err := client.CodeAt(opCtx, d.SetupMultiSend, nil)
+		if err != nil {
+			return err
+		}
+		if len(code) == 0 {
+			return fmt.Errorf("setup multiSend %s is not deployed on this chain, pass the 1.4.1 MultiSend with -setup-multisend", d.SetupMultiSend.Hex())
+		}
+	}
+	// refuse before deploying rather than leave an unfunded safe
+	if d.Funding != nil && d.Funding.Sign() > 0 {
+		deployer := crypto.PubkeyToAddress(key.PublicKey)
+		balance, err := client.BalanceAt(opCtx, deployer, nil)
+		if err != nil {
+			return err
+		}
+		if balance.Cmp(d.Funding) <= 0 {
+			return fmt.Errorf("deployer %s holds %s, not enough to fund the safe with %s and pay for gas", deployer.Hex(), formatWei(balance), formatWei(d.Funding))
+		}
+	}
+
+	suggested, err := suggestFees(rpc, fees)
+	if err != nil {
+		return err
+	}
+	if _, err := sendEthTransaction(client, key, d.Factory, common.Big0, data, suggested); err != nil {
+		return err
+	}
+	if err := checkDeployment(client, address, d); err != nil {
+		return err
+	}
+
+	if d.Funding != nil && d.Funding.Sign() > 0 {
+		fmt.Println("funding the safe with", formatWei(d.Funding))
+		if _, err := sendEthTransaction(client, key, address, d.Funding, nil, suggested); err != nil {
+			return fmt.Errorf("safe %s deployed but not funded: %w", address.Hex(), err)
+		}
+	}
+
+	fmt.Println("waiting for the transaction service to index the safe...")
+
+	info, err := waitForIndexing(address, indexTimeout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("safe indexed, version:", info.Version, "threshold:", info.Threshold, "owners:", info.Owners)
+	return nil
+}
+
+// checkDeployment reads the deployed safe back, its setup must match d
+func checkDeployment(client EthClient, safe common.Address, d *safeDeployment) error {
+	state, err := readSafeState(client, safe, nil)
+	if err != nil {
+		return err
+	}
+	if state.Threshold != d.Threshold || len(state.Owners) != len(d.Owners) {
+		return fmt.Errorf("deployed safe %s has %d of %d owners, want %d of %d", safe.Hex(), state.Threshold, len(state.Owners), d.Threshold, len(d.Owners))
+	}
+	if state.FallbackHandler != d.FallbackHandler {
+		return fmt.Errorf("deployed safe %s has fallback handler %s, want %s", safe.Hex(), state.FallbackHandler.Hex(), d.FallbackHandler.Hex())
+	}
+	if state.Guard != d.Guard {
+		return fmt.Errorf("deployed safe %s has guard %s, want %s", safe.Hex(), state.Guard.Hex(), d.Guard.Hex())
+	}
+	for _, module := range d.Modules {
+		values, err := callView(client, safe, "isModuleEnabled(address)", "(bool)", module)
+		if err != nil {
+			return err
+		}
+		if !values[0].(bool) {
+			return fmt.Errorf("module %s is not enabled on the deployed safe %s", module.Hex(), safe.Hex())
+		}
+	}
+
+	fmt.Printf("safe deployed: %d of %d owners", state.Threshold, len(state.Owners))
+	if len(d.Modules) > 0 {
+		fmt.Printf(", %d modules", len(d.Modules))
+	}
+	if d.Guard != (common.Address{}) {
+		fmt.Print(", guard ", displayAddress(d.Guard))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// drafts are batch files composed over several sessions before anything is
+// signed, kept as <name>.json in the drafts directory; a draft is a plain
+// batch file, shared as it is and proposed with batch -draft or -file
+
+var draftNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// draftsDir is dir when given, otherwise $GNOSIS_TX_DRAFTS_DIR or drafts in
+// the config directory
+func draftsDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if env := os.Getenv("GNOSIS_TX_DRAFTS_DIR"); env != "" {
+		return env
+	}
+	return configPath("drafts")
+}
+
+func draftPath(dir, name string) (string, error) {
+	if !draftNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid draft name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(draftsDir(dir), name+".json"), nil
+}
+
+// loadDraft reads a draft, nil when there is none of that name
+func loadDraft(dir, name string) (*batchFile, error) {
+	path, err := draftPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return loadBatchFile(path)
+}
+
+// saveDraft writes a draft as indented json, the same draft always giving the
+// same bytes so its changes read well in a diff
+func saveDraft(dir, name string, draft *batchFile) (string, error) {
+	path, err := draftPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := json.MarshalIndent(draft, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, append(encoded, '\n'), 0o644)
+}
+
+type draftSummary struct {
+	Name  string
+	Path  string
+	Draft *batchFile
+	Err   error
+}
+
+// listDrafts returns the drafts of the directory by name, a draft that
+// doesn't parse is listed with its error
+func listDrafts(dir string) ([]draftSummary, error) {
+	entries, err := ioutil.ReadDir(draftsDir(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var drafts []draftSummary
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || name == entry.Name() || !draftNamePattern.MatchString(name) {
+			continue
+		}
+		summary := draftSummary{Name: name, Path: filepath.Join(draftsDir(dir), entry.Name())}
+		summary.Draft, summary.Err = loadBatchFile(summary.Path)
+		drafts = append(drafts, summary)
+	}
+	sort.Slice(drafts, func(i, j int) bool { return drafts[i].Name < drafts[j].Name })
+	return drafts, nil
+}
+
+// checkDraftCall builds a call without variables to catch mistakes when it
+// is saved, calls with ${VARIABLES} are only checked when proposed
+func checkDraftCall(call batchCall) error {
+	fields := append([]string{call.To, call.Value, call.Method, call.Data}, call.Args...)
+	for _, field := range fields {
+		if strings.Contains(field, "${") {
+			return nil
+		}
+	}
+	vars, err := newVariables(nil)
+	if err != nil {
+		return err
+	}
+	_, err = call.build(vars)
+	return err
+}
+
+// removeDraftCall drops the call at the 1-based index
+func removeDraftCall(draft *batchFile, index int) error {
+	if index < 1 || index > len(draft.Calls) {
+		return fmt.Errorf("the draft has no call %d, it has %d", index, len(draft.Calls))
+	}
+	if len(draft.Calls) == 1 {
+		return errors.New("can't remove the only call of the draft, delete the draft instead")
+	}
+	draft.Calls = append(draft.Calls[:index-1], draft.Calls[index:]...)
+	return nil
+}
+
+// editDraftFile opens a copy of the draft in $VISUAL or $EDITOR and returns
+// it once it parses as a batch file, the draft itself is left as it was
+// otherwise
+func editDraftFile(path string) (*batchFile, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		return nil, errors.New("set $EDITOR to edit the draft, or edit it with -remove, -description and -safe")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".edit-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+
+	// the editor may come with arguments, e.g. "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], tmp.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor: %w", err)
+	}
+	return loadBatchFile(tmp.Name())
+}
+
+// argFlags collects repeated -arg flags in order
+type argFlags []string
+
+func (a *argFlags) String() string {
+	return strings.Join(*a, " ")
+}
+
+func (a *argFlags) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+// a draft is signed as a team in a shared directory, typically a git repo:
+// draft freeze writes <name>.signing/transaction.json, the transaction the
+// draft resolves to at a nonce, and every owner adds <name>.signing/<owner>.json
+// with draft sign; each file is written on its own so owners signing in
+// parallel branches never conflict
+const (
+	DRAFT_SIGNING_SUFFIX = ".signing"
+	DRAFT_TX_FILE        = "transaction.json"
+	// origin fields tying a frozen transaction to its draft
+	ORIGIN_DRAFT      = "draft"
+	ORIGIN_DRAFT_HASH = "draftHash"
+)
+
+func signingDir(dir, name string) (string, error) {
+	path, err := draftPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(path, ".json") + DRAFT_SIGNING_SUFFIX, nil
+}
+
+func draftTxPath(signing string) string {
+	return filepath.Join(signing, DRAFT_TX_FILE)
+}
+
+func draftSignaturePath(signing string, owner common.Address) string {
+	return filepath.Join(signing, owner.Hex()+".json")
+}
+
+// draftHash is the keccak256 of the draft file, recorded when it is frozen
+func draftHash(dir, name string) (common.Hash, error) {
+	path, err := draftPath(dir, name)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(content), nil
+}
+
+// frozenDraftHash returns the draft hash recorded in the origin of a frozen
+// transaction
+func frozenDraftHash(tx *multisigTxResponse) common.Hash {
+	if tx.Origin == nil {
+		return common.Hash{}
+	}
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(*tx.Origin), &fields); err != nil {
+		return common.Hash{}
+	}
+	return common.HexToHash(fields[ORIGIN_DRAFT_HASH])
+}
+
+// newFrozenDraft is the transaction file of a draft resolved to a call, in
+// the transaction service format sign and aggregate read
+func newFrozenDraft(name string, hash common.Hash, safe, to common.Address, value *big.Int, data []byte, operation uint8, safeTxGas, baseGas, nonce, chainID int64, version string) (*multisigTxResponse, error) {
+	origin, err := json.Marshal(map[string]string{ORIGIN_NAME: DEFAULT_ORIGIN_NAME, ORIGIN_DRAFT: name, ORIGIN_DRAFT_HASH: hash.Hex()})
+	if err != nil {
+		return nil, err
+	}
+	encodedData := hexutil.Encode(data)
+	originJSON := string(origin)
+	tx := &multisigTxResponse{
+		Safe:           safe.Hex(),
+		To:             to.Hex(),
+		Value:          value.String(),
+		Data:           &encodedData,
+		Operation:      operation,
+		GasToken:       ZERO_ADDR,
+		SafeTxGas:      safeTxGas,
+		BaseGas:        baseGas,
+		GasPrice:       "0",
+		RefundReceiver: ZERO_ADDR,
+		Nonce:          nonce,
+		Origin:         &originJSON,
+		SafeVersion:    version,
+	}
+	safeTxHash, err := tx.hash(chainID, version)
+	if err != nil {
+		return nil, err
+	}
+	tx.SafeTxHash = safeTxHash.Hex()
+	return tx, nil
+}
+
+// writeFrozenDraft writes the transaction of a draft, removing the signatures
+// of an earlier freeze as they are over another transaction
+func writeFrozenDraft(dir, name string, tx *multisigTxResponse) (string, error) {
+	signing, err := signingDir(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(signing, 0o700); err != nil {
+		return "", err
+	}
+	sigs, _, err := loadDraftSignatures(signing)
+	if err != nil {
+		return "", err
+	}
+	for path, sig := range sigs {
+		if !strings.EqualFold(sig.SafeTxHash, tx.SafeTxHash) {
+			if err := os.Remove(path); err != nil {
+				return "", err
+			}
+			fmt.Println("removed the signature of", sig.Owner, "over the earlier transaction", sig.SafeTxHash)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := draftTxPath(signing)
+	return path, ioutil.WriteFile(path, append(encoded, '\n'), 0o644)
+}
+
+// loadDraftSignatures reads the signature files of a signing directory by
+// path, a file that can't be read is returned as an error of its own
+func loadDraftSignatures(signing string) (map[string]*detachedSignature, map[string]error, error) {
+	entries, err := ioutil.ReadDir(signing)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sigs := map[string]*detachedSignature{}
+	invalid := map[string]error{}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == DRAFT_TX_FILE || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(signing, entry.Name())
+		if sig, err := loadDetachedSignature(path); err != nil {
+			invalid[path] = err
+		} else {
+			sigs[path] = sig
+		}
+	}
+	return sigs, invalid, nil
+}
+
+// draftSignature is a signature file of a draft as checked by draft status
+type draftSignature struct {
+	Path  string
+	Owner common.Address
+	// why the signature doesn't count, empty when it does
+	Problem string
+}
+
+// checkDraftSignatures checks the signatures of a frozen draft against its
+// transaction and the owners of the safe, sorted by owner
+func checkDraftSignatures(tx *multisigTxResponse, sigs map[string]*detachedSignature, invalid map[string]error, owners []common.Address) ([]draftSignature, error) {
+	chainID, version, err := txDomain(tx, nil)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := tx.hash(chainID, version)
+	if err != nil {
+		return nil, err
+	}
+	isOwner := map[common.Address]bool{}
+	for _, owner := range owners {
+		isOwner[owner] = true
+	}
+
+	var checked []draftSignature
+	for path, err := range invalid {
+		checked = append(checked, draftSignature{Path: path, Problem: err.Error()})
+	}
+	for path, sig := range sigs {
+		s := draftSignature{Path: path, Owner: common.HexToAddress(sig.Owner)}
+		switch {
+		case common.HexToHash(sig.SafeTxHash) != hash:
+			s.Problem = "over " + sig.SafeTxHash + ", an earlier freeze of the draft"
+		case !isOwner[s.Owner]:
+			s.Problem = "not an owner of the safe"
+		default:
+			if err := checkDetachedSignature(sig, hash); err != nil {
+				s.Problem = err.Error()
+			}
+		}
+		checked = append(checked, s)
+	}
+	sort.Slice(checked, func(i, j int) bool {
+		if checked[i].Owner != checked[j].Owner {
+			return bytes.Compare(checked[i].Owner.Bytes(), checked[j].Owner.Bytes()) < 0
+		}
+		return checked[i].Path < checked[j].Path
+	})
+	return checked, nil
+}
+
+// printDraftStatus shows where the signing of a draft stands: whether it is
+// frozen, which owners signed its transaction and which are missing; the
+// owners are read via client when given, otherwise from the service
+func printDraftStatus(dir string, d draftSummary, client EthClient) error {
+	if d.Err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", d.Name, d.Err)
+		return nil
+	}
+	fmt.Printf("%s: %d calls", d.Name, len(d.Draft.Calls))
+	if d.Draft.Description != "" {
+		fmt.Print(", ", d.Draft.Description)
+	}
+	fmt.Println()
+
+	signing, err := signingDir(dir, d.Name)
+	if err != nil {
+		return err
+	}
+	txPath := draftTxPath(signing)
+	if _, err := os.Stat(txPath); os.IsNotExist(err) {
+		fmt.Println("  not frozen, freeze it with draft freeze -name", d.Name)
+		return nil
+	}
+	tx, err := loadSafeTxFile(txPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  transaction %s of %s at nonce %d\n", tx.SafeTxHash, displayAddress(common.HexToAddress(tx.Safe)), tx.Nonce)
+	if current, err := draftHash(dir, d.Name); err == nil && current != frozenDraftHash(tx) {
+		fmt.Println("  the draft changed since it was frozen, freeze it again")
+	}
+
+	var owners []common.Address
+	var threshold, nonce int64
+	if client != nil {
+		state, err := readSafeState(client, common.HexToAddress(tx.Safe), nil)
+		if err != nil {
+			return err
+		}
+		owners, threshold, nonce = state.Owners, state.Threshold, state.Nonce
+	} else {
+		info, err := getSafeInfo(tx.Safe)
+		if err != nil {
+			return fmt.Errorf("%w, pass -rpc to read the owners from the chain", err)
+		}
+		owners, threshold, nonce = checksummed(info.Owners), info.Threshold, info.Nonce
+	}
+	if nonce > tx.Nonce {
+		fmt.Printf("  nonce %d is already used, the safe is at nonce %d\n", tx.Nonce, nonce)
+	}
+
+	sigs, invalid, err := loadDraftSignatures(signing)
+	if err != nil {
+		return err
+	}
+	checked, err := checkDraftSignatures(tx, sigs, invalid, owners)
+	if err != nil {
+		return err
+	}
+	signed := map[common.Address]bool{}
+	var valid []string
+	for _, s := range checked {
+		if s.Problem != "" {
+			fmt.Printf("  invalid %s: %s\n", s.Path, s.Problem)
+			continue
+		}
+		if !signed[s.Owner] {
+			signed[s.Owner] = true
+			valid = append(valid, s.Path)
+		}
+	}
+	fmt.Printf("  signed by %d of %d required:\n", len(signed), threshold)
+	var missing []string
+	for _, owner := range owners {
+		if signed[owner] {
+			fmt.Println("    " + displayAddress(owner))
+		} else {
+			missing = append(missing, displayAddress(owner))
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Println("  not signed by:", strings.Join(missing, ", "))
+	}
+	if int64(len(signed)) >= threshold {
+		fmt.Println("  ready, the signatures are aggregated with: aggregate -tx", txPath, strings.Join(valid, " "))
+	}
+	return nil
+}
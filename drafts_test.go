@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDraftCommand(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	dir := t.TempDir()
+
+	steps := [][]string{
+		{"save", "-dir", dir, "-name", "payroll", "-safe", testSafe, "-to", goldenWETH, "-method", "transfer(address,uint256)", "-arg", testRecipient, "-arg", "1000"},
+		{"save", "-dir", dir, "-name", "payroll", "-to", testRecipient, "-value", "${AMOUNT}"},
+		{"save", "-dir", dir, "-name", "payroll", "-to", testRecipient, "-value", "5"},
+		{"edit", "-dir", dir, "-name", "payroll", "-remove", "2", "-description", "monthly payroll"},
+	}
+	for _, args := range steps {
+		if err := draftCommand(args); err != nil {
+			t.Fatalf("draft %s: %v", strings.Join(args, " "), err)
+		}
+	}
+
+	draft, err := loadDraft(dir, "payroll")
+	if err != nil || draft == nil {
+		t.Fatalf("loadDraft = %v, %v", draft, err)
+	}
+	if len(draft.Calls) != 2 || draft.Calls[1].Value != "5" || draft.Description != "monthly payroll" || draft.Safe != testSafe {
+		t.Errorf("draft = %+v, want the transfer and the 5 wei call of %s", draft, testSafe)
+	}
+
+	// saving the same draft again writes the same bytes
+	path := filepath.Join(dir, "payroll.json")
+	before, _ := ioutil.ReadFile(path)
+	if _, err := saveDraft(dir, "payroll", draft); err != nil {
+		t.Fatalf("saveDraft: %v", err)
+	}
+	if after, _ := ioutil.ReadFile(path); string(after) != string(before) {
+		t.Errorf("draft rewritten as\n%s\nwant\n%s", after, before)
+	}
+
+	if err := draftCommand([]string{"save", "-dir", dir, "-name", "payroll", "-to", "0x1234"}); err == nil {
+		t.Errorf("draft save of an invalid address succeeded, want an error")
+	}
+	if err := draftCommand([]string{"save", "-dir", dir, "-name", "../payroll", "-to", testRecipient}); err == nil {
+		t.Errorf("draft save outside the drafts directory succeeded, want an error")
+	}
+	if err := draftCommand([]string{"delete", "-dir", dir, "-name", "payroll"}); err != nil {
+		t.Fatalf("draft delete: %v", err)
+	}
+	if drafts, err := listDrafts(dir); err != nil || len(drafts) != 0 {
+		t.Errorf("listDrafts after delete = %v, %v, want none", drafts, err)
+	}
+}
+
+func TestDraftSigningSession(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	useService(t, proposalService())
+	dir := t.TempDir()
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+
+	steps := [][]string{
+		{"save", "-dir", dir, "-name", "grant", "-safe", testSafe, "-to", testRecipient, "-value", "1000"},
+		{"freeze", "-dir", dir, "-name", "grant"},
+		{"sign", "-dir", dir, "-name", "grant", "-key", key},
+	}
+	for _, args := range steps {
+		if err := draftCommand(args); err != nil {
+			t.Fatalf("draft %s: %v", strings.Join(args, " "), err)
+		}
+	}
+
+	signing, _ := signingDir(dir, "grant")
+	tx, err := loadSafeTxFile(draftTxPath(signing))
+	if err != nil {
+		t.Fatalf("loadSafeTxFile: %v", err)
+	}
+	if tx.Nonce != 7 || tx.SafeTxGas != 0 || tx.Value != "1000" {
+		t.Errorf("frozen transaction = %+v, want 1000 wei at nonce 7 with safeTxGas 0", tx)
+	}
+	sigs, invalid, err := loadDraftSignatures(signing)
+	if err != nil {
+		t.Fatalf("loadDraftSignatures: %v", err)
+	}
+	checked, err := checkDraftSignatures(tx, sigs, invalid, []common.Address{testOwner})
+	if err != nil || len(checked) != 1 || checked[0].Owner != testOwner || checked[0].Problem != "" {
+		t.Errorf("checkDraftSignatures = %+v, %v, want a valid signature of %s", checked, err, testOwner.Hex())
+	}
+
+	// a draft changed after freezing is frozen again before it is signed
+	if err := draftCommand([]string{"save", "-dir", dir, "-name", "grant", "-to", testRecipient, "-value", "500"}); err != nil {
+		t.Fatalf("draft save: %v", err)
+	}
+	if err := draftCommand([]string{"sign", "-dir", dir, "-name", "grant", "-key", key}); err == nil || !strings.Contains(err.Error(), "freeze it again") {
+		t.Errorf("draft sign of a changed draft = %v, want a freeze it again error", err)
+	}
+	if err := draftCommand([]string{"freeze", "-dir", dir, "-name", "grant"}); err != nil {
+		t.Fatalf("draft freeze: %v", err)
+	}
+	if sigs, _, _ := loadDraftSignatures(signing); len(sigs) != 0 {
+		t.Errorf("%d signatures kept after freezing the changed draft, want the stale one removed", len(sigs))
+	}
+
+	// a policy the transaction breaks is checked before it is signed
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := ioutil.WriteFile(policyFile, []byte(`{"allowedDestinations": ["`+goldenWETH+`"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := draftCommand([]string{"sign", "-dir", dir, "-name", "grant", "-key", key, "-policy", policyFile}); err == nil || !strings.Contains(err.Error(), "policy violation") {
+		t.Errorf("draft sign against the policy = %v, want a policy violation", err)
+	}
+	if sigs, _, _ := loadDraftSignatures(signing); len(sigs) != 0 {
+		t.Errorf("%d signatures written against the policy, want none", len(sigs))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// dialRPC connects to rpc, which has to be on the chain of the transaction
+// service; while that one is unknown, the chain of the rpc is taken
+func dialRPC(rpc string) (EthClient, error) {
+	if rpc == "" {
+		return nil, errors.New("an -rpc endpoint is required")
+	}
+	client, err := ethclient.DialContext(opCtx, rpc)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkChain(client, rpc); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// dialRawRPC connects to rpc for the calls ethclient doesn't wrap, with the
+// chain checked as by dialRPC
+func dialRawRPC(rpcURL string) (*rpc.Client, error) {
+	client, err := rpc.DialContext(opCtx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkChain(ethclient.NewClient(client), rpcURL); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func checkChain(client EthClient, rpc string) error {
+	chainID, err := client.ChainID(opCtx)
+	if err != nil {
+		return fmt.Errorf("reading the chain id of %s: %w", redactURL(rpc), err)
+	}
+	if serviceChainID == 0 {
+		if err := currentNetworks().checkChain(chainID.Int64()); err != nil {
+			return err
+		}
+		logger.Debug("chain read from the rpc", "chainId", chainID)
+		serviceChainID = chainID.Int64()
+		return nil
+	}
+	if chainID.Int64() != serviceChainID {
+		return fmt.Errorf("rpc %s is on %s, the transaction service %s on %s", redactURL(rpc), networkName(chainID.Int64()), serviceURL, networkName(serviceChainID))
+	}
+	return nil
+}
+
+func callContract(client EthClient, to common.Address, data []byte) ([]byte, error) {
+	return client.CallContract(opCtx, ethereum.CallMsg{To: &to, Data: data}, nil)
+}
+
+func callFrom(client EthClient, from, to common.Address, value *big.Int, data []byte) ([]byte, error) {
+	return client.CallContract(opCtx, ethereum.CallMsg{From: from, To: &to, Value: value, Data: data}, nil)
+}
+
+// sendEthTransaction signs and sends a transaction from the key's address and
+// waits for it to be mined
+func sendEthTransaction(client EthClient, key *ecdsa.PrivateKey, to common.Address, value *big.Int, data []byte, fees *txFees) (*types.Receipt, error) {
+	signedTx, err := submitEthTransaction(client, key, to, value, data, fees)
+	if err != nil {
+		return nil, err
+	}
+	return waitForReceipt(client, signedTx)
+}
+
+// submitEthTransaction signs and sends a transaction without waiting for it
+func submitEthTransaction(client EthClient, key *ecdsa.PrivateKey, to common.Address, value *big.Int, data []byte, fees *txFees) (*types.Transaction, error) {
+	ctx := opCtx
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	gas, err := client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Value: value, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("gas estimation failed: %w", err)
+	}
+
+	tx := newFeeTx(chainID, nonce, to, value, gas, data, fees)
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.SendTransaction(ctx, signedTx); err != nil {
+		return nil, err
+	}
+
+	logger.Info("transaction sent", "txHash", signedTx.Hash().Hex(), "fees", fees)
+	currentOperation.TxHash = signedTx.Hash().Hex()
+	currentOperation.step("waiting for receipt")
+
+	return signedTx, nil
+}
+
+// EthClient is the part of the ethereum rpc the tool uses, implemented by
+// ethclient.Client and by fakes in tests
+type EthClient interface {
+	ethereum.ChainStateReader
+	ethereum.ContractCaller
+	ethereum.LogFilterer
+	ethereum.TransactionReader
+	ethereum.TransactionSender
+	ethereum.GasEstimator
+	ethereum.GasPricer
+	ethereum.PendingStateReader
+	ChainID(ctx context.Context) (*big.Int, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	Close()
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// buildSignatures verifies the confirmations of current owners, adds
+// approved-hash entries for owners who approved onchain (and for the
+// executor, if an owner), and encodes them sorted by owner address as
+// required by execTransaction
+func buildSignatures(tx *multisigTxResponse, client EthClient, executor common.Address) ([]byte, int64, error) {
+	safe := common.HexToAddress(tx.Safe)
+
+	gnosisSafeTx, err := tx.gnosisSafeTx()
+	if err != nil {
+		return nil, 0, err
+	}
+	chainID, version, err := txDomain(tx, client)
+	if err != nil {
+		return nil, 0, err
+	}
+	encodedTx, err := encodeSafeTx(gnosisSafeTx, chainID, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash := crypto.Keccak256Hash(encodedTx)
+
+	if hash != common.HexToHash(tx.SafeTxHash) {
+		return nil, 0, fmt.Errorf("transaction fields hash to %s, not %s", hash.Hex(), tx.SafeTxHash)
+	}
+
+	state, err := readSafeState(client, safe, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	isOwner := map[common.Address]bool{}
+	for _, owner := range state.Owners {
+		isOwner[owner] = true
+	}
+
+	signed := map[common.Address]bool{}
+	var sigs []ownerSignature
+	for _, confirmation := range tx.Confirmations {
+		// the service keeps the confirmations of removed owners, the safe
+		// reverts with GS026 on them
+		owner := common.HexToAddress(confirmation.Owner)
+		if !isOwner[owner] {
+			logger.Warn("confirmation of a non-owner ignored", "owner", confirmation.Owner)
+			continue
+		}
+		if signed[owner] {
+			logger.Warn("duplicate confirmation ignored", "owner", confirmation.Owner)
+			continue
+		}
+
+		signature, err := hexutil.Decode(confirmation.Signature)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid signature of owner %s: %w", confirmation.Owner, err)
+		}
+
+		sig, err := verifyOwnerSignature(safe, hash, encodedTx, signature, client)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid signature of owner %s: %w", confirmation.Owner, err)
+		}
+		if sig.Owner != owner {
+			return nil, 0, fmt.Errorf("confirmation of %s is signed by %s", confirmation.Owner, sig.Owner.Hex())
+		}
+		signed[sig.Owner] = true
+		sigs = append(sigs, *sig)
+	}
+
+	for _, owner := range state.Owners {
+		if signed[owner] {
+			continue
+		}
+
+		// the safe accepts v=1 for msg.sender without an onchain approval
+		approved := owner == executor
+		if !approved {
+			if approved, err = isHashApproved(client, safe, owner, hash); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if approved {
+			fmt.Println("using approved hash of", owner.Hex())
+			signed[owner] = true
+			sigs = append(sigs, encodeApprovedHash(owner))
+		}
+	}
+
+	if int64(len(sigs)) < state.Threshold {
+		return nil, 0, fmt.Errorf("transaction has %d of %d required confirmations", len(sigs), state.Threshold)
+	}
+
+	return encodeSignatures(sigs), int64(len(sigs)), nil
+}
+
+func encodeExecTransaction(tx *multisigTxResponse, signatures []byte) ([]byte, error) {
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %q", tx.Value)
+	}
+
+	gasPrice, ok := new(big.Int).SetString(tx.GasPrice, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid gas price %q", tx.GasPrice)
+	}
+
+	var data []byte
+	if tx.Data != nil {
+		var err error
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeCall("execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)",
+		common.HexToAddress(tx.To), value, data, tx.Operation, big.NewInt(tx.SafeTxGas), big.NewInt(tx.BaseGas),
+		gasPrice, common.HexToAddress(tx.GasToken), common.HexToAddress(tx.RefundReceiver), signatures)
+}
+
+// executionContext collects the parameters used to explain a failed execution
+func executionContext(client EthClient, tx *multisigTxResponse, signatures int64, executor common.Address) *revertContext {
+	gasPrice, _ := new(big.Int).SetString(tx.GasPrice, 10)
+	c := &revertContext{
+		Operation:  tx.Operation,
+		SafeTxGas:  tx.SafeTxGas,
+		BaseGas:    tx.BaseGas,
+		GasPrice:   gasPrice,
+		GasToken:   common.HexToAddress(tx.GasToken),
+		Signatures: signatures,
+		Executor:   executor,
+	}
+
+	if state, err := readSafeState(client, common.HexToAddress(tx.Safe), nil); err == nil {
+		c.Threshold = state.Threshold
+		c.Owners = len(state.Owners)
+		c.IsOwner = state.isOwner(executor)
+	}
+	return c
+}
+
+// executeOptions are the settings of an execution, with a relay no executor
+// key is needed
+type executeOptions struct {
+	rpc           string
+	privKey       string
+	relay         string
+	confirmations confirmationsConfig
+	// usd value used to pick the confirmation depth, negative for the native value
+	usdValue float64
+	usdPrice float64
+	hooks    *hooksConfig
+	fees     *feeOptions
+	wait     bool
+}
+
+func executeTransaction(safeTxHash string, opts *executeOptions) error {
+	currentOperation.SafeTxHash = safeTxHash
+	currentOperation.step("fetching transaction")
+
+	tx, err := getMultisigTransaction(safeTxHash)
+	if err != nil {
+		return err
+	}
+
+	if tx.IsExecuted {
+		return errors.New("transaction is already executed")
+	}
+
+	return executeSafeTx(tx, nil, opts)
+}
+
+// executeTransactionFile executes a transaction file with the detached
+// signatures of its owners, without the transaction service
+func executeTransactionFile(txFile string, sigFiles []string, opts *executeOptions) error {
+	tx, sigs, err := loadSignedTxFile(txFile, sigFiles, opts.rpc)
+	if err != nil {
+		return err
+	}
+	currentOperation.SafeTxHash = tx.SafeTxHash
+
+	return executeSafeTx(tx, sigs, opts)
+}
+
+// executeSafeTx executes with the detached signatures when given, otherwise
+// with the confirmations of the service and approved hashes
+func executeSafeTx(tx *multisigTxResponse, detached []*detachedSignature, opts *executeOptions) error {
+	client, err := dialRPC(opts.rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// a relay sends from its own account, which can't stand in for an owner
+	var key *ecdsa.PrivateKey
+	var executor common.Address
+	if opts.relay == "" {
+		if key, err = crypto.HexToECDSA(opts.privKey); err != nil {
+			return err
+		}
+		executor = crypto.PubkeyToAddress(key.PublicKey)
+	}
+
+	currentOperation.step("collecting signatures")
+	var signatures []byte
+	var count int64
+	if detached != nil {
+		signatures, count, err = bundleSignatures(tx, detached, client)
+	} else {
+		signatures, count, err = buildSignatures(tx, client, executor)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeExecTransaction(tx, signatures)
+	if err != nil {
+		return err
+	}
+
+	chainID, err := client.ChainID(opCtx)
+	if err != nil {
+		return err
+	}
+
+	// value used to pick the confirmation depth, the native value unless given explicitly
+	usdValue := opts.usdValue
+	if usdValue < 0 {
+		usdPrice := opts.usdPrice
+		if usdPrice == 0 {
+			usdPrice = opts.confirmations[chainID.String()].NativeUsdPrice
+		}
+		value, _ := new(big.Int).SetString(tx.Value, 10)
+		usdValue = weiToUsd(value, usdPrice)
+	}
+	depth := opts.confirmations.requiredConfirmations(chainID, usdValue)
+	// the depth and the post-execution hooks need the receipt
+	if !opts.wait && (depth > 1 || len(opts.hooks.PostExecution) > 0) {
+		logger.Warn("waiting for the receipt despite -wait=false, the execution needs a confirmation depth or runs post-execution hooks", "confirmations", depth, "hooks", len(opts.hooks.PostExecution))
+		opts.wait = true
+	}
+
+	currentOperation.RPC = opts.rpc
+	currentOperation.Confirmations = depth
+	var receipt *types.Receipt
+	if opts.relay != "" {
+		var relay RelayClient
+		if relay, err = newRelayClient(opts.relay); err != nil {
+			return err
+		}
+		receipt, err = relayExecution(client, relay, chainID, common.HexToAddress(tx.Safe), data, opts.wait)
+	} else {
+		receipt, err = sendExecution(client, key, common.HexToAddress(tx.Safe), data, opts)
+	}
+	if receipt == nil && err == nil {
+		return nil
+	}
+
+	var event *safeExecutionEvent
+	if receipt != nil {
+		event = reportExecution(client, receipt, tx)
+	}
+	if err != nil {
+		return explainRevert(err, executionContext(client, tx, count, executor))
+	}
+
+	fmt.Println("mined in block", receipt.BlockNumber, "- waiting for", depth, "confirmations")
+	currentOperation.step("waiting for confirmations")
+
+	if err := waitForConfirmations(client, receipt, depth); err != nil {
+		return err
+	}
+
+	fmt.Println("executed:", receipt.TxHash.Hex())
+	currentOperation.step("executed")
+
+	if err := runPostExecutionHooks(opts.hooks.PostExecution, newExecutionResult(tx, receipt, executor, depth)); err != nil {
+		return err
+	}
+	if event != nil && !event.Success {
+		return errExecutionFailed
+	}
+	return nil
+}
+
+// sendExecution sends execTransaction from the executor key, returning the
+// receipt or nil when not waiting for it
+func sendExecution(client EthClient, key *ecdsa.PrivateKey, safe common.Address, data []byte, opts *executeOptions) (*types.Receipt, error) {
+	fees, err := suggestFees(opts.rpc, opts.fees)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := submitEthTransaction(client, key, safe, common.Big0, data, fees)
+	if err != nil {
+		return nil, err
+	}
+	currentOperation.Submitted = true
+
+	if !opts.wait {
+		fmt.Println("not waiting for the receipt, follow it with receipt -tx-hash", signedTx.Hash().Hex(), "-rpc <RPC>, or replace it at higher fees with speedup")
+		return nil, nil
+	}
+	return waitForReceipt(client, signedTx)
+}
+
+// approveHash sends approveHash(hash) to the safe from an owner key
+func approveHash(rpc, privKey string, safe common.Address, hash common.Hash, fees *feeOptions) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	key, err := crypto.HexToECDSA(privKey)
+	if err != nil {
+		return err
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+
+	state, err := readSafeState(client, safe, nil)
+	if err != nil {
+		return err
+	}
+	if !state.isOwner(owner) {
+		return fmt.Errorf("%s is not an owner of %s", owner.Hex(), safe.Hex())
+	}
+
+	approved, err := isHashApproved(client, safe, owner, hash)
+	if err != nil {
+		return err
+	}
+	if approved {
+		return fmt.Errorf("%s already approved %s", owner.Hex(), hash.Hex())
+	}
+
+	data, err := encodeCall("approveHash(bytes32)", hash)
+	if err != nil {
+		return err
+	}
+
+	suggested, err := suggestFees(rpc, fees)
+	if err != nil {
+		return err
+	}
+	if _, err := sendEthTransaction(client, key, safe, common.Big0, data, suggested); err != nil {
+		return err
+	}
+
+	fmt.Println("approved", hash.Hex(), "as", owner.Hex())
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newSafeRPC serves the state of a safe with the given owners and threshold,
+// with no hash approved onchain
+func newSafeRPC(t *testing.T, owners []common.Address, threshold int64) EthClient {
+	t.Helper()
+	results := map[string]func() ([]byte, error){
+		"getOwners()": func() ([]byte, error) {
+			args, err := methodArguments("(address[])")
+			if err != nil {
+				return nil, err
+			}
+			return args.Pack(owners)
+		},
+		"getThreshold()":                  func() ([]byte, error) { return common.LeftPadBytes(big.NewInt(threshold).Bytes(), 32), nil },
+		"nonce()":                         func() ([]byte, error) { return make([]byte, 32), nil },
+		"approvedHashes(address,bytes32)": func() ([]byte, error) { return make([]byte, 32), nil },
+	}
+	selectors := map[string]func() ([]byte, error){}
+	for signature, result := range results {
+		selectors[hexutil.Encode(crypto.Keccak256([]byte(signature))[:4])] = result
+	}
+
+	return newTestRPC(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_getBlockByNumber": func([]json.RawMessage) (interface{}, error) {
+			return &types.Header{Number: big.NewInt(100), Difficulty: new(big.Int)}, nil
+		},
+		"eth_getStorageAt": func([]json.RawMessage) (interface{}, error) {
+			return common.Hash{}.Hex(), nil
+		},
+		"eth_call": func(params []json.RawMessage) (interface{}, error) {
+			var call struct {
+				Data hexutil.Bytes `json:"data"`
+			}
+			if err := json.Unmarshal(params[0], &call); err != nil {
+				return nil, err
+			}
+			result, err := selectors[hexutil.Encode(call.Data[:4])]()
+			return hexutil.Encode(result), err
+		},
+	})
+}
+
+func TestSignaturesOfRemovedOwner(t *testing.T) {
+	removedKey, _ := crypto.HexToECDSA("8f2a55949038a9610f50fb23b5883af3b4ecb3c3bb792cbcefbd1542c692be63")
+
+	tx := &multisigTxResponse{Safe: testSafe, To: testRecipient, Value: "1", GasPrice: "0",
+		GasToken: ZERO_ADDR, RefundReceiver: ZERO_ADDR, SafeVersion: "1.3.0"}
+	hash, err := tx.hash(serviceChainID, tx.SafeVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SafeTxHash = hash.Hex()
+
+	var detached []*detachedSignature
+	for _, key := range []*ecdsa.PrivateKey{testKey, removedKey} {
+		signature, err := signSafeTxHash(hash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owner := crypto.PubkeyToAddress(key.PublicKey).Hex()
+		tx.Confirmations = append(tx.Confirmations, multisigConfirmation{Owner: owner, Signature: hexutil.Encode(signature)})
+		detached = append(detached, &detachedSignature{SafeTxHash: hash.Hex(), Owner: owner, Signature: hexutil.Encode(signature)})
+	}
+
+	// the service still serves the confirmation of the removed owner, which
+	// is neither encoded nor counted towards the threshold
+	client := newSafeRPC(t, []common.Address{testOwner}, 1)
+	blob, count, err := buildSignatures(tx, client, common.Address{})
+	if err != nil {
+		t.Fatalf("buildSignatures: %v", err)
+	}
+	if count != 1 || len(blob) != 65 {
+		t.Fatalf("buildSignatures encoded %d signatures, want 1", count)
+	}
+	if signer, err := recoverSigner(hash, blob); err != nil || signer != testOwner {
+		t.Errorf("buildSignatures encoded the signature of %s, %v, want the one of %s", signer.Hex(), err, testOwner.Hex())
+	}
+	if _, count, err := bundleSignatures(tx, detached, client); err != nil || count != 1 {
+		t.Errorf("bundleSignatures = %d signatures, %v, want 1", count, err)
+	}
+
+	client = newSafeRPC(t, []common.Address{testOwner}, 2)
+	if _, count, err := buildSignatures(tx, client, common.Address{}); err == nil {
+		t.Errorf("buildSignatures = %d signatures, want too few for a threshold of 2", count)
+	}
+	if _, count, err := bundleSignatures(tx, detached, client); err == nil {
+		t.Errorf("bundleSignatures = %d signatures, want too few for a threshold of 2", count)
+	}
+}
+
+func TestAggregateUnverifiedSignatures(t *testing.T) {
+	tx := &multisigTxResponse{Safe: testSafe, To: testRecipient, Value: "1", GasPrice: "0",
+		GasToken: ZERO_ADDR, RefundReceiver: ZERO_ADDR, SafeVersion: "1.3.0"}
+	hash, err := tx.hash(serviceChainID, tx.SafeVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signSafeTxHash(hash, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approver := common.HexToAddress(testRecipient)
+	sigs := []*detachedSignature{
+		{SafeTxHash: hash.Hex(), Owner: testOwner.Hex(), Signature: hexutil.Encode(signature)},
+		{SafeTxHash: hash.Hex(), Owner: approver.Hex(), Signature: hexutil.Encode(encodeApprovedHash(approver).Signature)},
+	}
+	owners := []common.Address{testOwner, approver}
+
+	// without an rpc the approval can't be checked and doesn't count
+	if _, count, err := aggregateSignatures(tx, sigs, owners, 2, nil); err == nil || !strings.Contains(err.Error(), "-rpc") {
+		t.Errorf("aggregateSignatures = %d signatures, %v, want the approved hash to need -rpc", count, err)
+	}
+	blob, count, err := aggregateSignatures(tx, sigs, owners, 1, nil)
+	if err != nil || count != 1 || len(blob) != 65 {
+		t.Fatalf("aggregateSignatures = %d signatures, %v, want the one of %s", count, err, testOwner.Hex())
+	}
+	if signer, err := recoverSigner(hash, blob); err != nil || signer != testOwner {
+		t.Errorf("aggregateSignatures encoded the signature of %s, %v, want the one of %s", signer.Hex(), err, testOwner.Hex())
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// the fakes, the golden transactions and the bundled contracts the tests use
+// are on rinkeby
+const testChainID = 4
+
+func TestMain(m *testing.M) {
+	serviceChainID = testChainID
+	os.Exit(m.Run())
+}
+
+// fakeService is an in-memory transaction service recording what is sent
+type fakeService struct {
+	safe      safeNonceResponse
+	safeTxGas int64
+	pending   []multisigTxResponse
+	// queued by another owner once the pending transactions were first read
+	queuedMeanwhile []multisigTxResponse
+	executed        []multisigTxResponse
+	txs             map[string]*multisigTxResponse
+	proposeErr      error
+	// failures of the relay and the service gas estimations
+	relayErr    error
+	estimateErr error
+
+	estimated     []gasEstimationRequest
+	proposals     []*gnosisTxRequest
+	confirmations map[string][]string
+}
+
+func (f *fakeService) SafeInfo(safe string) (*safeNonceResponse, error) {
+	if common.HexToAddress(safe) != common.HexToAddress(f.safe.Address) {
+		return nil, errSafeNotFound
+	}
+	info := f.safe
+	return &info, nil
+}
+
+func (f *fakeService) EstimateSafeTxGas(safe, to string, value int64, data []byte, operation uint8) (*int64, error) {
+	if f.relayErr != nil {
+		return nil, f.relayErr
+	}
+	return f.estimate(to, value, data, operation)
+}
+
+func (f *fakeService) EstimateTransaction(safe, to string, value int64, data []byte, operation uint8) (*int64, error) {
+	if f.estimateErr != nil {
+		return nil, f.estimateErr
+	}
+	return f.estimate(to, value, data, operation)
+}
+
+func (f *fakeService) estimate(to string, value int64, data []byte, operation uint8) (*int64, error) {
+	f.estimated = append(f.estimated, gasEstimationRequest{To: to, Value: value, Data: stringPtr(hexutil.Encode(data)), Operation: int(operation)})
+	gas := f.safeTxGas
+	return &gas, nil
+}
+
+func (f *fakeService) ProposeTransaction(safe string, request *gnosisTxRequest) error {
+	if f.proposeErr != nil {
+		return f.proposeErr
+	}
+	f.proposals = append(f.proposals, request)
+	return nil
+}
+
+func (f *fakeService) Transaction(safeTxHash string) (*multisigTxResponse, error) {
+	tx, ok := f.txs[safeTxHash]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s %w", safeTxHash, errTxNotFound)
+	}
+	return tx, nil
+}
+
+func (f *fakeService) PendingTransactions(safe string, fromNonce int64) ([]multisigTxResponse, error) {
+	var txs []multisigTxResponse
+	for _, tx := range f.pending {
+		if tx.Nonce >= fromNonce {
+			txs = append(txs, tx)
+		}
+	}
+	f.pending = append(f.pending, f.queuedMeanwhile...)
+	f.queuedMeanwhile = nil
+	return txs, nil
+}
+
+func (f *fakeService) ExecutedTransactions(safe string) ([]multisigTxResponse, error) {
+	return f.executed, nil
+}
+
+func (f *fakeService) Confirm(safeTxHash, signature string) error {
+	if f.confirmations == nil {
+		f.confirmations = map[string][]string{}
+	}
+	f.confirmations[safeTxHash] = append(f.confirmations[safeTxHash], signature)
+	return nil
+}
+
+// useService swaps the transaction service client for the test
+func useService(t *testing.T, service TransactionServiceClient) {
+	t.Helper()
+	previous := transactionService
+	transactionService = service
+	t.Cleanup(func() { transactionService = previous })
+}
+
+// useServiceURL points the http service client at a test server
+func useServiceURL(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	previous := serviceURL
+	serviceURL = srv.URL
+	t.Cleanup(func() {
+		serviceURL = previous
+		srv.Close()
+	})
+	return srv
+}
+
+// fakeRelay accepts every submission and reports the task as executed
+type fakeRelay struct {
+	submitted [][]byte
+	txHash    common.Hash
+	state     string
+}
+
+func (f *fakeRelay) Submit(chainID *big.Int, safe common.Address, data []byte) (string, error) {
+	f.submitted = append(f.submitted, data)
+	return fmt.Sprintf("task-%d", len(f.submitted)), nil
+}
+
+func (f *fakeRelay) TaskStatus(taskID string) (*relayTaskStatus, error) {
+	status := &relayTaskStatus{}
+	status.Task.TaskState = f.state
+	hash := f.txHash.Hex()
+	status.Task.TransactionHash = &hash
+	return status, nil
+}
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// newTestRPC serves json-rpc from handlers keyed by method, unknown methods
+// answer with an error; the client dialed to it is the EthClient of tests
+func newTestRPC(t *testing.T, handlers map[string]func(params []json.RawMessage) (interface{}, error)) EthClient {
+	t.Helper()
+	client, err := dialRPC(serveTestRPC(t, handlers))
+	if err != nil {
+		t.Fatalf("dialRPC: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// serveTestRPC returns the url of the json-rpc server of newTestRPC
+func serveTestRPC(t *testing.T, handlers map[string]func(params []json.RawMessage) (interface{}, error)) string {
+	t.Helper()
+	// dialRPC checks the chain of every rpc
+	if _, ok := handlers["eth_chainId"]; !ok {
+		handlers["eth_chainId"] = func([]json.RawMessage) (interface{}, error) {
+			return hexutil.EncodeBig(big.NewInt(serviceChainID)), nil
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		handler, ok := handlers[req.Method]
+		if !ok {
+			response["error"] = map[string]interface{}{"code": -32601, "message": "method not found: " + req.Method}
+		} else if result, err := handler(req.Params); err != nil {
+			response["error"] = map[string]interface{}{"code": -32000, "message": err.Error()}
+		} else {
+			response["result"] = result
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
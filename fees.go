@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// number of recent blocks whose priority fees the suggested tip is taken from
+const FEE_HISTORY_BLOCKS = 20
+
+// replacements must raise both fee caps by 10% for nodes to accept them
+const MIN_FEE_BUMP = 10.0
+
+// txFees are the fees of a sent transaction: the EIP-1559 caps, or a gas
+// price for legacy transactions
+type txFees struct {
+	MaxFee         *big.Int
+	MaxPriorityFee *big.Int
+	GasPrice       *big.Int
+}
+
+func (f *txFees) String() string {
+	if f.GasPrice != nil {
+		return "gas price " + formatGwei(f.GasPrice) + " (legacy)"
+	}
+	return "max fee " + formatGwei(f.MaxFee) + ", max priority fee " + formatGwei(f.MaxPriorityFee)
+}
+
+// feeOptions are the fees asked for, nil ones are suggested from the chain
+type feeOptions struct {
+	maxFee         *big.Int
+	maxPriorityFee *big.Int
+	gasPrice       *big.Int
+	legacy         bool
+	tipPercentile  float64
+}
+
+type feeFlags struct {
+	maxFee         *string
+	maxPriorityFee *string
+	gasPrice       *string
+	legacy         *bool
+	tipPercentile  *float64
+}
+
+func addFeeFlags(fs *flag.FlagSet) *feeFlags {
+	return &feeFlags{
+		maxFee:         fs.String("max-fee", "", "max fee per gas in gwei (default: twice the base fee plus the priority fee)"),
+		maxPriorityFee: fs.String("max-priority-fee", "", "max priority fee per gas in gwei (default: from the fee history of recent blocks)"),
+		gasPrice:       fs.String("gas-price", "", "send a legacy transaction at this gas price in gwei"),
+		legacy:         fs.Bool("legacy", false, "send a legacy transaction at the suggested gas price, chains without EIP-1559 always get one"),
+		tipPercentile:  fs.Float64("tip-percentile", 50, "percentile of the priority fees paid in recent blocks to suggest"),
+	}
+}
+
+func (f *feeFlags) options() (*feeOptions, error) {
+	o := &feeOptions{legacy: *f.legacy, tipPercentile: *f.tipPercentile}
+	for _, fee := range []struct {
+		flag  string
+		value string
+		to    **big.Int
+	}{{"-max-fee", *f.maxFee, &o.maxFee}, {"-max-priority-fee", *f.maxPriorityFee, &o.maxPriorityFee}, {"-gas-price", *f.gasPrice, &o.gasPrice}} {
+		if fee.value == "" {
+			continue
+		}
+		wei, err := parseGwei(fee.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", fee.flag, fee.value, err)
+		}
+		*fee.to = wei
+	}
+
+	if o.gasPrice != nil {
+		o.legacy = true
+	}
+	if o.legacy && (o.maxFee != nil || o.maxPriorityFee != nil) {
+		return nil, errors.New("-max-fee and -max-priority-fee can't be used with a legacy transaction")
+	}
+	if o.tipPercentile < 0 || o.tipPercentile > 100 {
+		return nil, fmt.Errorf("invalid -tip-percentile %v, expected 0 to 100", o.tipPercentile)
+	}
+	return o, nil
+}
+
+// parseGwei parses a decimal gwei amount into wei
+func parseGwei(s string) (*big.Int, error) {
+	amount, ok := new(big.Rat).SetString(s)
+	if !ok || amount.Sign() < 0 {
+		return nil, errors.New("expected a positive amount of gwei")
+	}
+	amount.Mul(amount, new(big.Rat).SetInt64(1e9))
+	if !amount.IsInt() {
+		return nil, errors.New("more precise than 1 wei")
+	}
+	return amount.Num(), nil
+}
+
+// suggestFees completes the asked fees from the chain: legacy chains and
+// transactions get the node's gas price, otherwise the priority fee is a
+// percentile of those paid in recent blocks and the max fee leaves room for
+// the base fee to double
+func suggestFees(rpcURL string, o *feeOptions) (*txFees, error) {
+	client, err := dialRawRPC(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var latest blockHeader
+	if err := client.CallContext(opCtx, &latest, "eth_getBlockByNumber", "latest", false); err != nil {
+		return nil, err
+	}
+
+	if o.legacy || latest.BaseFee == nil {
+		if o.maxFee != nil || o.maxPriorityFee != nil {
+			return nil, errors.New("chain does not support EIP-1559 fees, use -gas-price")
+		}
+		fees := &txFees{GasPrice: o.gasPrice}
+		if fees.GasPrice == nil {
+			var price hexutil.Big
+			if err := client.CallContext(opCtx, &price, "eth_gasPrice"); err != nil {
+				return nil, err
+			}
+			fees.GasPrice = price.ToInt()
+		}
+		return fees, nil
+	}
+
+	fees := &txFees{MaxFee: o.maxFee, MaxPriorityFee: o.maxPriorityFee}
+	if fees.MaxPriorityFee == nil {
+		if fees.MaxPriorityFee, err = suggestTip(client, o.tipPercentile); err != nil {
+			return nil, err
+		}
+	}
+	if fees.MaxFee == nil {
+		fees.MaxFee = new(big.Int).Add(new(big.Int).Mul(latest.BaseFee.ToInt(), common.Big2), fees.MaxPriorityFee)
+	}
+	if fees.MaxFee.Cmp(fees.MaxPriorityFee) < 0 {
+		return nil, fmt.Errorf("max fee %s is below the max priority fee %s", formatGwei(fees.MaxFee), formatGwei(fees.MaxPriorityFee))
+	}
+	if fees.MaxFee.Cmp(latest.BaseFee.ToInt()) < 0 {
+		logger.Warn("max fee is below the current base fee, the transaction waits for it to drop", "maxFee", formatGwei(fees.MaxFee), "baseFee", formatGwei(latest.BaseFee.ToInt()))
+	}
+	return fees, nil
+}
+
+// suggestTip returns the percentile of the priority fees paid in recent
+// blocks, or the node's suggestion if it keeps no reward history
+func suggestTip(client *rpc.Client, percentile float64) (*big.Int, error) {
+	var result feeHistoryResult
+	err := client.CallContext(opCtx, &result, "eth_feeHistory", hexutil.EncodeUint64(FEE_HISTORY_BLOCKS), "latest", []float64{percentile})
+	if err == nil {
+		var tips []*big.Int
+		for _, rewards := range result.Reward {
+			if len(rewards) > 0 {
+				tips = append(tips, rewards[0].ToInt())
+			}
+		}
+		if len(tips) > 0 {
+			return medianFee(tips), nil
+		}
+	}
+
+	var tip hexutil.Big
+	if err := client.CallContext(opCtx, &tip, "eth_maxPriorityFeePerGas"); err != nil {
+		return nil, fmt.Errorf("no priority fee suggestion, pass -max-priority-fee: %w", err)
+	}
+	return tip.ToInt(), nil
+}
+
+// bumpFee raises a fee by percent, rounding up so small fees grow too
+func bumpFee(fee *big.Int, percent float64) *big.Int {
+	basisPoints := big.NewInt(10000 + int64(percent*100))
+	bumped := new(big.Int).Mul(fee, basisPoints)
+	bumped.Add(bumped, big.NewInt(9999))
+	return bumped.Div(bumped, big.NewInt(10000))
+}
+
+func higherFee(a, b *big.Int) *big.Int {
+	if b != nil && b.Cmp(a) > 0 {
+		return b
+	}
+	return a
+}
+
+// replacementFees bumps the fees of a pending transaction by percent, or to
+// the current suggestion when that is higher, keeping its transaction type
+func replacementFees(pending *types.Transaction, suggested *txFees, percent float64) *txFees {
+	if pending.Type() == types.LegacyTxType {
+		return &txFees{GasPrice: higherFee(bumpFee(pending.GasPrice(), percent), suggested.GasPrice)}
+	}
+
+	fees := &txFees{
+		MaxFee:         higherFee(bumpFee(pending.GasFeeCap(), percent), suggested.MaxFee),
+		MaxPriorityFee: higherFee(bumpFee(pending.GasTipCap(), percent), suggested.MaxPriorityFee),
+	}
+	if suggested.GasPrice != nil {
+		fees.MaxFee = higherFee(fees.MaxFee, suggested.GasPrice)
+	}
+	fees.MaxFee = higherFee(fees.MaxFee, fees.MaxPriorityFee)
+	return fees
+}
+
+// newFeeTx builds a transaction paying fees
+func newFeeTx(chainID *big.Int, nonce uint64, to common.Address, value *big.Int, gas uint64, data []byte, fees *txFees) *types.Transaction {
+	if fees.GasPrice != nil {
+		return types.NewTransaction(nonce, to, value, gas, fees.GasPrice, data)
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: fees.MaxPriorityFee,
+		GasFeeCap: fees.MaxFee,
+		Gas:       gas,
+		To:        &to,
+		Value:     value,
+		Data:      data,
+	})
+}
+
+// speedUp replaces a pending transaction of the key's address by the same
+// transaction at higher fees
+func speedUp(rpcURL string, key *ecdsa.PrivateKey, hash common.Hash, percent float64, o *feeOptions, wait bool) error {
+	if percent < MIN_FEE_BUMP {
+		return fmt.Errorf("-bump must be at least %v%%, nodes reject smaller replacements", MIN_FEE_BUMP)
+	}
+	client, err := dialRPC(rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	pending, isPending, err := client.TransactionByHash(opCtx, hash)
+	if err != nil {
+		return fmt.Errorf("transaction %s: %w", hash.Hex(), err)
+	}
+	if !isPending {
+		return fmt.Errorf("transaction %s is already mined, check it with receipt -tx-hash %s", hash.Hex(), hash.Hex())
+	}
+	if pending.To() == nil {
+		return errors.New("contract creations can't be sped up")
+	}
+
+	chainID, err := client.ChainID(opCtx)
+	if err != nil {
+		return err
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), pending)
+	if err != nil {
+		return err
+	}
+	if from := crypto.PubkeyToAddress(key.PublicKey); from != sender {
+		return fmt.Errorf("transaction %s is sent by %s, not by the key's %s", hash.Hex(), sender.Hex(), from.Hex())
+	}
+
+	// keep the type of the pending transaction, replacing it with another type is refused
+	if pending.Type() == types.LegacyTxType && !o.legacy {
+		if o.maxFee != nil || o.maxPriorityFee != nil {
+			return fmt.Errorf("transaction %s is a legacy transaction, use -gas-price", hash.Hex())
+		}
+		legacy := *o
+		legacy.legacy = true
+		o = &legacy
+	}
+	suggested, err := suggestFees(rpcURL, o)
+	if err != nil {
+		return err
+	}
+	fees := replacementFees(pending, suggested, percent)
+
+	replacement := newFeeTx(chainID, pending.Nonce(), *pending.To(), pending.Value(), pending.Gas(), pending.Data(), fees)
+	signedTx, err := types.SignTx(replacement, types.LatestSignerForChainID(chainID), key)
+	if err != nil {
+		return err
+	}
+	if err := client.SendTransaction(opCtx, signedTx); err != nil {
+		return fmt.Errorf("replacement rejected: %w", err)
+	}
+
+	fmt.Println("replaced", hash.Hex(), "at nonce", pending.Nonce(), "with", fees)
+	logger.Info("replacement sent", "txHash", signedTx.Hash().Hex())
+	if !wait {
+		return nil
+	}
+
+	// the original can still be mined before its replacement
+	receipt, err := pollReceipts(client, hash, signedTx.Hash())
+	if err != nil {
+		return err
+	}
+	fmt.Println("mined:", receipt.TxHash.Hex())
+	if tx, err := decodeExecTransaction(*pending.To(), pending.Data()); err == nil {
+		if event := reportExecution(client, receipt, tx); event != nil && !event.Success {
+			return errExecutionFailed
+		}
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("transaction %s reverted: %s", receipt.TxHash.Hex(), replayRevert(client, signedTx, receipt))
+	}
+	return nil
+}
+
+// pollReceipts waits for the first of the transactions sharing a nonce to be mined
+func pollReceipts(client EthClient, hashes ...common.Hash) (*types.Receipt, error) {
+	for {
+		for _, hash := range hashes {
+			receipt, err := client.TransactionReceipt(opCtx, hash)
+			if err == nil {
+				return receipt, nil
+			}
+			if !errors.Is(err, ethereum.NotFound) {
+				return nil, err
+			}
+		}
+		if err := sleep(RECEIPT_POLL_INTERVAL); err != nil {
+			return nil, fmt.Errorf("not mined yet: %w", err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// counterparties returns the addresses a call pays or authorizes: the
+// destination and, for token methods, the recipient or spender
+func counterparties(call multiSendTx) []common.Address {
+	parties := []common.Address{call.To}
+
+	method, ok := lookupMethod(call.Data)
+	if !ok {
+		return parties
+	}
+	args, err := methodArguments(method)
+	if err != nil {
+		return parties
+	}
+	values, err := args.UnpackValues(call.Data[4:])
+	if err != nil {
+		return parties
+	}
+
+	switch method {
+	case "transfer(address,uint256)", "approve(address,uint256)", "increaseAllowance(address,uint256)":
+		parties = append(parties, values[0].(common.Address))
+	case "transferFrom(address,address,uint256)", "safeTransferFrom(address,address,uint256)", "safeTransferFrom(address,address,uint256,uint256,bytes)":
+		parties = append(parties, values[1].(common.Address))
+	}
+	return parties
+}
+
+// knownCounterparties collects the counterparties of the executed
+// transactions of the safe from the transaction service
+func knownCounterparties(safe string) (map[common.Address]bool, error) {
+	txs, err := getExecutedTransactions(safe)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the transaction history failed: %w", err)
+	}
+
+	known := map[common.Address]bool{}
+	for _, tx := range txs {
+		var data []byte
+		if tx.Data != nil {
+			if data, err = hexutil.Decode(*tx.Data); err != nil {
+				return nil, err
+			}
+		}
+		value, ok := new(big.Int).SetString(tx.Value, 10)
+		if !ok {
+			value = new(big.Int)
+		}
+
+		calls, err := flattenTx(common.HexToAddress(tx.To), value, data, tx.Operation)
+		if err != nil {
+			calls = []multiSendTx{{Operation: tx.Operation, To: common.HexToAddress(tx.To), Value: value, Data: data}}
+		}
+		for _, call := range calls {
+			for _, party := range counterparties(call) {
+				known[party] = true
+			}
+		}
+	}
+	return known, nil
+}
+
+// checkFirstInteraction refuses transactions paying or authorizing addresses
+// the safe never interacted with, unless each is listed in acknowledged
+func checkFirstInteraction(acknowledged []string, safe, to common.Address, value *big.Int, data []byte, operation uint8) error {
+	calls, err := flattenTx(to, value, data, operation)
+	if err != nil {
+		return err
+	}
+	known, err := knownCounterparties(safe.Hex())
+	if err != nil {
+		return err
+	}
+
+	acked := map[common.Address]bool{}
+	for _, addr := range acknowledged {
+		if err := checkAddress(addr); err != nil {
+			return fmt.Errorf("invalid -ack-new address %q: %w", addr, err)
+		}
+		acked[common.HexToAddress(addr)] = true
+	}
+
+	var unacknowledged []string
+	seen := map[common.Address]bool{safe: true}
+	for _, call := range calls {
+		for _, party := range counterparties(call) {
+			if seen[party] || known[party] {
+				continue
+			}
+			seen[party] = true
+
+			if acked[party] {
+				fmt.Println("first interaction with", party.Hex(), "(acknowledged)")
+				continue
+			}
+			logger.Warn("the safe never interacted with this address", "address", party.Hex())
+			unacknowledged = append(unacknowledged, party.Hex())
+		}
+	}
+
+	if len(unacknowledged) > 0 {
+		return fmt.Errorf("first interaction with %s, verify the address out of band (not from your transaction history) and acknowledge with -ack-new %s",
+			strings.Join(unacknowledged, ", "), strings.Join(unacknowledged, ","))
+	}
+	return nil
+}
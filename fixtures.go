@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// export formats, the fixtures carry the safeTxHash computed here so the
+// python and typescript test suites can check their hashing against it
+const (
+	EXPORT_TXBUILDER   = "txbuilder"
+	EXPORT_SAFE_ETH_PY = "safe-eth-py"
+	EXPORT_SAFE_SDK    = "safe-sdk"
+)
+
+// safeEthPyFixture holds the SafeTx constructor arguments of safe-eth-py
+type safeEthPyFixture struct {
+	SafeAddress    string `json:"safe_address"`
+	ChainID        int64  `json:"chain_id"`
+	SafeVersion    string `json:"safe_version"`
+	To             string `json:"to"`
+	Value          string `json:"value"`
+	Data           string `json:"data"`
+	Operation      uint8  `json:"operation"`
+	SafeTxGas      int64  `json:"safe_tx_gas"`
+	BaseGas        int64  `json:"base_gas"`
+	GasPrice       string `json:"gas_price"`
+	GasToken       string `json:"gas_token"`
+	RefundReceiver string `json:"refund_receiver"`
+	SafeNonce      int64  `json:"safe_nonce"`
+	Signatures     string `json:"signatures"`
+	SafeTxHash     string `json:"safe_tx_hash"`
+}
+
+// safeSDKTransactionData is the SafeTransactionData of the Safe{Core} SDK
+type safeSDKTransactionData struct {
+	To             string `json:"to"`
+	Value          string `json:"value"`
+	Data           string `json:"data"`
+	Operation      uint8  `json:"operation"`
+	SafeTxGas      int64  `json:"safeTxGas"`
+	BaseGas        int64  `json:"baseGas"`
+	GasPrice       string `json:"gasPrice"`
+	GasToken       string `json:"gasToken"`
+	RefundReceiver string `json:"refundReceiver"`
+	Nonce          int64  `json:"nonce"`
+}
+
+type safeSDKSignature struct {
+	Signer string `json:"signer"`
+	Data   string `json:"data"`
+}
+
+type safeSDKFixture struct {
+	SafeAddress         string                 `json:"safeAddress"`
+	ChainID             int64                  `json:"chainId"`
+	SafeVersion         string                 `json:"safeVersion"`
+	SafeTransactionData safeSDKTransactionData `json:"safeTransactionData"`
+	Signatures          []safeSDKSignature     `json:"signatures"`
+	EncodedSignatures   string                 `json:"encodedSignatures"`
+	SafeTxHash          string                 `json:"safeTxHash"`
+	TypedData           apitypes.TypedData     `json:"typedData"`
+}
+
+// newBatchTx returns the unsigned safe transaction of batch calls at a nonce
+func newBatchTx(safe common.Address, txs []multiSendTx, nonce int64) *multisigTxResponse {
+	to, value, data, operation := batchTransaction(txs)
+	if value == nil {
+		value = new(big.Int)
+	}
+	encoded := hexutil.Encode(data)
+	return &multisigTxResponse{
+		Safe:           safe.Hex(),
+		To:             to.Hex(),
+		Value:          value.String(),
+		Data:           &encoded,
+		Operation:      operation,
+		GasPrice:       "0",
+		GasToken:       ZERO_ADDR,
+		RefundReceiver: ZERO_ADDR,
+		Nonce:          nonce,
+	}
+}
+
+// fixtureSignatures decodes the confirmations of a transaction, checking
+// each EOA signature recovers to its owner
+func fixtureSignatures(tx *multisigTxResponse, hash common.Hash) ([]ownerSignature, error) {
+	var sigs []ownerSignature
+	for _, confirmation := range tx.Confirmations {
+		signature, err := hexutil.Decode(confirmation.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature of owner %s: %w", confirmation.Owner, err)
+		}
+		sig, err := decodeSignature(signature)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature of owner %s: %w", confirmation.Owner, err)
+		}
+
+		owner := common.HexToAddress(confirmation.Owner)
+		if sig.Type == SIG_ECDSA || sig.Type == SIG_ETH_SIGN {
+			if sig.Owner, err = recoverSigner(hash, sig.Signature); err != nil {
+				return nil, fmt.Errorf("invalid signature of owner %s: %w", confirmation.Owner, err)
+			}
+		}
+		if sig.Owner != owner {
+			return nil, fmt.Errorf("confirmation of %s is signed by %s", confirmation.Owner, sig.Owner.Hex())
+		}
+		sigs = append(sigs, *sig)
+	}
+	return sortSignatures(sigs), nil
+}
+
+// exportFixture encodes a safe transaction in the format of safe-eth-py or
+// the Safe{Core} SDK, with its safeTxHash and signatures for the safe version,
+// the one of the safe when empty
+func exportFixture(tx *multisigTxResponse, format, version string) ([]byte, error) {
+	chainID, err := serviceChain()
+	if err != nil {
+		return nil, err
+	}
+	safeVersion := version
+	if safeVersion == "" {
+		if chainID, safeVersion, err = txDomain(tx, nil); err != nil {
+			return nil, err
+		}
+	}
+	gnosisSafeTx, err := tx.gnosisSafeTx()
+	if err != nil {
+		return nil, err
+	}
+	typedData, err := safeTxTypedData(gnosisSafeTx, chainID, safeVersion)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := safeTxHash(gnosisSafeTx, chainID, safeVersion)
+	if err != nil {
+		return nil, err
+	}
+	if tx.SafeTxHash != "" && common.HexToHash(tx.SafeTxHash) != hash {
+		return nil, fmt.Errorf("transaction fields hash to %s, not %s", hash.Hex(), tx.SafeTxHash)
+	}
+
+	sigs, err := fixtureSignatures(tx, hash)
+	if err != nil {
+		return nil, err
+	}
+	encodedSignatures := "0x"
+	if len(sigs) > 0 {
+		encodedSignatures = hexutil.Encode(encodeSignatures(sigs))
+	}
+
+	data := "0x"
+	if tx.Data != nil {
+		data = *tx.Data
+	}
+	safe := common.HexToAddress(tx.Safe).Hex()
+
+	var fixture interface{}
+	switch format {
+	case EXPORT_SAFE_ETH_PY:
+		fixture = &safeEthPyFixture{
+			SafeAddress:    safe,
+			ChainID:        chainID,
+			SafeVersion:    safeVersion,
+			To:             common.HexToAddress(tx.To).Hex(),
+			Value:          tx.Value,
+			Data:           data,
+			Operation:      tx.Operation,
+			SafeTxGas:      tx.SafeTxGas,
+			BaseGas:        tx.BaseGas,
+			GasPrice:       tx.GasPrice,
+			GasToken:       common.HexToAddress(tx.GasToken).Hex(),
+			RefundReceiver: common.HexToAddress(tx.RefundReceiver).Hex(),
+			SafeNonce:      tx.Nonce,
+			Signatures:     encodedSignatures,
+			SafeTxHash:     hash.Hex(),
+		}
+
+	case EXPORT_SAFE_SDK:
+		sdk := &safeSDKFixture{
+			SafeAddress: safe,
+			ChainID:     chainID,
+			SafeVersion: safeVersion,
+			SafeTransactionData: safeSDKTransactionData{
+				To:             common.HexToAddress(tx.To).Hex(),
+				Value:          tx.Value,
+				Data:           data,
+				Operation:      tx.Operation,
+				SafeTxGas:      tx.SafeTxGas,
+				BaseGas:        tx.BaseGas,
+				GasPrice:       tx.GasPrice,
+				GasToken:       common.HexToAddress(tx.GasToken).Hex(),
+				RefundReceiver: common.HexToAddress(tx.RefundReceiver).Hex(),
+				Nonce:          tx.Nonce,
+			},
+			Signatures:        []safeSDKSignature{},
+			EncodedSignatures: encodedSignatures,
+			SafeTxHash:        hash.Hex(),
+			TypedData:         typedData,
+		}
+		// the sdk keeps the standalone encoding of each owner's signature
+		for _, sig := range sigs {
+			encoded := sig.Signature
+			if sig.Type == SIG_CONTRACT {
+				encoded = encodeContractSignature(sig.Owner, sig.Signature)
+			}
+			sdk.Signatures = append(sdk.Signatures, safeSDKSignature{Signer: sig.Owner.Hex(), Data: hexutil.Encode(encoded)})
+		}
+		fixture = sdk
+
+	default:
+		return nil, fmt.Errorf("unknown fixture format %q, expected %s or %s", format, EXPORT_SAFE_ETH_PY, EXPORT_SAFE_SDK)
+	}
+	return json.MarshalIndent(fixture, "", "  ")
+}
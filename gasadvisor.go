@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// eth_feeHistory returns at most 1024 blocks per call
+const FEE_HISTORY_CHUNK = 1024
+
+type feeHistoryResult struct {
+	OldestBlock   hexutil.Uint64   `json:"oldestBlock"`
+	BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"`
+	Reward        [][]*hexutil.Big `json:"reward"`
+}
+
+type blockHeader struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+	BaseFee   *hexutil.Big   `json:"baseFeePerGas"`
+}
+
+type gasHistory struct {
+	OldestBlock uint64
+	OldestTime  time.Time
+	BlockTime   time.Duration
+	BaseFees    []*big.Int
+}
+
+type gasWindow struct {
+	Hour   int
+	Median *big.Int
+}
+
+func getHeader(client *rpc.Client, number string) (*blockHeader, error) {
+	var header blockHeader
+	if err := client.CallContext(opCtx, &header, "eth_getBlockByNumber", number, false); err != nil {
+		return nil, err
+	}
+	if header.BaseFee == nil {
+		return nil, errors.New("chain does not support EIP-1559 base fees")
+	}
+	return &header, nil
+}
+
+// fetchGasHistory collects the base fee of the last blocks blocks
+func fetchGasHistory(client *rpc.Client, blocks uint64) (*gasHistory, error) {
+	latest, err := getHeader(client, "latest")
+	if err != nil {
+		return nil, err
+	}
+
+	head := uint64(latest.Number)
+	if blocks > head {
+		blocks = head
+	}
+	oldest := head - blocks + 1
+
+	history := &gasHistory{OldestBlock: oldest}
+	for start := oldest; start <= head; start += FEE_HISTORY_CHUNK {
+		count := uint64(FEE_HISTORY_CHUNK)
+		if start+count-1 > head {
+			count = head - start + 1
+		}
+
+		var result feeHistoryResult
+		last := hexutil.EncodeUint64(start + count - 1)
+		if err := client.CallContext(opCtx, &result, "eth_feeHistory", hexutil.EncodeUint64(count), last, []float64{}); err != nil {
+			return nil, err
+		}
+
+		// the last entry is the base fee of the block after the range
+		for i := 0; i < len(result.BaseFeePerGas)-1; i++ {
+			history.BaseFees = append(history.BaseFees, result.BaseFeePerGas[i].ToInt())
+		}
+	}
+
+	first, err := getHeader(client, hexutil.EncodeUint64(oldest))
+	if err != nil {
+		return nil, err
+	}
+
+	history.OldestTime = time.Unix(int64(first.Timestamp), 0).UTC()
+	if head > oldest {
+		history.BlockTime = time.Duration(uint64(latest.Timestamp)-uint64(first.Timestamp)) * time.Second / time.Duration(head-oldest)
+	}
+
+	return history, nil
+}
+
+func medianFee(fees []*big.Int) *big.Int {
+	return percentileFee(fees, 50)
+}
+
+func percentileFee(fees []*big.Int, percentile float64) *big.Int {
+	if len(fees) == 0 {
+		return new(big.Int)
+	}
+
+	sorted := append([]*big.Int(nil), fees...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+
+	index := int(percentile / 100 * float64(len(sorted)-1))
+	return sorted[index]
+}
+
+// windows groups the history by hour of day in the display zone, cheapest first
+func (h *gasHistory) windows() []gasWindow {
+	byHour := map[int][]*big.Int{}
+	for i, fee := range h.BaseFees {
+		at := h.OldestTime.Add(time.Duration(i) * h.BlockTime).In(displayZone)
+		byHour[at.Hour()] = append(byHour[at.Hour()], fee)
+	}
+
+	var windows []gasWindow
+	for hour, fees := range byHour {
+		windows = append(windows, gasWindow{Hour: hour, Median: medianFee(fees)})
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Median.Cmp(windows[j].Median) < 0 })
+	return windows
+}
+
+func formatGwei(wei *big.Int) string {
+	if display.Numbers == NUMBERS_RAW {
+		return wei.String() + " wei"
+	}
+	return formatUnits(wei, 9, 2) + " gwei"
+}
+
+func printGasAdvice(h *gasHistory, current *big.Int) {
+	fmt.Printf("analyzed %d blocks since %s (~%s per block)\n", len(h.BaseFees), formatTime(h.OldestTime), h.BlockTime)
+	fmt.Println("current base fee:", formatGwei(current))
+	fmt.Println("p25 base fee:    ", formatGwei(percentileFee(h.BaseFees, 25)))
+	fmt.Println("median base fee: ", formatGwei(medianFee(h.BaseFees)))
+
+	fmt.Printf("cheapest hours (%s):\n", displayZone)
+	for i, window := range h.windows() {
+		if i == 5 {
+			break
+		}
+		fmt.Printf("  %02d:00-%02d:59  median %s\n", window.Hour, window.Hour, formatGwei(window.Median))
+	}
+}
+
+// waitForGasWindow blocks until the base fee drops to the given percentile of
+// recent history, or maxWait elapses
+func waitForGasWindow(rpcURL string, historyBlocks uint64, percentile float64, maxWait time.Duration) error {
+	client, err := dialRawRPC(rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	history, err := fetchGasHistory(client, historyBlocks)
+	if err != nil {
+		return err
+	}
+
+	target := percentileFee(history.BaseFees, percentile)
+	deadline := time.Now().Add(maxWait)
+	fmt.Println("waiting for base fee", formatGwei(target), "until", formatTime(deadline), "at the latest")
+
+	for {
+		latest, err := getHeader(client, "latest")
+		if err != nil {
+			return err
+		}
+
+		current := latest.BaseFee.ToInt()
+		if current.Cmp(target) <= 0 {
+			fmt.Println("base fee", formatGwei(current), "is within target", formatGwei(target))
+			return nil
+		}
+		if time.Now().After(deadline) {
+			fmt.Println("max wait reached, proceeding at base fee", formatGwei(current))
+			return nil
+		}
+
+		fmt.Println("base fee", formatGwei(current), "above target", formatGwei(target), "- waiting")
+		if err := sleep(30 * time.Second); err != nil {
+			return err
+		}
+	}
+}
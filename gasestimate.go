@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	ESTIMATE_RELAY = "relay"
+	ESTIMATE_LOCAL = "local"
+	// safeTxGas 0, execTransaction forwards all its gas to the call
+	ESTIMATE_NONE = "none"
+
+	// extra safeTxGas on top of the simulated inner call, covers nested calls
+	// losing 1/64 of the gas and the call setup inside execTransaction
+	SAFE_TX_GAS_BUFFER = 10000
+
+	TX_BASE_GAS = 21000
+	// nonce update, event emission and refund bookkeeping in execTransaction
+	SAFE_EXEC_OVERHEAD = 15000
+	// ecrecover and owner lookup, per signature
+	SIGNATURE_CHECK_GAS = 6000
+)
+
+// sources of a safeTxGas estimate
+const (
+	GAS_SOURCE_RELAY   = "relay estimation"
+	GAS_SOURCE_SERVICE = "transaction service estimation"
+	GAS_SOURCE_LOCAL   = "local estimation"
+	GAS_SOURCE_FLAG    = "-safe-tx-gas flag"
+	GAS_SOURCE_NONE    = "not estimated, all gas is forwarded"
+)
+
+type gasEstimate struct {
+	SafeTxGas int64
+	BaseGas   int64
+	Source    string
+}
+
+// defaultEstimation picks the estimation of a proposal without -estimate:
+// safes from 1.3.0 revert when a call with safeTxGas 0 fails, so they skip
+// the deprecated relay like the web interface unless the refund is bounded
+// by safeTxGas; chain-only proposals estimate against their -rpc. The version
+// is the one the proposal is hashed for
+func defaultEstimation(version string, chainOnly, refund bool) string {
+	if chainOnly {
+		return ESTIMATE_LOCAL
+	}
+	if refund {
+		return ESTIMATE_RELAY
+	}
+	if versionAtLeast(version, 1, 3) {
+		return ESTIMATE_NONE
+	}
+	return ESTIMATE_RELAY
+}
+
+// requiredTxGas simulates the inner call with the safe's requiredTxGas, which
+// always reverts with the gas used abi encoded in the revert reason
+func requiredTxGas(client EthClient, safe, to common.Address, value *big.Int, data []byte, operation uint8) (int64, error) {
+	call, err := encodeCall("requiredTxGas(address,uint256,bytes,uint8)", to, value, data, operation)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = client.CallContract(opCtx, ethereum.CallMsg{From: safe, To: &safe, Data: call}, nil)
+	if err == nil {
+		return 0, errors.New("requiredTxGas did not revert, unsupported safe version")
+	}
+
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return 0, err
+	}
+	encoded, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return 0, err
+	}
+	revert, decodeErr := hexutil.Decode(encoded)
+	// Error(string) with a 32 byte string holding the gas
+	if decodeErr != nil || len(revert) != 4+32*3 {
+		return 0, fmt.Errorf("inner call reverts: %w", err)
+	}
+
+	return new(big.Int).SetBytes(revert[len(revert)-32:]).Int64(), nil
+}
+
+// dataGas is the calldata cost of the given bytes
+func dataGas(data []byte) int64 {
+	var gas int64
+	for _, b := range data {
+		if b == 0 {
+			gas += 4
+		} else {
+			gas += 16
+		}
+	}
+	return gas
+}
+
+// estimateGasLocal derives safeTxGas and baseGas from simulations against
+// rpcURL instead of the relay service
+func estimateGasLocal(rpcURL string, safe, to common.Address, value *big.Int, data []byte, operation uint8) (*gasEstimate, error) {
+	client, err := dialRPC(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	inner, err := requiredTxGas(client, safe, to, value, data, operation)
+	if err != nil {
+		if operation != 0 {
+			return nil, err
+		}
+
+		// fall back to estimating the call as if sent by the safe itself
+		estimated, estimateErr := client.EstimateGas(opCtx, ethereum.CallMsg{From: safe, To: &to, Value: value, Data: data})
+		if estimateErr != nil {
+			return nil, fmt.Errorf("inner call estimation failed: %w", estimateErr)
+		}
+		inner = int64(estimated) - TX_BASE_GAS - dataGas(data)
+		if inner < 0 {
+			inner = 0
+		}
+	}
+
+	result, err := callAt(client, safe, "getThreshold()", nil)
+	if err != nil {
+		return nil, err
+	}
+	threshold := new(big.Int).SetBytes(result).Int64()
+
+	baseGas, err := estimateBaseGas(to, value, data, operation, inner, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &gasEstimate{SafeTxGas: inner + SAFE_TX_GAS_BUFFER, BaseGas: baseGas}, nil
+}
+
+// estimateBaseGas is the gas of execTransaction outside the inner call, per
+// the Safe gas formula: the transaction and its calldata with threshold
+// worst case signatures, the signature checks, and the nonce update, event
+// emission and refund
+func estimateBaseGas(to common.Address, value *big.Int, data []byte, operation uint8, safeTxGas, threshold int64) (int64, error) {
+	signatures := make([]byte, 65*threshold)
+	for i := range signatures {
+		signatures[i] = 0xff
+	}
+	execData, err := encodeCall("execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)",
+		to, value, data, operation, big.NewInt(safeTxGas), big.NewInt(0), big.NewInt(0), common.Address{}, common.Address{}, signatures)
+	if err != nil {
+		return 0, err
+	}
+	return TX_BASE_GAS + dataGas(execData) + SAFE_EXEC_OVERHEAD + SIGNATURE_CHECK_GAS*threshold, nil
+}
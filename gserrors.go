@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// revertContext holds the parameters of the transaction that reverted, used
+// to narrow down the likely cause of a revert code
+type revertContext struct {
+	Operation  uint8
+	SafeTxGas  int64
+	BaseGas    int64
+	GasPrice   *big.Int
+	GasToken   common.Address
+	Signatures int64
+	Threshold  int64
+	Owners     int
+	Executor   common.Address
+	IsOwner    bool
+}
+
+type gsError struct {
+	Meaning string
+	Hint    string
+	// cause refines the hint from the transaction parameters, it may return
+	// an empty string when they don't explain the revert
+	cause func(c *revertContext) string
+}
+
+// gsErrors are the revert codes of the Safe contracts (v1.3.0)
+var gsErrors = map[string]gsError{
+	"GS000": {Meaning: "could not finish initialization", Hint: "the setup call or fallback handler of the deployment reverted"},
+	"GS001": {Meaning: "threshold needs to be defined", Hint: "the safe was not set up, is the address a proxy that was never initialized?"},
+	"GS010": {Meaning: "not enough gas to execute safe transaction", Hint: "raise the gas limit of the execution, it must cover safeTxGas plus overhead", cause: func(c *revertContext) string {
+		if c.SafeTxGas > 0 {
+			return fmt.Sprintf("the gas limit must be at least ~%d (64/63 of safeTxGas %d plus baseGas %d), raise it or lower safeTxGas", c.SafeTxGas*64/63+c.BaseGas+2500, c.SafeTxGas, c.BaseGas)
+		}
+		return ""
+	}},
+	"GS011": {Meaning: "could not pay gas costs with ether", Hint: "the safe doesn't hold enough ether for the refund", cause: func(c *revertContext) string {
+		if c.GasPrice != nil && c.GasPrice.Sign() > 0 && c.GasToken == (common.Address{}) {
+			return fmt.Sprintf("gasPrice is %s with ether refunds, fund the safe or propose with gasPrice 0", formatWei(c.GasPrice))
+		}
+		return ""
+	}},
+	"GS012": {Meaning: "could not pay gas costs with token", Hint: "the safe doesn't hold enough of the gas token for the refund", cause: func(c *revertContext) string {
+		if c.GasToken != (common.Address{}) {
+			return fmt.Sprintf("the safe needs a %s balance covering (safeTxGas + baseGas) * gasPrice", c.GasToken.Hex())
+		}
+		return ""
+	}},
+	"GS013": {Meaning: "safe transaction failed when gasPrice and safeTxGas were 0", Hint: "the inner call reverts, run with -simulate to see why", cause: func(c *revertContext) string {
+		if c.Operation == 1 {
+			return "the delegatecall reverted, check the target is a trusted library such as MultiSend and the calldata matches it"
+		}
+		return ""
+	}},
+	"GS020": {Meaning: "signatures data too short", Hint: "collect at least threshold signatures before executing", cause: func(c *revertContext) string {
+		if c.Threshold > 0 && c.Signatures < c.Threshold {
+			return fmt.Sprintf("only %d of %d required signatures were provided", c.Signatures, c.Threshold)
+		}
+		return ""
+	}},
+	"GS021": {Meaning: "invalid contract signature location: inside static part", Hint: "the offset of a contract signature (v=0) points into the static part, rebuild the signatures"},
+	"GS022": {Meaning: "invalid contract signature location: length not present", Hint: "the dynamic part of a contract signature (v=0) is missing, rebuild the signatures"},
+	"GS023": {Meaning: "invalid contract signature location: data not complete", Hint: "the dynamic part of a contract signature (v=0) is truncated, rebuild the signatures"},
+	"GS024": {Meaning: "invalid contract signature provided", Hint: "the owner contract rejected the signature, check it was made over the owner safe's message hash"},
+	"GS025": {Meaning: "hash not approved", Hint: "did you sign with the wrong chainId domain, or approve a different hash?", cause: func(c *revertContext) string {
+		if !c.IsOwner && c.Executor != (common.Address{}) {
+			return fmt.Sprintf("an approved-hash signature (v=1) is only implicit for the executor, %s is not an owner so each such owner must call approveHash first", c.Executor.Hex())
+		}
+		return ""
+	}},
+	"GS026": {Meaning: "invalid owner provided", Hint: "a signer is not an owner or signatures are not sorted by owner, did you sign with the wrong chainId domain?", cause: func(c *revertContext) string {
+		if c.Signatures > 0 {
+			return "a signature recovered to a non-owner, most likely it was made over a different safeTxHash (wrong domain, nonce or gas parameters)"
+		}
+		return ""
+	}},
+	"GS030": {Meaning: "only owners can approve a hash", Hint: "send approveHash from an owner key", cause: func(c *revertContext) string {
+		if c.Executor != (common.Address{}) && !c.IsOwner {
+			return fmt.Sprintf("%s is not an owner of the safe", c.Executor.Hex())
+		}
+		return ""
+	}},
+	"GS031": {Meaning: "method can only be called from this contract", Hint: "owner, module, guard and handler changes must be proposed as safe transactions to the safe itself"},
+	"GS100": {Meaning: "modules have already been initialized", Hint: "setup can only be called once"},
+	"GS101": {Meaning: "invalid module address provided", Hint: "the module address is zero or the sentinel"},
+	"GS102": {Meaning: "module has already been added", Hint: "the module is already enabled"},
+	"GS103": {Meaning: "invalid prevModule, module pair provided", Hint: "prevModule must be the module before it in getModulesPaginated, or 0x1 for the first"},
+	"GS104": {Meaning: "method can only be called from an enabled module", Hint: "execTransactionFromModule was called by an address that is not an enabled module"},
+	"GS200": {Meaning: "owners have already been setup", Hint: "setup can only be called once"},
+	"GS201": {Meaning: "threshold cannot exceed owner count", Hint: "lower the threshold together with removing owners", cause: func(c *revertContext) string {
+		if c.Owners > 0 {
+			return fmt.Sprintf("the safe has %d owners, the new threshold must be at most that", c.Owners)
+		}
+		return ""
+	}},
+	"GS202": {Meaning: "threshold needs to be greater than 0", Hint: "use a threshold of at least 1"},
+	"GS203": {Meaning: "invalid owner address provided", Hint: "the owner is zero, the sentinel or the safe itself"},
+	"GS204": {Meaning: "address is already an owner", Hint: "the address is already an owner"},
+	"GS205": {Meaning: "invalid prevOwner, owner pair provided", Hint: "prevOwner must be the owner before it in getOwners, or 0x1 for the first"},
+}
+
+// explainRevert wraps err with the meaning of the Safe revert code it contains
+// and the most likely cause given the transaction parameters
+func explainRevert(err error, c *revertContext) error {
+	if err == nil {
+		return nil
+	}
+
+	code := gsCode.FindString(err.Error())
+	known, ok := gsErrors[code]
+	if !ok {
+		return withHint(err)
+	}
+
+	hint := known.Hint
+	if c != nil && known.cause != nil {
+		if cause := known.cause(c); cause != "" {
+			hint = cause
+		}
+	}
+	return &remediationError{Code: code, Meaning: known.Meaning, Hint: hint, Err: err}
+}
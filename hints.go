@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// remediationError wraps a service or contract error with a short hint on how
+// to fix it
+type remediationError struct {
+	Code    string
+	Meaning string
+	Hint    string
+	Err     error
+}
+
+func (e *remediationError) Error() string {
+	message := e.Err.Error()
+	if e.Meaning != "" && !strings.Contains(message, e.Meaning) {
+		message += " (" + e.Code + ": " + e.Meaning + ")"
+	}
+	return message
+}
+
+func (e *remediationError) Unwrap() error {
+	return e.Err
+}
+
+// serviceHints matches validation errors returned by the transaction service
+var serviceHints = []struct {
+	pattern *regexp.Regexp
+	code    string
+	hint    string
+}{
+	{regexp.MustCompile(`(?i)does not match provided contract-tx-hash`), "DRF_HASH_MISMATCH", "the service computed a different safeTxHash, check the EIP-712 domain (chainId for safes >=1.3.0), nonce and gas parameters"},
+	{regexp.MustCompile(`(?i)is not an owner`), "DRF_NOT_OWNER", "sign with an owner key, or register the sender as a delegate"},
+	{regexp.MustCompile(`(?i)nonce.*(already executed|too low|lower than)`), "DRF_NONCE", "the nonce is already used, propose at the current nonce or with -nonce " + NONCE_NEXT_QUEUED},
+	{regexp.MustCompile(`(?i)(not indexed|does not exist)`), "DRF_NOT_INDEXED", "the safe is not known to the service yet, check the network or wait for indexing"},
+	{regexp.MustCompile(`(?i)signature.*(not valid|invalid|cannot be recovered|could not be recovered)`), "DRF_SIGNATURE", "the signature didn't recover to the sender, check the key and the signature type (v)"},
+	{regexp.MustCompile(`(?i)checksum`), "DRF_CHECKSUM", "use the checksummed (mixed case) address"},
+	{regexp.MustCompile(`(?i)already exists`), "DRF_DUPLICATE", "the transaction was already proposed, confirm it instead"},
+}
+
+var gsCode = regexp.MustCompile(`GS\d{3}`)
+
+// withHint wraps err with a remediation hint when it contains a known Safe
+// revert code or transaction service validation error
+func withHint(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var hinted *remediationError
+	if errors.As(err, &hinted) {
+		return err
+	}
+
+	if hinted := authHint(err); hinted != nil {
+		return hinted
+	}
+
+	message := err.Error()
+	if code := gsCode.FindString(message); code != "" {
+		if known, ok := gsErrors[code]; ok {
+			return &remediationError{Code: code, Meaning: known.Meaning, Hint: known.Hint, Err: err}
+		}
+	}
+
+	for _, known := range serviceHints {
+		if known.pattern.MatchString(message) {
+			return &remediationError{Code: known.code, Hint: known.hint, Err: err}
+		}
+	}
+
+	return err
+}
+
+// errorHintOf returns the remediation hint carried by err, if any
+func errorHintOf(err error) string {
+	var hinted *remediationError
+	if errors.As(err, &hinted) {
+		return hinted.Hint
+	}
+	return ""
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"plugin"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// hook is a shell command run with the event json on stdin, a webhook the
+// json is POSTed to, or a Go plugin whose Hook function is called with it
+type hook struct {
+	Command string `json:"command,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+	Plugin  string `json:"plugin,omitempty"`
+}
+
+// pluginHook is the Hook symbol a hook plugin exports, its output is the
+// reason shown for a pre-sign verdict and an error refuses
+type pluginHook = func(payload []byte) ([]byte, error)
+
+type hooksConfig struct {
+	// must each approve a proposal or confirmation before it is signed
+	PreSign []hook `json:"preSign"`
+	// run once a proposal is submitted, or kept locally with -chain-only
+	PostPropose []hook `json:"postPropose"`
+	// run once a transaction executed by the tool has its confirmations
+	PostExecution []hook `json:"postExecution"`
+}
+
+func loadHooksConfig(path string) (*hooksConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		path = configPath("hooks.json")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return &hooksConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config hooksConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("invalid hooks config %s: %w", path, err)
+	}
+	for _, h := range append(append(config.PreSign, config.PostPropose...), config.PostExecution...) {
+		set := 0
+		for _, field := range []string{h.Command, h.Webhook, h.Plugin} {
+			if field != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("invalid hooks config %s: a hook has one of a command, a webhook or a plugin", path)
+		}
+	}
+	return &config, nil
+}
+
+func (h hook) String() string {
+	switch {
+	case h.Command != "":
+		return "command " + h.Command
+	case h.Plugin != "":
+		return "plugin " + h.Plugin
+	}
+	return "webhook " + h.Webhook
+}
+
+// call runs the hook and returns the command output or response body
+func (h hook) call(payload []byte) ([]byte, error) {
+	if h.Command != "" {
+		cmd := exec.CommandContext(opCtx, "sh", "-c", h.Command)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stderr = os.Stderr
+		return cmd.Output()
+	}
+	if h.Plugin != "" {
+		p, err := plugin.Open(h.Plugin)
+		if err != nil {
+			return nil, err
+		}
+		symbol, err := p.Lookup("Hook")
+		if err != nil {
+			return nil, err
+		}
+		f, ok := symbol.(pluginHook)
+		if !ok {
+			if fp, isPointer := symbol.(*pluginHook); isPointer {
+				f, ok = *fp, true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: Hook is a %T, not a func([]byte) ([]byte, error)", h.Plugin, symbol)
+		}
+		return f(payload)
+	}
+
+	resp, err := httpPost(h.Webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return body, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+func (h hook) run(payload []byte) error {
+	output, err := h.call(payload)
+	if len(output) > 0 && h.Webhook == "" {
+		os.Stdout.Write(output)
+	}
+	return err
+}
+
+// signingRequest is the canonical json of a proposal or confirmation sent to
+// pre-sign hooks
+type signingRequest struct {
+	Action         string   `json:"action"`
+	ChainID        int      `json:"chainId"`
+	Safe           string   `json:"safe"`
+	SafeTxHash     string   `json:"safeTxHash"`
+	Nonce          int64    `json:"nonce"`
+	To             string   `json:"to"`
+	Value          string   `json:"value"`
+	Data           string   `json:"data"`
+	Operation      uint8    `json:"operation"`
+	SafeTxGas      int64    `json:"safeTxGas"`
+	BaseGas        int64    `json:"baseGas"`
+	GasPrice       string   `json:"gasPrice"`
+	GasToken       string   `json:"gasToken"`
+	RefundReceiver string   `json:"refundReceiver"`
+	Intent         []string `json:"intent"`
+	Signer         string   `json:"signer"`
+	Origin         *string  `json:"origin"`
+}
+
+// hookVerdict is the json response of a pre-sign webhook, commands approve
+// by exiting with 0 and may print the reason
+type hookVerdict struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason"`
+}
+
+func newSigningRequest(action string, tx *multisigTxResponse, signer common.Address) (*signingRequest, error) {
+	var data []byte
+	if tx.Data != nil {
+		var err error
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return nil, err
+		}
+	}
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %q", tx.Value)
+	}
+	chainID, err := serviceChain()
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingRequest{
+		Action:         action,
+		ChainID:        int(chainID),
+		Safe:           common.HexToAddress(tx.Safe).Hex(),
+		SafeTxHash:     tx.SafeTxHash,
+		Nonce:          tx.Nonce,
+		To:             common.HexToAddress(tx.To).Hex(),
+		Value:          value.String(),
+		Data:           hexutil.Encode(data),
+		Operation:      tx.Operation,
+		SafeTxGas:      tx.SafeTxGas,
+		BaseGas:        tx.BaseGas,
+		GasPrice:       tx.GasPrice,
+		GasToken:       common.HexToAddress(tx.GasToken).Hex(),
+		RefundReceiver: common.HexToAddress(tx.RefundReceiver).Hex(),
+		Intent:         describeTx(common.HexToAddress(tx.To), value, data, tx.Operation),
+		Signer:         signer.Hex(),
+		Origin:         tx.Origin,
+	}, nil
+}
+
+// approval asks a pre-sign hook for its verdict, anything but an explicit
+// approval refuses
+func (h hook) approval(payload []byte) (bool, string) {
+	output, err := h.call(payload)
+	reason := strings.TrimSpace(string(output))
+
+	if h.Webhook == "" {
+		if err != nil {
+			if reason == "" {
+				reason = err.Error()
+			}
+			return false, reason
+		}
+		return true, reason
+	}
+
+	if err != nil {
+		return false, err.Error()
+	}
+	var verdict hookVerdict
+	if err := json.Unmarshal(output, &verdict); err != nil {
+		return false, fmt.Sprintf("invalid response: %v", err)
+	}
+	return verdict.Approved, verdict.Reason
+}
+
+// checkPreSignHooks refuses to sign unless every pre-sign hook approves
+func checkPreSignHooks(hooks []hook, action string, tx *multisigTxResponse, signer common.Address) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	request, err := newSigningRequest(action, tx, signer)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hooks {
+		approved, reason := h.approval(payload)
+		if !approved {
+			return fmt.Errorf("pre-sign hook %s refused: %s", h, reason)
+		}
+		if reason != "" {
+			fmt.Printf("pre-sign hook %s approved: %s\n", h, reason)
+		} else {
+			fmt.Printf("pre-sign hook %s approved\n", h)
+		}
+	}
+	return nil
+}
+
+// runPostProposeHooks runs every hook with the proposal even if some fail,
+// the proposal is submitted either way
+func runPostProposeHooks(hooks []hook, tx *multisigTxResponse, signer common.Address) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	request, err := newSigningRequest("propose", tx, signer)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, h := range hooks {
+		fmt.Println("running post-propose hook:", h)
+		if err := h.run(payload); err != nil {
+			fmt.Printf("warning: post-propose hook %s failed: %v\n", h, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("transaction %s is proposed, but %d of %d post-propose hooks failed", tx.SafeTxHash, failed, len(hooks))
+	}
+	return nil
+}
+
+// executionResult is the json passed to post-execution hooks
+type executionResult struct {
+	Safe            string  `json:"safe"`
+	SafeTxHash      string  `json:"safeTxHash"`
+	Nonce           int64   `json:"nonce"`
+	To              string  `json:"to"`
+	Value           string  `json:"value"`
+	Data            *string `json:"data"`
+	Operation       uint8   `json:"operation"`
+	Origin          *string `json:"origin"`
+	Executor        string  `json:"executor"`
+	TransactionHash string  `json:"transactionHash"`
+	BlockNumber     uint64  `json:"blockNumber"`
+	BlockHash       string  `json:"blockHash"`
+	GasUsed         uint64  `json:"gasUsed"`
+	Confirmations   uint64  `json:"confirmations"`
+	// false if execTransaction emitted ExecutionFailure: the nonce is used
+	// but the call itself reverted
+	Success    bool   `json:"success"`
+	ExecutedAt string `json:"executedAt"`
+}
+
+var (
+	executionSuccessTopic = crypto.Keccak256Hash([]byte("ExecutionSuccess(bytes32,uint256)"))
+	executionFailureTopic = crypto.Keccak256Hash([]byte("ExecutionFailure(bytes32,uint256)"))
+)
+
+// executionSucceeded looks for the safe's ExecutionSuccess event of the
+// transaction in the receipt
+func executionSucceeded(receipt *types.Receipt, safe common.Address, safeTxHash common.Hash) bool {
+	for _, event := range safeExecutionEvents(receipt, safe) {
+		if event.SafeTxHash == safeTxHash {
+			return event.Success
+		}
+	}
+	return receipt.Status == types.ReceiptStatusSuccessful
+}
+
+func newExecutionResult(tx *multisigTxResponse, receipt *types.Receipt, executor common.Address, depth uint64) *executionResult {
+	return &executionResult{
+		Safe:            common.HexToAddress(tx.Safe).Hex(),
+		SafeTxHash:      tx.SafeTxHash,
+		Nonce:           tx.Nonce,
+		To:              tx.To,
+		Value:           tx.Value,
+		Data:            tx.Data,
+		Operation:       tx.Operation,
+		Origin:          tx.Origin,
+		Executor:        executor.Hex(),
+		TransactionHash: receipt.TxHash.Hex(),
+		BlockNumber:     receipt.BlockNumber.Uint64(),
+		BlockHash:       receipt.BlockHash.Hex(),
+		GasUsed:         receipt.GasUsed,
+		Confirmations:   depth,
+		Success:         executionSucceeded(receipt, common.HexToAddress(tx.Safe), common.HexToHash(tx.SafeTxHash)),
+		ExecutedAt:      formatTime(time.Now()),
+	}
+}
+
+// runPostExecutionHooks runs every hook even if some fail, the transaction is
+// executed either way
+func runPostExecutionHooks(hooks []hook, result *executionResult) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, h := range hooks {
+		fmt.Println("running post-execution hook:", h)
+		if err := h.run(payload); err != nil {
+			fmt.Printf("warning: post-execution hook %s failed: %v\n", h, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("transaction %s is executed, but %d of %d post-execution hooks failed", result.TransactionHash, failed, len(hooks))
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const (
+	SIGNER_AWS_KMS = "aws-kms"
+	SIGNER_GCP_KMS = "gcp-kms"
+)
+
+// kmsBackend signs 32 byte digests with a secp256k1 key held in a cloud HSM,
+// returning DER encoded signatures
+type kmsBackend interface {
+	publicKey() ([]byte, error)
+	sign(digest []byte) ([]byte, error)
+}
+
+type kmsSigner struct {
+	backend kmsBackend
+	pub     *ecdsa.PublicKey
+	address common.Address
+}
+
+var secp256k1HalfN = new(big.Int).Rsh(crypto.S256().Params().N, 1)
+
+func openKMS(backend kmsBackend) (signer, error) {
+	der, err := backend.publicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// x509 doesn't know secp256k1, the key is the bit string of the SPKI
+	var spki struct {
+		Algorithm struct {
+			Algorithm  asn1.ObjectIdentifier
+			Parameters asn1.ObjectIdentifier
+		}
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, fmt.Errorf("invalid KMS public key: %w", err)
+	}
+	pub, err := crypto.UnmarshalPubkey(spki.PublicKey.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("KMS key is not a secp256k1 key: %w", err)
+	}
+
+	return &kmsSigner{backend: backend, pub: pub, address: crypto.PubkeyToAddress(*pub)}, nil
+}
+
+func (s *kmsSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *kmsSigner) SignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	encoded, err := encodeTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+	return s.SignHash(crypto.Keccak256Hash(encoded))
+}
+
+// SignHash converts the DER signature of the KMS to a 65 byte ethereum
+// signature, normalizing s to the lower half and recovering v
+func (s *kmsSigner) SignHash(hash common.Hash) ([]byte, error) {
+	der, err := s.backend.sign(hash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("invalid KMS signature: %w", err)
+	}
+	if sig.S.Cmp(secp256k1HalfN) > 0 {
+		sig.S.Sub(crypto.S256().Params().N, sig.S)
+	}
+
+	signature := make([]byte, 65)
+	sig.R.FillBytes(signature[:32])
+	sig.S.FillBytes(signature[32:64])
+
+	expected := crypto.FromECDSAPub(s.pub)
+	for v := byte(0); v < 2; v++ {
+		signature[64] = v
+		recovered, err := crypto.Ecrecover(hash.Bytes(), signature)
+		if err == nil && bytes.Equal(recovered, expected) {
+			return normalizeECDSA(signature)
+		}
+	}
+	return nil, errors.New("KMS signature does not recover to the key's address")
+}
+
+func (s *kmsSigner) Close() {}
+
+// awsKMS calls the KMS JSON API with requests signed with signature v4, using
+// the standard AWS_* credential environment variables
+type awsKMS struct {
+	keyID  string
+	region string
+}
+
+func newAWSKMS(keyID string) (*awsKMS, error) {
+	// arn:aws:kms:<region>:<account>:key/<id>
+	parts := strings.Split(keyID, ":")
+	if len(parts) < 6 || parts[0] != "arn" || parts[2] != "kms" {
+		return nil, fmt.Errorf("invalid KMS key ARN %q, expected arn:aws:kms:<region>:<account>:key/<id>", keyID)
+	}
+	return &awsKMS{keyID: keyID, region: parts[3]}, nil
+}
+
+// awsSigningKey derives the signature v4 key of a day, region and service
+func awsSigningKey(secret, date, region, service string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return key
+}
+
+// awsSignatureHeaders returns the headers authenticating a POST to host / with
+// body, signed with signature v4
+func awsSignatureHeaders(accessKey, secret, token, region, service, host string, headers map[string]string, body []byte, now time.Time) map[string]string {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	signed := map[string]string{"host": host, "x-amz-date": amzDate}
+	if token != "" {
+		signed["x-amz-security-token"] = token
+	}
+	for name, value := range headers {
+		signed[strings.ToLower(name)] = value
+	}
+
+	var names []string
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString("POST\n/\n\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(signed[name]) + "\n")
+	}
+	bodyHash := sha256.Sum256(body)
+	canonical.WriteString("\n" + strings.Join(names, ";") + "\n" + hex.EncodeToString(bodyHash[:]))
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	mac := hmac.New(sha256.New, awsSigningKey(secret, date, region, service))
+	mac.Write([]byte(toSign))
+
+	result := map[string]string{}
+	for name, value := range signed {
+		if name != "host" {
+			result[name] = value
+		}
+	}
+	result["authorization"] = fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, strings.Join(names, ";"), hex.EncodeToString(mac.Sum(nil)))
+	return result
+}
+
+func (k *awsKMS) call(action string, request, response interface{}) error {
+	accessKey, err := secretFromEnv("AWS_ACCESS_KEY_ID", "AWS access key")
+	if err != nil {
+		return err
+	}
+	secret, err := secretFromEnv("AWS_SECRET_ACCESS_KEY", "AWS secret key")
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	host := "kms." + k.region + ".amazonaws.com"
+	headers := awsSignatureHeaders(accessKey, secret, os.Getenv("AWS_SESSION_TOKEN"), k.region, "kms", host, map[string]string{
+		"content-type": "application/x-amz-json-1.1",
+		"x-amz-target": "TrentService." + action,
+	}, body, time.Now())
+
+	resp, err := httpDoHeaders(http.MethodPost, "https://"+host+"/", headers, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("AWS KMS %s failed (%s): %s", action, resp.Status, string(content))
+	}
+	return json.Unmarshal(content, response)
+}
+
+func (k *awsKMS) publicKey() ([]byte, error) {
+	var resp struct {
+		PublicKey []byte
+		KeySpec   string
+	}
+	if err := k.call("GetPublicKey", map[string]string{"KeyId": k.keyID}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.KeySpec != "ECC_SECG_P256K1" {
+		return nil, fmt.Errorf("KMS key %s is %s, an ECC_SECG_P256K1 key is required", k.keyID, resp.KeySpec)
+	}
+	return resp.PublicKey, nil
+}
+
+func (k *awsKMS) sign(digest []byte) ([]byte, error) {
+	var resp struct {
+		Signature []byte
+	}
+	err := k.call("Sign", map[string]interface{}{
+		"KeyId":            k.keyID,
+		"Message":          digest,
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	}, &resp)
+	return resp.Signature, err
+}
+
+// gcpKMS calls the Cloud KMS REST API for a key version, authenticated with an
+// OAuth access token, e.g. from gcloud auth print-access-token
+type gcpKMS struct {
+	name     string
+	tokenEnv string
+}
+
+func (k *gcpKMS) call(method, url string, request, response interface{}) error {
+	token, err := secretFromEnv(k.tokenEnv, "Google Cloud access token")
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if request != nil {
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+
+	resp, err := httpDoHeaders(method, url, map[string]string{
+		"Authorization": "Bearer " + token,
+		"Content-Type":  "application/json",
+	}, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Cloud KMS request failed (%s): %s", resp.Status, string(content))
+	}
+	return json.Unmarshal(content, response)
+}
+
+func (k *gcpKMS) publicKey() ([]byte, error) {
+	var resp struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := k.call(http.MethodGet, "https://cloudkms.googleapis.com/v1/"+k.name+"/publicKey", nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Algorithm != "EC_SIGN_SECP256K1_SHA256" {
+		return nil, fmt.Errorf("KMS key %s is %s, an EC_SIGN_SECP256K1_SHA256 key is required", k.name, resp.Algorithm)
+	}
+
+	block, _ := pem.Decode([]byte(resp.Pem))
+	if block == nil {
+		return nil, errors.New("invalid public key PEM from Cloud KMS")
+	}
+	return block.Bytes, nil
+}
+
+func (k *gcpKMS) sign(digest []byte) ([]byte, error) {
+	var resp struct {
+		Signature string `json:"signature"`
+	}
+	request := map[string]interface{}{"digest": map[string]string{"sha256": base64.StdEncoding.EncodeToString(digest)}}
+	if err := k.call(http.MethodPost, "https://cloudkms.googleapis.com/v1/"+k.name+":asymmetricSign", request, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Signature)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// storage layout of the safe singleton
+var (
+	ownersSlot    = common.BigToHash(big.NewInt(2))
+	thresholdSlot = common.BigToHash(big.NewInt(4))
+	nonceSlot     = common.BigToHash(big.NewInt(5))
+
+	sentinelOwner = common.HexToAddress("0x0000000000000000000000000000000000000001")
+)
+
+// rawHeader holds the header fields as returned by the RPC, so the hash can be
+// recomputed including fields added by later forks
+type rawHeader struct {
+	ParentHash            common.Hash     `json:"parentHash"`
+	UncleHash             common.Hash     `json:"sha3Uncles"`
+	Coinbase              common.Address  `json:"miner"`
+	Root                  common.Hash     `json:"stateRoot"`
+	TxHash                common.Hash     `json:"transactionsRoot"`
+	ReceiptHash           common.Hash     `json:"receiptsRoot"`
+	Bloom                 hexutil.Bytes   `json:"logsBloom"`
+	Difficulty            *hexutil.Big    `json:"difficulty"`
+	Number                *hexutil.Big    `json:"number"`
+	GasLimit              hexutil.Uint64  `json:"gasLimit"`
+	GasUsed               hexutil.Uint64  `json:"gasUsed"`
+	Time                  hexutil.Uint64  `json:"timestamp"`
+	Extra                 hexutil.Bytes   `json:"extraData"`
+	MixDigest             common.Hash     `json:"mixHash"`
+	Nonce                 hexutil.Bytes   `json:"nonce"`
+	BaseFee               *hexutil.Big    `json:"baseFeePerGas"`
+	WithdrawalsHash       *common.Hash    `json:"withdrawalsRoot"`
+	BlobGasUsed           *hexutil.Uint64 `json:"blobGasUsed"`
+	ExcessBlobGas         *hexutil.Uint64 `json:"excessBlobGas"`
+	ParentBeaconBlockRoot *common.Hash    `json:"parentBeaconBlockRoot"`
+	RequestsHash          *common.Hash    `json:"requestsHash"`
+	Hash                  common.Hash     `json:"hash"`
+}
+
+func (h *rawHeader) computeHash() (common.Hash, error) {
+	fields := []interface{}{
+		h.ParentHash, h.UncleHash, h.Coinbase, h.Root, h.TxHash, h.ReceiptHash, []byte(h.Bloom),
+		h.Difficulty.ToInt(), h.Number.ToInt(), uint64(h.GasLimit), uint64(h.GasUsed), uint64(h.Time),
+		[]byte(h.Extra), h.MixDigest, []byte(h.Nonce),
+	}
+
+	// optional fields are appended in fork order, each requiring the previous ones
+	if h.BaseFee != nil {
+		fields = append(fields, h.BaseFee.ToInt())
+	}
+	if h.WithdrawalsHash != nil {
+		fields = append(fields, *h.WithdrawalsHash)
+	}
+	if h.BlobGasUsed != nil && h.ExcessBlobGas != nil {
+		fields = append(fields, uint64(*h.BlobGasUsed), uint64(*h.ExcessBlobGas))
+	}
+	if h.ParentBeaconBlockRoot != nil {
+		fields = append(fields, *h.ParentBeaconBlockRoot)
+	}
+	if h.RequestsHash != nil {
+		fields = append(fields, *h.RequestsHash)
+	}
+
+	encoded, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+type storageProof struct {
+	Key   hexutil.Big     `json:"key"`
+	Value hexutil.Big     `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+type accountProof struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []storageProof  `json:"storageProof"`
+}
+
+type proofAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// verifiedReader serves storage reads proven against the state root of a
+// header whose hash matches a trusted block hash
+type verifiedReader struct {
+	client *rpc.Client
+	header *rawHeader
+}
+
+func newVerifiedReader(client *rpc.Client, trustedHash common.Hash) (*verifiedReader, error) {
+	var header rawHeader
+	if err := client.CallContext(opCtx, &header, "eth_getBlockByHash", trustedHash, false); err != nil {
+		return nil, err
+	}
+	if header.Number == nil {
+		return nil, fmt.Errorf("block %s not found", trustedHash.Hex())
+	}
+
+	hash, err := header.computeHash()
+	if err != nil {
+		return nil, err
+	}
+	if hash != trustedHash {
+		return nil, fmt.Errorf("header returned for %s hashes to %s, refusing to trust its state root", trustedHash.Hex(), hash.Hex())
+	}
+
+	return &verifiedReader{client: client, header: &header}, nil
+}
+
+func proofDB(nodes []hexutil.Bytes) *memorydb.Database {
+	db := memorydb.New()
+	for _, node := range nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// storageAt returns the value of a storage slot of account, verified against
+// the trusted state root
+func (r *verifiedReader) storageAt(account common.Address, slot common.Hash) (common.Hash, error) {
+	var proof accountProof
+	if err := r.client.CallContext(opCtx, &proof, "eth_getProof", account, []common.Hash{slot}, r.header.Number); err != nil {
+		return common.Hash{}, err
+	}
+
+	encodedAccount, err := trie.VerifyProof(r.header.Root, crypto.Keccak256(account.Bytes()), proofDB(proof.AccountProof))
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("invalid account proof for %s: %w", account.Hex(), err)
+	}
+	if encodedAccount == nil {
+		return common.Hash{}, fmt.Errorf("account %s does not exist at block %s", account.Hex(), r.header.Number.ToInt())
+	}
+
+	var acc proofAccount
+	if err := rlp.DecodeBytes(encodedAccount, &acc); err != nil {
+		return common.Hash{}, err
+	}
+
+	if len(proof.StorageProof) != 1 {
+		return common.Hash{}, errors.New("missing storage proof")
+	}
+
+	value, err := trie.VerifyProof(acc.Root, crypto.Keccak256(slot.Bytes()), proofDB(proof.StorageProof[0].Proof))
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("invalid storage proof for slot %s: %w", slot.Hex(), err)
+	}
+	if value == nil {
+		return common.Hash{}, nil
+	}
+
+	var content []byte
+	if err := rlp.DecodeBytes(value, &content); err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
+
+func mappingSlot(key common.Address, slot common.Hash) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(key.Bytes(), 32), slot.Bytes())
+}
+
+// readSafeStateVerified reads the safe state from storage proofs instead of
+// trusting eth_call results
+func readSafeStateVerified(r *verifiedReader, safe common.Address) (*onchainState, error) {
+	state := &onchainState{Block: r.header.Number.ToInt().Uint64(), BlockHash: r.header.Hash}
+
+	// walk the owners linked list starting at the sentinel
+	current := sentinelOwner
+	for i := 0; ; i++ {
+		next, err := r.storageAt(safe, mappingSlot(current, ownersSlot))
+		if err != nil {
+			return nil, err
+		}
+
+		owner := common.BytesToAddress(next.Bytes())
+		if owner == sentinelOwner {
+			break
+		}
+		if owner == (common.Address{}) || i > 1000 {
+			return nil, errors.New("corrupt owners list, is it a Safe?")
+		}
+		state.Owners = append(state.Owners, owner)
+		current = owner
+	}
+
+	threshold, err := r.storageAt(safe, thresholdSlot)
+	if err != nil {
+		return nil, err
+	}
+	state.Threshold = threshold.Big().Int64()
+
+	nonce, err := r.storageAt(safe, nonceSlot)
+	if err != nil {
+		return nil, err
+	}
+	state.Nonce = nonce.Big().Int64()
+
+	guard, err := r.storageAt(safe, guardStorageSlot)
+	if err != nil {
+		return nil, err
+	}
+	state.Guard = common.BytesToAddress(guard.Bytes())
+
+	handler, err := r.storageAt(safe, fallbackHandlerStorageSlot)
+	if err != nil {
+		return nil, err
+	}
+	state.FallbackHandler = common.BytesToAddress(handler.Bytes())
+
+	return state, nil
+}
+
+// checkSignerVerified refuses to sign unless the proven state at the trusted
+// block has the signer as owner (unless proposing as delegate) and the nonce unused
+func checkSignerVerified(rpcURL string, trustedHash common.Hash, safe, signer common.Address, nonce int64, delegate bool) error {
+	client, err := dialRawRPC(rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	reader, err := newVerifiedReader(client, trustedHash)
+	if err != nil {
+		return fmt.Errorf("refusing to sign: %w", err)
+	}
+
+	state, err := readSafeStateVerified(reader, safe)
+	if err != nil {
+		return fmt.Errorf("refusing to sign: %w", err)
+	}
+
+	fmt.Println("verified state at block", state.Block, ":", state)
+
+	if !delegate && !state.isOwner(signer) {
+		return fmt.Errorf("refusing to sign: %s is not an owner of %s", signer.Hex(), safe.Hex())
+	}
+	if nonce < state.Nonce {
+		return fmt.Errorf("refusing to sign: nonce %d is already used, verified nonce is %d", nonce, state.Nonce)
+	}
+	return nil
+}
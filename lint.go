@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// modes of the pre-signing checks
+const (
+	CHECK_OFF    = "off"
+	CHECK_WARN   = "warn"
+	CHECK_STRICT = "strict"
+)
+
+// the safe methods a transaction may call on the safe itself
+var managementMethods = []string{
+	"addOwnerWithThreshold(address,uint256)",
+	"removeOwner(address,address,uint256)",
+	"swapOwner(address,address,address)",
+	"changeThreshold(uint256)",
+	"enableModule(address)",
+	"disableModule(address,address)",
+	"setGuard(address)",
+	"setFallbackHandler(address)",
+}
+
+type linter struct {
+	client EthClient
+	safe   common.Address
+	code   map[common.Address]bool
+	token  map[common.Address]bool
+}
+
+func (l *linter) isContract(addr common.Address) (bool, error) {
+	if contract, ok := l.code[addr]; ok {
+		return contract, nil
+	}
+	code, err := l.client.CodeAt(opCtx, addr, nil)
+	if err != nil {
+		return false, err
+	}
+	l.code[addr] = len(code) > 0
+	return len(code) > 0, nil
+}
+
+// isToken treats contracts answering totalSupply() and decimals() as tokens
+func (l *linter) isToken(addr common.Address) (bool, error) {
+	if token, ok := l.token[addr]; ok {
+		return token, nil
+	}
+	contract, err := l.isContract(addr)
+	if err != nil || !contract {
+		return false, err
+	}
+
+	token := true
+	for _, method := range []string{"totalSupply()", "decimals()"} {
+		if result, err := callAt(l.client, addr, method, nil); err != nil || len(result) != 32 {
+			token = false
+		}
+	}
+	l.token[addr] = token
+	return token, nil
+}
+
+func (l *linter) lintCall(call multiSendTx) ([]string, error) {
+	var findings []string
+	value := call.Value
+	if value == nil {
+		value = common.Big0
+	}
+
+	if call.To == l.safe {
+		method, ok := lookupMethod(call.Data)
+		managed := false
+		for _, m := range managementMethods {
+			managed = managed || (ok && m == method)
+		}
+		if !managed {
+			findings = append(findings, "calls the safe itself with something else than an owner, module, guard or fallback handler change")
+		}
+	}
+
+	if l.client == nil {
+		return findings, nil
+	}
+
+	if value.Sign() > 0 {
+		token, err := l.isToken(call.To)
+		if err != nil {
+			return nil, err
+		}
+		contract, err := l.isContract(call.To)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case token:
+			findings = append(findings, fmt.Sprintf("sends %s to the token contract %s, tokens are moved with transfer, not value", formatWei(value), call.To.Hex()))
+		case contract && len(call.Data) == 0 && call.To != l.safe:
+			findings = append(findings, fmt.Sprintf("sends %s with empty data to the contract %s, which may reject or lock it", formatWei(value), call.To.Hex()))
+		}
+	}
+
+	if method, ok := lookupMethod(call.Data); ok && (method == "approve(address,uint256)" || method == "increaseAllowance(address,uint256)") && len(call.Data) >= 36 {
+		spender := common.BytesToAddress(call.Data[4:36])
+		contract, err := l.isContract(spender)
+		if err != nil {
+			return nil, err
+		}
+		if !contract {
+			findings = append(findings, fmt.Sprintf("approves %s, which is not a contract; approvals normally go to protocols", spender.Hex()))
+		}
+	}
+
+	return findings, nil
+}
+
+// lintTx flags red flag patterns in every call of a transaction, the code
+// based checks need an rpc endpoint
+func lintTx(rpc string, safe, to common.Address, value *big.Int, data []byte, operation uint8) ([]string, error) {
+	calls, err := flattenTx(to, value, data, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{safe: safe, code: map[common.Address]bool{}, token: map[common.Address]bool{}}
+	if rpc != "" {
+		if l.client, err = dialRPC(rpc); err != nil {
+			return nil, err
+		}
+		defer l.client.Close()
+	}
+
+	var findings []string
+	for i, call := range calls {
+		callFindings, err := l.lintCall(call)
+		if err != nil {
+			return nil, err
+		}
+		for _, finding := range callFindings {
+			if len(calls) > 1 {
+				finding = fmt.Sprintf("call %d %s", i+1, finding)
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// checkLint runs the lint pass in the given mode, refusing to continue on
+// findings in strict mode
+func checkLint(mode, rpc string, safe, to common.Address, value *big.Int, data []byte, operation uint8) error {
+	switch mode {
+	case CHECK_OFF:
+		return nil
+	case "", CHECK_WARN, CHECK_STRICT:
+	default:
+		return fmt.Errorf("unknown lint mode %q, expected %s, %s or %s", mode, CHECK_OFF, CHECK_WARN, CHECK_STRICT)
+	}
+
+	if rpc == "" {
+		fmt.Println("lint: no -rpc, skipping the contract and token checks")
+	}
+	findings, err := lintTx(rpc, safe, to, value, data, operation)
+	if err != nil {
+		return err
+	}
+	for _, finding := range findings {
+		fmt.Println("lint warning:", finding)
+	}
+
+	if mode == CHECK_STRICT && len(findings) > 0 {
+		return fmt.Errorf("refusing to sign with %d lint findings: %s", len(findings), strings.Join(findings, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logger carries the progress of an operation, nonce, gas and hashes at info
+// level and warnings, on stderr so results on stdout stay parseable; the
+// global -verbose flag adds the debug output of every http exchange, -quiet
+// leaves warnings and errors only, -trace-http dumps the exchanges in full
+var logger = newLogger(os.Stderr, slog.LevelInfo)
+
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func setLogLevel(verbose, quiet bool) {
+	switch {
+	case verbose:
+		logger = newLogger(os.Stderr, slog.LevelDebug)
+	case quiet:
+		logger = newLogger(os.Stderr, slog.LevelWarn)
+	}
+}
+
+// secret names of query parameters and json fields, compared in lower case
+var secretNames = map[string]bool{
+	"apikey":        true,
+	"api_key":       true,
+	"sponsorapikey": true,
+	"key":           true,
+	"token":         true,
+	"access_token":  true,
+	"secret":        true,
+	"password":      true,
+	"authorization": true,
+}
+
+var jsonStringField = regexp.MustCompile(`"([A-Za-z_]+)"\s*:\s*"[^"]*"`)
+
+// rpc providers take the api key as a path segment, e.g. /v3/<key>
+var pathKey = regexp.MustCompile(`^[A-Za-z0-9_-]{24,}$`)
+
+// redactURL hides secret query parameters, api keys in the path and userinfo
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.User != nil {
+		u.User = url.User(REDACTED)
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if pathKey.MatchString(segment) && !strings.HasPrefix(segment, "0x") {
+			segments[i] = REDACTED
+		}
+	}
+	u.Path, u.RawPath = strings.Join(segments, "/"), ""
+	query := u.Query()
+	for name := range query {
+		if secretNames[strings.ToLower(name)] {
+			query.Set(name, REDACTED)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// redactBody hides secret string fields of a json body
+func redactBody(body []byte) string {
+	return jsonStringField.ReplaceAllStringFunc(string(body), func(field string) string {
+		name := jsonStringField.FindStringSubmatch(field)[1]
+		if !secretNames[strings.ToLower(name)] {
+			return field
+		}
+		return `"` + name + `":"` + REDACTED + `"`
+	})
+}
+
+// headers carrying credentials, canonical form
+var secretHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"X-Access-Key":  true,
+	"X-Api-Key":     true,
+}
+
+// signatures are shortened in traces, they are long and rarely the problem
+var signatureField = regexp.MustCompile(`"(signatures?)"\s*:\s*"(0x[0-9a-fA-F]{10})[0-9a-fA-F]{8,}([0-9a-fA-F]{8})"`)
+
+const SIGNATURE_ELLIPSIS = "..."
+
+func truncateSignatures(body string) string {
+	return signatureField.ReplaceAllString(body, `"$1":"$2`+SIGNATURE_ELLIPSIS+`$3"`)
+}
+
+// loggingTransport logs every http exchange, of the transaction service, the
+// relays and the ethereum rpc alike: a summary at debug level, or the whole
+// exchange with headers on trace
+type loggingTransport struct {
+	next  http.RoundTripper
+	trace io.Writer
+}
+
+// setHTTPLogging installs the logging transport in front of the default one,
+// which the default client and the rpc clients share
+func setHTTPLogging(trace bool) {
+	transport := &loggingTransport{next: http.DefaultTransport}
+	if trace {
+		transport.trace = os.Stderr
+	} else if !logger.Enabled(opCtx, slog.LevelDebug) {
+		return
+	}
+	http.DefaultTransport = transport
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	redactedURL := redactURL(req.URL.String())
+	t.dumpRequest(req, redactedURL, body)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	took := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		logger.Debug("http error", "url", redactedURL, "took", took, "error", err)
+		if t.trace != nil {
+			fmt.Fprintf(t.trace, "< %s failed after %s: %v\n\n", redactedURL, took, err)
+		}
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	t.dumpResponse(resp, redactedURL, took, respBody)
+	return resp, nil
+}
+
+func (t *loggingTransport) dumpRequest(req *http.Request, redactedURL string, body []byte) {
+	logger.Debug("http request", "method", req.Method, "url", redactedURL, "body", truncateSignatures(redactBody(body)))
+	if t.trace == nil {
+		return
+	}
+	fmt.Fprintf(t.trace, "> %s %s\n", req.Method, redactedURL)
+	dumpHeaders(t.trace, "> ", req.Header)
+	if len(body) > 0 {
+		fmt.Fprintf(t.trace, "> %s\n", truncateSignatures(redactBody(body)))
+	}
+	fmt.Fprintln(t.trace)
+}
+
+func (t *loggingTransport) dumpResponse(resp *http.Response, redactedURL string, took time.Duration, body []byte) {
+	logger.Debug("http response", "status", resp.Status, "url", redactedURL, "took", took, "body", truncateSignatures(redactBody(body)))
+	if t.trace == nil {
+		return
+	}
+	fmt.Fprintf(t.trace, "< %s %s in %s\n", resp.Status, redactedURL, took)
+	dumpHeaders(t.trace, "< ", resp.Header)
+	if len(body) > 0 {
+		fmt.Fprintf(t.trace, "< %s\n", truncateSignatures(redactBody(body)))
+	}
+	fmt.Fprintln(t.trace)
+}
+
+func dumpHeaders(w io.Writer, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			if secretHeaders[http.CanonicalHeaderKey(name)] {
+				value = REDACTED
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
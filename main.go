@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bytes"
+	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/big"
-	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -16,10 +15,16 @@ import (
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
 
 const ZERO_ADDR = "0x0000000000000000000000000000000000000000"
 
+var (
+	errSafeNotFound = errors.New("safe not found in transaction service")
+	errTxNotFound   = errors.New("not found in transaction service")
+)
+
 type safeNonceResponse struct {
 	Address         string   `json:"address"`
 	Nonce           int64    `json:"nonce"`
@@ -32,19 +37,20 @@ type safeNonceResponse struct {
 	Version         string   `json:"version"`
 }
 
-func getSafeNonce(safe string) (*int64, error) {
-	resp, err := http.Get("https://safe-transaction.rinkeby.gnosis.io/api/v1/safes/" + safe)
-	if err != nil {
-		return nil, err
+func getSafeInfo(safe string) (*safeNonceResponse, error) {
+	info, err := transactionService.SafeInfo(safe)
+	if err != nil || verifyOnchainRPC == "" {
+		return info, err
 	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	if err := verifyOnchain(info); err != nil {
 		return nil, err
 	}
+	return info, nil
+}
 
-	var data safeNonceResponse
-	if err := json.Unmarshal(body, &data); err != nil {
+func getSafeNonce(safe string) (*int64, error) {
+	data, err := getSafeInfo(safe)
+	if err != nil {
 		return nil, err
 	}
 
@@ -70,41 +76,47 @@ type gasEstimationResponse struct {
 	RefundReceiver string `json:"refundReceiver"`
 }
 
-func getGasEstimation(to, safe string, value int64) (*int64, error) {
-	request := gasEstimationRequest{
-		To:        to,
-		Value:     value,
-		Data:      nil,
-		Operation: 0,
-		GasToken:  nil,
-	}
-
-	req, err := json.Marshal(request)
+// getGasEstimation falls back through the sources of safeTxGas: the relay
+// simulation, the transaction service estimation, a local estimation against
+// rpc when given and last the fallback safeTxGas; baseGas is the one of
+// executing the call with threshold signatures
+func getGasEstimation(to, safe string, value int64, data []byte, operation uint8, rpc string, fallback *int64) (*gasEstimate, error) {
+	var failures []string
+	safeTxGas, err := transactionService.EstimateSafeTxGas(safe, to, value, data, operation)
+	source := GAS_SOURCE_RELAY
 	if err != nil {
-		return nil, err
+		logger.Warn("relay gas estimation failed, trying the transaction service", "err", err)
+		failures = append(failures, GAS_SOURCE_RELAY+": "+err.Error())
+		safeTxGas, err = transactionService.EstimateTransaction(safe, to, value, data, operation)
+		source = GAS_SOURCE_SERVICE
 	}
-
-	resp, err := http.Post("https://safe-relay.rinkeby.gnosis.io/api/v2/safes/"+safe+"/transactions/estimate/", "application/json", bytes.NewBuffer(req))
 	if err != nil {
-		return nil, err
+		failures = append(failures, GAS_SOURCE_SERVICE+": "+err.Error())
+		if rpc != "" {
+			logger.Warn("transaction service gas estimation failed, estimating locally", "err", err)
+			estimate, localErr := estimateGasLocal(rpc, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(value), data, operation)
+			if localErr == nil {
+				estimate.Source = GAS_SOURCE_LOCAL
+				return estimate, nil
+			}
+			failures = append(failures, GAS_SOURCE_LOCAL+": "+localErr.Error())
+		}
+		if fallback == nil {
+			return nil, fmt.Errorf("gas estimation failed, estimate locally with -rpc or give -safe-tx-gas: %s", strings.Join(failures, "; "))
+		}
+		logger.Warn("gas estimation failed, using -safe-tx-gas", "safeTxGas", *fallback)
+		safeTxGas, source = fallback, GAS_SOURCE_FLAG
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	info, err := cachedSafeInfo(safe)
 	if err != nil {
 		return nil, err
 	}
-
-	var data gasEstimationResponse
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
-	}
-
-	safeTxGas, err := strconv.ParseInt(data.SafeTxGas, 10, 64)
+	baseGas, err := estimateBaseGas(common.HexToAddress(to), big.NewInt(value), data, operation, *safeTxGas, info.Threshold)
 	if err != nil {
 		return nil, err
 	}
-
-	return &safeTxGas, nil
+	return &gasEstimate{SafeTxGas: *safeTxGas, BaseGas: baseGas, Source: source}, nil
 }
 
 type gnosisTxRequest struct {
@@ -124,71 +136,492 @@ type gnosisTxRequest struct {
 	Origin                  *string `json:"origin"`
 }
 
-type gnosisTxErrResponse struct {
-	NonFieldErrors []string `json:"nonFieldErrors"`
-}
+func sendGnosisTx(from, to, safe string, amount int64, data []byte, operation uint8, safeTxGas, baseGas, nonce int64, refund *gasRefund, hash, signature string, origin *string) error {
+	var txData *string
+	if len(data) > 0 {
+		encoded := hexutil.Encode(data)
+		txData = &encoded
+	}
 
-func sendGnosisTx(from, to, safe string, amount, safeTxGas, nonce int64, hash, signature string) error {
 	request := gnosisTxRequest{
 		To:                      to,
 		Value:                   amount,
-		Data:                    nil,
-		Operation:               0,
-		GasToken:                ZERO_ADDR,
+		Data:                    txData,
+		Operation:               int64(operation),
+		GasToken:                refund.gasToken.Hex(),
 		SafeTxGas:               safeTxGas,
-		BaseGas:                 0,
-		GasPrice:                0,
-		RefundReceiver:          ZERO_ADDR,
+		BaseGas:                 baseGas,
+		GasPrice:                refund.gasPrice.Int64(),
+		RefundReceiver:          refund.receiver.Hex(),
 		Nonce:                   nonce,
 		ContractTransactionHash: hash,
 		Sender:                  from,
 		Signature:               signature,
-		Origin:                  nil,
+		Origin:                  origin,
 	}
 
-	req, err := json.Marshal(request)
+	// keep the signed proposal so it can be resubmitted without signing again
+	currentOperation.Proposal = &request
+	currentOperation.Signature = signature
+	currentOperation.step("submitting proposal")
+
+	return postGnosisTx(safe, &request)
+}
+
+func postGnosisTx(safe string, request *gnosisTxRequest) error {
+	return transactionService.ProposeTransaction(safe, request)
+}
+
+type multisigConfirmation struct {
+	Owner         string `json:"owner"`
+	Signature     string `json:"signature"`
+	SignatureType string `json:"signatureType"`
+}
+
+type multisigTxResponse struct {
+	Safe                  string                 `json:"safe"`
+	To                    string                 `json:"to"`
+	Value                 string                 `json:"value"`
+	Data                  *string                `json:"data"`
+	Operation             uint8                  `json:"operation"`
+	GasToken              string                 `json:"gasToken"`
+	SafeTxGas             int64                  `json:"safeTxGas"`
+	BaseGas               int64                  `json:"baseGas"`
+	GasPrice              string                 `json:"gasPrice"`
+	RefundReceiver        string                 `json:"refundReceiver"`
+	Nonce                 int64                  `json:"nonce"`
+	SafeTxHash            string                 `json:"safeTxHash"`
+	SubmissionDate        string                 `json:"submissionDate"`
+	Proposer              string                 `json:"proposer"`
+	IsExecuted            bool                   `json:"isExecuted"`
+	TransactionHash       *string                `json:"transactionHash"`
+	ConfirmationsRequired int64                  `json:"confirmationsRequired"`
+	Confirmations         []multisigConfirmation `json:"confirmations"`
+	Origin                *string                `json:"origin"`
+	DataDecoded           *decodedData           `json:"dataDecoded"`
+	// the version of the safe, which the service doesn't serve; transaction
+	// files record it so they can be hashed offline
+	SafeVersion string `json:"safeVersion,omitempty"`
+}
+
+// decodedData is the service's decoding of the calldata with the verified
+// contract abi, for multiSend the inner calls are in the valueDecoded of the
+// transactions parameter
+type decodedData struct {
+	Method     string             `json:"method"`
+	Parameters []decodedParameter `json:"parameters"`
+}
+
+type decodedParameter struct {
+	Name         string           `json:"name"`
+	Type         string           `json:"type"`
+	ValueDecoded []decodedInnerTx `json:"valueDecoded"`
+}
+
+type decodedInnerTx struct {
+	DataDecoded *decodedData `json:"dataDecoded"`
+}
+
+func getMultisigTransaction(safeTxHash string) (*multisigTxResponse, error) {
+	return transactionService.Transaction(safeTxHash)
+}
+
+type multisigTxListResponse struct {
+	Count   int                  `json:"count"`
+	Next    *string              `json:"next"`
+	Results []multisigTxResponse `json:"results"`
+}
+
+func getPendingTransactions(safe string, fromNonce int64) ([]multisigTxResponse, error) {
+	return transactionService.PendingTransactions(safe, fromNonce)
+}
+
+func getExecutedTransactions(safe string) ([]multisigTxResponse, error) {
+	return transactionService.ExecutedTransactions(safe)
+}
+
+// listMultisigTransactions follows the pages of a multisig transaction listing
+func listMultisigTransactions(url string) ([]multisigTxResponse, error) {
+	var txs []multisigTxResponse
+	for url != "" {
+		resp, err := httpGet(url)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := serviceBody(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		var page multisigTxListResponse
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+
+		txs = append(txs, page.Results...)
+
+		url = ""
+		if page.Next != nil {
+			url = *page.Next
+		}
+	}
+
+	return txs, nil
+}
+
+type confirmationRequest struct {
+	Signature string `json:"signature"`
+}
+
+func submitConfirmation(safeTxHash, signature string) error {
+	return transactionService.Confirm(safeTxHash, signature)
+}
+
+// encodeSafeTx returns the EIP-712 encoding hashed into the safeTxHash of a
+// safe of the given version on chainID, which is also the data passed to
+// EIP-1271 contract owners
+func encodeSafeTx(gnosisSafeTx *core.GnosisSafeTx, chainID int64, version string) ([]byte, error) {
+	typedData, err := safeTxTypedData(gnosisSafeTx, chainID, version)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return encodeTypedData(typedData)
+}
 
-	resp, err := http.Post("https://safe-transaction.rinkeby.gnosis.io/api/v1/safes/"+safe+"/multisig-transactions/", "application/json", bytes.NewBuffer(req))
+// encodeTypedData returns 0x1901 || domain separator || struct hash, the
+// keccak256 of which is signed
+func encodeTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	domainHash, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
 	if err != nil {
-		return err
+		return nil, err
+	}
+	primaryTypeHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusOK {
-		return nil
+	encoded := []byte{0x19, 0x01}
+	encoded = append(encoded, domainHash...)
+	encoded = append(encoded, primaryTypeHash...)
+
+	return encoded, nil
+}
+
+// safeTxHash is the safeTxHash of a safe of the given version on chainID
+func safeTxHash(gnosisSafeTx *core.GnosisSafeTx, chainID int64, version string) (common.Hash, error) {
+	encodedTx, err := encodeSafeTx(gnosisSafeTx, chainID, version)
+	if err != nil {
+		return common.Hash{}, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	return crypto.Keccak256Hash(encodedTx), nil
+}
+
+// safeTxTypedData is the typed data of a transaction for the domain of a safe
+// version: chainId joined the domain in 1.3.0 and safes before 1.0.0 named
+// baseGas dataGas, so a transaction can't be hashed without the version
+func safeTxTypedData(gnosisSafeTx *core.GnosisSafeTx, chainID int64, version string) (apitypes.TypedData, error) {
+	if _, ok := parseVersion(version); !ok {
+		return apitypes.TypedData{}, fmt.Errorf("unknown safe version %q, the hash of its transactions depends on it", version)
+	}
+	typedData := gnosisSafeTx.ToTypedData()
+
+	if versionAtLeast(version, 1, 3) {
+		typedData.Domain.ChainId = math.NewHexOrDecimal256(chainID)
+		typedData.Types["EIP712Domain"] = append([]apitypes.Type{{Name: "chainId", Type: "uint256"}}, typedData.Types["EIP712Domain"]...)
+	}
+	if !versionAtLeast(version, 1, 0) {
+		fields := make([]apitypes.Type, len(typedData.Types["SafeTx"]))
+		for i, field := range typedData.Types["SafeTx"] {
+			if field.Name == "baseGas" {
+				field.Name = "dataGas"
+			}
+			fields[i] = field
+		}
+		typedData.Types["SafeTx"] = fields
+		typedData.Message["dataGas"] = typedData.Message["baseGas"]
+		delete(typedData.Message, "baseGas")
+	}
+	return typedData, nil
+}
+
+// safeTxDomain is the chain and version of a safe the hash of its
+// transactions depends on, the version read onchain when a client is given
+// and otherwise from the transaction service
+func safeTxDomain(safe string, client EthClient) (int64, string, error) {
+	var version string
+	if client != nil {
+		v, err := readVersion(client, common.HexToAddress(safe))
+		if err != nil {
+			return 0, "", err
+		}
+		version = v
+	} else {
+		info, err := cachedSafeInfo(safe)
+		if err != nil {
+			return 0, "", err
+		}
+		version = info.Version
+	}
+	if version == "" {
+		return 0, "", fmt.Errorf("the version of safe %s is unknown, the hash of its transactions depends on it", safe)
+	}
+	chainID, err := serviceChain()
 	if err != nil {
-		return err
+		return 0, "", err
+	}
+	return chainID, version, nil
+}
+
+// txDomain is safeTxDomain of the safe of tx, unless its transaction file
+// records the version
+func txDomain(tx *multisigTxResponse, client EthClient) (int64, string, error) {
+	if tx.SafeVersion != "" {
+		chainID, err := serviceChain()
+		return chainID, tx.SafeVersion, err
 	}
+	return safeTxDomain(tx.Safe, client)
+}
 
-	var data gnosisTxErrResponse
-	if err := json.Unmarshal(body, &data); err != nil {
-		return err
+func signSafeTxHash(hash common.Hash, privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	signature, err := crypto.Sign(hash.Bytes(), privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalizeECDSA(signature)
+}
+
+func (tx *multisigTxResponse) gnosisSafeTx() (*core.GnosisSafeTx, error) {
+	value, ok := math.ParseBig256(tx.Value)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %q", tx.Value)
+	}
+
+	gasPrice, ok := math.ParseBig256(tx.GasPrice)
+	if !ok {
+		return nil, fmt.Errorf("invalid gas price %q", tx.GasPrice)
+	}
+
+	data := hexutil.Bytes{}
+	if tx.Data != nil {
+		var err error
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &core.GnosisSafeTx{
+		Safe:           common.NewMixedcaseAddress(common.HexToAddress(tx.Safe)),
+		To:             common.NewMixedcaseAddress(common.HexToAddress(tx.To)),
+		Value:          math.Decimal256(*value),
+		GasPrice:       math.Decimal256(*gasPrice),
+		Data:           &data,
+		Operation:      tx.Operation,
+		GasToken:       common.HexToAddress(tx.GasToken),
+		RefundReceiver: common.HexToAddress(tx.RefundReceiver),
+		BaseGas:        *big.NewInt(tx.BaseGas),
+		SafeTxGas:      *big.NewInt(tx.SafeTxGas),
+		Nonce:          *big.NewInt(tx.Nonce),
+	}, nil
+}
+
+// typedData is the typed data of tx the owners of a safe of the given
+// version on chainID sign
+func (tx *multisigTxResponse) typedData(chainID int64, version string) (apitypes.TypedData, error) {
+	gnosisSafeTx, err := tx.gnosisSafeTx()
+	if err != nil {
+		return apitypes.TypedData{}, err
 	}
+	return safeTxTypedData(gnosisSafeTx, chainID, version)
+}
 
-	return errors.New(strings.Join(data.NonFieldErrors, "\n"))
+func (tx *multisigTxResponse) hash(chainID int64, version string) (common.Hash, error) {
+	gnosisSafeTx, err := tx.gnosisSafeTx()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return safeTxHash(gnosisSafeTx, chainID, version)
 }
 
-func sendTransaction(from, to, safe string, amount int64, privKey string) error {
-	// get current safe nonce
-	nonce, err := getSafeNonce(safe)
+type proposalOptions struct {
+	policy       *policy
+	reviewDir    string
+	manifestFile string
+	quorumRPCs   []string
+	rpc          string
+	trustedBlock common.Hash
+	nonce        string
+	replace      int64
+	estimate     string
+	simulate     bool
+	asDelegate   bool
+	signer       string
+	signersFile  string
+	lint         string
+	verification string
+	proxies      string
+	ackNew       []string
+	allowUnknown bool
+	chainOnly    bool
+	bundleDir    string
+	hooks        *hooksConfig
+	attester     *attester
+	refund       *gasRefund
+	onNonceRace  string
+	// safeTxGas used when every estimation fails
+	safeTxGas *int64
+	// times the proposal moved nonce after a race
+	nonceRaces int
+	// extra fields of the proposal origin
+	origin map[string]string
+	// resolved template variables, shown in the review artifact
+	variables []string
+}
+
+func sendTransaction(from, to, safe string, amount int64, data []byte, operation uint8, privKey string, opts *proposalOptions) error {
+	for _, addr := range []struct{ flag, value string }{{"-from", from}, {"-to", to}, {"-safe", safe}} {
+		if err := checkAddress(addr.value); err != nil {
+			return fmt.Errorf("invalid %s address %q: %w", addr.flag, addr.value, err)
+		}
+	}
+
+	// check policy before doing anything else
+	if err := checkPolicy(opts.policy, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation); err != nil {
+		return err
+	}
+	if err := checkLint(opts.lint, opts.rpc, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation); err != nil {
+		return err
+	}
+	if err := checkVerification(opts.verification, opts.rpc, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation); err != nil {
+		return err
+	}
+	if err := checkProxies(opts.proxies, opts.rpc, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation); err != nil {
+		return err
+	}
+	if opts.chainOnly {
+		logger.Warn("first interactions aren't checked in chain-only mode, the history is in the transaction service")
+	} else if err := checkFirstInteraction(opts.ackNew, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation); err != nil {
+		return chainOnlyHint(err)
+	}
+	if err := checkAddressBook(opts.allowUnknown, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation); err != nil {
+		return err
+	}
+
+	// get the nonce to propose at
+	currentOperation.Safe = safe
+	currentOperation.step("resolving nonce")
+	var nonce *int64
+	var err error
+	if opts.chainOnly {
+		nonce, err = resolveNonceOnchain(opts.rpc, safe, opts.nonce, opts.replace)
+	} else if nonce, err = resolveNonce(safe, opts.nonce, opts.replace); err != nil {
+		err = chainOnlyHint(err)
+	}
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("nonce:", *nonce)
+	logger.Info("nonce", "nonce", *nonce)
+	currentOperation.Nonce = nonce
+
+	// the domain of the hash, read onchain in chain-only mode
+	var versionClient EthClient
+	if opts.chainOnly {
+		if versionClient, err = dialRPC(opts.rpc); err != nil {
+			return err
+		}
+		defer versionClient.Close()
+	}
+	chainID, version, err := safeTxDomain(safe, versionClient)
+	if err != nil {
+		return chainOnlyHint(err)
+	}
+	currentOperation.step("estimating gas")
 
 	// get gas estimation
-	safeTxGas, err := getGasEstimation(to, safe, amount)
+	var estimate *gasEstimate
+	estimation := opts.estimate
+	if estimation == "" {
+		estimation = defaultEstimation(version, opts.chainOnly, opts.refund != nil)
+	}
+	if opts.chainOnly && estimation == ESTIMATE_RELAY {
+		// the relay estimation is an endpoint of the service
+		estimation = ESTIMATE_LOCAL
+	}
+	switch estimation {
+	case ESTIMATE_NONE:
+		if opts.refund != nil {
+			return errors.New("the refund is bounded by safeTxGas, estimate it with -estimate " + ESTIMATE_RELAY + " or " + ESTIMATE_LOCAL)
+		}
+		if !versionAtLeast(version, 1, 3) {
+			logger.Warn("safes before 1.3.0 don't revert a failed call with safeTxGas 0, it still uses up the nonce", "version", version)
+		}
+		estimate = &gasEstimate{Source: GAS_SOURCE_NONE}
+	case ESTIMATE_RELAY:
+		if estimate, err = getGasEstimation(to, safe, amount, data, operation, opts.rpc, opts.safeTxGas); err != nil {
+			return err
+		}
+	case ESTIMATE_LOCAL:
+		if estimate, err = estimateGasLocal(opts.rpc, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation); err != nil {
+			if opts.safeTxGas == nil {
+				return err
+			}
+			logger.Warn("local gas estimation failed, using -safe-tx-gas", "err", err)
+			estimate = &gasEstimate{SafeTxGas: *opts.safeTxGas, Source: GAS_SOURCE_FLAG}
+		} else {
+			estimate.Source = GAS_SOURCE_LOCAL
+		}
+	default:
+		return fmt.Errorf("unknown estimation %q, expected %s, %s or %s", opts.estimate, ESTIMATE_RELAY, ESTIMATE_LOCAL, ESTIMATE_NONE)
+	}
+	safeTxGas, baseGas := &estimate.SafeTxGas, estimate.BaseGas
+	logger.Info("gas estimate", "baseGas", baseGas, "source", estimate.Source)
+
+	if opts.refund != nil && opts.chainOnly && opts.refund.gasPrice == nil {
+		return errors.New("the refund quote is an endpoint of the relay, give -chain-only proposals an explicit -gas-price")
+	}
+	refund, err := resolveRefund(opts.refund, estimate.Source == GAS_SOURCE_RELAY, safe, to, amount, data, operation, safeTxGas, &baseGas)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("safeTxGas:", safeTxGas)
+	logger.Info("gas estimate", "safeTxGas", *safeTxGas)
+	fmt.Printf("safeTxGas: %d (%s)\n", *safeTxGas, estimate.Source)
+	currentOperation.SafeTxGas = safeTxGas
+
+	if opts.refund != nil {
+		if baseGas == 0 {
+			logger.Warn("baseGas is 0, the refund only covers the gas of the inner call")
+		}
+		var client EthClient
+		if opts.rpc != "" {
+			if client, err = dialRPC(opts.rpc); err != nil {
+				return err
+			}
+			defer client.Close()
+			checkRefundBalance(client, common.HexToAddress(safe), big.NewInt(amount), maxRefund(*safeTxGas, baseGas, refund.gasPrice), refund.gasToken)
+		}
+		fmt.Println("refund:", describeRefund(client, *safeTxGas, baseGas, refund.gasPrice, refund.gasToken, refund.receiver))
+	}
+
+	// simulate the execution before anything is signed
+	simulation := "not performed"
+	if opts.simulate {
+		currentOperation.step("simulating")
+		result, err := simulateExecution(opts.rpc, common.HexToAddress(safe), common.HexToAddress(to), big.NewInt(amount), data, operation, *safeTxGas, baseGas)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("simulation:", result)
+		if !result.Success {
+			return explainRevert(fmt.Errorf("refusing to propose, execution would fail: %s", result.Reason),
+				&revertContext{Operation: operation, SafeTxGas: *safeTxGas, BaseGas: baseGas, GasPrice: refund.gasPrice, GasToken: refund.gasToken})
+		}
+		simulation = result.String()
+	}
 
 	// get contract transaction hash
 	gnosisSafeTx := core.GnosisSafeTx{
@@ -196,69 +629,300 @@ func sendTransaction(from, to, safe string, amount int64, privKey string) error
 		Safe:           common.NewMixedcaseAddress(common.HexToAddress(safe)),
 		To:             common.NewMixedcaseAddress(common.HexToAddress(to)),
 		Value:          *math.NewDecimal256(amount),
-		GasPrice:       *math.NewDecimal256(0),
-		Data:           &hexutil.Bytes{},
-		Operation:      0,
-		GasToken:       common.HexToAddress(ZERO_ADDR),
-		RefundReceiver: common.HexToAddress(ZERO_ADDR),
-		BaseGas:        *common.Big0,
+		GasPrice:       *math.NewDecimal256(refund.gasPrice.Int64()),
+		Data:           (*hexutil.Bytes)(&data),
+		Operation:      operation,
+		GasToken:       refund.gasToken,
+		RefundReceiver: refund.receiver,
+		BaseGas:        *big.NewInt(baseGas),
 		SafeTxGas:      *big.NewInt(*safeTxGas),
 		Nonce:          *big.NewInt(*nonce),
 	}
 
-	typedData := gnosisSafeTx.ToTypedData()
-
-	domainHash, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	encodedTxHash, err := safeTxHash(&gnosisSafeTx, chainID, version)
 	if err != nil {
 		return err
 	}
-	primaryTypeHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
-	if err != nil {
-		return err
+
+	logger.Info("safe transaction hash", "safeTxHash", encodedTxHash.Hex())
+	currentOperation.SafeTxHash = encodedTxHash.Hex()
+	currentOperation.step("checking signer")
+
+	var proposer signer
+	if opts.signer != "" {
+		if proposer, err = findSigner(opts.signersFile, opts.signer); err != nil {
+			return err
+		}
+	} else {
+		privateKey, err := crypto.HexToECDSA(privKey)
+		if err != nil {
+			return err
+		}
+		proposer = &keySigner{key: privateKey}
+	}
+	defer proposer.Close()
+	signerAddr := proposer.Address()
+
+	// a delegate proposes without confirming, the service only accepts it as sender if registered
+	if opts.asDelegate {
+		if opts.chainOnly {
+			return errors.New("delegates are registered in the transaction service, -as-delegate can't be used with -chain-only")
+		}
+		if signerAddr != common.HexToAddress(from) {
+			return fmt.Errorf("-from %s must be the delegate address %s", from, signerAddr.Hex())
+		}
+		if err := checkDelegate(safe, signerAddr); err != nil {
+			return err
+		}
+	}
+
+	// confirm an identical proposal rather than duplicating it
+	var existing *multisigTxResponse
+	if !opts.chainOnly {
+		if existing, err = existingProposal(safe, encodedTxHash, *nonce, opts.replace, signerAddr); err != nil {
+			return chainOnlyHint(err)
+		}
+		if existing != nil && opts.asDelegate {
+			return fmt.Errorf("transaction %s is already proposed, a delegate can't confirm it", encodedTxHash.Hex())
+		}
+	}
+
+	// cross-check the state the signature depends on
+	if len(opts.quorumRPCs) > 0 {
+		if err := checkSignerQuorum(opts.quorumRPCs, common.HexToAddress(safe), signerAddr, *nonce, opts.asDelegate); err != nil {
+			return err
+		}
 	}
 
-	encodedTx := []byte{1, 19}
-	encodedTx = append(encodedTx, domainHash...)
-	encodedTx = append(encodedTx, primaryTypeHash...)
+	if opts.trustedBlock != (common.Hash{}) {
+		if err := checkSignerVerified(opts.rpc, opts.trustedBlock, common.HexToAddress(safe), signerAddr, *nonce, opts.asDelegate); err != nil {
+			return err
+		}
+	}
 
-	encodedTxHash := crypto.Keccak256Hash(encodedTx)
+	// write review artifact, referenced in the proposal origin
+	originFields := map[string]string{}
+	for name, value := range opts.origin {
+		originFields[name] = value
+	}
+	if opts.reviewDir != "" {
+		reviewer, ok := proposer.(hashSigner)
+		if !ok {
+			return fmt.Errorf("signer %s can't sign review artifacts, drop -review-dir or use another signer", opts.signer)
+		}
+		artifact := newReviewArtifact(&gnosisSafeTx, chainID, version, encodedTxHash, proposer.Address(), opts.policy)
+		artifact.Simulation = simulation
+		artifact.Variables = opts.variables
+		artifactHash, err := writeReviewArtifact(opts.reviewDir, artifact, reviewer)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("reviewArtifact:", artifactHash.Hex())
+
+		originFields["reviewArtifact"] = artifactHash.Hex()
+	}
+	if opts.attester != nil {
+		att, err := opts.attester.attest(signerAddr, encodedTxHash)
+		if err != nil {
+			return err
+		}
+		dir := opts.reviewDir
+		if dir == "" {
+			dir = configPath("attestations")
+		}
+		path, err := writeAttestation(dir, att)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("attestation:", att.Hash, "written to", path)
+		originFields["attestation"] = att.Kind + ":" + att.Hash
+	}
+	var origin *string
+	if len(originFields) > 0 {
+		encoded, err := json.Marshal(originFields)
+		if err != nil {
+			return err
+		}
+		originJSON := string(encoded)
+		origin = &originJSON
+	}
 
-	fmt.Println("encodedTxHash:", encodedTxHash.Hex())
+	encodedData := hexutil.Encode(data)
+	proposal := &multisigTxResponse{
+		Safe:           safe,
+		To:             to,
+		Value:          big.NewInt(amount).String(),
+		Data:           &encodedData,
+		Operation:      operation,
+		GasToken:       refund.gasToken.Hex(),
+		SafeTxGas:      *safeTxGas,
+		BaseGas:        baseGas,
+		GasPrice:       refund.gasPrice.String(),
+		RefundReceiver: refund.receiver.Hex(),
+		Nonce:          *nonce,
+		SafeTxHash:     encodedTxHash.Hex(),
+		Origin:         origin,
+		SafeVersion:    version,
+	}
+
+	// external validation of the exact proposal before it is signed
+	if opts.hooks != nil {
+		if err := checkPreSignHooks(opts.hooks.PreSign, "propose", proposal, signerAddr); err != nil {
+			return err
+		}
+	}
 
 	// sign
-	privateKey, err := crypto.HexToECDSA(privKey)
+	typedData, err := safeTxTypedData(&gnosisSafeTx, chainID, version)
 	if err != nil {
 		return err
 	}
-
-	signature, err := crypto.Sign(encodedTxHash.Bytes(), privateKey)
+	signature, err := proposer.SignTypedData(typedData)
 	if err != nil {
 		return err
 	}
 
-	if signature[64] == 0 || signature[64] == 1 {
-		signature[64] += 27
+	// another owner may have proposed at the nonce while this one was signed
+	if !opts.chainOnly && existing == nil {
+		if existing, err = recheckNonce(safe, encodedTxHash, *nonce, opts.replace); err != nil {
+			var race *nonceRace
+			if errors.As(err, &race) && opts.onNonceRace == NONCE_RACE_BUMP && opts.nonceRaces < NONCE_RACE_RETRIES {
+				logger.Warn("nonce taken while signing, proposing again at the next free nonce", "nonce", *nonce, "next", race.Next)
+				bumped := *opts
+				bumped.nonce = strconv.FormatInt(race.Next, 10)
+				bumped.replace = -1
+				bumped.nonceRaces++
+				return sendTransaction(from, to, safe, amount, data, operation, privKey, &bumped)
+			}
+			return chainOnlyHint(err)
+		}
 	}
 
-	// send transaction to gnosis
-	if err := sendGnosisTx(from, to, safe, amount, *safeTxGas, *nonce, encodedTxHash.Hex(), hexutil.Encode(signature)); err != nil {
-		return err
+	// send transaction to gnosis, or keep it locally without the service
+	if opts.chainOnly {
+		if err := writeChainOnlyProposal(opts.bundleDir, proposal, signerAddr, signature); err != nil {
+			return err
+		}
+	} else if existing != nil {
+		fmt.Println("transaction already proposed by", existing.Proposer, "with", len(existing.Confirmations), "confirmations, confirming it instead")
+		if err := submitConfirmation(encodedTxHash.Hex(), hexutil.Encode(signature)); err != nil {
+			return chainOnlyHint(err)
+		}
+	} else if err := sendGnosisTx(from, to, safe, amount, data, operation, *safeTxGas, baseGas, *nonce, refund, encodedTxHash.Hex(), hexutil.Encode(signature), origin); err != nil {
+		return chainOnlyHint(err)
+	}
+	currentOperation.Submitted = true
+	currentOperation.Manifest = opts.manifestFile
+	currentOperation.step("submitted")
+
+	// record the proposal in the batch manifest
+	if opts.manifestFile != "" {
+		root, err := appendToManifest(opts.manifestFile, manifestEntry{Safe: common.HexToAddress(safe).Hex(), Nonce: *nonce, SafeTxHash: encodedTxHash.Hex()})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("manifestRoot:", root.Hex())
 	}
 
+	if opts.hooks != nil {
+		return runPostProposeHooks(opts.hooks.PostPropose, proposal, signerAddr)
+	}
 	return nil
 }
 
 func main() {
-	var (
-		safe    string = "<SAFE_ADDRESS>"
-		from    string = "<SIGNER_ADDRESS>"
-		to      string = "<RECEIVER_ADDRESS>"
-		privKey string = "<SIGNER_PRIVATE_KEY>"
-		amount  int64  = 1000000
-	)
-
-	// on rinkeby network
-	if err := sendTransaction(from, to, safe, amount, privKey); err != nil {
+	args, timeout, err := extractTimeout(os.Args[1:])
+	if err != nil {
 		fmt.Println("error:", err.Error())
+		os.Exit(2)
+	}
+
+	args, skipChecksum = extractBoolFlag(args, "no-checksum")
+	args, verbose := extractBoolFlag(args, "verbose")
+	args, quiet := extractBoolFlag(args, "quiet")
+	args, traceHTTP := extractBoolFlag(args, "trace-http")
+	args, noCache := extractBoolFlag(args, "no-cache")
+	cacheDisabled = cacheDisabled || noCache
+	setLogLevel(verbose, quiet)
+	// before the logging transport, which wraps the default one
+	if err := setTransport(); err != nil {
+		fmt.Println("error:", err.Error())
+		os.Exit(2)
+	}
+	setHTTPLogging(traceHTTP)
+
+	args, zone, _, err := extractFlag(args, "tz")
+	if err == nil {
+		err = setDisplayZone(zone)
+	}
+	var numbers string
+	if err == nil {
+		args, numbers, _, err = extractFlag(args, "numbers")
+	}
+	if err == nil {
+		err = setNumberFormat(numbers)
+	}
+	var service string
+	if err == nil {
+		args, service, _, err = extractFlag(args, "service")
+	}
+	var verifyRPC string
+	var verify bool
+	if err == nil {
+		args, verifyRPC, verify, err = extractFlag(args, "verify-onchain")
+	}
+	if verify {
+		verifyOnchainRPC = verifyRPC
+	}
+	if err == nil {
+		err = setServiceURL(service)
+	}
+	if err == nil {
+		err = setServiceAuth()
+	}
+	if err == nil {
+		err = setServiceChain()
+	}
+	if err == nil {
+		err = setServiceMirrors()
+	}
+	if err == nil {
+		err = setNetworks()
+	}
+	if err == nil {
+		err = setAddressBook()
+	}
+	if err != nil {
+		fmt.Println("error:", err.Error())
+		os.Exit(2)
+	}
+
+	cancel := setOperationTimeout(timeout)
+	defer cancel()
+
+	command := "send"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	run, ok := commands[command]
+	if !ok {
+		fmt.Println("error: unknown command", command)
+		os.Exit(2)
+	}
+
+	currentOperation = newOperationState(command, args)
+	if err := run(args); err != nil {
+		err = withHint(err)
+		fmt.Println("error:", currentOperation.failed(err).Error())
+		if hint := errorHintOf(err); hint != "" {
+			fmt.Println("hint:", hint)
+		}
+		cancel()
+		os.Exit(1)
 	}
+	currentOperation.finish()
 }
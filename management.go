@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	setGuardSelector           = []byte{0xe1, 0x9a, 0x9d, 0xd9}
+	setFallbackHandlerSelector = []byte{0xf0, 0x8a, 0x03, 0x23}
+	enableModuleSelector       = []byte{0x61, 0x0b, 0x59, 0x25}
+)
+
+func encodeAddressCall(selector []byte, addr common.Address) []byte {
+	data := common.CopyBytes(selector)
+	return append(data, common.LeftPadBytes(addr.Bytes(), 32)...)
+}
+
+// versionAtLeast compares a safe version such as "1.3.0+L2" against major.minor
+func versionAtLeast(version string, major, minor int) bool {
+	version = strings.SplitN(version, "+", 2)[0]
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return false
+	}
+
+	maj, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	min, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+
+	return maj > major || (maj == major && min >= minor)
+}
+
+func isContract(rpc string, addr common.Address) (bool, error) {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	code, err := client.CodeAt(opCtx, addr, nil)
+	if err != nil {
+		return false, err
+	}
+
+	return len(code) > 0, nil
+}
+
+func buildSetGuard(safe, rpc string, guard common.Address) ([]byte, error) {
+	info, err := getSafeInfo(safe)
+	if err != nil {
+		return nil, err
+	}
+
+	if !versionAtLeast(info.Version, 1, 3) {
+		return nil, fmt.Errorf("guards require safe version 1.3.0 or later, safe is %s", info.Version)
+	}
+
+	current := common.HexToAddress(info.Guard)
+	if current == guard {
+		return nil, fmt.Errorf("guard is already set to %s", guard.Hex())
+	}
+
+	if guard == (common.Address{}) {
+		logger.Warn("removing the guard, transactions will no longer be checked by it", "guard", current.Hex())
+	} else {
+		ok, err := isContract(rpc, guard)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("guard %s is not a contract", guard.Hex())
+		}
+		if current != (common.Address{}) {
+			logger.Warn("replacing the guard", "guard", current.Hex())
+		}
+	}
+
+	return encodeAddressCall(setGuardSelector, guard), nil
+}
+
+func buildSetFallbackHandler(safe, rpc string, handler common.Address) ([]byte, error) {
+	info, err := getSafeInfo(safe)
+	if err != nil {
+		return nil, err
+	}
+
+	current := common.HexToAddress(info.FallbackHandler)
+	if current == handler {
+		return nil, fmt.Errorf("fallback handler is already set to %s", handler.Hex())
+	}
+
+	if handler == (common.Address{}) {
+		logger.Warn("removing the fallback handler, token callbacks and EIP-1271 signatures will stop working", "handler", current.Hex())
+	} else {
+		ok, err := isContract(rpc, handler)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("fallback handler %s is not a contract", handler.Hex())
+		}
+	}
+
+	return encodeAddressCall(setFallbackHandlerSelector, handler), nil
+}
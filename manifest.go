@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type manifestEntry struct {
+	Safe       string `json:"safe"`
+	Nonce      int64  `json:"nonce"`
+	SafeTxHash string `json:"safeTxHash"`
+}
+
+type batchManifest struct {
+	CreatedAt  string          `json:"createdAt"`
+	Entries    []manifestEntry `json:"entries"`
+	MerkleRoot string          `json:"merkleRoot"`
+}
+
+func hashPair(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256(a, b)
+}
+
+func manifestLeaf(entry manifestEntry) []byte {
+	return crypto.Keccak256(common.HexToAddress(entry.Safe).Bytes(), common.HexToHash(entry.SafeTxHash).Bytes())
+}
+
+// merkleRoot builds a sorted-pair keccak256 tree, promoting the last node of odd levels
+func merkleRoot(leaves [][]byte) common.Hash {
+	if len(leaves) == 0 {
+		return common.Hash{}
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, hashPair(level[i], level[i+1]))
+			}
+		}
+		level = next
+	}
+
+	return common.BytesToHash(level[0])
+}
+
+// merkleProof returns the sibling path of leaf index in the tree built by merkleRoot
+func merkleProof(leaves [][]byte, index int) [][]byte {
+	var proof [][]byte
+
+	level := leaves
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, hashPair(level[i], level[i+1]))
+			}
+		}
+		level, index = next, index/2
+	}
+
+	return proof
+}
+
+func verifyMerkleProof(root common.Hash, leaf []byte, proof [][]byte) bool {
+	node := leaf
+	for _, sibling := range proof {
+		node = hashPair(node, sibling)
+	}
+	return common.BytesToHash(node) == root
+}
+
+func (m *batchManifest) leaves() [][]byte {
+	leaves := make([][]byte, len(m.Entries))
+	for i, entry := range m.Entries {
+		leaves[i] = manifestLeaf(entry)
+	}
+	return leaves
+}
+
+func (m *batchManifest) contains(safeTxHash string) bool {
+	for _, entry := range m.Entries {
+		if entry.SafeTxHash == safeTxHash {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *batchManifest) root() common.Hash {
+	return merkleRoot(m.leaves())
+}
+
+func loadManifest(path string) (*batchManifest, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m batchManifest
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// appendToManifest adds a proposal to the manifest at path, creating it if needed
+func appendToManifest(path string, entry manifestEntry) (common.Hash, error) {
+	m, err := loadManifest(path)
+	if os.IsNotExist(err) {
+		m, err = &batchManifest{CreatedAt: formatTime(time.Now())}, nil
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	if m.contains(entry.SafeTxHash) {
+		return common.Hash{}, fmt.Errorf("proposal %s is already in manifest %s", entry.SafeTxHash, path)
+	}
+
+	m.Entries = append(m.Entries, entry)
+	root := m.root()
+	m.MerkleRoot = root.Hex()
+
+	encoded, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return root, ioutil.WriteFile(path, encoded, 0o644)
+}
+
+// verifyManifest recomputes the manifest root and checks it against the recorded
+// root and, if given, the root published by the coordinator
+func verifyManifest(m *batchManifest, expectedRoot string) error {
+	root := m.root()
+	if root.Hex() != m.MerkleRoot {
+		return fmt.Errorf("manifest root mismatch: recorded %s, computed %s", m.MerkleRoot, root.Hex())
+	}
+	if expectedRoot != "" && common.HexToHash(expectedRoot) != root {
+		return fmt.Errorf("manifest root %s does not match expected root %s", root.Hex(), expectedRoot)
+	}
+	return nil
+}
+
+// manifestProof returns the inclusion proof of a safeTxHash in the manifest
+func manifestProof(m *batchManifest, safeTxHash common.Hash) ([][]byte, error) {
+	for i, entry := range m.Entries {
+		if common.HexToHash(entry.SafeTxHash) == safeTxHash {
+			return merkleProof(m.leaves(), i), nil
+		}
+	}
+	return nil, fmt.Errorf("proposal %s is not part of the manifest", safeTxHash.Hex())
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+type safeMessageConfirmation struct {
+	Owner     string `json:"owner"`
+	Signature string `json:"signature"`
+}
+
+type safeMessageResponse struct {
+	MessageHash       string                    `json:"messageHash"`
+	Message           json.RawMessage           `json:"message"`
+	Confirmations     []safeMessageConfirmation `json:"confirmations"`
+	PreparedSignature *string                   `json:"preparedSignature"`
+}
+
+type safeMessageRequest struct {
+	Message   interface{} `json:"message"`
+	SafeAppID *int64      `json:"safeAppId"`
+	Signature string      `json:"signature"`
+}
+
+// dappMessage is a message a dapp asks the safe to sign, either EIP-191 text
+// or EIP-712 typed data
+type dappMessage struct {
+	Text      string
+	TypedData *apitypes.TypedData
+}
+
+func loadTypedData(path string) (*apitypes.TypedData, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// dapps usually send the chain id as a number, which apitypes rejects
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("invalid typed data %s: %w", path, err)
+	}
+	var domain map[string]interface{}
+	if err := json.Unmarshal(raw["domain"], &domain); err == nil {
+		if chainID, ok := domain["chainId"].(float64); ok {
+			domain["chainId"] = fmt.Sprintf("%.0f", chainID)
+			if raw["domain"], err = json.Marshal(domain); err != nil {
+				return nil, err
+			}
+			if content, err = json.Marshal(raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var typedData apitypes.TypedData
+	if err := json.Unmarshal(content, &typedData); err != nil {
+		return nil, fmt.Errorf("invalid typed data %s: %w", path, err)
+	}
+	return &typedData, nil
+}
+
+// hash is the hash the dapp verifies with isValidSignature(bytes32,bytes)
+func (m *dappMessage) hash() (common.Hash, error) {
+	if m.TypedData == nil {
+		return common.BytesToHash(accounts.TextHash([]byte(m.Text))), nil
+	}
+
+	domainSeparator, err := m.TypedData.HashStruct("EIP712Domain", m.TypedData.Domain.Map())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	structHash, err := m.TypedData.HashStruct(m.TypedData.PrimaryType, m.TypedData.Message)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator, structHash), nil
+}
+
+func (m *dappMessage) payload() interface{} {
+	if m.TypedData != nil {
+		return m.TypedData
+	}
+	return m.Text
+}
+
+func getSafeMessage(messageHash common.Hash) (*safeMessageResponse, error) {
+	resp, err := httpGet(serviceEndpoint("/messages/") + messageHash.Hex() + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := serviceBody(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("message %s %w", messageHash.Hex(), errTxNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data safeMessageResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func proposeSafeMessage(safe string, message *dappMessage, signature []byte) error {
+	req, err := json.Marshal(safeMessageRequest{Message: message.payload(), Signature: hexutil.Encode(signature)})
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpPost(serviceEndpoint("/safes/")+safe+"/messages/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return err
+	}
+
+	if _, err := serviceBody(resp); err != nil {
+		return withHint(fmt.Errorf("message rejected: %w", err))
+	}
+	return nil
+}
+
+func confirmSafeMessage(messageHash common.Hash, signature []byte) error {
+	req, err := json.Marshal(confirmationRequest{Signature: hexutil.Encode(signature)})
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpPost(serviceEndpoint("/messages/")+messageHash.Hex()+"/signatures/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return err
+	}
+
+	if _, err := serviceBody(resp); err != nil {
+		return withHint(fmt.Errorf("message signature rejected: %w", err))
+	}
+	return nil
+}
+
+// signSafeMessageOffchain signs the safe message hash of message with an owner
+// key and proposes it, or adds the signature when already proposed
+func signSafeMessageOffchain(rpc, safe string, message *dappMessage, key *ecdsa.PrivateKey) error {
+	if err := requireServiceFeature(FEATURE_MESSAGES); err != nil {
+		return fmt.Errorf("%w, sign the message with -onchain instead", err)
+	}
+
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	dataHash, err := message.hash()
+	if err != nil {
+		return err
+	}
+
+	// the safe verifies isValidSignature(bytes32) with the hash as message
+	messageHash, err := safeMessageHash(client, common.HexToAddress(safe), dataHash.Bytes())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("dataHash:", dataHash.Hex())
+	fmt.Println("safeMessageHash:", messageHash.Hex())
+
+	signature, err := signSafeTxHash(messageHash, key)
+	if err != nil {
+		return err
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+
+	existing, err := getSafeMessage(messageHash)
+	switch {
+	case errors.Is(err, errTxNotFound):
+		if err := proposeSafeMessage(safe, message, signature); err != nil {
+			return err
+		}
+		fmt.Println("proposed message signed by", owner.Hex())
+	case err != nil:
+		return err
+	default:
+		for _, confirmation := range existing.Confirmations {
+			if common.HexToAddress(confirmation.Owner) == owner {
+				return fmt.Errorf("%s already signed message %s", owner.Hex(), messageHash.Hex())
+			}
+		}
+		if err := confirmSafeMessage(messageHash, signature); err != nil {
+			return err
+		}
+		fmt.Println("added signature of", owner.Hex())
+	}
+
+	updated, err := getSafeMessage(messageHash)
+	if err != nil {
+		return err
+	}
+	info, err := cachedSafeInfo(safe)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("confirmations: %d/%d\n", len(updated.Confirmations), info.Threshold)
+	if updated.PreparedSignature != nil && int64(len(updated.Confirmations)) >= info.Threshold {
+		fmt.Println("EIP-1271 signature:", *updated.PreparedSignature)
+	}
+	return nil
+}
+
+// signMessageCall is the SignMessageLib call marking the message as signed
+// onchain, to be executed by the safe with delegatecall
+func signMessageCall(message *dappMessage) ([]byte, error) {
+	dataHash, err := message.hash()
+	if err != nil {
+		return nil, err
+	}
+	return encodeCall("signMessage(bytes)", dataHash.Bytes())
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a mirror that failed within this long is tried after the healthy ones
+const MIRROR_COOLDOWN = 5 * time.Minute
+
+// serviceMirrors are other deployments of the transaction service indexing
+// the same chain, tried in turn when serviceURL fails; read from mirrors.json
+// in the config directory by chain id, or $GNOSIS_TX_SERVICE_MIRRORS
+var serviceMirrors []string
+
+// mirrorHealth is the record of a service base in service-health.json
+type mirrorHealth struct {
+	// consecutive failures, reset by a success
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure,omitempty"`
+	// moving average of the response time of successes
+	LatencyMs int64 `json:"latencyMs"`
+}
+
+var (
+	healthMu sync.Mutex
+	health   map[string]*mirrorHealth
+)
+
+func setServiceMirrors() error {
+	path := configPath("mirrors.json")
+	byChain := map[string][]string{}
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(content, &byChain); err != nil {
+			return fmt.Errorf("invalid mirrors config %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	mirrors := byChain[strconv.FormatInt(serviceChainID, 10)]
+	if env := os.Getenv("GNOSIS_TX_SERVICE_MIRRORS"); env != "" {
+		mirrors = strings.Split(env, ",")
+	}
+	serviceMirrors = nil
+	for _, mirror := range mirrors {
+		mirror = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(mirror), "/"), "/api/v1")
+		if !strings.HasPrefix(mirror, "https://") && !strings.HasPrefix(mirror, "http://") {
+			return fmt.Errorf("invalid service mirror %q", mirror)
+		}
+		if mirror != serviceURL {
+			serviceMirrors = append(serviceMirrors, mirror)
+		}
+	}
+	return nil
+}
+
+// serviceBase returns the service base url is under, if any
+func serviceBase(url string) (string, bool) {
+	for _, base := range append([]string{serviceURL}, serviceMirrors...) {
+		if underEndpoint(url, base) {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+func loadHealth() map[string]*mirrorHealth {
+	if health != nil {
+		return health
+	}
+	health = map[string]*mirrorHealth{}
+	if content, err := ioutil.ReadFile(configPath("service-health.json")); err == nil {
+		if err := json.Unmarshal(content, &health); err != nil {
+			logger.Warn("ignoring invalid service health records", "err", err)
+			health = map[string]*mirrorHealth{}
+		}
+	}
+	return health
+}
+
+// serviceCandidates orders serviceURL and its mirrors by health: those
+// without a recent failure first, then by consecutive failures and latency,
+// the configured order breaking ties
+func serviceCandidates() []string {
+	candidates := append([]string{serviceURL}, serviceMirrors...)
+	if len(candidates) == 1 {
+		return candidates
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	records := loadHealth()
+	cooling := func(base string) bool {
+		h := records[base]
+		return h != nil && h.Failures > 0 && time.Since(h.LastFailure) < MIRROR_COOLDOWN
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := records[candidates[i]], records[candidates[j]]
+		if ci, cj := cooling(candidates[i]), cooling(candidates[j]); ci != cj {
+			return cj
+		}
+		if a == nil || b == nil {
+			return false
+		}
+		if a.Failures != b.Failures {
+			return a.Failures < b.Failures
+		}
+		return a.LatencyMs < b.LatencyMs
+	})
+	return candidates
+}
+
+// recordHealth updates the health of a service base after a request, the
+// records only matter with mirrors to choose from
+func recordHealth(base string, ok bool, took time.Duration) {
+	if len(serviceMirrors) == 0 {
+		return
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	records := loadHealth()
+	h := records[base]
+	if h == nil {
+		h = &mirrorHealth{}
+		records[base] = h
+	}
+	if ok {
+		h.Failures = 0
+		if h.LatencyMs == 0 {
+			h.LatencyMs = took.Milliseconds()
+		} else {
+			h.LatencyMs = (3*h.LatencyMs + took.Milliseconds()) / 4
+		}
+	} else {
+		h.Failures++
+		h.LastFailure = time.Now().UTC()
+	}
+
+	if err := os.MkdirAll(configDir(), 0o700); err == nil {
+		if encoded, err := json.MarshalIndent(records, "", "  "); err == nil {
+			ioutil.WriteFile(configPath("service-health.json"), encoded, 0o644)
+		}
+	}
+}
+
+// failOver reports whether a service response or error should be retried on
+// the next mirror: unreachable services always, server errors only for reads
+// as a write may have gone through
+func failOver(method string, resp *http.Response, err error) bool {
+	if err != nil {
+		return opCtx.Err() == nil
+	}
+	return method == http.MethodGet && resp.StatusCode >= 500
+}
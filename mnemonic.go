@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const SIGNER_MNEMONIC = "mnemonic"
+
+// the standard ethereum path, the last component is the account index
+const DEFAULT_HD_PATH = "m/44'/60'/0'/0/0"
+
+// readMnemonic takes the mnemonic from the environment variable, prompting
+// for it without echo when none is configured
+func readMnemonic(env string) (string, error) {
+	mnemonic := os.Getenv(env)
+	if env != "" && mnemonic == "" {
+		return "", fmt.Errorf("$%s holding the mnemonic is not set", env)
+	}
+
+	if env == "" {
+		var err error
+		if mnemonic, err = prompt.Stdin.PromptPassword("mnemonic: "); err != nil {
+			return "", err
+		}
+	}
+
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return "", errors.New("invalid BIP-39 mnemonic, check the words and their order")
+	}
+	return mnemonic, nil
+}
+
+// deriveKey derives the BIP-32 key at path from a BIP-39 seed
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	curve := crypto.S256().Params()
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode := new(big.Int).SetBytes(sum[:32]), sum[32:]
+
+	for _, index := range path {
+		data := make([]byte, 0, 37)
+		if index >= 0x80000000 {
+			data = append(append(data, 0), key.FillBytes(make([]byte, 32))...)
+		} else {
+			private, err := crypto.ToECDSA(key.FillBytes(make([]byte, 32)))
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, crypto.CompressPubkey(&private.PublicKey)...)
+		}
+		data = append(data, make([]byte, 4)...)
+		binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(curve.N) >= 0 {
+			return nil, errors.New("invalid derived key, use the next index")
+		}
+		key.Add(key, tweak).Mod(key, curve.N)
+		if key.Sign() == 0 {
+			return nil, errors.New("invalid derived key, use the next index")
+		}
+		chainCode = sum[32:]
+	}
+
+	return crypto.ToECDSA(key.FillBytes(make([]byte, 32)))
+}
+
+func parseHDPath(path string) (accounts.DerivationPath, error) {
+	if path == "" {
+		path = DEFAULT_HD_PATH
+	}
+	return accounts.ParseDerivationPath(path)
+}
+
+// openMnemonic derives the signing key at path, the passphrase (BIP-39 "25th
+// word") is read from passwordEnv when set
+func openMnemonic(keyEnv, path, passwordEnv string) (signer, error) {
+	derivation, err := parseHDPath(path)
+	if err != nil {
+		return nil, err
+	}
+	mnemonic, err := readMnemonic(keyEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	var passphrase string
+	if passwordEnv != "" {
+		if passphrase, err = secretFromEnv(passwordEnv, "mnemonic passphrase"); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := deriveKey(bip39.NewSeed(mnemonic, passphrase), derivation)
+	if err != nil {
+		return nil, err
+	}
+	return &keySigner{key: key}, nil
+}
+
+// listDerivedAddresses prints the addresses of count accounts from the base
+// path, incrementing its last component
+func listDerivedAddresses(keyEnv, path, passwordEnv string, count int) error {
+	base, err := parseHDPath(path)
+	if err != nil {
+		return err
+	}
+	mnemonic, err := readMnemonic(keyEnv)
+	if err != nil {
+		return err
+	}
+
+	var passphrase string
+	if passwordEnv != "" {
+		if passphrase, err = secretFromEnv(passwordEnv, "mnemonic passphrase"); err != nil {
+			return err
+		}
+	}
+	seed := bip39.NewSeed(mnemonic, passphrase)
+
+	next := accounts.DefaultIterator(base)
+	for i := 0; i < count; i++ {
+		derivation := next()
+		key, err := deriveKey(seed, derivation)
+		if err != nil {
+			fmt.Printf("%-22s %v\n", derivation, err)
+			continue
+		}
+		fmt.Printf("%-22s %s\n", derivation, crypto.PubkeyToAddress(key.PublicKey).Hex())
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const DEFAULT_WORKERS = 8
+
+// loadSafeList combines the comma separated safes with those of a safes file,
+// one address per line with # comments
+func loadSafeList(list, file string) ([]string, error) {
+	entries := splitList(list)
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				entries = append(entries, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var safes []string
+	seen := map[common.Address]bool{}
+	for _, entry := range entries {
+		if err := checkAddress(entry); err != nil {
+			return nil, fmt.Errorf("invalid safe address %q: %w", entry, err)
+		}
+		if addr := common.HexToAddress(entry); !seen[addr] {
+			seen[addr] = true
+			safes = append(safes, addr.Hex())
+		}
+	}
+	if len(safes) == 0 {
+		return nil, errors.New("no safes given")
+	}
+	return safes, nil
+}
+
+// forEachSafe runs fn for every safe on a pool of workers, returning the
+// error of each safe by index so one failing safe doesn't stop the others
+func forEachSafe(safes []string, workers int, fn func(i int, safe string) error) []error {
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, len(safes))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(safes); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i, safes[i])
+			}
+		}()
+	}
+	for i := range safes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
+
+// safeErrors prints the failed safes and summarizes them as one error
+func safeErrors(safes []string, errs []error) error {
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: safe %s: %v\n", safes[i], err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d safes failed", failed, len(safes))
+	}
+	return nil
+}
+
+// printPending lists the queued transactions of a safe from its nonce on
+func printPending(safe string, nonce int64, pending []multisigTxResponse) {
+	fmt.Printf("%s: nonce %d, %d pending\n", safe, nonce, len(pending))
+	// oldest first, the listing is newest first
+	for i := len(pending) - 1; i >= 0; i-- {
+		tx := &pending[i]
+		fmt.Printf("  nonce %d %s (%d/%d confirmations)\n", tx.Nonce, tx.SafeTxHash, len(tx.Confirmations), tx.ConfirmationsRequired)
+		if origin := describeOrigin(tx.Origin); origin != "" {
+			fmt.Println("    origin:", origin)
+		}
+		for _, intent := range newWatchEvent(EVENT_PROPOSED, tx).Intent {
+			fmt.Println("    -", intent)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var multiSendSelector = []byte{0x8d, 0x80, 0xff, 0x0a}
+
+type multiSendTx struct {
+	Operation uint8
+	To        common.Address
+	Value     *big.Int
+	Data      []byte
+}
+
+func isMultiSend(data []byte) bool {
+	return len(data) >= 4 && bytes.Equal(data[:4], multiSendSelector)
+}
+
+// decodeMultiSend unpacks the transactions of a multiSend(bytes) call,
+// each one encoded as operation (1) | to (20) | value (32) | dataLength (32) | data
+func decodeMultiSend(data []byte) ([]multiSendTx, error) {
+	if !isMultiSend(data) {
+		return nil, errors.New("not a multiSend call")
+	}
+
+	args := data[4:]
+	if len(args) < 64 {
+		return nil, errors.New("multiSend call too short")
+	}
+
+	offset := new(big.Int).SetBytes(args[:32])
+	if !offset.IsUint64() || offset.Uint64()+32 > uint64(len(args)) {
+		return nil, errors.New("invalid multiSend data offset")
+	}
+	start := offset.Uint64()
+
+	length := new(big.Int).SetBytes(args[start : start+32])
+	if !length.IsUint64() || start+32+length.Uint64() > uint64(len(args)) {
+		return nil, errors.New("invalid multiSend data length")
+	}
+	packed := args[start+32 : start+32+length.Uint64()]
+
+	var txs []multiSendTx
+	for len(packed) > 0 {
+		if len(packed) < 85 {
+			return nil, errors.New("truncated multiSend transaction")
+		}
+
+		dataLength := new(big.Int).SetBytes(packed[53:85])
+		if !dataLength.IsUint64() || 85+dataLength.Uint64() > uint64(len(packed)) {
+			return nil, errors.New("invalid multiSend transaction data length")
+		}
+		end := 85 + dataLength.Uint64()
+
+		txs = append(txs, multiSendTx{
+			Operation: packed[0],
+			To:        common.BytesToAddress(packed[1:21]),
+			Value:     new(big.Int).SetBytes(packed[21:53]),
+			Data:      common.CopyBytes(packed[85:end]),
+		})
+		packed = packed[end:]
+	}
+
+	return txs, nil
+}
+
+func encodeMultiSend(txs []multiSendTx) []byte {
+	var packed []byte
+	for _, tx := range txs {
+		value := tx.Value
+		if value == nil {
+			value = common.Big0
+		}
+
+		packed = append(packed, tx.Operation)
+		packed = append(packed, tx.To.Bytes()...)
+		packed = append(packed, common.LeftPadBytes(value.Bytes(), 32)...)
+		packed = append(packed, common.LeftPadBytes(big.NewInt(int64(len(tx.Data))).Bytes(), 32)...)
+		packed = append(packed, tx.Data...)
+	}
+
+	data := common.CopyBytes(multiSendSelector)
+	data = append(data, common.LeftPadBytes(big.NewInt(32).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(packed))).Bytes(), 32)...)
+	data = append(data, common.RightPadBytes(packed, (len(packed)+31)/32*32)...)
+
+	return data
+}
+
+// canonicalMultiSends are the MultiSend and MultiSendCallOnly deployments of
+// every safe version, whichever one a batch was built against
+var canonicalMultiSends = map[common.Address]bool{
+	// 1.1.1
+	common.HexToAddress("0x8D29bE29923b68abfDD21e541b9374737B49cdAD"): true,
+	// 1.3.0
+	common.HexToAddress("0xA238CBeb142c10Ef7Ad8442C6D1f9E89e07e7761"): true,
+	common.HexToAddress("0x40A2aCCbd92BCA938b02010E17A5b8929b49130D"): true,
+	// 1.3.0 eip155
+	common.HexToAddress("0x998739BFdAAdde7C933B942a68053933098f9EDa"): true,
+	common.HexToAddress("0xA1dabEF33b3B82c7814B6D82A79e50F4AC44102B"): true,
+	// 1.4.1
+	common.HexToAddress(SETUP_MULTI_SEND):                             true,
+	common.HexToAddress("0x9641d764fc13c8B624c04430C7356C1C7C8102e2"): true,
+}
+
+// isMultiSendBatch tells a delegatecall into a canonical MultiSend or
+// MultiSendCallOnly apart from a call of any other contract exposing
+// multiSend(bytes), which runs code of its own
+func isMultiSendBatch(to common.Address, data []byte, operation uint8) bool {
+	if operation != 1 || !isMultiSend(data) {
+		return false
+	}
+	return canonicalMultiSends[to] || to == contractAddress(CONTRACT_MULTI_SEND) || to == contractAddress(CONTRACT_MULTI_SEND_CALL_ONLY)
+}
+
+// flattenTx returns the individual calls performed by a Safe transaction,
+// expanding MultiSend batches and the batches nested in them; any other
+// delegatecall is a single call to its target
+func flattenTx(to common.Address, value *big.Int, data []byte, operation uint8) ([]multiSendTx, error) {
+	if !isMultiSendBatch(to, data, operation) {
+		return []multiSendTx{{Operation: operation, To: to, Value: value, Data: data}}, nil
+	}
+
+	batch, err := decodeMultiSend(data)
+	if err != nil {
+		return nil, err
+	}
+	var txs []multiSendTx
+	for _, tx := range batch {
+		calls, err := flattenTx(tx.To, tx.Value, tx.Data, tx.Operation)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, calls...)
+	}
+	return txs, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestFlattenTx(t *testing.T) {
+	recipient, token := common.HexToAddress(testRecipient), common.HexToAddress(goldenWETH)
+	transfer := multiSendTx{To: recipient, Value: big.NewInt(1), Data: []byte{}}
+	call := multiSendTx{To: token, Value: new(big.Int), Data: common.FromHex(goldenTransfer)}
+	nested := multiSendTx{Operation: 1, To: contractAddress(CONTRACT_MULTI_SEND), Value: new(big.Int),
+		Data: encodeMultiSend([]multiSendTx{call, transfer})}
+	// a contract of its own exposing multiSend(bytes), whose code runs in the
+	// context of the safe
+	impostor := common.HexToAddress("0x00000000000000000000000000000000000bad01")
+
+	tests := []struct {
+		name string
+		to   common.Address
+		data []byte
+		want []multiSendTx
+	}{
+		{"batch", contractAddress(CONTRACT_MULTI_SEND_CALL_ONLY), encodeMultiSend([]multiSendTx{transfer, call}), []multiSendTx{transfer, call}},
+		{"nested batch", contractAddress(CONTRACT_MULTI_SEND), encodeMultiSend([]multiSendTx{transfer, nested}), []multiSendTx{transfer, call, transfer}},
+		{"1.4.1 batch", common.HexToAddress(SETUP_MULTI_SEND), encodeMultiSend([]multiSendTx{call}), []multiSendTx{call}},
+		{"1.3.0 eip155 batch", common.HexToAddress("0xA1dabEF33b3B82c7814B6D82A79e50F4AC44102B"), encodeMultiSend([]multiSendTx{transfer}), []multiSendTx{transfer}},
+		{"other multiSend contract", impostor, encodeMultiSend([]multiSendTx{transfer}), nil},
+	}
+	for _, tt := range tests {
+		got, err := flattenTx(tt.to, new(big.Int), tt.data, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.want == nil {
+			// opaque, the delegatecall itself
+			tt.want = []multiSendTx{{Operation: 1, To: tt.to, Value: new(big.Int), Data: tt.data}}
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: flattened into %d calls, want %d", tt.name, len(got), len(tt.want))
+		}
+		for i := range got {
+			if got[i].Operation != tt.want[i].Operation || got[i].To != tt.want[i].To ||
+				got[i].Value.Cmp(tt.want[i].Value) != 0 || common.Bytes2Hex(got[i].Data) != common.Bytes2Hex(tt.want[i].Data) {
+				t.Errorf("%s: call %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCheckPolicyDelegateCallTarget(t *testing.T) {
+	safe, recipient := common.HexToAddress(testSafe), common.HexToAddress(testRecipient)
+	transfer := multiSendTx{To: recipient, Value: big.NewInt(1), Data: []byte{}}
+	batch := encodeMultiSend([]multiSendTx{transfer})
+	nested := encodeMultiSend([]multiSendTx{{Operation: 1, To: contractAddress(CONTRACT_MULTI_SEND), Value: new(big.Int), Data: batch}})
+	impostor := common.HexToAddress("0x00000000000000000000000000000000000bad01")
+	p := &policy{
+		AllowedDestinations: []string{testRecipient},
+		DelegateCallTargets: []string{contractAddress(CONTRACT_MULTI_SEND_CALL_ONLY).Hex(), impostor.Hex()},
+	}
+
+	tests := []struct {
+		name    string
+		to      common.Address
+		data    []byte
+		allowed bool
+	}{
+		{"canonical batch", contractAddress(CONTRACT_MULTI_SEND_CALL_ONLY), batch, true},
+		// the impostor runs its own code with the same calldata, being an
+		// allowed delegatecall target doesn't make it an allowed destination
+		{"other multiSend contract", impostor, batch, false},
+		{"nested batch to a disallowed target", contractAddress(CONTRACT_MULTI_SEND_CALL_ONLY), nested, false},
+	}
+	for _, tt := range tests {
+		err := checkPolicy(p, safe, tt.to, new(big.Int), tt.data, 1)
+		if tt.allowed && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.allowed && err == nil {
+			t.Errorf("%s: allowed by the policy", tt.name)
+		}
+	}
+}
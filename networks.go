@@ -0,0 +1,426 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// names of the canonical safe 1.3.0 contracts in the network bundle
+const (
+	CONTRACT_SAFE                 = "safe"
+	CONTRACT_SAFE_L2              = "safeL2"
+	CONTRACT_PROXY_FACTORY        = "proxyFactory"
+	CONTRACT_FALLBACK_HANDLER     = "compatibilityFallbackHandler"
+	CONTRACT_MULTI_SEND           = "multiSend"
+	CONTRACT_MULTI_SEND_CALL_ONLY = "multiSendCallOnly"
+	CONTRACT_SIGN_MESSAGE_LIB     = "signMessageLib"
+	CONTRACT_CREATE_CALL          = "createCall"
+	// not part of the safe deployments, kept as bundled
+	CONTRACT_ALLOWANCE_MODULE     = "allowanceModule"
+	CONTRACT_MODULE_PROXY_FACTORY = "moduleProxyFactory"
+	CONTRACT_DELAY_MODIFIER       = "delayModifier"
+)
+
+// the safe-deployments file of each contract
+var deploymentFiles = map[string]string{
+	CONTRACT_SAFE:                 "gnosis_safe.json",
+	CONTRACT_SAFE_L2:              "gnosis_safe_l2.json",
+	CONTRACT_PROXY_FACTORY:        "proxy_factory.json",
+	CONTRACT_FALLBACK_HANDLER:     "compatibility_fallback_handler.json",
+	CONTRACT_MULTI_SEND:           "multi_send.json",
+	CONTRACT_MULTI_SEND_CALL_ONLY: "multi_send_call_only.json",
+	CONTRACT_SIGN_MESSAGE_LIB:     "sign_message_lib.json",
+	CONTRACT_CREATE_CALL:          "create_call.json",
+}
+
+const (
+	SAFE_DEPLOYMENTS_URL = "https://raw.githubusercontent.com/gnosis/safe-deployments/main/src/assets/v1.3.0"
+	TOKEN_LIST_URL       = "https://tokens.uniswap.org"
+	FOURBYTE_API         = "https://www.4byte.directory/api/v1/signatures/"
+)
+
+// the bundle shipped with the binary, networks.json in the config directory
+// (written by networks update) takes precedence
+//
+//go:embed networks.json
+var embeddedNetworks []byte
+
+type networkToken struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+type network struct {
+	ChainID   int64             `json:"chainId"`
+	Name      string            `json:"name"`
+	Contracts map[string]string `json:"contracts"`
+	Tokens    []networkToken    `json:"tokens"`
+}
+
+// networkBundle holds everything needed to build and verify transactions
+// without network access: the canonical contracts and tokens of each chain
+// and a 4byte snapshot of method signatures by selector
+type networkBundle struct {
+	UpdatedAt string              `json:"updatedAt"`
+	Networks  []network           `json:"networks"`
+	Selectors map[string][]string `json:"selectors"`
+	source    string
+}
+
+var networks *networkBundle
+
+func parseNetworkBundle(content []byte, source string) (*networkBundle, error) {
+	var b networkBundle
+	if err := json.Unmarshal(content, &b); err != nil {
+		return nil, fmt.Errorf("invalid network bundle %s: %w", source, err)
+	}
+	b.source = source
+	if err := b.validate(); err != nil {
+		return nil, fmt.Errorf("invalid network bundle %s: %w", source, err)
+	}
+	return &b, nil
+}
+
+// validate checks the addresses and that every selector is the hash of its
+// signatures, and that the service chain has all the canonical contracts
+func (b *networkBundle) validate() error {
+	for _, n := range b.Networks {
+		for name, addr := range n.Contracts {
+			if err := checkAddress(addr); err != nil {
+				return fmt.Errorf("invalid %s address %q on chain %d: %w", name, addr, n.ChainID, err)
+			}
+		}
+		for _, t := range n.Tokens {
+			if err := checkAddress(t.Address); err != nil {
+				return fmt.Errorf("invalid %s token address %q on chain %d: %w", t.Symbol, t.Address, n.ChainID, err)
+			}
+		}
+	}
+
+	for selector, signatures := range b.Selectors {
+		for _, signature := range signatures {
+			if hexutil.Encode(crypto.Keccak256([]byte(signature))[:4]) != selector {
+				return fmt.Errorf("signature %q does not match selector %s", signature, selector)
+			}
+		}
+	}
+
+	if serviceChainID != 0 {
+		return b.checkChain(serviceChainID)
+	}
+	return nil
+}
+
+// checkChain checks the bundle has every canonical contract on chainID
+func (b *networkBundle) checkChain(chainID int64) error {
+	n := b.network(chainID)
+	if n == nil {
+		return fmt.Errorf("chain %d is missing", chainID)
+	}
+	for name := range deploymentFiles {
+		if _, ok := n.Contracts[name]; !ok {
+			return fmt.Errorf("%s is missing on chain %d", name, chainID)
+		}
+	}
+	return nil
+}
+
+func (b *networkBundle) network(chainID int64) *network {
+	for i := range b.Networks {
+		if b.Networks[i].ChainID == chainID {
+			return &b.Networks[i]
+		}
+	}
+	return nil
+}
+
+// loadNetworks reads networks.json from the config directory, falling back
+// to the embedded bundle
+func loadNetworks() (*networkBundle, error) {
+	path := configPath("networks.json")
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return parseNetworkBundle(embeddedNetworks, "embedded")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseNetworkBundle(content, path)
+}
+
+func setNetworks() error {
+	b, err := loadNetworks()
+	if err != nil {
+		return err
+	}
+	networks = b
+	return nil
+}
+
+// currentNetworks returns the loaded bundle, the embedded one if main did not
+// load any
+func currentNetworks() *networkBundle {
+	if networks == nil {
+		b, err := parseNetworkBundle(embeddedNetworks, "embedded")
+		if err != nil {
+			panic(err)
+		}
+		networks = b
+	}
+	return networks
+}
+
+// currentNetwork returns the network of the service chain, empty while the
+// chain is unknown
+func currentNetwork() *network {
+	if n := currentNetworks().network(serviceChainID); n != nil {
+		return n
+	}
+	return &network{ChainID: serviceChainID}
+}
+
+// contractAddress returns a canonical contract on the service chain, the
+// bundle is validated to have all of them
+func contractAddress(name string) common.Address {
+	return common.HexToAddress(currentNetwork().Contracts[name])
+}
+
+func isCanonicalContract(addr common.Address) bool {
+	for _, contract := range currentNetwork().Contracts {
+		if common.HexToAddress(contract) == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func networkName(chainID int64) string {
+	if n := currentNetworks().network(chainID); n != nil {
+		return n.Name
+	}
+	return fmt.Sprintf("chain %d", chainID)
+}
+
+func bundledToken(token common.Address) (networkToken, bool) {
+	for _, t := range currentNetwork().Tokens {
+		if common.HexToAddress(t.Address) == token {
+			return t, true
+		}
+	}
+	return networkToken{}, false
+}
+
+// lookupSelector returns the snapshot signatures of a method selector
+func lookupSelector(selector []byte) []string {
+	return currentNetworks().Selectors[hexutil.Encode(selector)]
+}
+
+func fetchDeployments(b *networkBundle) ([]string, error) {
+	var changes []string
+	names := make([]string, 0, len(deploymentFiles))
+	for name := range deploymentFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var deployment struct {
+			NetworkAddresses map[string]string `json:"networkAddresses"`
+		}
+		if err := getJSON(SAFE_DEPLOYMENTS_URL+"/"+deploymentFiles[name], &deployment); err != nil {
+			return nil, fmt.Errorf("fetching the %s deployments failed: %w", name, err)
+		}
+
+		for i := range b.Networks {
+			n := &b.Networks[i]
+			addr, ok := deployment.NetworkAddresses[fmt.Sprint(n.ChainID)]
+			if !ok || !common.IsHexAddress(addr) {
+				continue
+			}
+			addr = common.HexToAddress(addr).Hex()
+			if old, ok := n.Contracts[name]; ok && old != addr {
+				changes = append(changes, fmt.Sprintf("%s on %s changed from %s to %s", name, n.Name, old, addr))
+			}
+			if n.Contracts == nil {
+				n.Contracts = map[string]string{}
+			}
+			n.Contracts[name] = addr
+		}
+	}
+	return changes, nil
+}
+
+func fetchTokenList(b *networkBundle, list string) error {
+	var tokens struct {
+		Tokens []struct {
+			ChainID  int64  `json:"chainId"`
+			Address  string `json:"address"`
+			Symbol   string `json:"symbol"`
+			Decimals int    `json:"decimals"`
+		} `json:"tokens"`
+	}
+	if err := getJSON(list, &tokens); err != nil {
+		return fmt.Errorf("fetching the token list failed: %w", err)
+	}
+
+	for i := range b.Networks {
+		n := &b.Networks[i]
+		var updated []networkToken
+		for _, t := range tokens.Tokens {
+			if t.ChainID == n.ChainID && common.IsHexAddress(t.Address) {
+				updated = append(updated, networkToken{Address: common.HexToAddress(t.Address).Hex(), Symbol: t.Symbol, Decimals: t.Decimals})
+			}
+		}
+		// keep the bundled tokens of chains the list doesn't cover
+		if len(updated) > 0 {
+			n.Tokens = updated
+		}
+	}
+	return nil
+}
+
+// fetchSelectors refreshes the snapshot signatures of each selector from
+// 4byte, oldest registration first
+func fetchSelectors(b *networkBundle, extra []string) error {
+	for _, selector := range extra {
+		selector = strings.ToLower(selector)
+		if len(selector) != 10 || !strings.HasPrefix(selector, "0x") {
+			return fmt.Errorf("invalid selector %q", selector)
+		}
+		if _, ok := b.Selectors[selector]; !ok {
+			b.Selectors[selector] = nil
+		}
+	}
+
+	for selector := range b.Selectors {
+		signatures, err := fetchSelector(selector)
+		if err != nil {
+			return err
+		}
+		if len(signatures) > 0 {
+			b.Selectors[selector] = signatures
+		} else if b.Selectors[selector] == nil {
+			delete(b.Selectors, selector)
+			logger.Warn("4byte knows no signature of the selector", "selector", selector)
+		}
+	}
+	return nil
+}
+
+// fetchSelector returns the 4byte signatures of a selector, cached
+func fetchSelector(selector string) ([]string, error) {
+	var signatures []string
+	if cacheGet(CACHE_SELECTORS, selector, CACHE_TTL_SELECTOR, &signatures) {
+		return signatures, nil
+	}
+
+	var result struct {
+		Results []struct {
+			TextSignature string `json:"text_signature"`
+		} `json:"results"`
+	}
+	if err := getJSON(FOURBYTE_API+"?ordering=created_at&hex_signature="+url.QueryEscape(selector), &result); err != nil {
+		return nil, fmt.Errorf("fetching the signatures of %s failed: %w", selector, err)
+	}
+	for _, r := range result.Results {
+		// 4byte is user submitted, only keep signatures that hash to the selector
+		if hexutil.Encode(crypto.Keccak256([]byte(r.TextSignature))[:4]) == selector {
+			signatures = append(signatures, r.TextSignature)
+		}
+	}
+	cachePut(CACHE_SELECTORS, selector, signatures)
+	return signatures, nil
+}
+
+// updateNetworks refreshes the current bundle from the safe deployments, a
+// token list and 4byte, reporting changed contract addresses
+func updateNetworks(tokenList string, selectors []string, out string) error {
+	content, err := json.Marshal(currentNetworks())
+	if err != nil {
+		return err
+	}
+	var b networkBundle
+	if err := json.Unmarshal(content, &b); err != nil {
+		return err
+	}
+	if b.Selectors == nil {
+		b.Selectors = map[string][]string{}
+	}
+
+	changes, err := fetchDeployments(&b)
+	if err != nil {
+		return err
+	}
+	if err := fetchTokenList(&b, tokenList); err != nil {
+		return err
+	}
+	if err := fetchSelectors(&b, selectors); err != nil {
+		return err
+	}
+	if err := b.validate(); err != nil {
+		return fmt.Errorf("the updated bundle is invalid: %w", err)
+	}
+	b.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	for _, change := range changes {
+		logger.Warn(change)
+	}
+
+	encoded, err := json.MarshalIndent(&b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		if err := os.MkdirAll(configDir(), 0o700); err != nil {
+			return err
+		}
+		out = configPath("networks.json")
+	}
+	if err := ioutil.WriteFile(out, encoded, 0o644); err != nil {
+		return err
+	}
+	fmt.Println("wrote", out, "with", len(b.Networks), "networks and", len(b.Selectors), "selectors")
+	return nil
+}
+
+func printNetworks(chainID int64) error {
+	b := currentNetworks()
+	fmt.Println("bundle", b.source, "updated", b.UpdatedAt)
+
+	for _, n := range b.Networks {
+		if chainID != 0 && n.ChainID != chainID {
+			continue
+		}
+		fmt.Printf("%s (chain %d)\n", n.Name, n.ChainID)
+
+		names := make([]string, 0, len(n.Contracts))
+		for name := range n.Contracts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println("  ", name, n.Contracts[name])
+		}
+		for _, t := range n.Tokens {
+			fmt.Println("  ", "token", t.Symbol, t.Address, t.Decimals, "decimals")
+		}
+	}
+
+	if chainID != 0 && b.network(chainID) == nil {
+		return fmt.Errorf("the bundle has no chain %d", chainID)
+	}
+	fmt.Println(len(b.Selectors), "method selectors")
+	return nil
+}
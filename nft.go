@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	NFT_AUTO    = "auto"
+	NFT_ERC721  = "erc721"
+	NFT_ERC1155 = "erc1155"
+)
+
+// erc165 interface ids of the token standards
+var (
+	erc721InterfaceID  = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	erc1155InterfaceID = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+func supportsInterface(client EthClient, token common.Address, id [4]byte) bool {
+	call, err := encodeCall("supportsInterface(bytes4)", id)
+	if err != nil {
+		return false
+	}
+	result, err := callContract(client, token, call)
+	return err == nil && len(result) == 32 && result[31] == 1
+}
+
+// detectNFTStandard asks the token contract which standard it implements
+func detectNFTStandard(client EthClient, token common.Address) (string, error) {
+	switch {
+	case supportsInterface(client, token, erc721InterfaceID):
+		return NFT_ERC721, nil
+	case supportsInterface(client, token, erc1155InterfaceID):
+		return NFT_ERC1155, nil
+	}
+	return "", fmt.Errorf("%s supports neither ERC-721 nor ERC-1155, pass -standard to override", token.Hex())
+}
+
+func callUint(client EthClient, token common.Address, signature string, values ...interface{}) (*big.Int, error) {
+	call, err := encodeCall(signature, values...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := callContract(client, token, call)
+	if err != nil {
+		return nil, fmt.Errorf("%s on %s failed: %w", signature, token.Hex(), err)
+	}
+	if len(result) != 32 {
+		return nil, fmt.Errorf("invalid %s response from %s", signature, token.Hex())
+	}
+	return new(big.Int).SetBytes(result), nil
+}
+
+// buildNFTTransfer checks the safe holds the token and returns the
+// safeTransferFrom call moving it from the safe to the recipient
+func buildNFTTransfer(rpc string, safe, token, to common.Address, id, amount *big.Int, standard string) ([]byte, error) {
+	if amount.Sign() <= 0 {
+		return nil, errors.New("the -amount to transfer must be positive")
+	}
+
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if standard == NFT_AUTO {
+		if standard, err = detectNFTStandard(client, token); err != nil {
+			return nil, err
+		}
+	}
+
+	code, err := client.CodeAt(opCtx, to, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) > 0 {
+		fmt.Println("note:", to.Hex(), "is a contract, the transfer reverts unless it accepts the token")
+	}
+
+	switch standard {
+	case NFT_ERC721:
+		if amount.Cmp(common.Big1) != 0 {
+			return nil, errors.New("an ERC-721 transfer moves exactly one token, drop -amount")
+		}
+		owner, err := callUint(client, token, "ownerOf(uint256)", id)
+		if err != nil {
+			return nil, err
+		}
+		if common.BigToAddress(owner) != safe {
+			return nil, fmt.Errorf("token %s of %s is owned by %s, not the safe", id, token.Hex(), common.BigToAddress(owner).Hex())
+		}
+		return encodeCall("safeTransferFrom(address,address,uint256)", safe, to, id)
+
+	case NFT_ERC1155:
+		balance, err := callUint(client, token, "balanceOf(address,uint256)", safe, id)
+		if err != nil {
+			return nil, err
+		}
+		if balance.Cmp(amount) < 0 {
+			return nil, fmt.Errorf("the safe holds %s of token %s of %s, cannot transfer %s", balance, id, token.Hex(), amount)
+		}
+		return encodeCall("safeTransferFrom(address,address,uint256,uint256,bytes)", safe, to, id, amount, []byte{})
+	}
+
+	return nil, fmt.Errorf("unknown token standard %q, expected %s, %s or %s", standard, NFT_AUTO, NFT_ERC721, NFT_ERC1155)
+}
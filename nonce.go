@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const NONCE_NEXT_QUEUED = "next-queued"
+
+// resolveNonce picks the nonce to propose at: the current safe nonce by
+// default, an explicit nonce, max(queued)+1 with "next-queued", or an occupied
+// nonce to replace when replace >= 0
+func resolveNonce(safe, strategy string, replace int64) (*int64, error) {
+	current, err := getSafeNonce(safe)
+	if err != nil {
+		return nil, err
+	}
+
+	if strategy == "" && replace < 0 {
+		return current, nil
+	}
+
+	pending, err := getPendingTransactions(safe, *current)
+	if err != nil {
+		return nil, err
+	}
+
+	occupied := map[int64]string{}
+	next := *current
+	for _, tx := range pending {
+		occupied[tx.Nonce] = tx.SafeTxHash
+		if tx.Nonce >= next {
+			next = tx.Nonce + 1
+		}
+	}
+
+	if replace >= 0 {
+		if strategy != "" {
+			return nil, fmt.Errorf("-nonce and -replace can't be used together")
+		}
+		if replace < *current {
+			return nil, fmt.Errorf("nonce %d is already executed, current nonce is %d", replace, *current)
+		}
+		hash, ok := occupied[replace]
+		if !ok {
+			return nil, fmt.Errorf("no queued transaction at nonce %d to replace, use -nonce %d", replace, replace)
+		}
+
+		fmt.Println("replacing queued transaction", hash, "at nonce", replace)
+		return &replace, nil
+	}
+
+	if strategy == NONCE_NEXT_QUEUED {
+		return &next, nil
+	}
+
+	nonce, err := strconv.ParseInt(strategy, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce %q, expected a number or %q", strategy, NONCE_NEXT_QUEUED)
+	}
+	if nonce < *current {
+		return nil, fmt.Errorf("nonce %d is already executed, current nonce is %d", nonce, *current)
+	}
+	if hash, ok := occupied[nonce]; ok {
+		return nil, fmt.Errorf("nonce %d is occupied by queued transaction %s, use -replace %d to propose a competing transaction", nonce, hash, nonce)
+	}
+	if nonce > next {
+		logger.Warn("nonce leaves a gap, it can't be executed before the next nonce", "nonce", nonce, "next", next)
+	}
+
+	return &nonce, nil
+}
+
+// existingProposal looks the transaction up in the service before it is
+// signed: the same safeTxHash already proposed is returned to be confirmed
+// instead, another transaction queued at the nonce aborts unless replaced
+func existingProposal(safe string, hash common.Hash, nonce, replace int64, signer common.Address) (*multisigTxResponse, error) {
+	tx, err := getMultisigTransaction(hash.Hex())
+	if err == nil {
+		if tx.IsExecuted {
+			return nil, fmt.Errorf("transaction %s is already executed", hash.Hex())
+		}
+		for _, c := range tx.Confirmations {
+			if common.HexToAddress(c.Owner) == signer {
+				return nil, fmt.Errorf("transaction %s is already proposed at nonce %d and confirmed by %s", hash.Hex(), tx.Nonce, signer.Hex())
+			}
+		}
+		return tx, nil
+	}
+	if !errors.Is(err, errTxNotFound) {
+		return nil, err
+	}
+
+	if nonce == replace {
+		return nil, nil
+	}
+	pending, err := getPendingTransactions(safe, nonce)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pending {
+		if p.Nonce == nonce {
+			return nil, fmt.Errorf("nonce %d is occupied by queued transaction %s, use -replace %d to propose a competing transaction or -nonce %s", nonce, p.SafeTxHash, nonce, NONCE_NEXT_QUEUED)
+		}
+	}
+	return nil, nil
+}
+
+// what a proposal does when its nonce is taken while it is signed
+const (
+	NONCE_RACE_ABORT = "abort"
+	NONCE_RACE_BUMP  = "bump"
+	// times a proposal moves to the next free nonce before giving up
+	NONCE_RACE_RETRIES = 3
+)
+
+// nonceRace is the nonce of a proposal taken between its nonce lookup and its
+// submission, by another proposal or an execution
+type nonceRace struct {
+	Nonce   int64
+	Current int64
+	// the competing proposal, nil when the nonce was executed
+	Competing *multisigTxResponse
+	// the next nonce nothing is queued at
+	Next int64
+}
+
+func (r *nonceRace) Error() string {
+	taken := fmt.Sprintf("executed, the safe nonce is now %d", r.Current)
+	if r.Competing != nil {
+		taken = fmt.Sprintf("taken by transaction %s proposed by %s", r.Competing.SafeTxHash, r.Competing.Proposer)
+		if submitted, err := parseServiceTime(r.Competing.SubmissionDate); err == nil && !submitted.IsZero() {
+			taken += " " + formatAge(submitted)
+		}
+	}
+	message := fmt.Sprintf("nonce %d was %s while signing, the next free nonce is %d; propose again with -nonce %d", r.Nonce, taken, r.Next, r.Next)
+	if r.Competing != nil {
+		message += fmt.Sprintf(", -replace %d to compete with it", r.Nonce)
+	}
+	return message + " or -on-nonce-race " + NONCE_RACE_BUMP
+}
+
+// recheckNonce looks the queue up again right before a proposal is submitted:
+// the same transaction proposed meanwhile is returned to be confirmed instead,
+// its nonce executed or queued by another proposal is a nonceRace
+func recheckNonce(safe string, hash common.Hash, nonce, replace int64) (*multisigTxResponse, error) {
+	tx, err := getMultisigTransaction(hash.Hex())
+	if err == nil {
+		return tx, nil
+	}
+	if !errors.Is(err, errTxNotFound) {
+		return nil, err
+	}
+
+	current, err := getSafeNonce(safe)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := getPendingTransactions(safe, *current)
+	if err != nil {
+		return nil, err
+	}
+
+	race := &nonceRace{Nonce: nonce, Current: *current, Next: *current}
+	for i, p := range pending {
+		if p.Nonce == nonce && nonce != replace && race.Competing == nil {
+			race.Competing = &pending[i]
+		}
+		if p.Nonce >= race.Next {
+			race.Next = p.Nonce + 1
+		}
+	}
+	if *current > nonce || race.Competing != nil {
+		return nil, race
+	}
+	return nil, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NUMBERS_RAW shows amounts as plain base unit integers, for scripts
+const NUMBERS_RAW = "raw"
+
+type numberLocale struct {
+	thousands string
+	decimal   string
+}
+
+var numberLocales = map[string]numberLocale{
+	"en": {",", "."},
+	"de": {".", ","},
+	"fr": {" ", ","},
+	"ch": {"'", "."},
+}
+
+type tokenDisplay struct {
+	Token     string `json:"token"`
+	Symbol    string `json:"symbol"`
+	Decimals  int    `json:"decimals"`
+	Precision *int   `json:"precision,omitempty"`
+}
+
+// displayConfig is read from display.json in the config directory
+type displayConfig struct {
+	Numbers   string         `json:"numbers"`
+	Precision int            `json:"precision"`
+	Tokens    []tokenDisplay `json:"tokens"`
+}
+
+var display = displayConfig{Numbers: "en", Precision: 4}
+
+// setNumberFormat loads display.json and applies the global -numbers flag or
+// $GNOSIS_TX_NUMBERS, a locale (en, de, fr, ch) or raw
+func setNumberFormat(format string) error {
+	content, err := ioutil.ReadFile(configPath("display.json"))
+	if err == nil {
+		if err := json.Unmarshal(content, &display); err != nil {
+			return fmt.Errorf("invalid display config: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if format == "" {
+		format = os.Getenv("GNOSIS_TX_NUMBERS")
+	}
+	if format != "" {
+		display.Numbers = strings.ToLower(format)
+	}
+	if _, ok := numberLocales[display.Numbers]; !ok && display.Numbers != NUMBERS_RAW {
+		return fmt.Errorf("unknown number format %q, expected raw, en, de, fr or ch", display.Numbers)
+	}
+	return nil
+}
+
+func groupDigits(digits, separator string) string {
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
+
+// formatUnits renders amount base units with decimals in the display locale,
+// keeping at most precision fraction digits; a leading ~ marks dropped digits
+// and amounts below the precision are shown as <0.0001
+func formatUnits(amount *big.Int, decimals, precision int) string {
+	if display.Numbers == NUMBERS_RAW {
+		return amount.String()
+	}
+	locale := numberLocales[display.Numbers]
+
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	digits := new(big.Int).Abs(amount).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-decimals], digits[len(digits)-decimals:]
+
+	fraction = strings.TrimRight(fraction, "0")
+	approx := ""
+	if len(fraction) > precision {
+		fraction, approx = fraction[:precision], "~"
+		fraction = strings.TrimRight(fraction, "0")
+		// never show a non zero amount as zero
+		if strings.TrimLeft(whole, "0") == "" && fraction == "" {
+			smallest := "1"
+			if precision > 0 {
+				smallest = "0" + locale.decimal + strings.Repeat("0", precision-1) + "1"
+			}
+			return "<" + smallest
+		}
+	}
+
+	formatted := approx + sign + groupDigits(whole, locale.thousands)
+	if fraction != "" {
+		formatted += locale.decimal + fraction
+	}
+	return formatted
+}
+
+// formatWei renders a native amount as ETH, or in wei in raw mode
+func formatWei(wei *big.Int) string {
+	if display.Numbers == NUMBERS_RAW {
+		return wei.String() + " wei"
+	}
+	return formatUnits(wei, 18, display.Precision) + " ETH"
+}
+
+// formatTokenAmount renders an amount of token using its configured symbol
+// and decimals, unknown tokens are shown in base units
+func formatTokenAmount(token common.Address, amount *big.Int) string {
+	for _, t := range display.Tokens {
+		if common.HexToAddress(t.Token) != token {
+			continue
+		}
+		if display.Numbers == NUMBERS_RAW {
+			return amount.String()
+		}
+		precision := display.Precision
+		if t.Precision != nil {
+			precision = *t.Precision
+		}
+		return formatUnits(amount, t.Decimals, precision) + " " + t.Symbol
+	}
+	if t, ok := bundledToken(token); ok {
+		if display.Numbers == NUMBERS_RAW {
+			return amount.String()
+		}
+		return formatUnits(amount, t.Decimals, display.Precision) + " " + t.Symbol
+	}
+	return formatUnits(amount, 0, 0)
+}
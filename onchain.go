@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	guardStorageSlot           = common.HexToHash("0x4a204f620c8c5ccdca3fd54d003badd85ba500436a431f0cbda4f558c93c34c8")
+	fallbackHandlerStorageSlot = common.HexToHash("0x6c9a6c4a39284e37ed1cf53d337577d14212a4870fb976a4366c693b939918d5")
+)
+
+// onchainState is the security-critical safe state read directly from the contract
+type onchainState struct {
+	Block           uint64
+	BlockHash       common.Hash
+	Owners          []common.Address
+	Threshold       int64
+	Nonce           int64
+	Guard           common.Address
+	FallbackHandler common.Address
+}
+
+func (s *onchainState) isOwner(addr common.Address) bool {
+	for _, owner := range s.Owners {
+		if owner == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *onchainState) String() string {
+	owners := make([]string, len(s.Owners))
+	for i, owner := range s.Owners {
+		owners[i] = owner.Hex()
+	}
+	return fmt.Sprintf("owners=[%s] threshold=%d nonce=%d guard=%s fallbackHandler=%s",
+		strings.Join(owners, ","), s.Threshold, s.Nonce, s.Guard.Hex(), s.FallbackHandler.Hex())
+}
+
+func callAt(client EthClient, to common.Address, signature string, block *big.Int) ([]byte, error) {
+	data := crypto.Keccak256([]byte(signature))[:4]
+	return client.CallContract(opCtx, ethereum.CallMsg{To: &to, Data: data}, block)
+}
+
+// readSafeState reads owners, threshold, nonce, guard and fallback handler at block
+func readSafeState(client EthClient, safe common.Address, block *big.Int) (*onchainState, error) {
+	ctx := opCtx
+
+	header, err := client.HeaderByNumber(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	block = header.Number
+	state := &onchainState{Block: header.Number.Uint64(), BlockHash: header.Hash()}
+
+	result, err := callAt(client, safe, "getOwners()", block)
+	if err != nil {
+		return nil, err
+	}
+	args, err := methodArguments("(address[])")
+	if err != nil {
+		return nil, err
+	}
+	values, err := args.UnpackValues(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid getOwners response from %s, is it a Safe? %w", safe.Hex(), err)
+	}
+	state.Owners = values[0].([]common.Address)
+
+	result, err = callAt(client, safe, "getThreshold()", block)
+	if err != nil {
+		return nil, err
+	}
+	state.Threshold = new(big.Int).SetBytes(result).Int64()
+
+	result, err = callAt(client, safe, "nonce()", block)
+	if err != nil {
+		return nil, err
+	}
+	state.Nonce = new(big.Int).SetBytes(result).Int64()
+
+	guard, err := client.StorageAt(ctx, safe, guardStorageSlot, block)
+	if err != nil {
+		return nil, err
+	}
+	state.Guard = common.BytesToAddress(guard)
+
+	handler, err := client.StorageAt(ctx, safe, fallbackHandlerStorageSlot, block)
+	if err != nil {
+		return nil, err
+	}
+	state.FallbackHandler = common.BytesToAddress(handler)
+
+	return state, nil
+}
+
+// readSafeStateQuorum reads the safe state from every provider at the same
+// block and fails unless they all agree
+func readSafeStateQuorum(rpcs []string, safe common.Address) (*onchainState, error) {
+	if len(rpcs) == 0 {
+		return nil, errors.New("no RPC providers given")
+	}
+
+	var clients []EthClient
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	// pin the read to a block every provider has, a couple of blocks deep
+	var pinned uint64
+	for i, url := range rpcs {
+		client, err := dialRPC(url)
+		if err != nil {
+			return nil, fmt.Errorf("provider %d: %w", i, err)
+		}
+		clients = append(clients, client)
+
+		head, err := client.BlockNumber(opCtx)
+		if err != nil {
+			return nil, fmt.Errorf("provider %d: %w", i, err)
+		}
+		if i == 0 || head < pinned {
+			pinned = head
+		}
+	}
+	if pinned > 2 {
+		pinned -= 2
+	}
+	block := new(big.Int).SetUint64(pinned)
+
+	var reference *onchainState
+	for i, client := range clients {
+		state, err := readSafeState(client, safe, block)
+		if err != nil {
+			return nil, fmt.Errorf("provider %d: %w", i, err)
+		}
+
+		if reference == nil {
+			reference = state
+			continue
+		}
+		if state.BlockHash != reference.BlockHash {
+			return nil, fmt.Errorf("providers disagree on block %d: %s vs %s", pinned, reference.BlockHash.Hex(), state.BlockHash.Hex())
+		}
+		if state.String() != reference.String() {
+			return nil, fmt.Errorf("providers disagree on safe state at block %d:\n  provider 0: %s\n  provider %d: %s", pinned, reference, i, state)
+		}
+	}
+
+	return reference, nil
+}
+
+// checkSignerQuorum refuses to sign unless every provider agrees the signer is
+// an owner (unless proposing as delegate) and the nonce has not been used yet
+func checkSignerQuorum(rpcs []string, safe, signer common.Address, nonce int64, delegate bool) error {
+	state, err := readSafeStateQuorum(rpcs, safe)
+	if err != nil {
+		return fmt.Errorf("refusing to sign: %w", err)
+	}
+
+	fmt.Println("onchain state (quorum of", len(rpcs), "providers at block", state.Block, "):", state)
+
+	if !delegate && !state.isOwner(signer) {
+		return fmt.Errorf("refusing to sign: %s is not an owner of %s", signer.Hex(), safe.Hex())
+	}
+	if nonce < state.Nonce {
+		return fmt.Errorf("refusing to sign: nonce %d is already used, onchain nonce is %d", nonce, state.Nonce)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const REDACTED = "REDACTED"
+
+var errMissingTimeout = errors.New("-timeout requires a duration, e.g. -timeout 2m")
+
+// operationState records how far the current command got, so an operation
+// cut short by the -timeout deadline or a crash can be picked up again
+type operationState struct {
+	ID         string   `json:"id"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	Step       string   `json:"step"`
+	Nonce      *int64   `json:"nonce,omitempty"`
+	SafeTxGas  *int64   `json:"safeTxGas,omitempty"`
+	SafeTxHash string   `json:"safeTxHash,omitempty"`
+	Signature  string   `json:"signature,omitempty"`
+	Submitted  bool     `json:"submitted"`
+	TxHash     string   `json:"txHash,omitempty"`
+
+	Safe          string           `json:"safe,omitempty"`
+	Proposal      *gnosisTxRequest `json:"proposal,omitempty"`
+	Manifest      string           `json:"manifest,omitempty"`
+	RPC           string           `json:"rpc,omitempty"`
+	Confirmations uint64           `json:"confirmations,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// currentOperation is the state of the command being run
+var currentOperation = &operationState{}
+
+func newOperationState(command string, args []string) *operationState {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &operationState{
+		ID:        hex.EncodeToString(id),
+		Command:   command,
+		Args:      args,
+		Step:      "started",
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// secretFlags are the flags holding keys or credentials, registered by
+// secretFlag where each is defined
+var secretFlags = map[string]bool{}
+
+// secretFlag defines a string flag whose value never ends up in a state file
+func secretFlag(fs *flag.FlagSet, name, value, usage string) *string {
+	secretFlags[name] = true
+	return fs.String(name, value, usage)
+}
+
+// flagName returns the name of a "-name" or "-name=value" argument
+func flagName(arg string) (string, bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return "", false
+	}
+	return strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0], true
+}
+
+// redactSecrets blanks out the values of secret flags so they never end up
+// in a state file
+func redactSecrets(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		name, isFlag := flagName(arg)
+		previous, afterFlag := "", false
+		if i > 0 {
+			previous, afterFlag = flagName(args[i-1])
+		}
+		switch {
+		case isFlag && secretFlags[name] && strings.Contains(arg, "="):
+			redacted[i] = arg[:strings.Index(arg, "=")+1] + REDACTED
+		case afterFlag && secretFlags[previous] && !strings.Contains(args[i-1], "="):
+			redacted[i] = REDACTED
+		default:
+			redacted[i] = arg
+		}
+	}
+	return redacted
+}
+
+// step records progress, persisting the state so the operation can be resumed
+func (s *operationState) step(name string) {
+	s.Step = name
+	if s.ID == "" {
+		return
+	}
+	if _, err := s.save(); err != nil {
+		logger.Warn("saving operation state failed", "error", err)
+	}
+}
+
+func operationsDir() string {
+	return configPath("operations")
+}
+
+func (s *operationState) path() string {
+	return filepath.Join(operationsDir(), s.ID+".json")
+}
+
+func (s *operationState) save() (string, error) {
+	if err := os.MkdirAll(operationsDir(), 0700); err != nil {
+		return "", err
+	}
+
+	// the command defined its flags by now, the secret ones are known
+	redacted := *s
+	redacted.Args = redactSecrets(s.Args)
+	content, err := json.MarshalIndent(&redacted, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(s.path(), content, 0600); err != nil {
+		return "", err
+	}
+	return s.path(), nil
+}
+
+// persisted reports whether the operation got far enough to be resumable
+func (s *operationState) persisted() bool {
+	return s.ID != "" && s.Step != "started"
+}
+
+// finish removes the state file of a completed operation
+func (s *operationState) finish() {
+	if s.persisted() {
+		os.Remove(s.path())
+	}
+}
+
+// failed persists the operation state when it can be resumed and returns an
+// error pointing at the state file
+func (s *operationState) failed(err error) error {
+	if !s.persisted() && opCtx.Err() == nil {
+		return err
+	}
+
+	reason := "failed"
+	if opCtx.Err() != nil {
+		reason = "timed out"
+	}
+
+	s.Error = err.Error()
+	path, saveErr := s.save()
+	if saveErr != nil {
+		return fmt.Errorf("%s at step %q (%v), and saving the operation state failed: %v", reason, s.Step, err, saveErr)
+	}
+	return fmt.Errorf("%s at step %q (%v), operation state saved to %s, continue with: resume %s", reason, s.Step, err, path, s.ID)
+}
+
+func loadOperationState(id string) (*operationState, error) {
+	state := &operationState{ID: id}
+
+	content, err := ioutil.ReadFile(state.path())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no interrupted operation %s in %s", id, operationsDir())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("invalid operation state %s: %w", state.path(), err)
+	}
+	return state, nil
+}
+
+// resumeOperation continues an interrupted operation, never signing again once
+// a signature was produced and never sending anything already submitted
+func resumeOperation(state *operationState, privKey string) error {
+	currentOperation = state
+	state.Error = ""
+
+	switch {
+	case state.TxHash != "":
+		return resumeExecution(state)
+	case state.Proposal != nil:
+		return resumeProposal(state)
+	}
+
+	// nothing irreversible happened yet, run the command again
+	fmt.Println("restarting", state.Command, "from step", state.Step, "- started", formatAge(state.CreatedAt))
+
+	args := make([]string, len(state.Args))
+	for i, arg := range state.Args {
+		if strings.HasSuffix(arg, REDACTED) {
+			name, _ := flagName(arg)
+			if !strings.Contains(arg, "=") && i > 0 {
+				name, _ = flagName(state.Args[i-1])
+			}
+			if name != "key" {
+				return fmt.Errorf("the operation needs its -%s again, run %s again", name, state.Command)
+			}
+			if privKey == "" {
+				return errors.New("the operation needs the signer key again, pass it with -key")
+			}
+			arg = strings.TrimSuffix(arg, REDACTED) + privKey
+		}
+		args[i] = arg
+	}
+
+	run, ok := commands[state.Command]
+	if !ok {
+		return fmt.Errorf("unknown command %s", state.Command)
+	}
+	return run(args)
+}
+
+func resumeProposal(state *operationState) error {
+	if !state.Submitted {
+		// the submission may have gone through before the interruption
+		_, err := getMultisigTransaction(state.SafeTxHash)
+		switch {
+		case err == nil:
+			fmt.Println("proposal", state.SafeTxHash, "was already submitted")
+		case errors.Is(err, errTxNotFound):
+			fmt.Println("submitting signed proposal", state.SafeTxHash)
+			if err := postGnosisTx(state.Safe, state.Proposal); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		state.Submitted = true
+		state.step("submitted")
+	}
+
+	if state.Manifest != "" {
+		m, err := loadManifest(state.Manifest)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if m == nil || !m.contains(state.SafeTxHash) {
+			root, err := appendToManifest(state.Manifest, manifestEntry{Safe: common.HexToAddress(state.Safe).Hex(), Nonce: state.Proposal.Nonce, SafeTxHash: state.SafeTxHash})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("manifestRoot:", root.Hex())
+		}
+	}
+
+	fmt.Println("proposal", state.SafeTxHash, "completed")
+	return nil
+}
+
+func resumeExecution(state *operationState) error {
+	client, err := dialRPC(state.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fmt.Println("waiting for execution transaction", state.TxHash)
+
+	hash := common.HexToHash(state.TxHash)
+	var receipt *types.Receipt
+	for {
+		if receipt, err = client.TransactionReceipt(opCtx, hash); err == nil {
+			break
+		}
+		if err != ethereum.NotFound {
+			return err
+		}
+		if err := sleep(4 * time.Second); err != nil {
+			return err
+		}
+	}
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("transaction %s reverted", state.TxHash)
+	}
+
+	state.Submitted = true
+	state.step("waiting for confirmations")
+
+	fmt.Println("mined in block", receipt.BlockNumber, "- waiting for", state.Confirmations, "confirmations")
+	if err := waitForConfirmations(client, receipt, state.Confirmations); err != nil {
+		return err
+	}
+
+	fmt.Println("executed:", receipt.TxHash.Hex())
+	state.step("executed")
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestOperationStateRedactsSecretFlags(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	const confirmKey = "8f2a55949038a9610f50fb23b5883af3b4ecb3c3bb792cbcefbd1542c692be63"
+	const proposerKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+	defer func(saved *operationState) { currentOperation = saved }(currentOperation)
+	args := []string{"-safe", "invalid", "-key=" + proposerKey, "-confirm-key", confirmKey, "-allow-default-service"}
+	currentOperation = newOperationState("bench", args)
+
+	// bench fails on the safe once its flags are defined, as a timeout
+	// would once the operation got underway
+	if err := benchCommand(args); err == nil {
+		t.Fatal("bench ran with an invalid safe")
+	}
+	currentOperation.Step = "proposing"
+	path, err := currentOperation.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{proposerKey, confirmKey} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("state file holds the secret %s:\n%s", secret, content)
+		}
+	}
+	if !strings.Contains(string(content), "invalid") {
+		t.Errorf("state file lost the other arguments:\n%s", content)
+	}
+
+	state, err := loadOperationState(currentOperation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resumeOperation(state, proposerKey); err == nil || !strings.Contains(err.Error(), "-confirm-key again") {
+		t.Errorf("resumeOperation = %v, want it to ask for -confirm-key again", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// the origin fields the safe web interface shows, name and url of the app
+// that queued the transaction
+const (
+	ORIGIN_NAME = "name"
+	ORIGIN_URL  = "url"
+	ORIGIN_NOTE = "note"
+)
+
+// DEFAULT_ORIGIN_NAME tells proposals of the tool apart in the queue
+const DEFAULT_ORIGIN_NAME = "gnosis-tx"
+
+// originFlags sets the origin of proposals, so teams can see which tool or
+// person queued a transaction
+type originFlags struct {
+	name   *string
+	url    *string
+	note   *string
+	fields *string
+}
+
+func addOriginFlags(fs *flag.FlagSet) *originFlags {
+	return &originFlags{
+		name:   fs.String("origin-name", "", "app name recorded in the proposal origin (default "+DEFAULT_ORIGIN_NAME+")"),
+		url:    fs.String("origin-url", "", "url recorded in the proposal origin"),
+		note:   fs.String("origin-note", "", "note recorded in the proposal origin, e.g. who queued it and why"),
+		fields: fs.String("origin", "", "json object of further origin fields, or a plain note"),
+	}
+}
+
+// originFields returns the origin fields of the flags, -origin-name,
+// -origin-url and -origin-note override the same fields of -origin
+func (o *originFlags) originFields() (map[string]string, error) {
+	fields := map[string]string{}
+	if text := strings.TrimSpace(*o.fields); strings.HasPrefix(text, "{") {
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &values); err != nil {
+			return nil, fmt.Errorf("invalid -origin: %w", err)
+		}
+		for name, value := range values {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid -origin: %s is not a string", name)
+			}
+			fields[name] = s
+		}
+	} else if text != "" {
+		fields[ORIGIN_NOTE] = text
+	}
+
+	for name, value := range map[string]string{ORIGIN_NAME: *o.name, ORIGIN_URL: *o.url, ORIGIN_NOTE: *o.note} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	if fields[ORIGIN_NAME] == "" {
+		fields[ORIGIN_NAME] = DEFAULT_ORIGIN_NAME
+	}
+	return fields, nil
+}
+
+// describeOrigin formats the origin of a proposal for listings: the name, url
+// and note followed by the other fields, or the origin as is if it isn't json
+func describeOrigin(origin *string) string {
+	if origin == nil || *origin == "" {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(*origin), &fields); err != nil {
+		return *origin
+	}
+
+	var parts []string
+	for _, name := range []string{ORIGIN_NAME, ORIGIN_URL, ORIGIN_NOTE} {
+		if value, ok := fields[name]; ok {
+			parts = append(parts, fmt.Sprint(value))
+			delete(fields, name)
+		}
+	}
+	var others []string
+	for name := range fields {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, fields[name]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// payoutRow is a transfer of a payout csv, amounts are in token units such
+// as 1.5; an empty token is the native coin
+type payoutRow struct {
+	Line     int
+	Receiver common.Address
+	Token    *common.Address
+	Amount   string
+}
+
+// column names of the csv header, those of CSV Airdrop included
+var payoutColumns = map[string]string{
+	"address":       "receiver",
+	"receiver":      "receiver",
+	"to":            "receiver",
+	"token":         "token",
+	"token_address": "token",
+	"amount":        "amount",
+	"value":         "amount",
+	"token_type":    "type",
+}
+
+// loadPayoutCSV reads address,token,amount rows; a header row may name the
+// columns in another order, including the CSV Airdrop token_type column
+// with which only erc20 and native rows are accepted
+func loadPayoutCSV(path string) ([]payoutRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	columns := map[string]int{"receiver": 0, "token": 1, "amount": 2, "type": -1}
+	var rows []payoutRow
+	var errs []string
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if line == 1 {
+			if _, header := payoutColumns[strings.ToLower(strings.TrimSpace(record[0]))]; header {
+				columns = map[string]int{"receiver": -1, "token": -1, "amount": -1, "type": -1}
+				for i, name := range record {
+					if column, ok := payoutColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+						columns[column] = i
+					}
+				}
+				if columns["receiver"] < 0 || columns["amount"] < 0 {
+					return nil, fmt.Errorf("%s: the header needs an address and an amount column", path)
+				}
+				continue
+			}
+		}
+
+		row, err := parsePayoutRow(record, columns)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s has %d invalid rows:\n  %s", path, len(errs), strings.Join(errs, "\n  "))
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s has no payouts", path)
+	}
+	return rows, nil
+}
+
+func parsePayoutRow(record []string, columns map[string]int) (payoutRow, error) {
+	field := func(column string) string {
+		i := columns[column]
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var row payoutRow
+	if t := strings.ToLower(field("type")); t != "" && t != "erc20" && t != "native" {
+		return row, fmt.Errorf("token type %q is not supported, only erc20 and native", t)
+	}
+	receiver, err := parseAddress(field("receiver"))
+	if err != nil {
+		return row, fmt.Errorf("invalid address %q: %w", field("receiver"), err)
+	}
+	row.Receiver = receiver
+	if token := field("token"); token != "" && !strings.EqualFold(token, "native") && !strings.EqualFold(token, "eth") {
+		addr, err := parseAddress(token)
+		if err != nil {
+			return row, fmt.Errorf("invalid token %q: %w", token, err)
+		}
+		row.Token = &addr
+	}
+	row.Amount = field("amount")
+	if row.Amount == "" {
+		return row, errors.New("missing amount")
+	}
+	return row, nil
+}
+
+// parseTokenAmount converts an amount in token units to base units, refusing
+// more fraction digits than the token has rather than rounding
+func parseTokenAmount(amount string, decimals int) (*big.Int, error) {
+	parts := strings.SplitN(amount, ".", 2)
+	if len(parts) == 2 && len(strings.TrimRight(parts[1], "0")) > decimals {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", amount, decimals)
+	}
+	if len(parts) == 2 && len(parts[1]) > decimals {
+		amount = parts[0] + "." + parts[1][:decimals]
+	}
+	value, ok := parseDecimal(amount, decimals)
+	if !ok || strings.HasPrefix(amount, "-") || strings.HasPrefix(amount, "+") {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	if value.Sign() == 0 {
+		return nil, fmt.Errorf("amount %s is zero", amount)
+	}
+	return value, nil
+}
+
+// payoutToken is a token of the payouts with its total outflow
+type payoutToken struct {
+	Token      *common.Address
+	Symbol     string
+	Decimals   int
+	Total      *big.Int
+	Recipients int
+}
+
+func (t *payoutToken) String() string {
+	return fmt.Sprintf("%s %s to %d recipients", formatUnits(t.Total, t.Decimals, t.Decimals), t.Symbol, t.Recipients)
+}
+
+// tokenDecimals resolves the decimals of a token from the bundled and the
+// configured tokens, else from the token contract, cached
+func tokenDecimals(client EthClient, token common.Address) (string, int, error) {
+	if t, ok := bundledToken(token); ok {
+		return t.Symbol, t.Decimals, nil
+	}
+	for _, t := range display.Tokens {
+		if common.HexToAddress(t.Token) == token {
+			return t.Symbol, t.Decimals, nil
+		}
+	}
+	var cached networkToken
+	if cacheGet(CACHE_TOKENS, token.Hex(), CACHE_TTL_TOKEN, &cached) {
+		return cached.Symbol, cached.Decimals, nil
+	}
+	if client == nil {
+		return "", 0, fmt.Errorf("decimals of token %s are unknown, pass -rpc to read them", token.Hex())
+	}
+	decimals, err := callUint(client, token, "decimals()")
+	if err != nil {
+		return "", 0, err
+	}
+	if !decimals.IsInt64() || decimals.Int64() > 77 {
+		return "", 0, fmt.Errorf("token %s reports %s decimals", token.Hex(), decimals)
+	}
+	symbol := displayAddress(token)
+	if values, err := callView(client, token, "symbol()", "(string)"); err == nil && values[0].(string) != "" {
+		symbol = values[0].(string)
+	}
+	cachePut(CACHE_TOKENS, token.Hex(), networkToken{Address: token.Hex(), Symbol: symbol, Decimals: int(decimals.Int64())})
+	return symbol, int(decimals.Int64()), nil
+}
+
+// buildPayouts returns the transfers of the rows with the outflow per token;
+// paying the same receiver the same token twice is refused as a likely
+// mistake unless allowDuplicates
+func buildPayouts(rows []payoutRow, client EthClient, allowDuplicates bool) ([]multiSendTx, []*payoutToken, error) {
+	tokens := map[common.Address]*payoutToken{}
+	var order []common.Address
+	seen := map[[2]common.Address]int{}
+
+	var txs []multiSendTx
+	var errs []string
+	for _, row := range rows {
+		key := common.Address{}
+		if row.Token != nil {
+			key = *row.Token
+		}
+		if first, ok := seen[[2]common.Address{row.Receiver, key}]; ok && !allowDuplicates {
+			errs = append(errs, fmt.Sprintf("line %d: %s is already paid the same token on line %d", row.Line, row.Receiver.Hex(), first))
+			continue
+		}
+		seen[[2]common.Address{row.Receiver, key}] = row.Line
+
+		t, ok := tokens[key]
+		if !ok {
+			t = &payoutToken{Token: row.Token, Symbol: "ETH", Decimals: 18, Total: new(big.Int)}
+			if row.Token != nil {
+				var err error
+				if t.Symbol, t.Decimals, err = tokenDecimals(client, *row.Token); err != nil {
+					return nil, nil, err
+				}
+			}
+			tokens[key] = t
+			order = append(order, key)
+		}
+
+		amount, err := parseTokenAmount(row.Amount, t.Decimals)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %v", row.Line, err))
+			continue
+		}
+		t.Total.Add(t.Total, amount)
+		t.Recipients++
+
+		if row.Token == nil {
+			txs = append(txs, multiSendTx{To: row.Receiver, Value: amount, Data: []byte{}})
+			continue
+		}
+		data, err := encodeCall("transfer(address,uint256)", row.Receiver, amount)
+		if err != nil {
+			return nil, nil, err
+		}
+		txs = append(txs, multiSendTx{To: *row.Token, Value: new(big.Int), Data: data})
+	}
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("%d invalid payouts:\n  %s", len(errs), strings.Join(errs, "\n  "))
+	}
+
+	// native first, then tokens by address
+	sort.Slice(order, func(i, j int) bool { return bytes.Compare(order[i].Bytes(), order[j].Bytes()) < 0 })
+	summary := make([]*payoutToken, len(order))
+	for i, key := range order {
+		summary[i] = tokens[key]
+	}
+	return txs, summary, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTokenAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		want     string
+		err      bool
+	}{
+		{"1.5", 6, "1500000", false},
+		{"0.000001", 6, "1", false},
+		{"2.50000000", 6, "2500000", false},
+		{"100", 0, "100", false},
+		{"0.0000001", 6, "", true},
+		{"0", 18, "", true},
+		{"-1", 18, "", true},
+		{"1.2.3", 18, "", true},
+		{"abc", 18, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseTokenAmount(tt.amount, tt.decimals)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseTokenAmount(%q, %d) = %s, want an error", tt.amount, tt.decimals, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("parseTokenAmount(%q, %d) = %v, %v, want %s", tt.amount, tt.decimals, got, err, tt.want)
+		}
+	}
+}
+
+func writePayouts(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "payouts.csv")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuildPayouts(t *testing.T) {
+	const token = "0x00000000000000000000000000000000000000aa"
+	defer func(saved displayConfig) { display = saved }(display)
+	display.Tokens = []tokenDisplay{{Token: token, Symbol: "TKN", Decimals: 6}}
+
+	path := writePayouts(t, "token_type,token_address,receiver,amount\n"+
+		"erc20,"+token+","+testRecipient+",1.5\n"+
+		"native,,"+testRecipient+",0.25\n"+
+		"erc20,"+token+","+testSafe+",2\n")
+	rows, err := loadPayoutCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, totals, err := buildPayouts(rows, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 3 || len(totals) != 2 {
+		t.Fatalf("buildPayouts = %d txs, %d totals, want 3, 2", len(txs), len(totals))
+	}
+	if got := totals[0].String(); !strings.HasPrefix(got, "0.25") || !strings.HasSuffix(got, "ETH to 1 recipients") {
+		t.Errorf("native total = %s, want 0.25 ETH to 1 recipients", got)
+	}
+	if totals[1].Total.String() != "3500000" || totals[1].Recipients != 2 {
+		t.Errorf("token total = %s to %d, want 3500000 to 2", totals[1].Total, totals[1].Recipients)
+	}
+	if txs[1].Value.String() != "250000000000000000" || txs[0].Value.Sign() != 0 {
+		t.Errorf("values = %s, %s, want 0, 250000000000000000", txs[0].Value, txs[1].Value)
+	}
+}
+
+func TestBuildPayoutsInvalid(t *testing.T) {
+	const token = "0x00000000000000000000000000000000000000aa"
+	defer func(saved displayConfig) { display = saved }(display)
+	display.Tokens = []tokenDisplay{{Token: token, Symbol: "TKN", Decimals: 6}}
+
+	tests := []struct {
+		csv  string
+		want string
+	}{
+		{testRecipient + "," + token + ",1\n" + testRecipient + "," + token + ",2\n", "already paid the same token on line 1"},
+		{testRecipient + "," + token + ",0.0000001\n", "more than 6 decimals"},
+		{"0x123," + token + ",1\n", "line 1: invalid address"},
+		{"address,amount\n" + testRecipient + ",\n", "line 2: missing amount"},
+		{testRecipient + ",0x00000000000000000000000000000000000000bb,1\n", "pass -rpc"},
+	}
+	for _, tt := range tests {
+		rows, err := loadPayoutCSV(writePayouts(t, tt.csv))
+		if err == nil {
+			_, _, err = buildPayouts(rows, nil, false)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("payouts %q = %v, want an error with %q", tt.csv, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	erc20TransferSelector          = []byte{0xa9, 0x05, 0x9c, 0xbb}
+	erc20TransferFromSelector      = []byte{0x23, 0xb8, 0x72, 0xdd}
+	erc20ApproveSelector           = []byte{0x09, 0x5e, 0xa7, 0xb3}
+	erc20IncreaseAllowanceSelector = []byte{0x39, 0x50, 0x93, 0x51}
+)
+
+type tokenRule struct {
+	Token string `json:"token" yaml:"token"`
+	// if set, the token may only be sent to (or approved for) these addresses
+	Recipients []string `json:"recipients" yaml:"recipients"`
+	// if set, the token may never leave the safe
+	Frozen bool `json:"frozen" yaml:"frozen"`
+}
+
+type selectorRule struct {
+	// 4-byte selector ("0x095ea7b3") or function signature ("approve(address,uint256)")
+	Selector string `json:"selector" yaml:"selector"`
+	// if set, the call is only blocked when one of its arguments is max uint256
+	Unlimited bool `json:"unlimited" yaml:"unlimited"`
+}
+
+type policy struct {
+	Tokens           []tokenRule    `json:"tokens" yaml:"tokens"`
+	BlockedSelectors []selectorRule `json:"blockedSelectors" yaml:"blockedSelectors"`
+	// if set, delegatecalls are only allowed to these addresses
+	DelegateCallTargets []string `json:"delegateCallTargets" yaml:"delegateCallTargets"`
+	// if set, every call must go to one of these addresses
+	AllowedDestinations []string `json:"allowedDestinations" yaml:"allowedDestinations"`
+	// if set, calls with data must call one of these selectors or signatures
+	AllowedMethods []string `json:"allowedMethods" yaml:"allowedMethods"`
+	// if set, the most wei the calls of a transaction may send in total
+	MaxValue string `json:"maxValue" yaml:"maxValue"`
+	// fields the proposal origin json must have, an empty value only
+	// requires the field to be present; proposals made by the tool meet
+	// these when they are made with the same fields
+	RequiredOrigin map[string]string `json:"requiredOrigin" yaml:"requiredOrigin"`
+}
+
+func parseSelector(selector string) ([]byte, error) {
+	if strings.Contains(selector, "(") {
+		return crypto.Keccak256([]byte(selector))[:4], nil
+	}
+
+	decoded, err := hexutil.Decode(selector)
+	if err != nil || len(decoded) != 4 {
+		return nil, fmt.Errorf("invalid selector in policy: %q", selector)
+	}
+	return decoded, nil
+}
+
+func (r *selectorRule) bytes() ([]byte, error) {
+	return parseSelector(r.Selector)
+}
+
+func (r *selectorRule) blocks(data []byte) bool {
+	selector, err := r.bytes()
+	if err != nil || len(data) < 4 || !bytes.Equal(data[:4], selector) {
+		return false
+	}
+	if !r.Unlimited {
+		return true
+	}
+
+	for i := 4; i+32 <= len(data); i += 32 {
+		if new(big.Int).SetBytes(data[i:i+32]).Cmp(math.MaxBig256) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// loadPolicyFlag loads the policy of a -policy flag, nil when none is given
+func loadPolicyFlag(path string) (*policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return loadPolicy(path)
+}
+
+func loadPolicy(path string) (*policy, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p policy
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		err = yaml.UnmarshalStrict(content, &p)
+	} else {
+		err = json.Unmarshal(content, &p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+
+	for _, rule := range p.Tokens {
+		if err := checkAddress(rule.Token); err != nil {
+			return nil, fmt.Errorf("invalid token address in policy: %q: %w", rule.Token, err)
+		}
+		for _, recipient := range rule.Recipients {
+			if err := checkAddress(recipient); err != nil {
+				return nil, fmt.Errorf("invalid recipient address in policy for token %s: %q: %w", rule.Token, recipient, err)
+			}
+		}
+	}
+
+	for _, rule := range p.BlockedSelectors {
+		if _, err := rule.bytes(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, target := range p.DelegateCallTargets {
+		if err := checkAddress(target); err != nil {
+			return nil, fmt.Errorf("invalid delegatecall target in policy: %q: %w", target, err)
+		}
+	}
+
+	for _, destination := range p.AllowedDestinations {
+		if err := checkAddress(destination); err != nil {
+			return nil, fmt.Errorf("invalid allowed destination in policy: %q: %w", destination, err)
+		}
+	}
+
+	for _, method := range p.AllowedMethods {
+		if _, err := parseSelector(method); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.MaxValue != "" {
+		if max, ok := new(big.Int).SetString(p.MaxValue, 10); !ok || max.Sign() < 0 {
+			return nil, fmt.Errorf("invalid maxValue in policy: %q, expected wei", p.MaxValue)
+		}
+	}
+
+	return &p, nil
+}
+
+func (p *policy) tokenRule(token common.Address) *tokenRule {
+	for i := range p.Tokens {
+		if common.HexToAddress(p.Tokens[i].Token) == token {
+			return &p.Tokens[i]
+		}
+	}
+	return nil
+}
+
+func (r *tokenRule) allows(recipient common.Address) bool {
+	if r.Frozen {
+		return false
+	}
+	if len(r.Recipients) == 0 {
+		return true
+	}
+	for _, allowed := range r.Recipients {
+		if common.HexToAddress(allowed) == recipient {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenOutflow returns the address receiving tokens (or an allowance over them)
+// in an ERC-20 call, if the call moves tokens out of the safe
+func tokenOutflow(safe common.Address, data []byte) (common.Address, string, bool) {
+	if len(data) < 4 {
+		return common.Address{}, "", false
+	}
+
+	word := func(i int) []byte {
+		if len(data) < 4+32*(i+1) {
+			return nil
+		}
+		return data[4+32*i : 4+32*(i+1)]
+	}
+
+	selector := data[:4]
+	switch {
+	case bytes.Equal(selector, erc20TransferSelector) && word(1) != nil:
+		return common.BytesToAddress(word(0)), "transfer", true
+	case bytes.Equal(selector, erc20TransferFromSelector) && word(2) != nil:
+		if common.BytesToAddress(word(0)) != safe {
+			return common.Address{}, "", false
+		}
+		return common.BytesToAddress(word(1)), "transferFrom", true
+	case bytes.Equal(selector, erc20ApproveSelector) && word(1) != nil:
+		// revoking an approval never moves funds
+		if new(big.Int).SetBytes(word(1)).Sign() == 0 {
+			return common.Address{}, "", false
+		}
+		return common.BytesToAddress(word(0)), "approve", true
+	case bytes.Equal(selector, erc20IncreaseAllowanceSelector) && word(1) != nil:
+		return common.BytesToAddress(word(0)), "increaseAllowance", true
+	}
+
+	return common.Address{}, "", false
+}
+
+func (p *policy) allowsDelegateCall(target common.Address) bool {
+	if len(p.DelegateCallTargets) == 0 {
+		return true
+	}
+	for _, allowed := range p.DelegateCallTargets {
+		if common.HexToAddress(allowed) == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) allowsDestination(to common.Address) bool {
+	if len(p.AllowedDestinations) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedDestinations {
+		if common.HexToAddress(allowed) == to {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMethod checks the selector of a call, plain transfers have none
+func (p *policy) allowsMethod(data []byte) bool {
+	if len(p.AllowedMethods) == 0 || len(data) == 0 {
+		return true
+	}
+	for _, method := range p.AllowedMethods {
+		if selector, err := parseSelector(method); err == nil && len(data) >= 4 && bytes.Equal(data[:4], selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// originViolations checks the required fields of the proposal origin
+func (p *policy) originViolations(origin *string) []string {
+	if len(p.RequiredOrigin) == 0 {
+		return nil
+	}
+
+	fields := map[string]interface{}{}
+	if origin == nil || json.Unmarshal([]byte(*origin), &fields) != nil {
+		return []string{"the proposal origin is missing or not json, required by the policy"}
+	}
+
+	var names []string
+	for name := range p.RequiredOrigin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []string
+	for _, name := range names {
+		want := p.RequiredOrigin[name]
+		got, ok := fields[name]
+		switch {
+		case !ok:
+			violations = append(violations, fmt.Sprintf("the proposal origin has no %s", name))
+		case want != "" && fmt.Sprint(got) != want:
+			violations = append(violations, fmt.Sprintf("the proposal origin has %s %q, not %q", name, fmt.Sprint(got), want))
+		}
+	}
+	return violations
+}
+
+func (p *policy) violations(safe common.Address, txs []multiSendTx) []string {
+	var violations []string
+
+	total := new(big.Int)
+	for i, tx := range txs {
+		if tx.Value != nil {
+			total.Add(total, tx.Value)
+		}
+
+		if !p.allowsDestination(tx.To) {
+			violations = append(violations, fmt.Sprintf("tx %d: %s is not an allowed destination", i, tx.To.Hex()))
+		}
+		if !p.allowsMethod(tx.Data) {
+			selector := tx.Data
+			if len(selector) > 4 {
+				selector = selector[:4]
+			}
+			violations = append(violations, fmt.Sprintf("tx %d: method %s of %s is not allowed", i, hexutil.Encode(selector), tx.To.Hex()))
+		}
+
+		if tx.Operation == 1 && !p.allowsDelegateCall(tx.To) {
+			violations = append(violations, fmt.Sprintf("tx %d: delegatecall to %s is not allowed", i, tx.To.Hex()))
+		}
+
+		for _, blocked := range p.BlockedSelectors {
+			if blocked.blocks(tx.Data) {
+				violations = append(violations, fmt.Sprintf("tx %d: call to %s matches blocked selector %s", i, tx.To.Hex(), blocked.Selector))
+			}
+		}
+
+		rule := p.tokenRule(tx.To)
+		if rule == nil {
+			continue
+		}
+
+		recipient, method, ok := tokenOutflow(safe, tx.Data)
+		if !ok || recipient == safe {
+			continue
+		}
+
+		if rule.allows(recipient) {
+			continue
+		}
+
+		if rule.Frozen {
+			violations = append(violations, fmt.Sprintf("tx %d: token %s may not leave the safe (%s to %s)", i, tx.To.Hex(), method, recipient.Hex()))
+		} else {
+			violations = append(violations, fmt.Sprintf("tx %d: %s of token %s to %s is not allowed", i, method, tx.To.Hex(), recipient.Hex()))
+		}
+	}
+
+	if p.MaxValue != "" {
+		if max, _ := new(big.Int).SetString(p.MaxValue, 10); max != nil && total.Cmp(max) > 0 {
+			violations = append(violations, fmt.Sprintf("the transaction sends %s wei, more than the maximum of %s", total, max))
+		}
+	}
+
+	return violations
+}
+
+// batchViolations checks the MultiSend delegatecalls of a batch and of the
+// batches nested in it, which are not part of its flattened calls; only the
+// canonical MultiSend contracts are flattened, so they are the only targets
+// exempt from the allowed destinations, any other one is checked as a call
+func (p *policy) batchViolations(to common.Address, data []byte, operation uint8) []string {
+	if !isMultiSendBatch(to, data, operation) {
+		return nil
+	}
+
+	var violations []string
+	if !p.allowsDelegateCall(to) {
+		violations = append(violations, fmt.Sprintf("delegatecall to %s is not allowed", to.Hex()))
+	}
+	txs, err := decodeMultiSend(data)
+	if err != nil {
+		// flattenTx fails on it as well
+		return violations
+	}
+	for _, tx := range txs {
+		violations = append(violations, p.batchViolations(tx.To, tx.Data, tx.Operation)...)
+	}
+	return violations
+}
+
+// checkTxPolicy checks a transaction of the service format against p before
+// it is signed, a nil policy allows every transaction
+func checkTxPolicy(p *policy, tx *multisigTxResponse) error {
+	if p == nil {
+		return nil
+	}
+	var data []byte
+	if tx.Data != nil {
+		var err error
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return err
+		}
+	}
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		return fmt.Errorf("invalid value %q", tx.Value)
+	}
+	return checkPolicy(p, common.HexToAddress(tx.Safe), common.HexToAddress(tx.To), value, data, tx.Operation)
+}
+
+func checkPolicy(p *policy, safe, to common.Address, value *big.Int, data []byte, operation uint8) error {
+	if p == nil {
+		return nil
+	}
+
+	txs, err := flattenTx(to, value, data, operation)
+	if err != nil {
+		return err
+	}
+
+	if violations := append(p.batchViolations(to, data, operation), p.violations(safe, txs)...); len(violations) > 0 {
+		return errors.New("policy violation:\n" + strings.Join(violations, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// implementation slots of the common proxy standards
+var (
+	eip1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	eip1967BeaconSlot         = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+	eip1822ProxiableSlot      = crypto.Keccak256Hash([]byte("PROXIABLE"))
+	zeppelinosSlot            = crypto.Keccak256Hash([]byte("org.zeppelinos.proxy.implementation"))
+)
+
+// proxyRecord is the implementation of a proxy destination as first seen,
+// kept in proxies.json in the config directory
+type proxyRecord struct {
+	Proxy          string `json:"proxy"`
+	Kind           string `json:"kind"`
+	Implementation string `json:"implementation"`
+	CodeHash       string `json:"codeHash"`
+	RecordedAt     string `json:"recordedAt"`
+}
+
+type proxyImplementation struct {
+	Kind           string
+	Implementation common.Address
+	CodeHash       common.Hash
+	CodeSize       int
+}
+
+func storedAddress(client EthClient, addr common.Address, slot common.Hash) (common.Address, error) {
+	value, err := client.StorageAt(opCtx, addr, slot, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(value), nil
+}
+
+// resolveProxy returns the current implementation of addr, or nil if it is
+// not a recognized proxy
+func resolveProxy(client EthClient, addr common.Address) (*proxyImplementation, error) {
+	var kind string
+	var impl common.Address
+
+	slots := []struct {
+		kind string
+		slot common.Hash
+	}{
+		{"EIP-1967", eip1967ImplementationSlot},
+		{"EIP-1822", eip1822ProxiableSlot},
+		{"OpenZeppelin legacy", zeppelinosSlot},
+	}
+	for _, s := range slots {
+		stored, err := storedAddress(client, addr, s.slot)
+		if err != nil {
+			return nil, err
+		}
+		if stored != (common.Address{}) {
+			kind, impl = s.kind, stored
+			break
+		}
+	}
+
+	if kind == "" {
+		beacon, err := storedAddress(client, addr, eip1967BeaconSlot)
+		if err != nil {
+			return nil, err
+		}
+		if beacon != (common.Address{}) {
+			result, err := callAt(client, beacon, "implementation()", nil)
+			if err != nil || len(result) != 32 {
+				return nil, fmt.Errorf("beacon %s of %s did not answer implementation()", beacon.Hex(), addr.Hex())
+			}
+			kind, impl = "EIP-1967 beacon", common.BytesToAddress(result)
+		}
+	}
+
+	// safe proxies answer masterCopy() with their first storage slot
+	if kind == "" {
+		result, err := callAt(client, addr, "masterCopy()", nil)
+		if err == nil && len(result) == 32 {
+			singleton, err := storedAddress(client, addr, masterCopySlot)
+			if err != nil {
+				return nil, err
+			}
+			if singleton != (common.Address{}) && singleton == common.BytesToAddress(result) {
+				kind, impl = "safe", singleton
+			}
+		}
+	}
+
+	if kind == "" {
+		return nil, nil
+	}
+
+	code, err := client.CodeAt(opCtx, impl, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyImplementation{Kind: kind, Implementation: impl, CodeHash: crypto.Keccak256Hash(code), CodeSize: len(code)}, nil
+}
+
+func loadProxyRecords() ([]proxyRecord, error) {
+	content, err := ioutil.ReadFile(configPath("proxies.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []proxyRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("invalid proxy records: %w", err)
+	}
+	return records, nil
+}
+
+func saveProxyRecords(records []proxyRecord) error {
+	encoded, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := configPath("proxies.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0o644)
+}
+
+// recordProxy stores impl as the known implementation of proxy, replacing an
+// earlier record
+func recordProxy(records []proxyRecord, proxy common.Address, impl *proxyImplementation) []proxyRecord {
+	record := proxyRecord{
+		Proxy:          proxy.Hex(),
+		Kind:           impl.Kind,
+		Implementation: impl.Implementation.Hex(),
+		CodeHash:       impl.CodeHash.Hex(),
+		RecordedAt:     formatTime(time.Now()),
+	}
+	for i, r := range records {
+		if common.HexToAddress(r.Proxy) == proxy {
+			records[i] = record
+			return records
+		}
+	}
+	return append(records, record)
+}
+
+// checkProxies shows the implementation behind proxy destinations and compares
+// it against the one recorded when the destination was first used, warning on
+// upgrades and refusing them in strict mode; needs rpc
+func checkProxies(mode, rpc string, safe, to common.Address, value *big.Int, data []byte, operation uint8) error {
+	switch mode {
+	case CHECK_OFF:
+		return nil
+	case "", CHECK_WARN, CHECK_STRICT:
+	default:
+		return fmt.Errorf("unknown proxy check mode %q, expected %s, %s or %s", mode, CHECK_OFF, CHECK_WARN, CHECK_STRICT)
+	}
+	if rpc == "" {
+		return nil
+	}
+
+	calls, err := flattenTx(to, value, data, operation)
+	if err != nil {
+		return err
+	}
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	records, err := loadProxyRecords()
+	if err != nil {
+		return err
+	}
+
+	checked := map[common.Address]bool{}
+	var changed []string
+	recorded := false
+	for _, call := range calls {
+		if call.To == safe || checked[call.To] {
+			continue
+		}
+		checked[call.To] = true
+
+		impl, err := resolveProxy(client, call.To)
+		if err != nil {
+			return err
+		}
+		if impl == nil {
+			continue
+		}
+		fmt.Printf("%s is a proxy (%s), implementation %s (%d bytes, code hash %s)\n", call.To.Hex(), impl.Kind, impl.Implementation.Hex(), impl.CodeSize, impl.CodeHash.Hex())
+
+		var known *proxyRecord
+		for i := range records {
+			if common.HexToAddress(records[i].Proxy) == call.To {
+				known = &records[i]
+			}
+		}
+		switch {
+		case known == nil:
+			records = recordProxy(records, call.To, impl)
+			recorded = true
+			fmt.Println("recorded the implementation of", call.To.Hex())
+		case common.HexToAddress(known.Implementation) != impl.Implementation:
+			fmt.Printf("warning: the implementation of %s changed from %s (recorded %s) to %s\n", call.To.Hex(), known.Implementation, known.RecordedAt, impl.Implementation.Hex())
+			changed = append(changed, call.To.Hex())
+		case common.HexToHash(known.CodeHash) != impl.CodeHash:
+			fmt.Printf("warning: the code of implementation %s of %s changed since %s, code hash %s is now %s\n", impl.Implementation.Hex(), call.To.Hex(), known.RecordedAt, known.CodeHash, impl.CodeHash.Hex())
+			changed = append(changed, call.To.Hex())
+		}
+	}
+
+	if recorded {
+		if err := saveProxyRecords(records); err != nil {
+			return err
+		}
+	}
+	if len(changed) > 0 {
+		fmt.Println("review the new implementation, then accept it with: proxies pin -address <proxy> -rpc <rpc>")
+	}
+	if mode == CHECK_STRICT && len(changed) > 0 {
+		return fmt.Errorf("refusing to call upgraded proxies: %s", strings.Join(changed, ", "))
+	}
+	return nil
+}
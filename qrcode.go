@@ -0,0 +1,419 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// a minimal QR code encoder (byte mode, error correction level L), enough to
+// show pairing URIs in the terminal
+
+type qrVersion struct {
+	ecPerBlock int
+	blocks     []int // data codewords of each block
+	alignment  []int
+}
+
+var qrVersions = []qrVersion{
+	1:  {7, []int{19}, nil},
+	2:  {10, []int{34}, []int{6, 18}},
+	3:  {15, []int{55}, []int{6, 22}},
+	4:  {20, []int{80}, []int{6, 26}},
+	5:  {26, []int{108}, []int{6, 30}},
+	6:  {18, []int{68, 68}, []int{6, 34}},
+	7:  {20, []int{78, 78}, []int{6, 22, 38}},
+	8:  {24, []int{97, 97}, []int{6, 24, 42}},
+	9:  {30, []int{116, 116}, []int{6, 26, 46}},
+	10: {18, []int{68, 68, 69, 69}, []int{6, 28, 50}},
+}
+
+func (v qrVersion) dataCodewords() int {
+	n := 0
+	for _, block := range v.blocks {
+		n += block
+	}
+	return n
+}
+
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func qrMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x1d
+		z ^= (y >> uint(i) & 1) * x
+	}
+	return z
+}
+
+// qrReedSolomon returns the n error correction codewords of data
+func qrReedSolomon(data []byte, n int) []byte {
+	divisor := make([]byte, n)
+	divisor[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := range divisor {
+			divisor[j] = qrMul(divisor[j], root)
+			if j+1 < n {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = qrMul(root, 2)
+	}
+
+	result := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[n-1] = 0
+		for i := range result {
+			result[i] ^= qrMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// qrCodewords encodes data in byte mode and interleaves it with the error
+// correction codewords of each block
+func qrCodewords(data []byte, version int) []byte {
+	v := qrVersions[version]
+	capacity := v.dataCodewords()
+
+	var bits []bool
+	put := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, value>>uint(i)&1 == 1)
+		}
+	}
+	put(4, 4)
+	if version < 10 {
+		put(len(data), 8)
+	} else {
+		put(len(data), 16)
+	}
+	for _, b := range data {
+		put(int(b), 8)
+	}
+	for i := 0; i < 4 && len(bits) < capacity*8; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 0x80 >> uint(j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xec); len(codewords) < capacity; pad ^= 0xec ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	var blocks, ecc [][]byte
+	for _, n := range v.blocks {
+		blocks = append(blocks, codewords[:n])
+		ecc = append(ecc, qrReedSolomon(codewords[:n], v.ecPerBlock))
+		codewords = codewords[n:]
+	}
+
+	var result []byte
+	for i := 0; i < v.blocks[len(v.blocks)-1]; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, block := range ecc {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+func (q *qrCode) drawFunctionPatterns(version int) {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || y < 0 || x >= q.size || y >= q.size {
+					continue
+				}
+				dist := qrMax(qrAbs(dx), qrAbs(dy))
+				q.set(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	positions := qrVersions[version].alignment
+	last := len(positions) - 1
+	for i, cy := range positions {
+		for j, cx := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(cx+dx, cy+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>uint(i)&1 == 1
+			a, b := q.size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+
+	// reserve the format areas, drawn with the chosen mask
+	q.drawFormat(0)
+}
+
+// drawFormat writes the format bits of error correction level L and mask
+func (q *qrCode) drawFormat(mask int) {
+	data := 1<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>uint(i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+func (q *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(codewords)*8 {
+					q.modules[y][x] = codewords[i>>3]>>uint(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func qrMasked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.function[y][x] && qrMasked(mask, x, y) {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores runs, 2x2 blocks and dark/light imbalance, which make a code
+// harder to scan
+func (q *qrCode) penalty() int {
+	score := 0
+	for y := 0; y < q.size; y++ {
+		for _, horizontal := range []bool{true, false} {
+			run := 0
+			for x := 0; x < q.size; x++ {
+				same := false
+				if x > 0 {
+					if horizontal {
+						same = q.modules[y][x] == q.modules[y][x-1]
+					} else {
+						same = q.modules[x][y] == q.modules[x-1][y]
+					}
+				}
+				if same {
+					run++
+					if run == 5 {
+						score += 3
+					} else if run > 5 {
+						score++
+					}
+				} else {
+					run = 1
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := q.size * q.size
+	score += qrAbs(dark*20-total*10) / total * 10
+	return score
+}
+
+func encodeQR(text string) (*qrCode, error) {
+	data := []byte(text)
+
+	version := 0
+	for v := 1; v < len(qrVersions); v++ {
+		header := 12
+		if v >= 10 {
+			header = 20
+		}
+		if len(data)*8+header <= qrVersions[v].dataCodewords()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errors.New("text too long for a QR code")
+	}
+
+	size := version*4 + 17
+	newGrid := func() [][]bool {
+		grid := make([][]bool, size)
+		for i := range grid {
+			grid[i] = make([]bool, size)
+		}
+		return grid
+	}
+
+	var best *qrCode
+	bestPenalty := 0
+	codewords := qrCodewords(data, version)
+	for mask := 0; mask < 8; mask++ {
+		q := &qrCode{size: size, modules: newGrid(), function: newGrid()}
+		q.drawFunctionPatterns(version)
+		q.drawCodewords(codewords)
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); best == nil || p < bestPenalty {
+			best, bestPenalty = q, p
+		}
+	}
+	return best, nil
+}
+
+// terminal renders the code with half blocks, two rows per line, forcing
+// light modules white so it scans on dark and light terminals alike
+func (q *qrCode) terminal() string {
+	const quiet = 2
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x >= 0 && y >= 0 && x < q.size && y < q.size && q.modules[y][x]
+	}
+
+	var b strings.Builder
+	total := q.size + 2*quiet
+	for y := 0; y < total; y += 2 {
+		b.WriteString("\x1b[97;40m")
+		for x := 0; x < total; x++ {
+			top, bottom := dark(x, y), dark(x, y+1)
+			switch {
+			case !top && !bottom:
+				b.WriteString("█")
+			case !top:
+				b.WriteString("▀")
+			case !bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	return b.String()
+}
+
+func qrAbs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func qrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// queueSlot is a nonce of the queue with the proposals at it, more than one
+// conflict as only one of them can execute
+type queueSlot struct {
+	Nonce int64
+	Txs   []multisigTxResponse
+	// Gap is the first nonce without a proposal below this one, -1 if none
+	Gap int64
+}
+
+func (s *queueSlot) status(current int64) string {
+	switch {
+	case len(s.Txs) == 0:
+		if s.Gap == s.Nonce {
+			return "gap, nothing proposed"
+		}
+		return fmt.Sprintf("gap, also blocked by the gap at nonce %d", s.Gap)
+	case s.Gap >= 0:
+		return fmt.Sprintf("blocked by the gap at nonce %d", s.Gap)
+	case s.Nonce > current:
+		return fmt.Sprintf("waits for nonce %d", s.Nonce-1)
+	}
+	for _, tx := range s.Txs {
+		if int64(len(tx.Confirmations)) >= tx.ConfirmationsRequired {
+			return "ready to execute"
+		}
+	}
+	return "awaiting confirmations"
+}
+
+// buildQueue groups the pending transactions by nonce from the current one to
+// the highest queued, the nonces in between without a proposal are gaps
+func buildQueue(current int64, pending []multisigTxResponse) []queueSlot {
+	byNonce := map[int64][]multisigTxResponse{}
+	last := current - 1
+	for _, tx := range pending {
+		if tx.Nonce < current {
+			continue
+		}
+		byNonce[tx.Nonce] = append(byNonce[tx.Nonce], tx)
+		if tx.Nonce > last {
+			last = tx.Nonce
+		}
+	}
+
+	var slots []queueSlot
+	gap := int64(-1)
+	for nonce := current; nonce <= last; nonce++ {
+		txs := byNonce[nonce]
+		if len(txs) == 0 && gap < 0 {
+			gap = nonce
+		}
+		// oldest proposal first
+		sort.SliceStable(txs, func(i, j int) bool { return txs[i].SubmissionDate < txs[j].SubmissionDate })
+		slots = append(slots, queueSlot{Nonce: nonce, Txs: txs, Gap: gap})
+	}
+	return slots
+}
+
+// confirmationBar renders confirmations out of required, e.g. [##-] 2/3
+func confirmationBar(confirmations, required int64) string {
+	bar := ""
+	for i := int64(0); i < required || i < confirmations; i++ {
+		if i < confirmations {
+			bar += "#"
+		} else {
+			bar += "-"
+		}
+	}
+	return fmt.Sprintf("[%s] %d/%d", bar, confirmations, required)
+}
+
+// printQueue renders the queue of a safe nonce by nonce, with the owners yet
+// to confirm each proposal
+func printQueue(info *safeNonceResponse, slots []queueSlot) {
+	fmt.Printf("%s: nonce %d, threshold %d of %d\n", info.Address, info.Nonce, info.Threshold, len(info.Owners))
+	if len(slots) == 0 {
+		fmt.Println("  queue is empty")
+		return
+	}
+
+	for _, slot := range slots {
+		status := slot.status(info.Nonce)
+		if len(slot.Txs) > 1 {
+			status = fmt.Sprintf("%s, conflict: %d proposals, only one can execute", status, len(slot.Txs))
+		}
+		fmt.Printf("  nonce %d: %s\n", slot.Nonce, status)
+
+		for _, tx := range slot.Txs {
+			required := tx.ConfirmationsRequired
+			if required == 0 {
+				required = info.Threshold
+			}
+			fmt.Printf("    %s %s\n", tx.SafeTxHash, confirmationBar(int64(len(tx.Confirmations)), required))
+			for _, intent := range newWatchEvent(EVENT_PROPOSED, &tx).Intent {
+				fmt.Println("      -", intent)
+			}
+			if missing := missingOwners(info.Owners, tx.Confirmations); len(missing) > 0 && int64(len(tx.Confirmations)) < required {
+				fmt.Println("      awaiting:", strings.Join(missing, ", "))
+			}
+		}
+	}
+}
+
+func missingOwners(owners []string, confirmations []multisigConfirmation) []string {
+	confirmed := map[common.Address]bool{}
+	for _, c := range confirmations {
+		confirmed[common.HexToAddress(c.Owner)] = true
+	}
+	var missing []string
+	for _, owner := range owners {
+		if addr := common.HexToAddress(owner); !confirmed[addr] {
+			missing = append(missing, displayAddress(addr))
+		}
+	}
+	return missing
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestBuildQueue(t *testing.T) {
+	confirmed := []multisigConfirmation{{Owner: testOwner.Hex()}}
+	pending := []multisigTxResponse{
+		{Nonce: 4, SafeTxHash: "old"},
+		{Nonce: 5, SafeTxHash: "b", SubmissionDate: "2022-01-02", ConfirmationsRequired: 1, Confirmations: confirmed},
+		{Nonce: 5, SafeTxHash: "a", SubmissionDate: "2022-01-01", ConfirmationsRequired: 2},
+		{Nonce: 6, SafeTxHash: "c", ConfirmationsRequired: 2},
+		{Nonce: 8, SafeTxHash: "d", ConfirmationsRequired: 2},
+	}
+	slots := buildQueue(5, pending)
+
+	tests := []struct {
+		nonce  int64
+		hashes []string
+		status string
+	}{
+		{5, []string{"a", "b"}, "ready to execute"},
+		{6, []string{"c"}, "waits for nonce 5"},
+		{7, nil, "gap, nothing proposed"},
+		{8, []string{"d"}, "blocked by the gap at nonce 7"},
+	}
+	if len(slots) != len(tests) {
+		t.Fatalf("buildQueue = %d slots, want %d", len(slots), len(tests))
+	}
+	for i, tt := range tests {
+		slot := slots[i]
+		var hashes []string
+		for _, tx := range slot.Txs {
+			hashes = append(hashes, tx.SafeTxHash)
+		}
+		if slot.Nonce != tt.nonce || len(hashes) != len(tt.hashes) {
+			t.Errorf("slot %d = nonce %d %v, want nonce %d %v", i, slot.Nonce, hashes, tt.nonce, tt.hashes)
+			continue
+		}
+		for j := range hashes {
+			if hashes[j] != tt.hashes[j] {
+				t.Errorf("slot %d = %v, want %v oldest first", i, hashes, tt.hashes)
+			}
+		}
+		if got := slot.status(5); got != tt.status {
+			t.Errorf("nonce %d status = %q, want %q", tt.nonce, got, tt.status)
+		}
+	}
+
+	if got := buildQueue(5, nil); len(got) != 0 {
+		t.Errorf("buildQueue of an empty queue = %v, want no slots", got)
+	}
+}
+
+func TestConfirmationBar(t *testing.T) {
+	tests := []struct {
+		confirmations, required int64
+		want                    string
+	}{
+		{0, 2, "[--] 0/2"},
+		{1, 3, "[#--] 1/3"},
+		{3, 2, "[###] 3/2"},
+	}
+	for _, tt := range tests {
+		if got := confirmationBar(tt.confirmations, tt.required); got != tt.want {
+			t.Errorf("confirmationBar(%d, %d) = %q, want %q", tt.confirmations, tt.required, got, tt.want)
+		}
+	}
+}
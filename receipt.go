@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const RECEIPT_POLL_INTERVAL = 4 * time.Second
+
+// errExecutionFailed is returned when execTransaction emitted ExecutionFailure
+var errExecutionFailed = errors.New("the safe transaction failed, its nonce is used up")
+
+// safeExecutionEvent is an ExecutionSuccess or ExecutionFailure event, the
+// payment is the refund paid to the executor
+type safeExecutionEvent struct {
+	Success    bool
+	SafeTxHash common.Hash
+	Payment    *big.Int
+}
+
+func (e *safeExecutionEvent) String() string {
+	name := "ExecutionFailure"
+	if e.Success {
+		name = "ExecutionSuccess"
+	}
+	return fmt.Sprintf("%s safeTxHash=%s payment=%s", name, e.SafeTxHash.Hex(), e.Payment)
+}
+
+// safeExecutionEvents returns the execution events the safe emitted in the receipt
+func safeExecutionEvents(receipt *types.Receipt, safe common.Address) []safeExecutionEvent {
+	var events []safeExecutionEvent
+	for _, log := range receipt.Logs {
+		if log.Address != safe || len(log.Topics) == 0 || len(log.Data) < 64 {
+			continue
+		}
+		if log.Topics[0] != executionSuccessTopic && log.Topics[0] != executionFailureTopic {
+			continue
+		}
+		// both arguments are unindexed: safeTxHash and payment
+		events = append(events, safeExecutionEvent{
+			Success:    log.Topics[0] == executionSuccessTopic,
+			SafeTxHash: common.BytesToHash(log.Data[:32]),
+			Payment:    new(big.Int).SetBytes(log.Data[32:64]),
+		})
+	}
+	return events
+}
+
+// waitForReceipt waits for the receipt of a sent transaction, a reverted one
+// returns its receipt along with the revert reason
+func waitForReceipt(client EthClient, signedTx *types.Transaction) (*types.Receipt, error) {
+	receipt, err := pollReceipts(client, signedTx.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, fmt.Errorf("transaction %s reverted: %s", signedTx.Hash().Hex(), replayRevert(client, signedTx, receipt))
+	}
+	return receipt, nil
+}
+
+// replayRevert replays a reverted transaction on the state before its block
+// to recover the revert reason, which receipts don't carry
+func replayRevert(client EthClient, tx *types.Transaction, receipt *types.Receipt) string {
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return "unknown sender: " + err.Error()
+	}
+	if receipt.GasUsed == tx.Gas() {
+		return fmt.Sprintf("out of gas, all %d gas used", tx.Gas())
+	}
+
+	msg := ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), Value: tx.Value(), Data: tx.Data()}
+	parent := new(big.Int).Sub(receipt.BlockNumber, common.Big1)
+	_, err = client.CallContract(opCtx, msg, parent)
+	if err == nil {
+		return "no revert when replayed, it depended on a transaction earlier in its block"
+	}
+	if reason, ok := callError(err); ok {
+		return reason
+	}
+	return err.Error()
+}
+
+// replayFailedCall recovers why the call of a safe transaction failed inside
+// execTransaction, replaying it from the safe before the execution block;
+// delegate calls run in the context of the safe and can't be replayed
+func replayFailedCall(client EthClient, tx *multisigTxResponse, receipt *types.Receipt) string {
+	if tx.Operation != 0 {
+		return "delegate calls can't be replayed"
+	}
+	msg, err := safeTxCallMsg(tx)
+	if err != nil {
+		return err.Error()
+	}
+	parent := new(big.Int).Sub(receipt.BlockNumber, common.Big1)
+	_, err = client.CallContract(opCtx, *msg, parent)
+	if err == nil {
+		return "no revert when replayed, it may have run out of the safeTxGas"
+	}
+	if reason, ok := callError(err); ok {
+		return reason
+	}
+	return err.Error()
+}
+
+func safeTxCallMsg(tx *multisigTxResponse) (*ethereum.CallMsg, error) {
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %q", tx.Value)
+	}
+	var data []byte
+	if tx.Data != nil {
+		var err error
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return nil, err
+		}
+	}
+	safe, to := common.HexToAddress(tx.Safe), common.HexToAddress(tx.To)
+	msg := &ethereum.CallMsg{From: safe, To: &to, Value: value, Data: data}
+	if tx.SafeTxGas > 0 {
+		msg.Gas = uint64(tx.SafeTxGas)
+	}
+	return msg, nil
+}
+
+// reportExecution prints the outcome of an execTransaction receipt and
+// returns the execution event of the safe transaction, nil if there is none
+func reportExecution(client EthClient, receipt *types.Receipt, tx *multisigTxResponse) *safeExecutionEvent {
+	status := "success"
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = "reverted"
+	}
+	logger.Info("receipt", "status", status, "block", receipt.BlockNumber, "blockHash", receipt.BlockHash.Hex(), "gasUsed", receipt.GasUsed)
+
+	var found *safeExecutionEvent
+	for _, event := range safeExecutionEvents(receipt, common.HexToAddress(tx.Safe)) {
+		if tx.SafeTxHash != "" && event.SafeTxHash != common.HexToHash(tx.SafeTxHash) {
+			continue
+		}
+		event := event
+		found = &event
+		fmt.Println("event:", found)
+		if !found.Success {
+			fmt.Println("failure reason:", replayFailedCall(client, tx, receipt))
+		}
+	}
+	if found == nil && receipt.Status == types.ReceiptStatusSuccessful {
+		logger.Warn("no execution event of the safe in the receipt")
+	}
+	return found
+}
+
+// decodeExecTransaction recovers the safe transaction from execTransaction
+// calldata sent to safe, without its nonce
+func decodeExecTransaction(safe common.Address, input []byte) (*multisigTxResponse, error) {
+	const signature = "execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)"
+	if len(input) < 4 || !bytes.Equal(input[:4], crypto.Keccak256([]byte(signature))[:4]) {
+		return nil, errors.New("not an execTransaction call")
+	}
+	args, err := methodArguments(signature)
+	if err != nil {
+		return nil, err
+	}
+	values, err := args.UnpackValues(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid execTransaction call: %w", err)
+	}
+
+	data := hexutil.Encode(values[2].([]byte))
+	return &multisigTxResponse{
+		Safe:           safe.Hex(),
+		To:             values[0].(common.Address).Hex(),
+		Value:          values[1].(*big.Int).String(),
+		Data:           &data,
+		Operation:      values[3].(uint8),
+		SafeTxGas:      values[4].(*big.Int).Int64(),
+		BaseGas:        values[5].(*big.Int).Int64(),
+		GasPrice:       values[6].(*big.Int).String(),
+		GasToken:       values[7].(common.Address).Hex(),
+		RefundReceiver: values[8].(common.Address).Hex(),
+	}, nil
+}
+
+// showReceipt reports the outcome of an execution sent earlier, waiting for
+// it to be mined
+func showReceipt(rpc string, hash common.Hash) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	signedTx, _, err := client.TransactionByHash(opCtx, hash)
+	if err != nil {
+		return fmt.Errorf("transaction %s: %w", hash.Hex(), err)
+	}
+	if signedTx.To() == nil {
+		return fmt.Errorf("transaction %s is a contract creation", hash.Hex())
+	}
+	tx, err := decodeExecTransaction(*signedTx.To(), signedTx.Data())
+	if err != nil {
+		return fmt.Errorf("transaction %s: %w", hash.Hex(), err)
+	}
+
+	receipt, err := waitForReceipt(client, signedTx)
+	if receipt == nil {
+		return err
+	}
+	event := reportExecution(client, receipt, tx)
+	if err != nil {
+		return err
+	}
+	if event != nil && !event.Success {
+		return errExecutionFailed
+	}
+	return nil
+}
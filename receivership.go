@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// payee returns who a call pays and how much: the destination for native
+// transfers, the recipient for erc20 transfers; token is zero for ETH
+func payee(to common.Address, value *big.Int, data []byte) (recipient, token common.Address, amount *big.Int, err error) {
+	if len(data) == 0 {
+		return to, common.Address{}, value, nil
+	}
+	if method, ok := lookupMethod(data); ok && method == "transfer(address,uint256)" {
+		args, err := methodArguments(method)
+		if err != nil {
+			return common.Address{}, common.Address{}, nil, err
+		}
+		values, err := args.UnpackValues(data[4:])
+		if err == nil {
+			return values[0].(common.Address), to, values[1].(*big.Int), nil
+		}
+	}
+	return common.Address{}, common.Address{}, nil, errors.New("the transaction is not a plain ETH or token transfer")
+}
+
+// ackMessage is the text the recipient signs with personal_sign, everything
+// in it is recomputed from the proposal except the challenge
+func ackMessage(safe, recipient, token common.Address, amount *big.Int, chainID int64, challenge string) string {
+	asset := "wei"
+	if token != (common.Address{}) {
+		asset = "base units of token " + token.Hex()
+	}
+	return fmt.Sprintf("I control %s and expect %s %s from Safe %s on chain %d. Challenge: %s",
+		recipient.Hex(), amount, asset, safe.Hex(), chainID, challenge)
+}
+
+func newAckChallenge() string {
+	challenge := make([]byte, 16)
+	rand.Read(challenge)
+	return hex.EncodeToString(challenge)
+}
+
+// verifyAck checks the recipient signed the acknowledgment of the transfer
+func verifyAck(safe, to common.Address, value *big.Int, data []byte, challenge, signature string) (common.Address, error) {
+	recipient, token, amount, err := payee(to, value, data)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid recipient signature: %w", err)
+	}
+
+	chainID, err := serviceChain()
+	if err != nil {
+		return common.Address{}, err
+	}
+	message := ackMessage(safe, recipient, token, amount, chainID, challenge)
+	signer, err := recoverSigner(common.BytesToHash(accounts.TextHash([]byte(message))), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if signer != recipient {
+		return common.Address{}, fmt.Errorf("the acknowledgment is signed by %s, not the recipient %s", signer.Hex(), recipient.Hex())
+	}
+	return recipient, nil
+}
+
+// checkRecipientAck verifies the recipient acknowledgment carried in the
+// origin of a proposal, if any
+func checkRecipientAck(tx *multisigTxResponse) error {
+	if tx.Origin == nil {
+		return nil
+	}
+	var origin map[string]string
+	if err := json.Unmarshal([]byte(*tx.Origin), &origin); err != nil || origin["recipientAck"] == "" {
+		return nil
+	}
+
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		return fmt.Errorf("invalid value %q", tx.Value)
+	}
+	var data []byte
+	if tx.Data != nil {
+		var err error
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return err
+		}
+	}
+
+	recipient, err := verifyAck(common.HexToAddress(tx.Safe), common.HexToAddress(tx.To), value, data, origin["recipientChallenge"], origin["recipientAck"])
+	if err != nil {
+		return fmt.Errorf("the recipient acknowledgment of the proposal is invalid: %w", err)
+	}
+	fmt.Println("recipient", recipient.Hex(), "proved control of the destination address")
+	return nil
+}
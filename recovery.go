@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// recovery runs through a zodiac delay modifier enabled as a module of the
+// safe: recoverers are modules of the delay, what they execute is queued in
+// it and only reaches the safe after the cooldown, during which the owners
+// can cancel it
+
+const DEFAULT_RECOVERY_COOLDOWN = 24 * time.Hour
+
+// buildRecoverySetup returns the calls attaching a delay modifier to the safe
+// with the recoverers as its modules; without an existing delay one is
+// deployed through the zodiac module factory, owned by the safe
+func buildRecoverySetup(client EthClient, safe common.Address, delay *common.Address, recoverers []common.Address, cooldown, expiration time.Duration, salt *big.Int) ([]multiSendTx, common.Address, error) {
+	if expiration > 0 && expiration < MIN_DELAY_EXPIRATION {
+		return nil, common.Address{}, fmt.Errorf("expiration must be at least %s", MIN_DELAY_EXPIRATION)
+	}
+
+	var txs []multiSendTx
+	enabled := map[common.Address]bool{}
+	if delay == nil {
+		if cooldown == 0 {
+			cooldown = DEFAULT_RECOVERY_COOLDOWN
+		}
+		initParams, err := methodArguments("(address,address,address,uint256,uint256)")
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		params, err := initParams.Pack(safe, safe, safe, big.NewInt(int64(cooldown/time.Second)), big.NewInt(int64(expiration/time.Second)))
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		setUp, err := encodeCall("setUp(bytes)", params)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		factory := contractAddress(CONTRACT_MODULE_PROXY_FACTORY)
+		deploy, err := encodeCall("deployModule(address,bytes,uint256)", contractAddress(CONTRACT_DELAY_MODIFIER), setUp, salt)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+
+		// the factory returns the proxy address, simulated from the safe
+		result, err := callFrom(client, safe, factory, nil, deploy)
+		if err != nil {
+			return nil, common.Address{}, fmt.Errorf("deploying the delay modifier would fail, try another -salt: %w", err)
+		}
+		address := common.BytesToAddress(result)
+		delay = &address
+		fmt.Println("deploying delay modifier", address.Hex(), "with a cooldown of", cooldown)
+		txs = append(txs, multiSendTx{To: factory, Value: new(big.Int), Data: deploy})
+	} else {
+		d, err := readDelay(client, *delay)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		if d.Avatar != safe || d.Target != safe {
+			return nil, common.Address{}, fmt.Errorf("delay modifier %s acts on %s, not on the safe", delay.Hex(), d.Target.Hex())
+		}
+		if d.Owner != safe {
+			return nil, common.Address{}, fmt.Errorf("delay modifier %s is owned by %s, the safe can't configure it", delay.Hex(), d.Owner.Hex())
+		}
+		if cooldown > 0 && cooldown != d.Cooldown {
+			data, err := encodeCall("setTxCooldown(uint256)", big.NewInt(int64(cooldown/time.Second)))
+			if err != nil {
+				return nil, common.Address{}, err
+			}
+			fmt.Println("changing the cooldown from", d.Cooldown, "to", cooldown)
+			txs = append(txs, multiSendTx{To: *delay, Value: new(big.Int), Data: data})
+		}
+		if expiration > 0 && expiration != d.Expiration {
+			data, err := encodeCall("setTxExpiration(uint256)", big.NewInt(int64(expiration/time.Second)))
+			if err != nil {
+				return nil, common.Address{}, err
+			}
+			fmt.Println("changing the expiration from", d.Expiration, "to", expiration)
+			txs = append(txs, multiSendTx{To: *delay, Value: new(big.Int), Data: data})
+		}
+		modules, err := readModules(client, *delay)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		for _, module := range modules {
+			enabled[module] = true
+		}
+	}
+
+	on, err := isModuleEnabled(client, safe, *delay)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	if !on {
+		data, err := encodeCall("enableModule(address)", *delay)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		txs = append(txs, multiSendTx{To: safe, Value: new(big.Int), Data: data})
+	}
+
+	for _, recoverer := range recoverers {
+		if enabled[recoverer] {
+			fmt.Println("recoverer", displayAddress(recoverer), "is already enabled")
+			continue
+		}
+		data, err := encodeCall("enableModule(address)", recoverer)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		txs = append(txs, multiSendTx{To: *delay, Value: new(big.Int), Data: data})
+	}
+
+	if len(txs) == 0 {
+		return nil, common.Address{}, errors.New("recovery is already set up as requested")
+	}
+	return txs, *delay, nil
+}
+
+// buildOwnerSwap returns the safe calls replacing oldOwner with newOwner and,
+// when threshold is positive, changing the threshold
+func buildOwnerSwap(client EthClient, safe, oldOwner, newOwner common.Address, threshold int64) ([]multiSendTx, error) {
+	state, err := readSafeState(client, safe, nil)
+	if err != nil {
+		return nil, err
+	}
+	if state.isOwner(newOwner) {
+		return nil, fmt.Errorf("%s is already an owner", newOwner.Hex())
+	}
+	prev := sentinelOwner
+	found := false
+	for _, owner := range state.Owners {
+		if owner == oldOwner {
+			found = true
+			break
+		}
+		prev = owner
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not an owner of %s", oldOwner.Hex(), safe.Hex())
+	}
+
+	data, err := encodeCall("swapOwner(address,address,address)", prev, oldOwner, newOwner)
+	if err != nil {
+		return nil, err
+	}
+	txs := []multiSendTx{{To: safe, Value: new(big.Int), Data: data}}
+	if threshold > 0 && threshold != state.Threshold {
+		if threshold > int64(len(state.Owners)) {
+			return nil, fmt.Errorf("threshold %d is above the %d owners", threshold, len(state.Owners))
+		}
+		data, err := encodeCall("changeThreshold(uint256)", big.NewInt(threshold))
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, multiSendTx{To: safe, Value: new(big.Int), Data: data})
+	}
+	return txs, nil
+}
+
+// queueRecovery queues the owner change in the delay from the recoverer key,
+// it reaches the safe with executeNextDelayed once the cooldown is over
+func queueRecovery(rpc string, key *ecdsa.PrivateKey, safe, delay, oldOwner, newOwner common.Address, threshold int64, fees *feeOptions) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	d, err := readDelay(client, delay)
+	if err != nil {
+		return err
+	}
+	if d.Target != safe {
+		return fmt.Errorf("delay modifier %s acts on %s, not on %s", delay.Hex(), d.Target.Hex(), safe.Hex())
+	}
+	recoverer := crypto.PubkeyToAddress(key.PublicKey)
+	if ok, err := isModuleEnabled(client, delay, recoverer); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%s is not a recoverer of delay modifier %s", recoverer.Hex(), delay.Hex())
+	}
+
+	txs, err := buildOwnerSwap(client, safe, oldOwner, newOwner, threshold)
+	if err != nil {
+		return err
+	}
+	to, value, data, operation := batchTransaction(txs)
+	call, err := encodeCall("execTransactionFromModule(address,uint256,bytes,uint8)", to, value, data, operation)
+	if err != nil {
+		return err
+	}
+
+	suggested, err := suggestFees(rpc, fees)
+	if err != nil {
+		return err
+	}
+	if _, err := sendEthTransaction(client, key, delay, common.Big0, call, suggested); err != nil {
+		return explainRevert(err, nil)
+	}
+
+	fmt.Println("recovery queued at delay nonce", d.QueueNonce, "replacing", displayAddress(oldOwner), "with", displayAddress(newOwner))
+	fmt.Println("it can be finalized from", formatTime(time.Now().Add(d.Cooldown)), "with recovery finalize, the owners can cancel it until then")
+	return nil
+}
+
+// buildCancelRecovery returns the owners' call skipping everything queued in
+// the delay
+func buildCancelRecovery(client EthClient, delay common.Address) ([]byte, error) {
+	d, err := readDelay(client, delay)
+	if err != nil {
+		return nil, err
+	}
+	if d.TxNonce >= d.QueueNonce {
+		return nil, fmt.Errorf("nothing is queued in delay modifier %s", delay.Hex())
+	}
+	fmt.Println("cancelling", d.QueueNonce-d.TxNonce, "queued transactions")
+	return encodeCall("setTxNonce(uint256)", new(big.Int).SetUint64(d.QueueNonce))
+}
+
+// showRecovery prints the delay configuration, its recoverers and its queue
+func showRecovery(rpc string, safe, delay common.Address) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	d, err := readDelay(client, delay)
+	if err != nil {
+		return err
+	}
+	if d.Avatar != safe {
+		return fmt.Errorf("delay modifier %s belongs to %s, not to %s", delay.Hex(), d.Avatar.Hex(), safe.Hex())
+	}
+	if err := printDelay(client, delay, d); err != nil {
+		return err
+	}
+
+	recoverers, err := readModules(client, delay)
+	if err != nil {
+		return err
+	}
+	for _, r := range recoverers {
+		fmt.Println("recoverer:", displayAddress(r))
+	}
+	return printDelayQueue(client, delay, d)
+}
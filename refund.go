@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// a transaction with a gasPrice above 0 refunds its executor, or its
+// refundReceiver when set, (gas used + baseGas) * gasPrice of its gasToken,
+// the native token for the zero address; relays execute such transactions
+// in exchange for the refund in the tokens they accept
+
+// REFUND_GAS_PRICE_RELAY takes the gas price and receiver quoted by the relay
+const REFUND_GAS_PRICE_RELAY = "relay"
+
+// refundRelayURL is the safe relay quoting refunds, the base of
+// GAS_ESTIMATION_URL
+var refundRelayURL = strings.TrimSuffix(GAS_ESTIMATION_URL, "/api/v2")
+
+// gasRefund is the refund of a proposal, a nil gasPrice is quoted by the relay
+type gasRefund struct {
+	gasToken common.Address
+	gasPrice *big.Int
+	receiver common.Address
+}
+
+// parseRefund reads the refund flags, nil when no -gas-price is given
+func parseRefund(gasToken, gasPrice, receiver string) (*gasRefund, error) {
+	if gasPrice == "" {
+		if gasToken != "" || receiver != "" {
+			return nil, errors.New("-gas-token and -refund-receiver need a -gas-price")
+		}
+		return nil, nil
+	}
+
+	refund := &gasRefund{}
+	if gasPrice != REFUND_GAS_PRICE_RELAY {
+		price, ok := new(big.Int).SetString(gasPrice, 10)
+		if !ok || price.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid -gas-price %q, expected a positive amount of the gas token per gas or %s", gasPrice, REFUND_GAS_PRICE_RELAY)
+		}
+		if !price.IsInt64() {
+			return nil, fmt.Errorf("-gas-price %s is too large", gasPrice)
+		}
+		refund.gasPrice = price
+	}
+	if gasToken != "" {
+		token, err := parseAddress(gasToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -gas-token: %w", err)
+		}
+		refund.gasToken = token
+	}
+	if receiver != "" {
+		addr, err := parseAddress(receiver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -refund-receiver: %w", err)
+		}
+		refund.receiver = addr
+	}
+	return refund, nil
+}
+
+// relayGasToken is a token the relay accepts refunds in
+type relayGasToken struct {
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+type relayGasTokenList struct {
+	Next    *string         `json:"next"`
+	Results []relayGasToken `json:"results"`
+}
+
+// relayGasTokens lists the tokens the relay accepts as gas token, besides the
+// native token
+func relayGasTokens() ([]relayGasToken, error) {
+	var tokens []relayGasToken
+	url := refundRelayURL + "/api/v1/tokens/?gas=true"
+	for url != "" {
+		var page relayGasTokenList
+		if err := getJSON(url, &page); err != nil {
+			return nil, fmt.Errorf("listing the relay gas tokens: %w", err)
+		}
+		tokens = append(tokens, page.Results...)
+		url = ""
+		if page.Next != nil {
+			url = *page.Next
+		}
+	}
+	return tokens, nil
+}
+
+// refundQuote is the relay estimation of a transaction refunded in a gas token
+type refundQuote struct {
+	SafeTxGas int64
+	BaseGas   int64
+	GasPrice  *big.Int
+	Receiver  common.Address
+}
+
+func quoteRefund(safe, to string, value int64, data []byte, operation uint8, token common.Address) (*refundQuote, error) {
+	var txData *string
+	if len(data) > 0 {
+		encoded := hexutil.Encode(data)
+		txData = &encoded
+	}
+	gasToken := token.Hex()
+	request := gasEstimationRequest{To: to, Value: value, Data: txData, Operation: int(operation), GasToken: &gasToken}
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpPost(refundRelayURL+"/api/v2/safes/"+safe+"/transactions/estimate/", "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	body, err := serviceBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("refund quote failed: %w", err)
+	}
+
+	var estimation gasEstimationResponse
+	if err := json.Unmarshal(body, &estimation); err != nil {
+		return nil, err
+	}
+	quote := &refundQuote{Receiver: common.HexToAddress(estimation.RefundReceiver)}
+	if quote.SafeTxGas, err = strconv.ParseInt(estimation.SafeTxGas, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid safeTxGas in the refund quote: %w", err)
+	}
+	baseGas := estimation.BaseGas
+	if baseGas == "" {
+		baseGas = estimation.DataGas
+	}
+	if quote.BaseGas, err = strconv.ParseInt(baseGas, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid baseGas in the refund quote: %w", err)
+	}
+	var ok bool
+	if quote.GasPrice, ok = new(big.Int).SetString(estimation.GasPrice, 10); !ok || !quote.GasPrice.IsInt64() {
+		return nil, fmt.Errorf("invalid gasPrice %q in the refund quote", estimation.GasPrice)
+	}
+	return quote, nil
+}
+
+// checkRelayGasToken refuses a gas token the relay doesn't accept
+func checkRelayGasToken(token common.Address) error {
+	if token == (common.Address{}) {
+		return nil
+	}
+	tokens, err := relayGasTokens()
+	if err != nil {
+		return err
+	}
+	var accepted []string
+	for _, t := range tokens {
+		if common.HexToAddress(t.Address) == token {
+			return nil
+		}
+		accepted = append(accepted, t.Symbol)
+	}
+	return fmt.Errorf("the relay doesn't accept %s as gas token, it accepts the native token and %s", displayAddress(token), strings.Join(accepted, ", "))
+}
+
+// maxRefund is the most a transaction refunds: gasPrice for safeTxGas, which
+// bounds the gas used, and baseGas
+func maxRefund(safeTxGas, baseGas int64, gasPrice *big.Int) *big.Int {
+	gas := big.NewInt(safeTxGas + baseGas)
+	return gas.Mul(gas, gasPrice)
+}
+
+// describeRefund returns the refund of a transaction in its gas token, empty
+// for transactions without one
+func describeRefund(client EthClient, safeTxGas, baseGas int64, gasPrice *big.Int, gasToken, receiver common.Address) string {
+	if gasPrice == nil || gasPrice.Sign() == 0 {
+		return ""
+	}
+	refund := maxRefund(safeTxGas, baseGas, gasPrice)
+	amount := formatWei(refund)
+	if gasToken != (common.Address{}) {
+		amount = refund.String() + " of token " + displayAddress(gasToken)
+		if symbol, decimals, err := tokenDecimals(client, gasToken); err == nil {
+			amount = formatUnits(refund, decimals, decimals) + " " + symbol
+		}
+	}
+	to := "the executor"
+	if receiver != (common.Address{}) {
+		to = displayAddress(receiver)
+	}
+	return fmt.Sprintf("up to %s to %s ((safeTxGas %d + baseGas %d) * gasPrice %s)", amount, to, safeTxGas, baseGas, gasPrice)
+}
+
+// txRefund is describeRefund for a proposed transaction
+func txRefund(client EthClient, tx *multisigTxResponse) string {
+	gasPrice, ok := new(big.Int).SetString(tx.GasPrice, 10)
+	if !ok {
+		return ""
+	}
+	return describeRefund(client, tx.SafeTxGas, tx.BaseGas, gasPrice, common.HexToAddress(tx.GasToken), common.HexToAddress(tx.RefundReceiver))
+}
+
+// checkRefundBalance warns when the safe can't pay the largest refund next to
+// the value it sends
+func checkRefundBalance(client EthClient, safe common.Address, value *big.Int, refund *big.Int, gasToken common.Address) {
+	needed := new(big.Int).Set(refund)
+	var balance *big.Int
+	var err error
+	if gasToken == (common.Address{}) {
+		needed.Add(needed, value)
+		balance, err = client.BalanceAt(opCtx, safe, nil)
+	} else {
+		balance, err = callUint(client, gasToken, "balanceOf(address)", safe)
+	}
+	if err != nil {
+		logger.Warn("refund balance not checked", "err", err)
+		return
+	}
+	if balance.Cmp(needed) < 0 {
+		logger.Warn("the safe may not cover the refund, execution fails with GS011/GS012", "balance", balance, "needed", needed)
+	}
+}
+
+// resolveRefund returns the refund of a proposal with the relay quote filled
+// in, the quote replacing a relay estimation of safeTxGas and baseGas as the
+// gas token changes the overhead; without a refund it is gasPrice 0
+func resolveRefund(refund *gasRefund, relayEstimate bool, safe, to string, amount int64, data []byte, operation uint8, safeTxGas *int64, baseGas *int64) (*gasRefund, error) {
+	if refund == nil {
+		return &gasRefund{gasPrice: new(big.Int)}, nil
+	}
+	resolved := *refund
+	if refund.gasPrice != nil && !relayEstimate {
+		return &resolved, nil
+	}
+
+	if refund.gasPrice == nil {
+		if err := checkRelayGasToken(refund.gasToken); err != nil {
+			return nil, err
+		}
+	}
+	quote, err := quoteRefund(safe, to, amount, data, operation, refund.gasToken)
+	if err != nil {
+		return nil, err
+	}
+	if relayEstimate {
+		*safeTxGas, *baseGas = quote.SafeTxGas, quote.BaseGas
+	}
+	if refund.gasPrice == nil {
+		resolved.gasPrice = quote.GasPrice
+		if refund.receiver == (common.Address{}) {
+			resolved.receiver = quote.Receiver
+		}
+	}
+	return &resolved, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// relays executing execTransaction on behalf of the tool, the safe relay is
+// sponsored by Safe with a limit of transactions per safe, gelato 1Balance
+// bills the sponsor of $GELATO_API_KEY
+const (
+	RELAY_SAFE   = "safe"
+	RELAY_GELATO = "gelato"
+)
+
+const (
+	SAFE_RELAY_URL   = "https://safe-client.safe.global/v1"
+	GELATO_RELAY_URL = "https://relay.gelato.digital"
+)
+
+const RELAY_POLL_INTERVAL = 5 * time.Second
+
+// final gelato task states, the others are pending
+const (
+	RELAY_TASK_SUCCESS   = "ExecSuccess"
+	RELAY_TASK_REVERTED  = "ExecReverted"
+	RELAY_TASK_CANCELLED = "Cancelled"
+)
+
+type relayTaskResponse struct {
+	TaskID string `json:"taskId"`
+}
+
+type relayTaskStatus struct {
+	Task struct {
+		TaskState        string  `json:"taskState"`
+		TransactionHash  *string `json:"transactionHash"`
+		LastCheckMessage string  `json:"lastCheckMessage"`
+	} `json:"task"`
+}
+
+type relayRemaining struct {
+	Remaining int64 `json:"remaining"`
+	Limit     int64 `json:"limit"`
+}
+
+// postJSONResult posts payload and decodes the json answer into response
+func postJSONResult(url string, payload, response interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := httpPost(url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s answered %s: %s", url, resp.Status, string(body))
+	}
+	return json.Unmarshal(body, response)
+}
+
+// RelayClient submits execTransaction calls to a relay and follows the
+// resulting tasks
+type RelayClient interface {
+	Submit(chainID *big.Int, safe common.Address, data []byte) (string, error)
+	TaskStatus(taskID string) (*relayTaskStatus, error)
+}
+
+func newRelayClient(relay string) (RelayClient, error) {
+	switch relay {
+	case RELAY_SAFE:
+		return &safeRelayClient{url: SAFE_RELAY_URL, gelatoTasks: gelatoTasks{url: GELATO_RELAY_URL}}, nil
+	case RELAY_GELATO:
+		apiKey := os.Getenv("GELATO_API_KEY")
+		if apiKey == "" {
+			return nil, errors.New("-relay " + RELAY_GELATO + " needs the 1Balance sponsor key in $GELATO_API_KEY")
+		}
+		return &gelatoRelayClient{apiKey: apiKey, gelatoTasks: gelatoTasks{url: GELATO_RELAY_URL}}, nil
+	default:
+		return nil, fmt.Errorf("unknown relay %q, expected %s or %s", relay, RELAY_SAFE, RELAY_GELATO)
+	}
+}
+
+// gelatoTasks reads task states, both relays run on gelato so their tasks
+// share the status endpoint
+type gelatoTasks struct {
+	url string
+}
+
+func (g gelatoTasks) TaskStatus(taskID string) (*relayTaskStatus, error) {
+	var status relayTaskStatus
+	if err := getJSON(g.url+"/tasks/status/"+taskID, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+type safeRelayClient struct {
+	url string
+	gelatoTasks
+}
+
+func (c *safeRelayClient) Submit(chainID *big.Int, safe common.Address, data []byte) (string, error) {
+	var remaining relayRemaining
+	if err := getJSON(fmt.Sprintf("%s/chains/%s/relay/%s", c.url, chainID, safe.Hex()), &remaining); err != nil {
+		return "", err
+	}
+	if remaining.Remaining <= 0 {
+		return "", fmt.Errorf("the safe relay limit of %d transactions of %s is used up, execute with a key or -relay %s", remaining.Limit, safe.Hex(), RELAY_GELATO)
+	}
+	fmt.Printf("safe relay: %d of %d sponsored transactions left\n", remaining.Remaining, remaining.Limit)
+
+	var task relayTaskResponse
+	request := map[string]string{"to": safe.Hex(), "data": hexutil.Encode(data)}
+	if err := postJSONResult(fmt.Sprintf("%s/chains/%s/relay", c.url, chainID), request, &task); err != nil {
+		return "", err
+	}
+	return task.TaskID, nil
+}
+
+// gelatoRelayClient sends sponsored calls billed to the 1Balance of apiKey
+type gelatoRelayClient struct {
+	apiKey string
+	gelatoTasks
+}
+
+func (c *gelatoRelayClient) Submit(chainID *big.Int, safe common.Address, data []byte) (string, error) {
+	var task relayTaskResponse
+	request := map[string]interface{}{
+		"chainId":       chainID.Int64(),
+		"target":        safe.Hex(),
+		"data":          hexutil.Encode(data),
+		"sponsorApiKey": c.apiKey,
+	}
+	if err := postJSONResult(c.url+"/relays/v2/sponsored-call", request, &task); err != nil {
+		return "", err
+	}
+	return task.TaskID, nil
+}
+
+// waitForRelayTask polls the relay task until it is mined or given up
+func waitForRelayTask(relay RelayClient, taskID string) (common.Hash, error) {
+	last := ""
+	for {
+		status, err := relay.TaskStatus(taskID)
+		if err != nil {
+			return common.Hash{}, err
+		}
+
+		task := status.Task
+		if task.TaskState != last {
+			fmt.Println("relay task:", task.TaskState)
+			last = task.TaskState
+		}
+		switch task.TaskState {
+		case RELAY_TASK_SUCCESS, RELAY_TASK_REVERTED:
+			if task.TransactionHash == nil {
+				return common.Hash{}, fmt.Errorf("relay task %s is %s without a transaction hash", taskID, task.TaskState)
+			}
+			return common.HexToHash(*task.TransactionHash), nil
+		case RELAY_TASK_CANCELLED:
+			return common.Hash{}, fmt.Errorf("relay task %s was cancelled: %s", taskID, task.LastCheckMessage)
+		}
+
+		if err := sleep(RELAY_POLL_INTERVAL); err != nil {
+			return common.Hash{}, fmt.Errorf("relay task %s not executed yet: %w", taskID, err)
+		}
+	}
+}
+
+// relayExecution executes through the relay, returning the receipt once the
+// task is mined or nil when not waiting for it
+func relayExecution(client EthClient, relay RelayClient, chainID *big.Int, safe common.Address, data []byte, wait bool) (*types.Receipt, error) {
+	taskID, err := relay.Submit(chainID, safe, data)
+	if err != nil {
+		return nil, err
+	}
+	if taskID == "" {
+		return nil, errors.New("relay answered without a task id")
+	}
+	fmt.Println("relay task:", taskID)
+	currentOperation.Submitted = true
+
+	if !wait {
+		fmt.Println("not waiting for the relay, follow it at", GELATO_RELAY_URL+"/tasks/status/"+taskID)
+		return nil, nil
+	}
+
+	currentOperation.step("waiting for relay")
+	hash, err := waitForRelayTask(relay, taskID)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("relay transaction", "txHash", hash.Hex())
+	currentOperation.TxHash = hash.Hex()
+
+	receipt, err := pollReceipts(client, hash)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		signedTx, _, err := client.TransactionByHash(opCtx, hash)
+		if err != nil {
+			return receipt, fmt.Errorf("transaction %s reverted", hash.Hex())
+		}
+		return receipt, fmt.Errorf("transaction %s reverted: %s", hash.Hex(), replayRevert(client, signedTx, receipt))
+	}
+	return receipt, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestRelaySubmit(t *testing.T) {
+	var request map[string]string
+	srv := useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/relay/"+testSafe):
+			w.Write([]byte(`{"remaining":3,"limit":5}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/chains/4/relay"):
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &request)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"taskId":"0xtask"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	relay := &safeRelayClient{url: srv.URL}
+	taskID, err := relay.Submit(big.NewInt(4), common.HexToAddress(testSafe), []byte{0x6a, 0x76, 0x12, 0x02})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if taskID != "0xtask" {
+		t.Errorf("Submit = %q, want 0xtask", taskID)
+	}
+	if request["to"] != testSafe || request["data"] != "0x6a761202" {
+		t.Errorf("relay received %v, want the execTransaction call of %s", request, testSafe)
+	}
+}
+
+func TestRelayLimitUsedUp(t *testing.T) {
+	srv := useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			t.Errorf("submitted despite the used up limit")
+		}
+		w.Write([]byte(`{"remaining":0,"limit":5}`))
+	}))
+
+	relay := &safeRelayClient{url: srv.URL}
+	if _, err := relay.Submit(big.NewInt(4), common.HexToAddress(testSafe), nil); err == nil || !strings.Contains(err.Error(), "used up") {
+		t.Errorf("Submit = %v, want the used up limit", err)
+	}
+}
+
+func TestRelayExecutionReceipt(t *testing.T) {
+	txHash := common.HexToHash("0x" + strings.Repeat("ab", 32))
+	client := newTestRPC(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_getTransactionReceipt": func(params []json.RawMessage) (interface{}, error) {
+			return map[string]interface{}{
+				"transactionHash":   txHash.Hex(),
+				"blockHash":         common.HexToHash("0x01").Hex(),
+				"blockNumber":       "0x10",
+				"transactionIndex":  "0x0",
+				"status":            "0x1",
+				"gasUsed":           "0x5208",
+				"cumulativeGasUsed": "0x5208",
+				"logsBloom":         "0x" + strings.Repeat("00", 256),
+				"logs":              []interface{}{},
+				"contractAddress":   nil,
+			}, nil
+		},
+	})
+
+	relay := &fakeRelay{txHash: txHash, state: RELAY_TASK_SUCCESS}
+	receipt, err := relayExecution(client, relay, big.NewInt(4), common.HexToAddress(testSafe), []byte{0x6a}, true)
+	if err != nil {
+		t.Fatalf("relayExecution: %v", err)
+	}
+	if receipt.TxHash != txHash || receipt.Status != types.ReceiptStatusSuccessful || receipt.BlockNumber.Int64() != 16 {
+		t.Errorf("relayExecution receipt = %+v, want the successful receipt of %s", receipt, txHash.Hex())
+	}
+	if len(relay.submitted) != 1 {
+		t.Errorf("%d submissions, want 1", len(relay.submitted))
+	}
+}
+
+func TestRelayTaskCancelled(t *testing.T) {
+	relay := &fakeRelay{state: RELAY_TASK_CANCELLED}
+	if _, err := waitForRelayTask(relay, "task-1"); err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("waitForRelayTask = %v, want the cancellation", err)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// reviewArtifact holds every field of the safe transaction and the domain
+// it is hashed in, so the safeTxHash it attests can be reproduced from it
+type reviewArtifact struct {
+	Safe           string   `json:"safe"`
+	ChainID        int64    `json:"chainId"`
+	SafeVersion    string   `json:"safeVersion"`
+	SafeTxHash     string   `json:"safeTxHash"`
+	Nonce          int64    `json:"nonce"`
+	To             string   `json:"to"`
+	Value          string   `json:"value"`
+	Data           string   `json:"data"`
+	Operation      uint8    `json:"operation"`
+	SafeTxGas      int64    `json:"safeTxGas"`
+	BaseGas        int64    `json:"baseGas"`
+	GasPrice       string   `json:"gasPrice"`
+	GasToken       string   `json:"gasToken"`
+	RefundReceiver string   `json:"refundReceiver"`
+	Intent         []string `json:"intent"`
+	Variables      []string `json:"variables,omitempty"`
+	Simulation     string   `json:"simulation"`
+	Policy         string   `json:"policy"`
+	Reviewer       string   `json:"reviewer"`
+}
+
+type signedReviewArtifact struct {
+	Artifact  reviewArtifact `json:"artifact"`
+	Hash      string         `json:"hash"`
+	Signature string         `json:"signature"`
+}
+
+// hash is computed over the canonical (compact) json encoding of the artifact
+func (a *reviewArtifact) hash() (common.Hash, error) {
+	encoded, err := json.Marshal(a)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// signingHash is the EIP-191 prefixed artifact hash the reviewer signs, no
+// signature of it can be submitted as one over a safeTxHash
+func signingHash(hash common.Hash) common.Hash {
+	return common.BytesToHash(accounts.TextHash(hash.Bytes()))
+}
+
+// safeTxHash hashes the transaction fields of the artifact in its domain
+func (a *reviewArtifact) safeTxHash() (common.Hash, error) {
+	tx := &multisigTxResponse{
+		Safe:           a.Safe,
+		To:             a.To,
+		Value:          a.Value,
+		Data:           &a.Data,
+		Operation:      a.Operation,
+		SafeTxGas:      a.SafeTxGas,
+		BaseGas:        a.BaseGas,
+		GasPrice:       a.GasPrice,
+		GasToken:       a.GasToken,
+		RefundReceiver: a.RefundReceiver,
+		Nonce:          a.Nonce,
+	}
+	return tx.hash(a.ChainID, a.SafeVersion)
+}
+
+func (a *reviewArtifact) markdown(hash common.Hash, signature []byte) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Review of safe transaction %s\n\n", a.SafeTxHash)
+	fmt.Fprintf(&b, "| Field | Value |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Safe | `%s` |\n", a.Safe)
+	fmt.Fprintf(&b, "| Nonce | %d |\n", a.Nonce)
+	fmt.Fprintf(&b, "| To | `%s` |\n", a.To)
+	value, ok := new(big.Int).SetString(a.Value, 10)
+	if ok {
+		fmt.Fprintf(&b, "| Value | %s |\n", formatWei(value))
+	} else {
+		fmt.Fprintf(&b, "| Value | %s wei |\n", a.Value)
+	}
+	fmt.Fprintf(&b, "| Operation | %d |\n", a.Operation)
+	fmt.Fprintf(&b, "| SafeTxGas | %d |\n", a.SafeTxGas)
+	fmt.Fprintf(&b, "| BaseGas | %d |\n", a.BaseGas)
+	fmt.Fprintf(&b, "| GasPrice | %s |\n", a.GasPrice)
+	fmt.Fprintf(&b, "| GasToken | `%s` |\n", a.GasToken)
+	fmt.Fprintf(&b, "| RefundReceiver | `%s` |\n", a.RefundReceiver)
+	fmt.Fprintf(&b, "| Chain | %d, safe version %s |\n", a.ChainID, a.SafeVersion)
+	fmt.Fprintf(&b, "| Data | `%s` |\n\n", a.Data)
+
+	fmt.Fprintf(&b, "## Decoded intent\n\n")
+	for _, line := range a.Intent {
+		fmt.Fprintf(&b, "- %s\n", line)
+	}
+
+	if len(a.Variables) > 0 {
+		fmt.Fprintf(&b, "\n## Variables\n\n")
+		for _, line := range a.Variables {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n## Simulation\n\n%s\n", a.Simulation)
+	fmt.Fprintf(&b, "\n## Policy\n\n%s\n", a.Policy)
+
+	fmt.Fprintf(&b, "\n## Attestation\n\n")
+	fmt.Fprintf(&b, "- Reviewer: `%s`\n", a.Reviewer)
+	fmt.Fprintf(&b, "- Artifact hash: `%s`\n", hash.Hex())
+	fmt.Fprintf(&b, "- Signature: `%s`\n", hexutil.Encode(signature))
+
+	return b.String()
+}
+
+// writeReviewArtifact signs the prefixed artifact hash with the reviewer key and writes
+// <safeTxHash>.json and <safeTxHash>.md to dir, returning the artifact hash
+func writeReviewArtifact(dir string, artifact *reviewArtifact, reviewer hashSigner) (common.Hash, error) {
+	hash, err := artifact.hash()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	signature, err := reviewer.SignHash(signingHash(hash))
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	signed := signedReviewArtifact{
+		Artifact:  *artifact,
+		Hash:      hash.Hex(),
+		Signature: hexutil.Encode(signature),
+	}
+
+	encoded, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return common.Hash{}, err
+	}
+
+	base := filepath.Join(dir, artifact.SafeTxHash)
+	if err := ioutil.WriteFile(base+".json", encoded, 0o644); err != nil {
+		return common.Hash{}, err
+	}
+	if err := ioutil.WriteFile(base+".md", []byte(artifact.markdown(hash, signature)), 0o644); err != nil {
+		return common.Hash{}, err
+	}
+
+	return hash, nil
+}
+
+// verifyReviewArtifact checks a signed artifact file and returns its reviewer
+func verifyReviewArtifact(path string) (common.Address, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	var signed signedReviewArtifact
+	if err := json.Unmarshal(content, &signed); err != nil {
+		return common.Address{}, err
+	}
+
+	hash, err := signed.Artifact.hash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	if hash.Hex() != signed.Hash {
+		return common.Address{}, fmt.Errorf("artifact hash mismatch: recorded %s, computed %s", signed.Hash, hash.Hex())
+	}
+	txHash, err := signed.Artifact.safeTxHash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	if txHash != common.HexToHash(signed.Artifact.SafeTxHash) {
+		return common.Address{}, fmt.Errorf("artifact attests %s but its transaction fields hash to %s", signed.Artifact.SafeTxHash, txHash.Hex())
+	}
+
+	signature, err := hexutil.Decode(signed.Signature)
+	if err != nil || len(signature) != 65 || signature[64] < 27 || signature[64] > 28 {
+		return common.Address{}, fmt.Errorf("invalid artifact signature")
+	}
+
+	reviewer, err := recoverSigner(signingHash(hash), signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if reviewer != common.HexToAddress(signed.Artifact.Reviewer) {
+		return common.Address{}, fmt.Errorf("artifact signed by %s, not by reviewer %s", reviewer.Hex(), signed.Artifact.Reviewer)
+	}
+
+	return reviewer, nil
+}
+
+func newReviewArtifact(tx *core.GnosisSafeTx, chainID int64, version string, safeTxHash common.Hash, reviewer common.Address, pol *policy) *reviewArtifact {
+	policyVerdict := "no policy configured"
+	if pol != nil {
+		policyVerdict = "passed"
+	}
+
+	var data []byte
+	if tx.Data != nil {
+		data = *tx.Data
+	}
+	value := (*big.Int)(&tx.Value)
+	return &reviewArtifact{
+		Safe:           tx.Safe.Address().Hex(),
+		ChainID:        chainID,
+		SafeVersion:    version,
+		SafeTxHash:     safeTxHash.Hex(),
+		Nonce:          tx.Nonce.Int64(),
+		To:             tx.To.Address().Hex(),
+		Value:          value.String(),
+		Data:           hexutil.Encode(data),
+		Operation:      tx.Operation,
+		SafeTxGas:      tx.SafeTxGas.Int64(),
+		BaseGas:        tx.BaseGas.Int64(),
+		GasPrice:       (*big.Int)(&tx.GasPrice).String(),
+		GasToken:       tx.GasToken.Hex(),
+		RefundReceiver: tx.RefundReceiver.Hex(),
+		Intent:         describeTx(tx.To.Address(), value, data, tx.Operation),
+		Simulation:     "not performed",
+		Policy:         policyVerdict,
+		Reviewer:       reviewer.Hex(),
+	}
+}
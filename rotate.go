@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// rotationMessage is the text the new owner signs with personal_sign, proving
+// it holds its key before any owner is replaced by it
+func rotationMessage(safe, oldOwner, newOwner common.Address, chainID int64, challenge string) string {
+	return fmt.Sprintf("I control %s and accept replacing owner %s of Safe %s on chain %d. Challenge: %s",
+		newOwner.Hex(), oldOwner.Hex(), safe.Hex(), chainID, challenge)
+}
+
+// verifyRotation checks the new owner signed the rotation message
+func verifyRotation(safe, oldOwner, newOwner common.Address, challenge, signature string) error {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return fmt.Errorf("invalid new owner signature: %w", err)
+	}
+	chainID, err := serviceChain()
+	if err != nil {
+		return err
+	}
+	message := rotationMessage(safe, oldOwner, newOwner, chainID, challenge)
+	signer, err := recoverSigner(common.BytesToHash(accounts.TextHash([]byte(message))), sig)
+	if err != nil {
+		return err
+	}
+	if signer != newOwner {
+		return fmt.Errorf("the rotation message is signed by %s, not the new owner %s", signer.Hex(), newOwner.Hex())
+	}
+	return nil
+}
+
+// trackProposal follows the confirmations of a proposal until it is executed
+// or the operation times out
+func trackProposal(safeTxHash string, interval time.Duration) (*multisigTxResponse, error) {
+	last := -1
+	for {
+		tx, err := getMultisigTransaction(safeTxHash)
+		if err != nil {
+			return nil, err
+		}
+		if len(tx.Confirmations) != last {
+			last = len(tx.Confirmations)
+			fmt.Println("confirmations:", confirmationBar(int64(last), tx.ConfirmationsRequired))
+		}
+		if tx.IsExecuted {
+			if tx.TransactionHash != nil {
+				fmt.Println("executed in", *tx.TransactionHash)
+			}
+			return tx, nil
+		}
+		if err := sleep(interval); err != nil {
+			return nil, fmt.Errorf("%s not executed yet with %d of %d confirmations: %w", safeTxHash, last, tx.ConfirmationsRequired, err)
+		}
+	}
+}
+
+// checkRotated verifies the rotation reached the chain
+func checkRotated(client EthClient, safe, oldOwner, newOwner common.Address) error {
+	state, err := readSafeState(client, safe, nil)
+	if err != nil {
+		return err
+	}
+	if !state.isOwner(newOwner) || state.isOwner(oldOwner) {
+		return fmt.Errorf("owners of %s after execution are %v, the rotation didn't apply", safe.Hex(), state.Owners)
+	}
+	fmt.Println("owner", displayAddress(oldOwner), "replaced by", displayAddress(newOwner))
+	return nil
+}
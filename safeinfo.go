@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// the singleton address is the first storage slot of the proxy
+var masterCopySlot = common.Hash{}
+
+type onchainSafeInfo struct {
+	*onchainState
+	MasterCopy common.Address
+	Modules    []common.Address
+	Version    string
+}
+
+func readSafeInfoOnchain(client EthClient, safe common.Address) (*onchainSafeInfo, error) {
+	state, err := readSafeState(client, safe, nil)
+	if err != nil {
+		return nil, err
+	}
+	block := new(big.Int).SetUint64(state.Block)
+	info := &onchainSafeInfo{onchainState: state}
+
+	singleton, err := client.StorageAt(opCtx, safe, masterCopySlot, block)
+	if err != nil {
+		return nil, err
+	}
+	info.MasterCopy = common.BytesToAddress(singleton)
+
+	call, err := encodeCall("getModulesPaginated(address,uint256)", sentinelOwner, big.NewInt(100))
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.CallContract(opCtx, ethereum.CallMsg{To: &safe, Data: call}, block)
+	if err != nil {
+		return nil, err
+	}
+	args, err := methodArguments("(address[],address)")
+	if err != nil {
+		return nil, err
+	}
+	values, err := args.UnpackValues(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid getModulesPaginated response: %w", err)
+	}
+	info.Modules = values[0].([]common.Address)
+
+	result, err = callAt(client, safe, "VERSION()", block)
+	if err != nil {
+		return nil, err
+	}
+	args, err = methodArguments("(string)")
+	if err != nil {
+		return nil, err
+	}
+	if values, err = args.UnpackValues(result); err != nil {
+		return nil, fmt.Errorf("invalid VERSION response: %w", err)
+	}
+	info.Version = values[0].(string)
+
+	return info, nil
+}
+
+func joinAddresses(addresses []common.Address) string {
+	hex := make([]string, len(addresses))
+	for i, address := range addresses {
+		hex[i] = address.Hex()
+	}
+	return strings.Join(hex, ",")
+}
+
+func checksummed(addresses []string) []common.Address {
+	result := make([]common.Address, len(addresses))
+	for i, address := range addresses {
+		result[i] = common.HexToAddress(address)
+	}
+	return result
+}
+
+// printSafeInfo prints the service view of the safe, cross-checked against
+// the onchain state when given
+func printSafeInfo(info *safeNonceResponse, onchain *onchainSafeInfo) int {
+	mismatches := 0
+	row := func(name, service, chain string) {
+		if onchain == nil {
+			fmt.Printf("%-16s %s\n", name+":", service)
+			return
+		}
+		status := "ok"
+		if service != chain {
+			status = "MISMATCH onchain " + chain
+			mismatches++
+		}
+		fmt.Printf("%-16s %s  [%s]\n", name+":", service, status)
+	}
+
+	var chain onchainSafeInfo
+	if onchain != nil {
+		chain = *onchain
+	} else {
+		chain.onchainState = &onchainState{}
+	}
+
+	row("address", common.HexToAddress(info.Address).Hex(), common.HexToAddress(info.Address).Hex())
+	row("version", info.Version, chain.Version)
+	row("masterCopy", common.HexToAddress(info.MasterCopy).Hex(), chain.MasterCopy.Hex())
+	row("nonce", fmt.Sprint(info.Nonce), fmt.Sprint(chain.Nonce))
+	row("threshold", fmt.Sprint(info.Threshold), fmt.Sprint(chain.Threshold))
+	row("owners", joinAddresses(checksummed(info.Owners)), joinAddresses(chain.Owners))
+	row("modules", joinAddresses(checksummed(info.Modules)), joinAddresses(chain.Modules))
+	row("guard", common.HexToAddress(info.Guard).Hex(), chain.Guard.Hex())
+	row("fallbackHandler", common.HexToAddress(info.FallbackHandler).Hex(), chain.FallbackHandler.Hex())
+
+	if onchain != nil {
+		fmt.Println("checked against block", onchain.Block, onchain.BlockHash.Hex())
+	}
+	return mismatches
+}
+
+// verifyOnchainRPC is set with the global -verify-onchain flag or
+// $GNOSIS_TX_VERIFY_ONCHAIN, every safe state read from the service is then
+// checked against the contract through it
+var verifyOnchainRPC = os.Getenv("GNOSIS_TX_VERIFY_ONCHAIN")
+
+// verifyClient is dialed on the first verification
+var verifyClient EthClient
+
+// safeInfoMismatches lists the fields of the service state differing from the
+// chain; owners and modules are compared as sets as only their order may differ
+func safeInfoMismatches(info *safeNonceResponse, onchain *onchainSafeInfo) []string {
+	var mismatches []string
+	check := func(name, service, chain string) {
+		if service != chain {
+			mismatches = append(mismatches, fmt.Sprintf("%s %s onchain %s", name, service, chain))
+		}
+	}
+	check("nonce", fmt.Sprint(info.Nonce), fmt.Sprint(onchain.Nonce))
+	check("threshold", fmt.Sprint(info.Threshold), fmt.Sprint(onchain.Threshold))
+	check("owners", joinAddresses(sortedAddresses(checksummed(info.Owners))), joinAddresses(sortedAddresses(onchain.Owners)))
+	check("modules", joinAddresses(sortedAddresses(checksummed(info.Modules))), joinAddresses(sortedAddresses(onchain.Modules)))
+	check("guard", common.HexToAddress(info.Guard).Hex(), onchain.Guard.Hex())
+	check("fallbackHandler", common.HexToAddress(info.FallbackHandler).Hex(), onchain.FallbackHandler.Hex())
+	return mismatches
+}
+
+func sortedAddresses(addresses []common.Address) []common.Address {
+	sorted := append([]common.Address(nil), addresses...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Bytes(), sorted[j].Bytes()) < 0
+	})
+	return sorted
+}
+
+// verifyOnchain aborts when the safe state returned by the service doesn't
+// match the contract, an indexer lagging or serving another chain
+func verifyOnchain(info *safeNonceResponse) error {
+	if verifyClient == nil {
+		client, err := dialRPC(verifyOnchainRPC)
+		if err != nil {
+			return fmt.Errorf("-verify-onchain: %w", err)
+		}
+		verifyClient = client
+	}
+	onchain, err := readSafeInfoOnchain(verifyClient, common.HexToAddress(info.Address))
+	if err != nil {
+		return fmt.Errorf("verifying the safe state onchain: %w", err)
+	}
+	mismatches := safeInfoMismatches(info, onchain)
+	if len(mismatches) == 0 {
+		logger.Debug("safe state verified onchain", "safe", info.Address, "block", onchain.Block)
+		return nil
+	}
+	return &remediationError{
+		Code: "DRF_INDEXER_MISMATCH",
+		Hint: "the service is behind or wrong about the safe, wait for it to index the latest blocks or check -service and the RPC are on the same chain",
+		Err:  fmt.Errorf("service state of %s doesn't match the chain at block %d: %s", info.Address, onchain.Block, strings.Join(mismatches, ", ")),
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// contract constants of the safe, the type hashes its EIP-712 encoding uses
+const (
+	safeTxTypeHash        = "0xbb8310d486368db6bd6f849402fdd73ad53d316b5a4b2644ad6efe0f941286d8"
+	safeTxDataGasTypeHash = "0x14d461bc7412367e924637b363c7bf29b8f47e2f84869f4426e5633d8af47b20"
+	domainTypeHash        = "0x035aff83d86937d35b32e04f0ddc6ff469290eef2f1b692d8a815c89404d4749"
+	domainChainTypeHash   = "0x47e79534a245952e8b16893a336b85a3d9ea9fa8c573f3d803afb92a79469218"
+)
+
+func TestSafeTxTypeHashes(t *testing.T) {
+	tx, err := (&multisigTxResponse{Safe: testSafe, To: testRecipient, Value: "0", GasPrice: "0"}).gnosisSafeTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		version         string
+		domain, primary string
+	}{
+		{"0.1.0", domainTypeHash, safeTxDataGasTypeHash},
+		{"1.1.1", domainTypeHash, safeTxTypeHash},
+		{"1.3.0", domainChainTypeHash, safeTxTypeHash},
+		{"1.4.1", domainChainTypeHash, safeTxTypeHash},
+	}
+	for _, tt := range tests {
+		typedData, err := safeTxTypedData(tx, 1, tt.version)
+		if err != nil {
+			t.Fatalf("safeTxTypedData(%q): %v", tt.version, err)
+		}
+		if got := common.BytesToHash(typedData.TypeHash("EIP712Domain")).Hex(); got != tt.domain {
+			t.Errorf("domain type hash of %q = %s, want %s", tt.version, got, tt.domain)
+		}
+		if got := common.BytesToHash(typedData.TypeHash("SafeTx")).Hex(); got != tt.primary {
+			t.Errorf("SafeTx type hash of %q = %s, want %s", tt.version, got, tt.primary)
+		}
+	}
+}
+
+const (
+	// transfer(0x3a1c...b8c0, 1000000)
+	goldenTransfer = "0xa9059cbb0000000000000000000000003a1ce38d3c5a6a6d3e9d52c9d8fa27b9a1e3b8c0" +
+		"00000000000000000000000000000000000000000000000000000000000f4240"
+	goldenWETH      = "0xc778417E063141139Fce010982780140Aa0cD5Ab"
+	goldenMultiSend = "0xA238CBeb142c10Ef7Ad8442C6D1f9E89e07e7761"
+	maxUint256      = "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// safe transactions of every domain and encoding variant with their
+// safeTxHash, any change of the hashing has to reproduce them exactly
+var goldenSafeTxs = []struct {
+	name    string
+	version string
+	chainID int64
+	tx      multisigTxResponse
+	want    string
+}{
+	{
+		name: "ether transfer", version: "1.1.1", chainID: 1,
+		tx:   multisigTxResponse{To: testRecipient, Value: "1000000000000000000", GasPrice: "0", Nonce: 0},
+		want: "0xb29ef09da8df8bb0127c27fe461dd2fd118e1bbd4f7a9de8ec72d43b7a80f5d9",
+	},
+	{
+		name: "token transfer with refund", version: "1.2.0", chainID: 4,
+		tx: multisigTxResponse{To: goldenWETH, Value: "0", Data: stringPtr(goldenTransfer), SafeTxGas: 60000, BaseGas: 30000,
+			GasToken: goldenWETH, GasPrice: "1000000000", RefundReceiver: testRecipient, Nonce: 42},
+		want: "0xb43fb0af6274c41cc712b05a3cfa93b8effbd8cf382ec7a31f9b54f6bd0b3a46",
+	},
+	{
+		name: "multisend delegatecall on mainnet", version: "1.3.0", chainID: 1,
+		tx:   multisigTxResponse{To: goldenMultiSend, Value: "0", Data: stringPtr("0x8d80ff0a"), Operation: 1, GasPrice: "0", Nonce: 7},
+		want: "0xab5484d211c07aabd6078bcdf30ec6c04f2181a54be7ad0005425cd739acde79",
+	},
+	{
+		name: "multisend delegatecall on rinkeby", version: "1.3.0", chainID: 4,
+		tx:   multisigTxResponse{To: goldenMultiSend, Value: "0", Data: stringPtr("0x8d80ff0a"), Operation: 1, GasPrice: "0", Nonce: 7},
+		want: "0x1174946228913ee41d63807ed2e549291df0f32a9761b0cdb806950ea91f2e59",
+	},
+	{
+		name: "l2 safe on gnosis chain", version: "1.3.0+L2", chainID: 100,
+		tx:   multisigTxResponse{To: testRecipient, Value: "250000000000000000", SafeTxGas: 45000, GasPrice: "0", Nonce: 123},
+		want: "0x3683dd6dde5ca13ed6c4bf79cf7401cab77d4b902e500f54089eaecb05a486ce",
+	},
+	{
+		name: "max value on polygon", version: "1.4.1", chainID: 137,
+		tx:   multisigTxResponse{To: testRecipient, Value: maxUint256, Data: stringPtr(goldenTransfer), GasPrice: "0", Nonce: 1},
+		want: "0x1240b6d78b835e615e3df9a24e0bdcdca2427fe340bbde3b636e847cc7fe63ad",
+	},
+	{
+		name: "gas price refund", version: "1.0.0", chainID: 4,
+		tx:   multisigTxResponse{To: testRecipient, Value: "1", SafeTxGas: 21000, BaseGas: 50000, GasPrice: "2000000000", Nonce: 3},
+		want: "0x58a1253be61e5337cca041d76feb58f9ba107f0894c83292447c0bf4dd054c2a",
+	},
+	{
+		name: "dataGas of pre 1.0 safes", version: "0.1.0", chainID: 4,
+		tx:   multisigTxResponse{To: testRecipient, Value: "1", SafeTxGas: 21000, BaseGas: 50000, GasPrice: "2000000000", Nonce: 3},
+		want: "0xf7d502472506dc99dc4928116243f1fcf7675b161009ced305617336cd47d889",
+	},
+}
+
+func TestGoldenSafeTxHashes(t *testing.T) {
+	for _, tt := range goldenSafeTxs {
+		tx := tt.tx
+		tx.Safe = testSafe
+		if tx.GasToken == "" {
+			tx.GasToken = ZERO_ADDR
+		}
+		if tx.RefundReceiver == "" {
+			tx.RefundReceiver = ZERO_ADDR
+		}
+		gnosisSafeTx, err := tx.gnosisSafeTx()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := safeTxHash(gnosisSafeTx, tt.chainID, tt.version)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != common.HexToHash(tt.want) {
+			t.Errorf("%s: safeTxHash(%d, %q) = %s, want %s", tt.name, tt.chainID, tt.version, got.Hex(), tt.want)
+		}
+	}
+}
+
+func TestSafeTxHashNeedsVersion(t *testing.T) {
+	// the domain depends on the version, a transaction of an unknown one
+	// isn't hashed as any of them
+	tx := goldenSafeTxs[0].tx
+	tx.Safe, tx.GasToken, tx.RefundReceiver = testSafe, ZERO_ADDR, ZERO_ADDR
+	for _, version := range []string{"", "unknown"} {
+		if got, err := tx.hash(1, version); err == nil {
+			t.Errorf("hash(1, %q) = %s, want an error", version, got.Hex())
+		}
+	}
+	got, err := tx.hash(1, goldenSafeTxs[0].version)
+	if err != nil || got != common.HexToHash(goldenSafeTxs[0].want) {
+		t.Errorf("hash(1, %q) = %s, %v, want %s", goldenSafeTxs[0].version, got.Hex(), err, goldenSafeTxs[0].want)
+	}
+}
+
+func TestExportTypedData(t *testing.T) {
+	tx := &multisigTxResponse{Safe: testSafe, To: goldenWETH, Value: "5", Data: stringPtr(goldenTransfer), GasPrice: "0", Nonce: 3}
+	for _, version := range []string{"1.1.1", "1.3.0", "1.4.1+L2"} {
+		want, err := tx.hash(serviceChainID, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := exportTypedData(tx, serviceChainID, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// what a wallet hashes after reading the payload back, its numeric
+		// chainId read as apitypes expects it
+		var payload walletTypedData
+		if err := json.Unmarshal(encoded, &payload); err != nil {
+			t.Fatal(err)
+		}
+		chainID, ok := payload.Domain["chainId"]
+		if ok != versionAtLeast(version, 1, 3) {
+			t.Errorf("typed data exported for %s has domain %v", version, payload.Domain)
+		}
+		typedData := apitypes.TypedData{Types: payload.Types, PrimaryType: payload.PrimaryType, Message: payload.Message}
+		typedData.Domain.VerifyingContract, _ = payload.Domain["verifyingContract"].(string)
+		if ok {
+			typedData.Domain.ChainId = math.NewHexOrDecimal256(int64(chainID.(float64)))
+		}
+		digest, err := encodeTypedData(typedData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := crypto.Keccak256Hash(digest); got != want {
+			t.Errorf("typed data exported for %s hashes to %s, want %s", version, got.Hex(), want.Hex())
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type aboutResponse struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	APIVersion string `json:"apiVersion"`
+}
+
+func getServiceAbout() (*aboutResponse, error) {
+	resp, err := httpGet(serviceEndpoint("/about/"))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := serviceBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("service answered %w", err)
+	}
+
+	var data aboutResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// getServiceChainID reads the chain the transaction service indexes from the
+// node it is connected to
+func getServiceChainID() (int64, error) {
+	resp, err := httpGet(serviceEndpoint("/about/ethereum-rpc/"))
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := serviceBody(resp)
+	if err != nil {
+		return 0, fmt.Errorf("service answered %w", err)
+	}
+
+	var data struct {
+		ChainID int64 `json:"chain_id"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return 0, err
+	}
+	if data.ChainID == 0 {
+		return 0, fmt.Errorf("%s reports no chain id", serviceEndpoint("/about/ethereum-rpc/"))
+	}
+	return data.ChainID, nil
+}
+
+type selfTestCheck struct {
+	Name   string
+	Detail string
+	Err    error
+	Skip   bool
+}
+
+type selfTestOptions struct {
+	safe        string
+	rpc         string
+	signersFile string
+	policyFile  string
+}
+
+// runSelfTest checks every part of the configured stack, continuing past
+// failures so the whole matrix is reported
+func runSelfTest(opts *selfTestOptions) []selfTestCheck {
+	var checks []selfTestCheck
+	check := func(name string, fn func() (string, error)) {
+		detail, err := fn()
+		checks = append(checks, selfTestCheck{Name: name, Detail: detail, Err: err})
+	}
+	skip := func(name, reason string) {
+		checks = append(checks, selfTestCheck{Name: name, Detail: reason, Skip: true})
+	}
+
+	check("transaction service", func() (string, error) {
+		v, err := negotiateService()
+		if err != nil {
+			return "", err
+		}
+		detail := fmt.Sprintf("%s %s at %s", v.Name, v.Version, serviceURL)
+		if serviceChainID != 0 {
+			detail += " on " + networkName(serviceChainID)
+		}
+		for feature, min := range serviceFeatures {
+			if ok, known := serviceVersionAtLeast(v.Version, min); known && !ok {
+				detail += fmt.Sprintf(", no %s (needs %s)", feature, min)
+			}
+		}
+		return detail, nil
+	})
+
+	var info *safeNonceResponse
+	check("safe indexed", func() (string, error) {
+		var err error
+		if info, err = getSafeInfo(opts.safe); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("version %s, threshold %d of %d", info.Version, info.Threshold, len(info.Owners)), nil
+	})
+
+	if opts.rpc == "" {
+		skip("rpc chain id", "no -rpc given")
+		skip("safe deployed", "no -rpc given")
+	} else {
+		check("rpc chain id", func() (string, error) {
+			client, err := dialRPC(opts.rpc)
+			if err != nil {
+				return "", err
+			}
+			defer client.Close()
+
+			// dialRPC refuses an rpc on another chain than the service
+			chainID, err := client.ChainID(opCtx)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s (%s)", chainID, networkName(chainID.Int64())), nil
+		})
+
+		check("safe deployed", func() (string, error) {
+			contract, err := isContract(opts.rpc, common.HexToAddress(opts.safe))
+			if err != nil {
+				return "", err
+			}
+			if !contract {
+				return "", fmt.Errorf("no code at %s", opts.safe)
+			}
+			return "code found", nil
+		})
+	}
+
+	configs, err := loadSignersConfig(opts.signersFile)
+	switch {
+	case err != nil:
+		checks = append(checks, selfTestCheck{Name: "signers config", Err: err})
+	case len(configs) == 0:
+		skip("signers", "no signers configured")
+	}
+	for _, c := range configs {
+		c := c
+		check("signer "+c.Name, func() (string, error) {
+			s, err := openSigner(c)
+			if err != nil {
+				return "", err
+			}
+			defer s.Close()
+
+			address := s.Address()
+			if info != nil {
+				for _, owner := range checksummed(info.Owners) {
+					if owner == address {
+						return address.Hex() + " (owner)", nil
+					}
+				}
+				return "", fmt.Errorf("%s is not an owner", address.Hex())
+			}
+			return address.Hex(), nil
+		})
+	}
+
+	if opts.policyFile == "" {
+		skip("policy", "no -policy given")
+	} else {
+		check("policy", func() (string, error) {
+			pol, err := loadPolicy(opts.policyFile)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d token rules, %d blocked selectors", len(pol.Tokens), len(pol.BlockedSelectors)), nil
+		})
+	}
+
+	return checks
+}
+
+func printSelfTest(checks []selfTestCheck) int {
+	failed := 0
+	for _, c := range checks {
+		status, detail := "PASS", c.Detail
+		switch {
+		case c.Skip:
+			status = "SKIP"
+		case c.Err != nil:
+			status, detail = "FAIL", withHint(c.Err).Error()
+			failed++
+		}
+		fmt.Printf("%-4s  %-22s %s\n", status, c.Name, detail)
+	}
+	return failed
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const DEFAULT_SERVICE_URL = "https://safe-transaction.rinkeby.gnosis.io"
+
+// serviceURL is the transaction service in use, set with the global -service
+// flag or $GNOSIS_TX_SERVICE_URL for self-hosted deployments
+var serviceURL = DEFAULT_SERVICE_URL
+
+func setServiceURL(url string) error {
+	if url == "" {
+		url = os.Getenv("GNOSIS_TX_SERVICE_URL")
+	}
+	if url == "" {
+		return nil
+	}
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return fmt.Errorf("invalid -service url %q", url)
+	}
+	serviceURL = strings.TrimSuffix(strings.TrimSuffix(url, "/"), "/api/v1")
+	return nil
+}
+
+func serviceEndpoint(path string) string {
+	return serviceURL + "/api/v1" + path
+}
+
+// features of the transaction service used by the tool that older
+// deployments lack, with the version introducing them
+const (
+	FEATURE_MESSAGES = "offchain messages"
+)
+
+var serviceFeatures = map[string]string{
+	FEATURE_MESSAGES: "4.6.0",
+}
+
+// serviceVersion is the /about of a service, recorded in services.json with
+// the chain it indexes
+type serviceVersion struct {
+	Name       string    `json:"name"`
+	Version    string    `json:"version"`
+	APIVersion string    `json:"apiVersion"`
+	ChainID    int64     `json:"chainId,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+// negotiated is the version of serviceURL, queried once per run at most
+var negotiated *serviceVersion
+
+// serviceChainID is the chain of the transaction service, which safe
+// transactions are hashed for and every rpc has to be on; zero while it is
+// unknown, then the first rpc dialled sets it
+var serviceChainID int64
+
+// parseVersion reads the numeric major.minor.patch of versions like
+// "v4.6.1" or "3.4.0-rc1"
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	for i, part := range parts {
+		if end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+			part = part[:end]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+func serviceVersionAtLeast(version, min string) (bool, bool) {
+	v, ok := parseVersion(version)
+	if !ok {
+		return false, false
+	}
+	m, _ := parseVersion(min)
+	for i := range v {
+		if v[i] != m[i] {
+			return v[i] > m[i], true
+		}
+	}
+	return true, true
+}
+
+// recordedServices reads services.json, the services queried so far
+func recordedServices() (map[string]*serviceVersion, error) {
+	path := configPath("services.json")
+	recorded := map[string]*serviceVersion{}
+	if content, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(content, &recorded); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+func recordServices(recorded map[string]*serviceVersion) {
+	if err := os.MkdirAll(configDir(), 0o700); err == nil {
+		if encoded, err := json.MarshalIndent(recorded, "", "  "); err == nil {
+			ioutil.WriteFile(configPath("services.json"), encoded, 0o644)
+		}
+	}
+}
+
+// negotiateService returns the version of the transaction service, from
+// services.json if checked within a day
+func negotiateService() (*serviceVersion, error) {
+	if negotiated != nil {
+		return negotiated, nil
+	}
+
+	recorded, err := recordedServices()
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := recorded[serviceURL]; ok && time.Since(v.CheckedAt) < 24*time.Hour {
+		negotiated = v
+		return v, nil
+	}
+
+	about, err := getServiceAbout()
+	if err != nil {
+		return nil, fmt.Errorf("querying the version of %s failed: %w", serviceURL, err)
+	}
+	v := &serviceVersion{Name: about.Name, Version: about.Version, APIVersion: about.APIVersion, CheckedAt: time.Now().UTC()}
+	if v.APIVersion != "" && v.APIVersion != "v1" {
+		return nil, fmt.Errorf("%s serves api %s, the tool speaks v1", serviceURL, v.APIVersion)
+	}
+	if previous, ok := recorded[serviceURL]; ok {
+		v.ChainID = previous.ChainID
+	}
+
+	recorded[serviceURL] = v
+	recordServices(recorded)
+	negotiated = v
+	return v, nil
+}
+
+// setServiceChain reads the chain of the transaction service, recorded in
+// services.json once queried as it never changes; a service that can't be
+// reached leaves it to the first rpc dialled
+func setServiceChain() error {
+	recorded, err := recordedServices()
+	if err != nil {
+		return err
+	}
+	if v, ok := recorded[serviceURL]; ok && v.ChainID != 0 {
+		serviceChainID = v.ChainID
+		return nil
+	}
+
+	chainID, err := getServiceChainID()
+	if err != nil {
+		logger.Debug("chain of the transaction service unknown, it is read from the rpc", "service", serviceURL, "error", err)
+		return nil
+	}
+	v, ok := recorded[serviceURL]
+	if !ok {
+		// CheckedAt is left zero, the version is still negotiated
+		v = &serviceVersion{}
+		recorded[serviceURL] = v
+	}
+	v.ChainID = chainID
+	recordServices(recorded)
+	serviceChainID = chainID
+	return nil
+}
+
+// serviceChain returns the chain of the transaction service, for what can't
+// be done without knowing it
+func serviceChain() (int64, error) {
+	if serviceChainID == 0 {
+		return 0, fmt.Errorf("the chain of %s is unknown as it can't be reached, pass -rpc to read it from the chain", serviceURL)
+	}
+	return serviceChainID, nil
+}
+
+// requireServiceFeature refuses features the transaction service is too old
+// for, rather than failing on a missing endpoint; services that can't be
+// queried or report unknown versions are given the benefit of the doubt
+func requireServiceFeature(feature string) error {
+	v, err := negotiateService()
+	if err != nil {
+		logger.Warn(err.Error())
+		return nil
+	}
+
+	supported, ok := serviceVersionAtLeast(v.Version, serviceFeatures[feature])
+	if !ok {
+		fmt.Printf("warning: unknown version %q of %s, assuming it supports %s\n", v.Version, serviceURL, feature)
+		return nil
+	}
+	if !supported {
+		return fmt.Errorf("%s runs %s %s, %s need version %s or later", serviceURL, v.Name, v.Version, feature, serviceFeatures[feature])
+	}
+	return nil
+}
+
+// TransactionServiceClient is the part of the transaction service API that
+// proposals and confirmations go through, replaced by fakes in tests
+type TransactionServiceClient interface {
+	SafeInfo(safe string) (*safeNonceResponse, error)
+	EstimateSafeTxGas(safe, to string, value int64, data []byte, operation uint8) (*int64, error)
+	EstimateTransaction(safe, to string, value int64, data []byte, operation uint8) (*int64, error)
+	ProposeTransaction(safe string, request *gnosisTxRequest) error
+	Transaction(safeTxHash string) (*multisigTxResponse, error)
+	PendingTransactions(safe string, fromNonce int64) ([]multisigTxResponse, error)
+	ExecutedTransactions(safe string) ([]multisigTxResponse, error)
+	Confirm(safeTxHash, signature string) error
+}
+
+const GAS_ESTIMATION_URL = "https://safe-relay.rinkeby.gnosis.io/api/v2"
+
+var transactionService TransactionServiceClient = &httpServiceClient{estimationURL: GAS_ESTIMATION_URL}
+
+// httpServiceClient talks to the service at serviceURL, the safeTxGas
+// estimation is an endpoint of the safe relay
+type httpServiceClient struct {
+	estimationURL string
+}
+
+func (c *httpServiceClient) SafeInfo(safe string) (*safeNonceResponse, error) {
+	resp, err := httpGet(serviceEndpoint("/safes/") + safe)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := serviceBody(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errSafeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data safeNonceResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (c *httpServiceClient) EstimateSafeTxGas(safe, to string, value int64, data []byte, operation uint8) (*int64, error) {
+	var txData *string
+	if len(data) > 0 {
+		encoded := hexutil.Encode(data)
+		txData = &encoded
+	}
+	request := gasEstimationRequest{
+		To:        to,
+		Value:     value,
+		Data:      txData,
+		Operation: int(operation),
+		GasToken:  nil,
+	}
+
+	req, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpPost(c.estimationURL+"/safes/"+safe+"/transactions/estimate/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := serviceBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("gas estimation failed: %w", err)
+	}
+
+	var estimation gasEstimationResponse
+	if err := json.Unmarshal(body, &estimation); err != nil {
+		return nil, err
+	}
+
+	safeTxGas, err := strconv.ParseInt(estimation.SafeTxGas, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &safeTxGas, nil
+}
+
+// safeTxGasEstimation is the transaction service estimation of safeTxGas
+type safeTxGasEstimation struct {
+	SafeTxGas string `json:"safeTxGas"`
+}
+
+// EstimateTransaction is the safeTxGas estimation of the transaction service,
+// which replaces the relay one on newer deployments
+func (c *httpServiceClient) EstimateTransaction(safe, to string, value int64, data []byte, operation uint8) (*int64, error) {
+	var txData *string
+	if len(data) > 0 {
+		encoded := hexutil.Encode(data)
+		txData = &encoded
+	}
+	req, err := json.Marshal(gasEstimationRequest{To: to, Value: value, Data: txData, Operation: int(operation)})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpPost(serviceEndpoint("/safes/")+safe+"/multisig-transactions/estimations/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return nil, err
+	}
+	body, err := serviceBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("gas estimation failed: %w", err)
+	}
+
+	var estimation safeTxGasEstimation
+	if err := json.Unmarshal(body, &estimation); err != nil {
+		return nil, err
+	}
+	safeTxGas, err := strconv.ParseInt(estimation.SafeTxGas, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid safeTxGas %q in the estimation: %w", estimation.SafeTxGas, err)
+	}
+	return &safeTxGas, nil
+}
+
+func (c *httpServiceClient) ProposeTransaction(safe string, request *gnosisTxRequest) error {
+	req, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpPost(serviceEndpoint("/safes/")+safe+"/multisig-transactions/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return err
+	}
+
+	if _, err := serviceBody(resp); err != nil {
+		return withHint(fmt.Errorf("proposal rejected: %w", err))
+	}
+	return nil
+}
+
+func (c *httpServiceClient) Transaction(safeTxHash string) (*multisigTxResponse, error) {
+	resp, err := httpGet(serviceEndpoint("/multisig-transactions/") + safeTxHash + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := serviceBody(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("transaction %s %w", safeTxHash, errTxNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data multisigTxResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (c *httpServiceClient) PendingTransactions(safe string, fromNonce int64) ([]multisigTxResponse, error) {
+	return listMultisigTransactions(serviceEndpoint("/safes/") + safe + "/multisig-transactions/?executed=false&nonce__gte=" + strconv.FormatInt(fromNonce, 10))
+}
+
+func (c *httpServiceClient) ExecutedTransactions(safe string) ([]multisigTxResponse, error) {
+	return listMultisigTransactions(serviceEndpoint("/safes/") + safe + "/multisig-transactions/?executed=true")
+}
+
+func (c *httpServiceClient) Confirm(safeTxHash, signature string) error {
+	req, err := json.Marshal(confirmationRequest{Signature: signature})
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpPost(serviceEndpoint("/multisig-transactions/")+safeTxHash+"/confirmations/", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return err
+	}
+
+	if _, err := serviceBody(resp); err != nil {
+		return withHint(fmt.Errorf("confirmation rejected: %w", err))
+	}
+	return nil
+}
+
+// MAX_RESPONSE_SIZE caps what is read of a service response, listings are
+// paginated and far below it
+const MAX_RESPONSE_SIZE = 8 << 20
+
+var errResponseTooLarge = fmt.Errorf("response exceeds %d bytes", MAX_RESPONSE_SIZE)
+
+// serviceBody reads and closes the body of a service response; any 2xx status
+// is a success, others are returned as a *serviceError along with the body
+func serviceBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MAX_RESPONSE_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MAX_RESPONSE_SIZE {
+		return nil, fmt.Errorf("%s %w", resp.Request.URL.Path, errResponseTooLarge)
+	}
+	if resp.StatusCode/100 != 2 {
+		return body, newServiceError(resp, body)
+	}
+	return body, nil
+}
+
+// serviceError is a rejection by the service, with the validation errors it
+// returns per field of the request, nested fields joined with dots
+type serviceError struct {
+	Status   string
+	Code     int
+	General  []string
+	Fields   map[string][]string
+	Response string
+}
+
+// fields of rest framework errors that don't name a request field
+var generalErrorFields = map[string]bool{
+	"nonFieldErrors":   true,
+	"non_field_errors": true,
+	"detail":           true,
+	"message":          true,
+}
+
+func newServiceError(resp *http.Response, body []byte) *serviceError {
+	e := &serviceError{Status: resp.Status, Code: resp.StatusCode, Fields: map[string][]string{}}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		e.Response = strings.TrimSpace(string(body))
+		if len(e.Response) > 200 {
+			e.Response = e.Response[:200] + "..."
+		}
+		return e
+	}
+	e.collect("", decoded)
+	return e
+}
+
+func (e *serviceError) collect(field string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if field == "" || generalErrorFields[field] {
+			e.General = append(e.General, v)
+		} else {
+			e.Fields[field] = append(e.Fields[field], v)
+		}
+	case []interface{}:
+		for i, item := range v {
+			if _, nested := item.(map[string]interface{}); nested {
+				e.collect(joinField(field, strconv.Itoa(i)), item)
+			} else {
+				e.collect(field, item)
+			}
+		}
+	case map[string]interface{}:
+		for name, item := range v {
+			if generalErrorFields[name] {
+				e.collect(name, item)
+			} else {
+				e.collect(joinField(field, name), item)
+			}
+		}
+	case nil:
+	default:
+		e.collect(field, fmt.Sprint(v))
+	}
+}
+
+func joinField(parent, name string) string {
+	if parent == "" || generalErrorFields[parent] {
+		return name
+	}
+	return parent + "." + name
+}
+
+func (e *serviceError) Error() string {
+	var details []string
+	details = append(details, e.General...)
+
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		details = append(details, name+": "+strings.Join(e.Fields[name], ", "))
+	}
+	if len(details) == 0 && e.Response != "" {
+		details = append(details, e.Response)
+	}
+	if len(details) == 0 {
+		return e.Status
+	}
+	return e.Status + ": " + strings.Join(details, "; ")
+}
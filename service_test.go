@@ -0,0 +1,658 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	testSafe      = "0x5aFE3855358E112B5647B952709E6165e1c1eEEe"
+	testRecipient = "0x3a1CE38d3C5A6a6d3e9D52C9d8fa27B9A1e3b8c0"
+)
+
+func TestServiceSafeInfo(t *testing.T) {
+	useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/safes/"+testSafe {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"address":"` + testSafe + `","nonce":7,"threshold":2,"owners":["` + testOwner.Hex() + `"],"version":"1.3.0"}`))
+	}))
+
+	info, err := getSafeInfo(testSafe)
+	if err != nil {
+		t.Fatalf("getSafeInfo: %v", err)
+	}
+	if info.Nonce != 7 || info.Threshold != 2 || info.Version != "1.3.0" || len(info.Owners) != 1 {
+		t.Errorf("getSafeInfo = %+v, want nonce 7, threshold 2, version 1.3.0 and one owner", info)
+	}
+
+	if _, err := getSafeInfo(ZERO_ADDR); !errors.Is(err, errSafeNotFound) {
+		t.Errorf("getSafeInfo of an unknown safe = %v, want errSafeNotFound", err)
+	}
+}
+
+func TestServiceChain(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	defer func(previous int64) { serviceChainID = previous }(serviceChainID)
+	queried := 0
+	useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/about/ethereum-rpc/" {
+			http.NotFound(w, r)
+			return
+		}
+		queried++
+		w.Write([]byte(`{"version":"Geth/v1.10.15","block_number":2000000,"chain_id":100,"chain_name":"GNOSIS","syncing":false}`))
+	}))
+
+	// the chain of a service never changes, it is queried once
+	for i := 0; i < 2; i++ {
+		serviceChainID = 0
+		if err := setServiceChain(); err != nil || serviceChainID != 100 {
+			t.Fatalf("setServiceChain = %v, chain %d, want chain 100", err, serviceChainID)
+		}
+	}
+	if queried != 1 {
+		t.Errorf("the chain was queried %d times, want once", queried)
+	}
+
+	rpc := serveTestRPC(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_chainId": func([]json.RawMessage) (interface{}, error) { return "0x4", nil },
+	})
+	if client, err := dialRPC(rpc); err == nil {
+		client.Close()
+		t.Error("dialRPC accepted an rpc on rinkeby for a service on gnosis chain")
+	}
+	// as are the raw dials of the fee, simulation and light client reads
+	if _, err := suggestFees(rpc, &feeOptions{}); err == nil || !strings.Contains(err.Error(), "is on") {
+		t.Errorf("suggestFees = %v, want the rpc refused for being on another chain", err)
+	}
+
+	// a service that can't be reached leaves the chain to the rpc
+	serviceChainID = 0
+	if _, err := serviceChain(); err == nil {
+		t.Error("serviceChain() = nil error with the chain unknown")
+	}
+	client, err := dialRPC(rpc)
+	if err != nil {
+		t.Fatalf("dialRPC: %v", err)
+	}
+	client.Close()
+	if serviceChainID != 4 {
+		t.Errorf("chain after dialing a rinkeby rpc = %d, want 4", serviceChainID)
+	}
+}
+
+func TestServiceTransactionNotFound(t *testing.T) {
+	useServiceURL(t, http.NotFoundHandler())
+
+	if _, err := getMultisigTransaction(testHash.Hex()); !errors.Is(err, errTxNotFound) {
+		t.Errorf("getMultisigTransaction = %v, want errTxNotFound", err)
+	}
+}
+
+func TestServicePendingPages(t *testing.T) {
+	var srvURL string
+	srv := useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Write([]byte(`{"count":2,"next":"` + srvURL + `/api/v1/next?page=2","results":[{"nonce":3}]}`))
+			return
+		}
+		w.Write([]byte(`{"count":2,"next":null,"results":[{"nonce":4}]}`))
+	}))
+	srvURL = srv.URL
+
+	txs, err := getPendingTransactions(testSafe, 3)
+	if err != nil {
+		t.Fatalf("getPendingTransactions: %v", err)
+	}
+	if len(txs) != 2 || txs[0].Nonce != 3 || txs[1].Nonce != 4 {
+		t.Errorf("getPendingTransactions = %+v, want nonces 3 and 4 from both pages", txs)
+	}
+}
+
+func TestServiceProposalRejected(t *testing.T) {
+	var received gnosisTxRequest
+	useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"nonFieldErrors":["Signer=` + testOwner.Hex() + ` is not an owner or delegate"]}`))
+	}))
+
+	err := postGnosisTx(testSafe, &gnosisTxRequest{Nonce: 5, Sender: testOwner.Hex()})
+	if err == nil || !strings.Contains(err.Error(), "is not an owner or delegate") {
+		t.Fatalf("postGnosisTx = %v, want the service's nonFieldErrors", err)
+	}
+	if received.Nonce != 5 || received.Sender != testOwner.Hex() {
+		t.Errorf("service received %+v, want nonce 5 from %s", received, testOwner.Hex())
+	}
+}
+
+func TestServiceProposalCreated(t *testing.T) {
+	useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if err := postGnosisTx(testSafe, &gnosisTxRequest{Nonce: 5}); err != nil {
+		t.Errorf("postGnosisTx answered 201 = %v, want success", err)
+	}
+}
+
+func TestServiceErrorFields(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"nonFieldErrors":["Nonce=3 is already executed"]}`, "422 Unprocessable Entity: Nonce=3 is already executed"},
+		{`{"to":["Checksum address validation failed"],"safeTxGas":["A valid integer is required."]}`,
+			"422 Unprocessable Entity: safeTxGas: A valid integer is required.; to: Checksum address validation failed"},
+		{`{"dataDecoded":{"parameters":[{"value":["Too long"]}]}}`, "422 Unprocessable Entity: dataDecoded.parameters.0.value: Too long"},
+		{`{"detail":"Not found."}`, "422 Unprocessable Entity: Not found."},
+		{`["Signature already exists"]`, "422 Unprocessable Entity: Signature already exists"},
+		{`<html>bad gateway</html>`, "422 Unprocessable Entity: <html>bad gateway</html>"},
+		{``, "422 Unprocessable Entity"},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Status: "422 Unprocessable Entity", StatusCode: http.StatusUnprocessableEntity}
+		if got := newServiceError(resp, []byte(tt.body)).Error(); got != tt.want {
+			t.Errorf("newServiceError(%s) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestServiceConfirmationRejected(t *testing.T) {
+	var path string
+	useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"signature":["Signature already exists"]}`))
+	}))
+
+	err := submitConfirmation(testHash.Hex(), "0x00")
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "Signature already exists") {
+		t.Errorf("submitConfirmation = %v, want the status and body of the rejection", err)
+	}
+	if want := "/api/v1/multisig-transactions/" + testHash.Hex() + "/confirmations/"; path != want {
+		t.Errorf("confirmation posted to %s, want %s", path, want)
+	}
+}
+
+func TestServiceUnreachableHint(t *testing.T) {
+	srv := useServiceURL(t, http.NotFoundHandler())
+	srv.Close()
+
+	_, err := getSafeInfo(testSafe)
+	if !serviceUnreachable(err) {
+		t.Fatalf("getSafeInfo on a closed server = %v, want a connection error", err)
+	}
+	if hinted := chainOnlyHint(err); !strings.Contains(hinted.Error(), "-chain-only") {
+		t.Errorf("chainOnlyHint = %v, want the -chain-only hint", hinted)
+	}
+}
+
+// proposalService is the fake service of a safe at nonce 7 owned by testOwner
+func proposalService() *fakeService {
+	return &fakeService{
+		safe:      safeNonceResponse{Address: testSafe, Nonce: 7, Threshold: 1, Owners: []string{testOwner.Hex()}, Version: "1.3.0"},
+		safeTxGas: 45000,
+	}
+}
+
+func proposalOptionsForTest() *proposalOptions {
+	return &proposalOptions{
+		lint:         CHECK_OFF,
+		verification: CHECK_OFF,
+		proxies:      CHECK_OFF,
+		ackNew:       []string{testRecipient},
+		allowUnknown: true,
+		estimate:     ESTIMATE_RELAY,
+		replace:      -1,
+	}
+}
+
+func TestSendTransactionPayload(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	service := proposalService()
+	useService(t, service)
+
+	data := []byte{0xa9, 0x05, 0x9c, 0xbb}
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+	if err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1000, data, 0, key, proposalOptionsForTest()); err != nil {
+		t.Fatalf("sendTransaction: %v", err)
+	}
+	if len(service.proposals) != 1 {
+		t.Fatalf("%d proposals sent, want 1", len(service.proposals))
+	}
+
+	got := service.proposals[0]
+	if got.To != testRecipient || got.Value != 1000 || got.Nonce != 7 || got.SafeTxGas != 45000 || got.Operation != 0 {
+		t.Errorf("proposal = %+v, want 1000 wei to %s at nonce 7 with safeTxGas 45000", got, testRecipient)
+	}
+	if got.Data == nil || *got.Data != hexutil.Encode(data) {
+		t.Errorf("proposal data = %v, want %s", got.Data, hexutil.Encode(data))
+	}
+	if len(service.estimated) != 1 || *service.estimated[0].Data != hexutil.Encode(data) {
+		t.Errorf("estimation requests = %+v, want one with the proposal data", service.estimated)
+	}
+	wantBaseGas, _ := estimateBaseGas(common.HexToAddress(testRecipient), big.NewInt(1000), data, 0, 45000, 1)
+	if got.BaseGas != wantBaseGas || got.BaseGas <= TX_BASE_GAS {
+		t.Errorf("proposal baseGas = %d, want the estimate %d for one signature", got.BaseGas, wantBaseGas)
+	}
+	if got.Sender != testOwner.Hex() || got.GasToken != ZERO_ADDR || got.RefundReceiver != ZERO_ADDR || got.GasPrice != 0 {
+		t.Errorf("proposal = %+v, want sender %s without refund", got, testOwner.Hex())
+	}
+
+	// the declared hash is the one of the proposed fields in the domain of
+	// the 1.3.0 safe, signed by the sender
+	tx := &multisigTxResponse{
+		Safe: testSafe, To: got.To, Value: "1000", Data: got.Data, Operation: uint8(got.Operation),
+		GasToken: got.GasToken, SafeTxGas: got.SafeTxGas, BaseGas: got.BaseGas, GasPrice: "0",
+		RefundReceiver: got.RefundReceiver, Nonce: got.Nonce,
+	}
+	hash, err := tx.hash(serviceChainID, service.safe.Version)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if got.ContractTransactionHash != hash.Hex() {
+		t.Errorf("contractTransactionHash = %s, want %s", got.ContractTransactionHash, hash.Hex())
+	}
+	signature, err := hexutil.Decode(got.Signature)
+	if err != nil {
+		t.Fatalf("invalid signature %q: %v", got.Signature, err)
+	}
+	signer, err := recoverSigner(hash, signature)
+	if err != nil || signer != testOwner {
+		t.Errorf("signature recovers to %s, %v, want %s", signer.Hex(), err, testOwner.Hex())
+	}
+}
+
+func TestGasEstimationFallback(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	fallback := int64(90000)
+	down := errors.New("503 service unavailable")
+	tests := []struct {
+		name                  string
+		relayErr, estimateErr error
+		fallback              *int64
+		wantSource            string
+		wantGas               int64
+	}{
+		{"relay", nil, nil, nil, GAS_SOURCE_RELAY, 45000},
+		{"relay down", down, nil, nil, GAS_SOURCE_SERVICE, 45000},
+		{"both down", down, down, &fallback, GAS_SOURCE_FLAG, 90000},
+		{"no fallback", down, down, nil, "", 0},
+	}
+	for _, tt := range tests {
+		service := proposalService()
+		service.relayErr, service.estimateErr = tt.relayErr, tt.estimateErr
+		useService(t, service)
+
+		got, err := getGasEstimation(testRecipient, testSafe, 1, nil, 0, "", tt.fallback)
+		if tt.wantSource == "" {
+			if err == nil || !strings.Contains(err.Error(), "-safe-tx-gas") {
+				t.Errorf("getGasEstimation(%s) = %v, want an error pointing to -safe-tx-gas", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getGasEstimation(%s): %v", tt.name, err)
+			continue
+		}
+		if got.Source != tt.wantSource || got.SafeTxGas != tt.wantGas || got.BaseGas == 0 {
+			t.Errorf("getGasEstimation(%s) = %+v, want safeTxGas %d from the %s", tt.name, got, tt.wantGas, tt.wantSource)
+		}
+	}
+}
+
+func TestSendTransactionWithoutEstimation(t *testing.T) {
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+	tests := []struct {
+		version       string
+		wantSafeTxGas int64
+	}{
+		{"1.3.0", 0},
+		{"1.4.1+L2", 0},
+		{"1.1.1", 45000},
+	}
+	for _, tt := range tests {
+		t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+		service := proposalService()
+		service.safe.Version = tt.version
+		useService(t, service)
+
+		opts := proposalOptionsForTest()
+		opts.estimate = ""
+		if err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1, nil, 0, key, opts); err != nil {
+			t.Fatalf("sendTransaction on %s: %v", tt.version, err)
+		}
+		if got := service.proposals[0].SafeTxGas; got != tt.wantSafeTxGas {
+			t.Errorf("safeTxGas on %s = %d, want %d", tt.version, got, tt.wantSafeTxGas)
+		}
+		if tt.wantSafeTxGas == 0 && len(service.estimated) != 0 {
+			t.Errorf("%d estimation requests on %s, want none", len(service.estimated), tt.version)
+		}
+
+		// the proposal is hashed and signed in the domain of its version,
+		// with the chainId from 1.3.0
+		got := service.proposals[0]
+		tx := &multisigTxResponse{
+			Safe: testSafe, To: got.To, Value: "1", Data: got.Data, GasToken: got.GasToken, SafeTxGas: got.SafeTxGas,
+			BaseGas: got.BaseGas, GasPrice: "0", RefundReceiver: got.RefundReceiver, Nonce: got.Nonce,
+		}
+		hash, err := tx.hash(serviceChainID, tt.version)
+		if err != nil || got.ContractTransactionHash != hash.Hex() {
+			t.Errorf("contractTransactionHash on %s = %s, want %s (%v)", tt.version, got.ContractTransactionHash, hash.Hex(), err)
+		}
+		chainless, _ := tx.hash(serviceChainID, "1.2.0")
+		if versionAtLeast(tt.version, 1, 3) && hash == chainless {
+			t.Errorf("hash on %s = %s, the chainless one", tt.version, hash.Hex())
+		}
+		signature, err := hexutil.Decode(got.Signature)
+		if err != nil {
+			t.Fatalf("invalid signature %q: %v", got.Signature, err)
+		}
+		if signer, err := recoverSigner(hash, signature); err != nil || signer != testOwner {
+			t.Errorf("signature on %s recovers to %s, %v, want %s", tt.version, signer.Hex(), err, testOwner.Hex())
+		}
+	}
+}
+
+func TestSendTransactionRefund(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	service := proposalService()
+	useService(t, service)
+
+	weth := "0xc778417E063141139Fce010982780140Aa0cD5Ab"
+	relayer := "0x00000000000000000000000000000000000000aa"
+	var quoted gasEstimationRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/tokens/":
+			json.NewEncoder(w).Encode(relayGasTokenList{Results: []relayGasToken{{Address: weth, Symbol: "WETH", Decimals: 18}}})
+		case "/api/v2/safes/" + testSafe + "/transactions/estimate/":
+			json.NewDecoder(r.Body).Decode(&quoted)
+			json.NewEncoder(w).Encode(gasEstimationResponse{SafeTxGas: "50000", BaseGas: "48000", GasPrice: "1000000000", GasToken: weth, RefundReceiver: relayer})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	previous := refundRelayURL
+	refundRelayURL = srv.URL
+	defer func() { refundRelayURL = previous }()
+
+	opts := proposalOptionsForTest()
+	opts.refund = &gasRefund{gasToken: common.HexToAddress(weth)}
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+	if err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1000, nil, 0, key, opts); err != nil {
+		t.Fatalf("sendTransaction: %v", err)
+	}
+	if quoted.GasToken == nil || common.HexToAddress(*quoted.GasToken) != common.HexToAddress(weth) {
+		t.Errorf("refund quoted for gas token %v, want %s", quoted.GasToken, weth)
+	}
+
+	got := service.proposals[0]
+	if got.GasToken != weth || got.GasPrice != 1000000000 || common.HexToAddress(got.RefundReceiver) != common.HexToAddress(relayer) {
+		t.Errorf("proposal refund = %s %d to %s, want the relay quote", got.GasToken, got.GasPrice, got.RefundReceiver)
+	}
+	if got.SafeTxGas != 50000 || got.BaseGas != 48000 {
+		t.Errorf("proposal gas = %d + %d, want the relay quote 50000 + 48000", got.SafeTxGas, got.BaseGas)
+	}
+	tx := &multisigTxResponse{
+		Safe: testSafe, To: got.To, Value: "1000", GasToken: got.GasToken, SafeTxGas: got.SafeTxGas, BaseGas: got.BaseGas,
+		GasPrice: "1000000000", RefundReceiver: got.RefundReceiver, Nonce: got.Nonce,
+	}
+	if hash, err := tx.hash(serviceChainID, service.safe.Version); err != nil || got.ContractTransactionHash != hash.Hex() {
+		t.Errorf("contractTransactionHash = %s, want %s (%v)", got.ContractTransactionHash, hash.Hex(), err)
+	}
+
+	if want := "up to 0.000098 WETH to"; !strings.HasPrefix(txRefund(nil, tx), want) {
+		t.Errorf("txRefund() = %q, want prefix %q", txRefund(nil, tx), want)
+	}
+}
+
+func TestSendTransactionRejected(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	service := proposalService()
+	service.proposeErr = errors.New("Nonce=7 is already executed")
+	useService(t, service)
+
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+	err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1, nil, 0, key, proposalOptionsForTest())
+	if err == nil || !strings.Contains(err.Error(), "already executed") {
+		t.Errorf("sendTransaction = %v, want the service rejection", err)
+	}
+}
+
+func TestSendTransactionInvalidAddress(t *testing.T) {
+	useService(t, proposalService())
+
+	err := sendTransaction(testOwner.Hex(), "0x1234", testSafe, 1, nil, 0, "", proposalOptionsForTest())
+	if err == nil || !strings.Contains(err.Error(), "-to") {
+		t.Errorf("sendTransaction to a malformed address = %v, want an -to error", err)
+	}
+	mixed := strings.Replace(testRecipient, "A", "a", 1)
+	if err := sendTransaction(testOwner.Hex(), mixed, testSafe, 1, nil, 0, "", proposalOptionsForTest()); err == nil {
+		t.Errorf("sendTransaction to %s with a broken checksum succeeded", mixed)
+	}
+}
+
+func TestRevertReason(t *testing.T) {
+	// Error("GS013")
+	encoded := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000005" +
+		"4753303133000000000000000000000000000000000000000000000000000000"
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"0x", "no revert reason"},
+		{encoded, "GS013"},
+		{"0xdeadbeef", "0xdeadbeef"},
+	}
+	for _, tt := range tests {
+		if got := revertReason(common.FromHex(tt.data)); got != tt.want {
+			t.Errorf("revertReason(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestSendTransactionConfirmsExisting(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	service := proposalService()
+	useService(t, service)
+
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+	send := func() error {
+		return sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1, nil, 0, key, proposalOptionsForTest())
+	}
+	if err := send(); err != nil {
+		t.Fatalf("sendTransaction: %v", err)
+	}
+	hash := service.proposals[0].ContractTransactionHash
+	service.txs = map[string]*multisigTxResponse{hash: {SafeTxHash: hash, Nonce: 7, Proposer: ZERO_ADDR}}
+
+	if err := send(); err != nil {
+		t.Fatalf("sendTransaction of a proposed transaction: %v", err)
+	}
+	if len(service.proposals) != 1 || len(service.confirmations[hash]) != 1 {
+		t.Errorf("%d proposals and %d confirmations, want the existing proposal confirmed", len(service.proposals), len(service.confirmations[hash]))
+	}
+
+	service.txs[hash].Confirmations = []multisigConfirmation{{Owner: testOwner.Hex()}}
+	if err := send(); err == nil || !strings.Contains(err.Error(), "already proposed") {
+		t.Errorf("sendTransaction of a confirmed transaction = %v, want an already proposed error", err)
+	}
+}
+
+func TestSendTransactionNonceConflict(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	service := proposalService()
+	service.pending = []multisigTxResponse{{Nonce: 7, SafeTxHash: testHash.Hex()}}
+	useService(t, service)
+
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+	err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1, nil, 0, key, proposalOptionsForTest())
+	if err == nil || !strings.Contains(err.Error(), "-replace 7") {
+		t.Errorf("sendTransaction at an occupied nonce = %v, want the -replace hint", err)
+	}
+	if len(service.proposals) != 0 {
+		t.Errorf("%d proposals sent at an occupied nonce, want none", len(service.proposals))
+	}
+
+	opts := proposalOptionsForTest()
+	opts.replace = 7
+	if err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1, nil, 0, key, opts); err != nil {
+		t.Errorf("sendTransaction with -replace 7 = %v, want a competing proposal", err)
+	}
+}
+
+func TestSendTransactionNonceRace(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	key := hexutil.Encode(crypto.FromECDSA(testKey))[2:]
+	competing := multisigTxResponse{Nonce: 7, SafeTxHash: testHash.Hex(), Proposer: testRecipient}
+
+	service := proposalService()
+	service.queuedMeanwhile = []multisigTxResponse{competing}
+	useService(t, service)
+	err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1, nil, 0, key, proposalOptionsForTest())
+	var race *nonceRace
+	if !errors.As(err, &race) || race.Next != 8 || !strings.Contains(err.Error(), testHash.Hex()) {
+		t.Errorf("sendTransaction racing another proposal = %v, want a conflict report at next nonce 8", err)
+	}
+	if len(service.proposals) != 0 {
+		t.Errorf("%d proposals sent after losing the nonce race, want none", len(service.proposals))
+	}
+
+	service = proposalService()
+	service.queuedMeanwhile = []multisigTxResponse{competing}
+	useService(t, service)
+	opts := proposalOptionsForTest()
+	opts.onNonceRace = NONCE_RACE_BUMP
+	if err := sendTransaction(testOwner.Hex(), testRecipient, testSafe, 1, nil, 0, key, opts); err != nil {
+		t.Fatalf("sendTransaction with -on-nonce-race bump = %v", err)
+	}
+	if len(service.proposals) != 1 || service.proposals[0].Nonce != 8 {
+		t.Errorf("proposals %+v, want one at the bumped nonce 8", service.proposals)
+	}
+}
+
+func TestServiceAPIKey(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	t.Setenv("GNOSIS_TX_API_KEY", "test-key")
+	defer func() { endpointAuths = nil }()
+
+	var authorization string
+	useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if authorization != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"detail":"Authentication credentials were not provided."}`))
+			return
+		}
+		w.Write([]byte(`{"address":"` + testSafe + `","nonce":7,"threshold":1,"owners":[]}`))
+	}))
+
+	_, err := getSafeInfo(testSafe)
+	if hint := errorHintOf(withHint(err)); err == nil || !strings.Contains(hint, "GNOSIS_TX_API_KEY") {
+		t.Errorf("getSafeInfo without a key = %v, hint %q, want a 401 with an API key hint", err, hint)
+	}
+
+	if err := setServiceAuth(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getSafeInfo(testSafe); err != nil {
+		t.Errorf("getSafeInfo with a key = %v, sent Authorization %q", err, authorization)
+	}
+}
+
+func TestUnderEndpoint(t *testing.T) {
+	tests := []struct {
+		url, endpoint string
+		want          bool
+	}{
+		{"https://safe.example/api/v1/safes", "https://safe.example", true},
+		{"https://safe.example", "https://safe.example", true},
+		{"https://safe.example?x=1", "https://safe.example", true},
+		{"https://safe.example.attacker.com/api", "https://safe.example", false},
+		{"https://other.example/api", "https://safe.example", false},
+	}
+	for _, tt := range tests {
+		if got := underEndpoint(tt.url, tt.endpoint); got != tt.want {
+			t.Errorf("underEndpoint(%q, %q) = %v, want %v", tt.url, tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestServiceMirrorFailover(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	useServiceURL(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	posted := 0
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posted++
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Write([]byte(`{"address":"` + testSafe + `","nonce":7,"threshold":1,"owners":[]}`))
+	}))
+	defer mirror.Close()
+	serviceMirrors, health = []string{mirror.URL}, nil
+	defer func() { serviceMirrors, health = nil, nil }()
+
+	info, err := getSafeInfo(testSafe)
+	if err != nil || info.Nonce != 7 {
+		t.Fatalf("getSafeInfo = %+v, %v, want the mirror's answer", info, err)
+	}
+	if candidates := serviceCandidates(); candidates[0] != mirror.URL {
+		t.Errorf("serviceCandidates = %v, want the healthy mirror first", candidates)
+	}
+	if h := health[serviceURL]; h == nil || h.Failures != 1 {
+		t.Errorf("health of the failed service = %+v, want one failure", h)
+	}
+
+	health = map[string]*mirrorHealth{}
+	// writes aren't repeated on a mirror after a server error, they may have gone through
+	if err := postGnosisTx(testSafe, &gnosisTxRequest{Nonce: 7}); err == nil || posted != 0 {
+		t.Errorf("postGnosisTx = %v with %d mirror posts, want the server error and none", err, posted)
+	}
+}
+
+func TestSafeInfoMismatches(t *testing.T) {
+	other := common.HexToAddress(testRecipient)
+	onchain := &onchainSafeInfo{onchainState: &onchainState{Owners: []common.Address{testOwner, other}, Threshold: 2, Nonce: 7}}
+	tests := []struct {
+		name string
+		info safeNonceResponse
+		want []string
+	}{
+		{"match", safeNonceResponse{Nonce: 7, Threshold: 2, Owners: []string{testRecipient, testOwner.Hex()}}, nil},
+		{"stale nonce", safeNonceResponse{Nonce: 6, Threshold: 2, Owners: []string{testOwner.Hex(), testRecipient}}, []string{"nonce 6 onchain 7"}},
+		{"removed owner", safeNonceResponse{Nonce: 7, Threshold: 1, Owners: []string{testOwner.Hex()}}, []string{"threshold", "owners"}},
+		{"module", safeNonceResponse{Nonce: 7, Threshold: 2, Owners: []string{testOwner.Hex(), testRecipient}, Modules: []string{testSafe}}, []string{"modules"}},
+	}
+	for _, tt := range tests {
+		got := safeInfoMismatches(&tt.info, onchain)
+		if len(got) != len(tt.want) {
+			t.Errorf("safeInfoMismatches(%s) = %q, want %d mismatches", tt.name, got, len(tt.want))
+			continue
+		}
+		for i := range got {
+			if !strings.HasPrefix(got[i], tt.want[i]) {
+				t.Errorf("safeInfoMismatches(%s)[%d] = %q, want %q", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
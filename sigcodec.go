@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// the safe signature types, told apart by the v byte
+const (
+	SIG_CONTRACT      = "contract"      // v=0, EIP-1271 signature of a contract owner
+	SIG_APPROVED_HASH = "approved hash" // v=1, hash approved onchain or the executor
+	SIG_ECDSA         = "ecdsa"         // v=27/28, over the safeTxHash
+	SIG_ETH_SIGN      = "eth_sign"      // v=31/32, over the eth_sign prefixed safeTxHash
+)
+
+// ownerSignature is a single owner's entry in the signatures passed to
+// execTransaction; for contract owners Signature holds the EIP-1271 signature
+// data, for the other types the 65 byte signature
+type ownerSignature struct {
+	Owner     common.Address
+	Type      string
+	Signature []byte
+}
+
+func signatureType(v byte) (string, error) {
+	switch v {
+	case 0:
+		return SIG_CONTRACT, nil
+	case 1:
+		return SIG_APPROVED_HASH, nil
+	case 27, 28:
+		return SIG_ECDSA, nil
+	case 31, 32:
+		return SIG_ETH_SIGN, nil
+	}
+	return "", fmt.Errorf("unsupported signature type v=%d", v)
+}
+
+// normalizeECDSA returns a copy of a 65 byte secp256k1 signature with the
+// recovery id as v=27/28, accepting the raw 0/1 of crypto.Sign and hardware
+// wallets as well
+func normalizeECDSA(signature []byte) ([]byte, error) {
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+
+	sig := common.CopyBytes(signature)
+	switch sig[64] {
+	case 0, 1:
+		sig[64] += 27
+	case 27, 28:
+	default:
+		return nil, fmt.Errorf("invalid ECDSA recovery id v=%d", sig[64])
+	}
+	return sig, nil
+}
+
+// toEthSign marks a signature over the eth_sign prefixed safeTxHash, as made
+// by wallets that only support personal_sign
+func toEthSign(signature []byte) ([]byte, error) {
+	sig, err := normalizeECDSA(signature)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 4
+	return sig, nil
+}
+
+// recoverSigner returns the owner of an EOA signature over safeTxHash, v 27/28
+// for plain signatures and 31/32 for eth_sign signatures
+func recoverSigner(hash common.Hash, signature []byte) (common.Address, error) {
+	if len(signature) != 65 {
+		return common.Address{}, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+
+	sig := common.CopyBytes(signature)
+	digest := hash.Bytes()
+
+	typ, err := signatureType(sig[64])
+	if err != nil {
+		return common.Address{}, err
+	}
+	switch typ {
+	case SIG_ECDSA:
+		sig[64] -= 27
+	case SIG_ETH_SIGN:
+		sig[64] -= 31
+		digest = accounts.TextHash(hash.Bytes())
+	default:
+		return common.Address{}, fmt.Errorf("a %s signature has no signer to recover", typ)
+	}
+
+	pub, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// encodeApprovedHash returns the v=1 entry of an owner that approved the hash
+// onchain (or is the executor)
+func encodeApprovedHash(owner common.Address) ownerSignature {
+	signature := common.LeftPadBytes(owner.Bytes(), 32)
+	signature = append(signature, make([]byte, 32)...)
+	signature = append(signature, 1)
+	return ownerSignature{Owner: owner, Type: SIG_APPROVED_HASH, Signature: signature}
+}
+
+// encodeContractSignature returns the standalone v=0 encoding of a contract signature
+func encodeContractSignature(owner common.Address, data []byte) []byte {
+	return encodeSignatures([]ownerSignature{{Owner: owner, Type: SIG_CONTRACT, Signature: data}})
+}
+
+// decodeDynamic reads the length prefixed contract signature data at offset
+func decodeDynamic(blob []byte, offset *big.Int) ([]byte, error) {
+	if !offset.IsUint64() || offset.Uint64()+32 > uint64(len(blob)) {
+		return nil, errors.New("invalid contract signature offset")
+	}
+	start := offset.Uint64()
+
+	length := new(big.Int).SetBytes(blob[start : start+32])
+	if !length.IsUint64() || start+32+length.Uint64() > uint64(len(blob)) {
+		return nil, errors.New("invalid contract signature length")
+	}
+	return common.CopyBytes(blob[start+32 : start+32+length.Uint64()]), nil
+}
+
+// decodeSignature decodes a standalone signature: 65 bytes for EOA and
+// approved hash signatures, or the v=0 static part followed by its dynamic
+// part for contracts; the owner of EOA signatures is left to recoverSigner
+func decodeSignature(signature []byte) (*ownerSignature, error) {
+	if len(signature) < 65 {
+		return nil, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+
+	typ, err := signatureType(signature[64])
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case SIG_CONTRACT:
+		data, err := decodeDynamic(signature, new(big.Int).SetBytes(signature[32:64]))
+		if err != nil {
+			return nil, err
+		}
+		return &ownerSignature{Owner: common.BytesToAddress(signature[:32]), Type: typ, Signature: data}, nil
+
+	case SIG_APPROVED_HASH:
+		if len(signature) != 65 {
+			return nil, fmt.Errorf("invalid signature length %d", len(signature))
+		}
+		return &ownerSignature{Owner: common.BytesToAddress(signature[:32]), Type: typ, Signature: common.CopyBytes(signature)}, nil
+	}
+
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+	return &ownerSignature{Type: typ, Signature: common.CopyBytes(signature)}, nil
+}
+
+// sortSignatures orders signatures by owner ascending, as the safe requires
+func sortSignatures(sigs []ownerSignature) []ownerSignature {
+	sorted := append([]ownerSignature(nil), sigs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].Owner.Bytes(), sorted[j].Owner.Bytes()) < 0 })
+	return sorted
+}
+
+// encodeSignatures sorts the signatures by owner and lays out the static parts
+// followed by the dynamic parts of contract signatures
+func encodeSignatures(sigs []ownerSignature) []byte {
+	sorted := sortSignatures(sigs)
+
+	var static, dynamic []byte
+	for _, sig := range sorted {
+		if sig.Type != SIG_CONTRACT {
+			static = append(static, sig.Signature...)
+			continue
+		}
+
+		offset := big.NewInt(int64(65*len(sorted) + len(dynamic)))
+		static = append(static, common.LeftPadBytes(sig.Owner.Bytes(), 32)...)
+		static = append(static, common.LeftPadBytes(offset.Bytes(), 32)...)
+		static = append(static, 0)
+
+		dynamic = append(dynamic, common.LeftPadBytes(big.NewInt(int64(len(sig.Signature))).Bytes(), 32)...)
+		dynamic = append(dynamic, sig.Signature...)
+	}
+
+	return append(static, dynamic...)
+}
+
+// splitSignatures decodes the first count entries of an execTransaction
+// signatures blob, the reverse of encodeSignatures; the owner of EOA
+// signatures is left to recoverSigner
+func splitSignatures(blob []byte, count int) ([]ownerSignature, error) {
+	if count <= 0 || len(blob) < 65*count {
+		return nil, fmt.Errorf("%d bytes of signatures are too short for %d signatures", len(blob), count)
+	}
+
+	sigs := make([]ownerSignature, count)
+	for i := range sigs {
+		entry := blob[65*i : 65*(i+1)]
+		typ, err := signatureType(entry[64])
+		if err != nil {
+			return nil, fmt.Errorf("signature %d: %w", i+1, err)
+		}
+		sigs[i] = ownerSignature{Type: typ, Signature: common.CopyBytes(entry)}
+
+		switch typ {
+		case SIG_APPROVED_HASH:
+			sigs[i].Owner = common.BytesToAddress(entry[:32])
+		case SIG_CONTRACT:
+			// the dynamic part must not overlap the static parts
+			offset := new(big.Int).SetBytes(entry[32:64])
+			if offset.Cmp(big.NewInt(int64(65*count))) < 0 {
+				return nil, fmt.Errorf("signature %d: contract signature offset points into the static part", i+1)
+			}
+			data, err := decodeDynamic(blob, offset)
+			if err != nil {
+				return nil, fmt.Errorf("signature %d: %w", i+1, err)
+			}
+			sigs[i].Owner, sigs[i].Signature = common.BytesToAddress(entry[:32]), data
+		}
+	}
+	return sigs, nil
+}
+
+// importSignature returns a signature of owner over hash made by another
+// wallet as the safe verifies it: a signature of the typed data as it is, one
+// made with personal_sign of the hash marked as eth_sign (v+4)
+func importSignature(hash common.Hash, owner common.Address, signature []byte) ([]byte, error) {
+	if len(signature) == 65 && (signature[64] == 31 || signature[64] == 32) {
+		signer, err := recoverSigner(hash, signature)
+		if err != nil {
+			return nil, err
+		}
+		if signer != owner {
+			return nil, fmt.Errorf("eth_sign signature recovers to %s, not the owner %s", signer.Hex(), owner.Hex())
+		}
+		return signature, nil
+	}
+
+	sig, err := normalizeECDSA(signature)
+	if err != nil {
+		return nil, err
+	}
+	typed, err := recoverSigner(hash, sig)
+	if err == nil && typed == owner {
+		return sig, nil
+	}
+	ethSign, _ := toEthSign(sig)
+	personal, err := recoverSigner(hash, ethSign)
+	if err == nil && personal == owner {
+		return ethSign, nil
+	}
+	return nil, fmt.Errorf("signature recovers to %s as typed data and %s as personal_sign, not the owner %s", typed.Hex(), personal.Hex(), owner.Hex())
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	testOwner  = crypto.PubkeyToAddress(testKey.PublicKey)
+	testHash   = crypto.Keccak256Hash([]byte("safe transaction"))
+)
+
+func signature65(v byte) []byte {
+	sig := make([]byte, 65)
+	sig[0] = 0xaa
+	sig[64] = v
+	return sig
+}
+
+func TestSignatureType(t *testing.T) {
+	tests := []struct {
+		v    byte
+		want string
+	}{
+		{0, SIG_CONTRACT},
+		{1, SIG_APPROVED_HASH},
+		{27, SIG_ECDSA},
+		{28, SIG_ECDSA},
+		{31, SIG_ETH_SIGN},
+		{32, SIG_ETH_SIGN},
+	}
+	for _, tt := range tests {
+		got, err := signatureType(tt.v)
+		if err != nil || got != tt.want {
+			t.Errorf("signatureType(%d) = %q, %v, want %q", tt.v, got, err, tt.want)
+		}
+	}
+
+	for _, v := range []byte{2, 26, 29, 30, 33, 255} {
+		if _, err := signatureType(v); err == nil {
+			t.Errorf("signatureType(%d) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestNormalizeECDSA(t *testing.T) {
+	tests := []struct {
+		v, want byte
+	}{
+		{0, 27},
+		{1, 28},
+		{27, 27},
+		{28, 28},
+	}
+	for _, tt := range tests {
+		in := signature65(tt.v)
+		got, err := normalizeECDSA(in)
+		if err != nil {
+			t.Fatalf("normalizeECDSA(v=%d): %v", tt.v, err)
+		}
+		if got[64] != tt.want {
+			t.Errorf("normalizeECDSA(v=%d) v = %d, want %d", tt.v, got[64], tt.want)
+		}
+		if in[64] != tt.v {
+			t.Errorf("normalizeECDSA(v=%d) modified its input", tt.v)
+		}
+	}
+
+	for _, v := range []byte{2, 26, 29, 31, 32} {
+		if _, err := normalizeECDSA(signature65(v)); err == nil {
+			t.Errorf("normalizeECDSA(v=%d) succeeded, want an error", v)
+		}
+	}
+	if _, err := normalizeECDSA(make([]byte, 64)); err == nil {
+		t.Error("normalizeECDSA of 64 bytes succeeded, want an error")
+	}
+}
+
+func TestToEthSign(t *testing.T) {
+	for v, want := range map[byte]byte{0: 31, 1: 32, 27: 31, 28: 32} {
+		got, err := toEthSign(signature65(v))
+		if err != nil || got[64] != want {
+			t.Errorf("toEthSign(v=%d) = %v, %v, want v=%d", v, got, err, want)
+		}
+	}
+	if _, err := toEthSign(signature65(31)); err == nil {
+		t.Error("toEthSign of an eth_sign signature succeeded, want an error")
+	}
+}
+
+func TestRecoverSigner(t *testing.T) {
+	sig, err := signSafeTxHash(testHash, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig[64] != 27 && sig[64] != 28 {
+		t.Fatalf("signSafeTxHash v = %d, want 27 or 28", sig[64])
+	}
+	if owner, err := recoverSigner(testHash, sig); err != nil || owner != testOwner {
+		t.Errorf("recoverSigner(ecdsa) = %s, %v, want %s", owner.Hex(), err, testOwner.Hex())
+	}
+
+	// eth_sign signs the prefixed hash
+	raw, err := crypto.Sign(accounts.TextHash(testHash.Bytes()), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ethSign, err := toEthSign(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := recoverSigner(testHash, ethSign); err != nil || owner != testOwner {
+		t.Errorf("recoverSigner(eth_sign) = %s, %v, want %s", owner.Hex(), err, testOwner.Hex())
+	}
+
+	// the same signature read as the other type recovers someone else
+	wrong := common.CopyBytes(sig)
+	wrong[64] += 4
+	if owner, err := recoverSigner(testHash, wrong); err == nil && owner == testOwner {
+		t.Error("recoverSigner accepted an ecdsa signature marked as eth_sign")
+	}
+
+	for _, v := range []byte{0, 1} {
+		if _, err := recoverSigner(testHash, signature65(v)); err == nil {
+			t.Errorf("recoverSigner(v=%d) succeeded, want an error", v)
+		}
+	}
+	if _, err := recoverSigner(testHash, sig[:64]); err == nil {
+		t.Error("recoverSigner of 64 bytes succeeded, want an error")
+	}
+}
+
+func TestDecodeSignature(t *testing.T) {
+	owner := common.HexToAddress("0x00000000000000000000000000000000000000c1")
+	contractData := []byte("contract signature data")
+
+	ecdsa, err := signSafeTxHash(testHash, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approved := encodeApprovedHash(owner)
+
+	tests := []struct {
+		name      string
+		signature []byte
+		typ       string
+		owner     common.Address
+		data      []byte
+	}{
+		{"ecdsa", ecdsa, SIG_ECDSA, common.Address{}, ecdsa},
+		{"eth_sign", signature65(31), SIG_ETH_SIGN, common.Address{}, signature65(31)},
+		{"approved hash", approved.Signature, SIG_APPROVED_HASH, owner, approved.Signature},
+		{"contract", encodeContractSignature(owner, contractData), SIG_CONTRACT, owner, contractData},
+		{"empty contract", encodeContractSignature(owner, nil), SIG_CONTRACT, owner, []byte{}},
+	}
+	for _, tt := range tests {
+		sig, err := decodeSignature(tt.signature)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if sig.Type != tt.typ || sig.Owner != tt.owner || !bytes.Equal(sig.Signature, tt.data) {
+			t.Errorf("%s: decoded %+v, want type %s owner %s data %x", tt.name, sig, tt.typ, tt.owner.Hex(), tt.data)
+		}
+	}
+}
+
+func TestDecodeSignatureErrors(t *testing.T) {
+	owner := common.HexToAddress("0x00000000000000000000000000000000000000c1")
+
+	contract := encodeContractSignature(owner, []byte("data"))
+	badOffset := common.CopyBytes(contract)
+	badOffset[63] = 0xff
+	badLength := common.CopyBytes(contract)
+	badLength[65+31] = 0xff
+
+	tests := []struct {
+		name      string
+		signature []byte
+		err       string
+	}{
+		{"short", make([]byte, 64), "invalid signature length"},
+		{"unknown type", signature65(2), "unsupported signature type"},
+		{"long ecdsa", append(signature65(27), 0), "invalid signature length"},
+		{"long approved hash", append(encodeApprovedHash(owner).Signature, 0), "invalid signature length"},
+		{"contract offset", badOffset, "invalid contract signature offset"},
+		{"contract length", badLength, "invalid contract signature length"},
+		{"truncated contract", contract[:len(contract)-1], "invalid contract signature length"},
+	}
+	for _, tt := range tests {
+		if _, err := decodeSignature(tt.signature); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestEncodeSignaturesSortsByOwner(t *testing.T) {
+	low := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	high := common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff")
+
+	blob := encodeSignatures([]ownerSignature{
+		{Owner: high, Type: SIG_ECDSA, Signature: signature65(27)},
+		encodeApprovedHash(low),
+	})
+	if len(blob) != 130 {
+		t.Fatalf("encoded %d bytes, want 130", len(blob))
+	}
+	if common.BytesToAddress(blob[:32]) != low || blob[64] != 1 {
+		t.Errorf("first signature is %x, want the approved hash of %s", blob[:65], low.Hex())
+	}
+	if blob[129] != 27 {
+		t.Errorf("second signature has v=%d, want 27", blob[129])
+	}
+}
+
+func TestSplitSignaturesRoundTrip(t *testing.T) {
+	ecdsa, err := signSafeTxHash(testHash, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractA := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	contractB := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+	approved := common.HexToAddress("0x0000000000000000000000000000000000000001")
+
+	sigs := []ownerSignature{
+		{Owner: contractB, Type: SIG_CONTRACT, Signature: []byte("second contract signature, longer than one word of data")},
+		{Owner: testOwner, Type: SIG_ECDSA, Signature: ecdsa},
+		encodeApprovedHash(approved),
+		{Owner: contractA, Type: SIG_CONTRACT, Signature: []byte("first")},
+	}
+
+	blob := encodeSignatures(sigs)
+	split, err := splitSignatures(blob, len(sigs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := sortSignatures(sigs)
+	for i := range split {
+		sig := &split[i]
+		if sig.Type == SIG_ECDSA {
+			if sig.Owner, err = recoverSigner(testHash, sig.Signature); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if sig.Owner != want[i].Owner || sig.Type != want[i].Type || !bytes.Equal(sig.Signature, want[i].Signature) {
+			t.Errorf("signature %d: got %+v, want %+v", i, sig, want[i])
+		}
+	}
+
+	if again := encodeSignatures(split); !bytes.Equal(again, blob) {
+		t.Errorf("re-encoding the split signatures gives %x, want %x", again, blob)
+	}
+}
+
+func TestSplitSignaturesErrors(t *testing.T) {
+	owner := common.HexToAddress("0x00000000000000000000000000000000000000c1")
+	blob := encodeSignatures([]ownerSignature{
+		{Owner: owner, Type: SIG_CONTRACT, Signature: []byte("data")},
+		encodeApprovedHash(common.HexToAddress("0x00000000000000000000000000000000000000c2")),
+	})
+
+	overlapping := common.CopyBytes(blob)
+	overlapping[63] = 65
+
+	tests := []struct {
+		name  string
+		blob  []byte
+		count int
+		err   string
+	}{
+		{"too short", blob[:129], 2, "too short"},
+		{"no signatures", blob, 0, "too short"},
+		{"static overlap", overlapping, 2, "points into the static part"},
+		{"dynamic out of range", blob[:130+32], 2, "invalid contract signature length"},
+		{"unknown type", signature65(5), 1, "unsupported signature type"},
+	}
+	for _, tt := range tests {
+		if _, err := splitSignatures(tt.blob, tt.count); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestImportSignature(t *testing.T) {
+	typed, err := crypto.Sign(testHash.Bytes(), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	personal, err := crypto.Sign(accounts.TextHash(testHash.Bytes()), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ethSign, _ := toEthSign(personal)
+	normalized, _ := normalizeECDSA(typed)
+
+	tests := []struct {
+		name      string
+		signature []byte
+		want      []byte
+	}{
+		{"typed data, raw v", typed, normalized},
+		{"typed data", normalized, normalized},
+		{"personal_sign", personal, ethSign},
+		{"eth_sign", ethSign, ethSign},
+	}
+	for _, tt := range tests {
+		got, err := importSignature(testHash, testOwner, tt.signature)
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("importSignature(%s) = %x, %v, want %x", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := importSignature(testHash, common.HexToAddress(testRecipient), typed); err == nil || !strings.Contains(err.Error(), "not the owner") {
+		t.Errorf("importSignature(other owner) error = %v, want not the owner", err)
+	}
+	if _, err := importSignature(testHash, testOwner, signature65(0)); err == nil {
+		t.Error("importSignature(contract signature) succeeded, want an error")
+	}
+}
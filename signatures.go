@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+type detachedSignature struct {
+	SafeTxHash string `json:"safeTxHash"`
+	Owner      string `json:"owner"`
+	Signature  string `json:"signature"`
+}
+
+func loadSafeTxFile(path string) (*multisigTxResponse, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx multisigTxResponse
+	if err := json.Unmarshal(content, &tx); err != nil {
+		return nil, fmt.Errorf("invalid transaction file %s: %w", path, err)
+	}
+	return &tx, nil
+}
+
+// fileTypedData is the typed data a transaction file is signed as and its
+// hash, for the safe version the file records or else the one read via rpc
+// when given, or from the transaction service
+func fileTypedData(tx *multisigTxResponse, rpc string) (apitypes.TypedData, common.Hash, error) {
+	var client EthClient
+	if tx.SafeVersion == "" && rpc != "" {
+		var err error
+		if client, err = dialRPC(rpc); err != nil {
+			return apitypes.TypedData{}, common.Hash{}, err
+		}
+		defer client.Close()
+	}
+	chainID, version, err := txDomain(tx, client)
+	if err != nil {
+		return apitypes.TypedData{}, common.Hash{}, err
+	}
+	typedData, err := tx.typedData(chainID, version)
+	if err != nil {
+		return apitypes.TypedData{}, common.Hash{}, err
+	}
+	encoded, err := encodeTypedData(typedData)
+	if err != nil {
+		return apitypes.TypedData{}, common.Hash{}, err
+	}
+	return typedData, crypto.Keccak256Hash(encoded), nil
+}
+
+func loadDetachedSignature(path string) (*detachedSignature, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig detachedSignature
+	if err := json.Unmarshal(content, &sig); err != nil {
+		return nil, fmt.Errorf("invalid signature file %s: %w", path, err)
+	}
+	return &sig, nil
+}
+
+// signTransaction signs the typed data of a safe transaction with key, or on
+// behalf of contractOwner when set, returning the owner and its standalone
+// signature
+func signTransaction(typedData apitypes.TypedData, key *ecdsa.PrivateKey, contractOwner, rpc string) (common.Address, []byte, error) {
+	encodedTx, err := encodeTypedData(typedData)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	if contractOwner == "" {
+		signature, err := signSafeTxHash(crypto.Keccak256Hash(encodedTx), key)
+		return crypto.PubkeyToAddress(key.PublicKey), signature, err
+	}
+
+	if err := checkAddress(contractOwner); err != nil {
+		return common.Address{}, nil, fmt.Errorf("invalid contract owner %q: %w", contractOwner, err)
+	}
+	owner := common.HexToAddress(contractOwner)
+
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	defer client.Close()
+
+	signature, err := signForContractOwner(client, owner, encodedTx, key)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	ok, err := isValidContractSignature(client, owner, encodedTx, signature[65+32:])
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if !ok {
+		return common.Address{}, nil, fmt.Errorf("%s does not accept the signature, is the key an owner with threshold 1?", owner.Hex())
+	}
+
+	return owner, signature, nil
+}
+
+// verifyOwnerSignature checks a standalone signature over the safe transaction
+// and returns the owner it belongs to; contract and approved-hash signatures
+// are checked over RPC when a client is given, and left unverified otherwise
+func verifyOwnerSignature(safe common.Address, hash common.Hash, encodedTx []byte, signature []byte, client EthClient) (*ownerSignature, error) {
+	sig, err := decodeSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if sig.Type == SIG_APPROVED_HASH {
+		if client == nil {
+			return sig, nil
+		}
+		ok, err := isHashApproved(client, safe, sig.Owner, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s has not approved hash %s onchain", sig.Owner.Hex(), hash.Hex())
+		}
+		return sig, nil
+	}
+
+	if sig.Type != SIG_CONTRACT {
+		if sig.Owner, err = recoverSigner(hash, sig.Signature); err != nil {
+			return nil, err
+		}
+		return sig, nil
+	}
+
+	if client == nil {
+		return sig, nil
+	}
+
+	ok, err := isValidContractSignature(client, sig.Owner, encodedTx, sig.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("contract owner %s rejected its signature", sig.Owner.Hex())
+	}
+	return sig, nil
+}
+
+// unverifiedSignature tells whether verifyOwnerSignature could only decode
+// sig, contract and approved-hash signatures being checked onchain
+func unverifiedSignature(sig *ownerSignature, client EthClient) bool {
+	return client == nil && (sig.Type == SIG_CONTRACT || sig.Type == SIG_APPROVED_HASH)
+}
+
+// aggregateSignatures verifies detached signatures for the safe transaction
+// and returns the signatures blob for execTransaction with how many it holds;
+// signatures of addresses outside the owner set are left out, as are those
+// that can't be verified without a client
+func aggregateSignatures(tx *multisigTxResponse, sigs []*detachedSignature, owners []common.Address, threshold int, client EthClient) ([]byte, int, error) {
+	chainID, version, err := txDomain(tx, client)
+	if err != nil {
+		return nil, 0, err
+	}
+	typedData, err := tx.typedData(chainID, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	encodedTx, err := encodeTypedData(typedData)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash := crypto.Keccak256Hash(encodedTx)
+
+	isOwner := map[common.Address]bool{}
+	for _, owner := range owners {
+		isOwner[owner] = true
+	}
+
+	bySigner := map[common.Address]ownerSignature{}
+	unverified := 0
+	for _, detached := range sigs {
+		if common.HexToHash(detached.SafeTxHash) != hash {
+			return nil, 0, fmt.Errorf("signature of %s is for %s, not %s", detached.Owner, detached.SafeTxHash, hash.Hex())
+		}
+
+		signature, err := hexutil.Decode(detached.Signature)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid signature of %s: %w", detached.Owner, err)
+		}
+
+		sig, err := verifyOwnerSignature(common.HexToAddress(tx.Safe), hash, encodedTx, signature, client)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid signature of %s: %w", detached.Owner, err)
+		}
+		if sig.Owner != common.HexToAddress(detached.Owner) {
+			return nil, 0, fmt.Errorf("signature declared for %s belongs to %s", detached.Owner, sig.Owner.Hex())
+		}
+		// a signature of a removed owner makes the safe revert with GS026
+		if !isOwner[sig.Owner] {
+			logger.Warn("signature of a non-owner ignored", "owner", sig.Owner.Hex())
+			continue
+		}
+		if _, ok := bySigner[sig.Owner]; ok {
+			logger.Warn("duplicate signature ignored", "owner", sig.Owner.Hex())
+			continue
+		}
+		// an invalid one among the threshold makes the safe revert
+		if unverifiedSignature(sig, client) {
+			logger.Warn(sig.Type+" signature not verified without -rpc, left out", "owner", sig.Owner.Hex())
+			unverified++
+			continue
+		}
+		bySigner[sig.Owner] = *sig
+	}
+
+	if len(bySigner) < threshold && unverified > 0 {
+		return nil, 0, fmt.Errorf("only %d of %d required signatures, %d contract or approved-hash signatures left out need -rpc to be verified", len(bySigner), threshold, unverified)
+	}
+	if len(bySigner) < threshold {
+		return nil, 0, fmt.Errorf("only %d of %d required signatures", len(bySigner), threshold)
+	}
+	if len(bySigner) == 0 {
+		return nil, 0, errors.New("no signatures to aggregate")
+	}
+
+	var collected []ownerSignature
+	for _, sig := range bySigner {
+		collected = append(collected, sig)
+	}
+	return encodeSignatures(collected), len(collected), nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const (
+	SIGNER_KEY      = "key"
+	SIGNER_KEYSTORE = "keystore"
+	SIGNER_LEDGER   = "ledger"
+
+	SIGNER_WALLETCONNECT = "walletconnect"
+)
+
+// signer is an owner key backend able to sign safe transactions
+type signer interface {
+	Address() common.Address
+	// SignTypedData signs EIP-712 typed data, returning a 65 byte signature
+	// with v of 27 or 28
+	SignTypedData(typedData apitypes.TypedData) ([]byte, error)
+	Close()
+}
+
+// hashSigner is implemented by backends able to sign arbitrary digests, which
+// review artifacts need
+type hashSigner interface {
+	SignHash(hash common.Hash) ([]byte, error)
+}
+
+// signerConfig describes one configured signer backend, secrets are read
+// from environment variables rather than stored in the config
+type signerConfig struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	KeyEnv      string `json:"keyEnv,omitempty"`
+	Keystore    string `json:"keystore,omitempty"`
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+	Path        string `json:"path,omitempty"`
+	ProjectID   string `json:"projectId,omitempty"`
+	KeyID       string `json:"keyId,omitempty"`
+	TokenEnv    string `json:"tokenEnv,omitempty"`
+	Endpoint    string `json:"endpoint,omitempty"`
+	Account     string `json:"account,omitempty"`
+}
+
+func loadSignersConfig(path string) ([]signerConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		path = configPath("signers.json")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config []signerConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("invalid signers config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+type keySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *keySigner) Address() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+func (s *keySigner) SignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	encoded, err := encodeTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+	return signSafeTxHash(crypto.Keccak256Hash(encoded), s.key)
+}
+
+func (s *keySigner) SignHash(hash common.Hash) ([]byte, error) {
+	return signSafeTxHash(hash, s.key)
+}
+
+func (s *keySigner) Close() {}
+
+type ledgerSigner struct {
+	wallet  accounts.Wallet
+	account accounts.Account
+}
+
+func (s *ledgerSigner) Address() common.Address {
+	return s.account.Address
+}
+
+func (s *ledgerSigner) SignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	encoded, err := encodeTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.wallet.SignData(s.account, accounts.MimetypeTypedData, encoded)
+	if err != nil {
+		return nil, err
+	}
+	if signature, err = normalizeECDSA(signature); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+func (s *ledgerSigner) Close() {
+	s.wallet.Close()
+}
+
+func secretFromEnv(name, what string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("no environment variable configured for the %s", what)
+	}
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("$%s holding the %s is not set", name, what)
+	}
+	return value, nil
+}
+
+func openLedger(path string) (signer, error) {
+	derivation := accounts.DefaultBaseDerivationPath
+	if path != "" {
+		var err error
+		if derivation, err = accounts.ParseDerivationPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	hub, err := usbwallet.NewLedgerHub()
+	if err != nil {
+		return nil, err
+	}
+	wallets := hub.Wallets()
+	if len(wallets) == 0 {
+		return nil, errors.New("no ledger device connected")
+	}
+
+	wallet := wallets[0]
+	if err := wallet.Open(""); err != nil {
+		return nil, fmt.Errorf("opening ledger failed, is it unlocked with the Ethereum app open? %w", err)
+	}
+	account, err := wallet.Derive(derivation, true)
+	if err != nil {
+		wallet.Close()
+		return nil, err
+	}
+	return &ledgerSigner{wallet: wallet, account: account}, nil
+}
+
+// openSigner connects to the backend, failing if the key is not usable
+func openSigner(c signerConfig) (signer, error) {
+	switch c.Type {
+	case SIGNER_KEY:
+		hex, err := secretFromEnv(c.KeyEnv, "private key")
+		if err != nil {
+			return nil, err
+		}
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(hex, "0x"))
+		if err != nil {
+			return nil, err
+		}
+		return &keySigner{key: key}, nil
+
+	case SIGNER_KEYSTORE:
+		content, err := ioutil.ReadFile(c.Keystore)
+		if err != nil {
+			return nil, err
+		}
+		password, err := secretFromEnv(c.PasswordEnv, "keystore password")
+		if err != nil {
+			return nil, err
+		}
+		key, err := keystore.DecryptKey(content, password)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting %s failed: %w", c.Keystore, err)
+		}
+		return &keySigner{key: key.PrivateKey}, nil
+
+	case SIGNER_LEDGER:
+		return openLedger(c.Path)
+
+	case SIGNER_WALLETCONNECT:
+		return openWalletConnect(c.ProjectID)
+
+	case SIGNER_AWS_KMS:
+		backend, err := newAWSKMS(c.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		return openKMS(backend)
+
+	case SIGNER_GCP_KMS:
+		if c.KeyID == "" {
+			return nil, errors.New("gcp-kms signers need the keyId of a key version, projects/.../cryptoKeyVersions/<n>")
+		}
+		tokenEnv := c.TokenEnv
+		if tokenEnv == "" {
+			tokenEnv = "GOOGLE_OAUTH_ACCESS_TOKEN"
+		}
+		return openKMS(&gcpKMS{name: c.KeyID, tokenEnv: tokenEnv})
+
+	case SIGNER_CLEF:
+		return openClef(c.Endpoint, c.Account)
+
+	case SIGNER_MNEMONIC:
+		return openMnemonic(c.KeyEnv, c.Path, c.PasswordEnv)
+	}
+
+	return nil, fmt.Errorf("unknown signer type %q, expected one of %s", c.Type,
+		strings.Join([]string{SIGNER_KEY, SIGNER_KEYSTORE, SIGNER_LEDGER, SIGNER_WALLETCONNECT, SIGNER_AWS_KMS, SIGNER_GCP_KMS, SIGNER_CLEF, SIGNER_MNEMONIC}, ", "))
+}
+
+// checkSigners opens every configured signer and checks it is an owner of the
+// safe, printing a line per signer
+func checkSigners(configs []signerConfig, owners []common.Address) int {
+	isOwner := map[common.Address]bool{}
+	for _, owner := range owners {
+		isOwner[owner] = true
+	}
+
+	failed := 0
+	for _, c := range configs {
+		s, err := openSigner(c)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %-16s %-9s unreachable: %v\n", c.Name, c.Type, err)
+			continue
+		}
+		address := s.Address()
+		s.Close()
+
+		if !isOwner[address] {
+			failed++
+			fmt.Printf("FAIL  %-16s %-9s %s is not an owner\n", c.Name, c.Type, address.Hex())
+			continue
+		}
+		fmt.Printf("ok    %-16s %-9s %s\n", c.Name, c.Type, address.Hex())
+	}
+	return failed
+}
+
+// findSigner opens the configured signer called name
+func findSigner(signersFile, name string) (signer, error) {
+	configs, err := loadSignersConfig(signersFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if c.Name == name {
+			return openSigner(c)
+		}
+	}
+	return nil, fmt.Errorf("no signer %q configured", name)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const SIMULATION_GAS = 10000000
+
+type tenderlyConfig struct {
+	Account   string `json:"account"`
+	Project   string `json:"project"`
+	AccessKey string `json:"accessKey"`
+}
+
+// loadTenderlyConfig returns nil when no credentials are configured
+func loadTenderlyConfig() (*tenderlyConfig, error) {
+	path := configPath("tenderly.json")
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config tenderlyConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("invalid tenderly config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+type simulationResult struct {
+	Success bool
+	Reason  string
+	Source  string
+}
+
+func (r *simulationResult) String() string {
+	if r.Success {
+		return "succeeds (" + r.Source + ")"
+	}
+	return "reverts: " + r.Reason + " (" + r.Source + ")"
+}
+
+// revertReason decodes Error(string) revert data, falling back to the raw data
+func revertReason(data []byte) string {
+	if len(data) == 0 {
+		return "no revert reason"
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+	return hexutil.Encode(data)
+}
+
+func callError(err error) (string, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return "", false
+	}
+	encoded, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return err.Error(), true
+	}
+	data, decodeErr := hexutil.Decode(encoded)
+	if decodeErr != nil {
+		return err.Error(), true
+	}
+	return revertReason(data), true
+}
+
+// stubExecution builds an execTransaction call that passes the signature check
+// once the threshold is overridden to 1: the approved-hash entry of the owner
+// sending the call
+func stubExecution(owner, to common.Address, value *big.Int, data []byte, operation uint8, safeTxGas, baseGas int64) ([]byte, error) {
+	signatures := encodeSignatures([]ownerSignature{encodeApprovedHash(owner)})
+	return encodeCall("execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)",
+		to, value, data, operation, big.NewInt(safeTxGas), big.NewInt(baseGas), big.NewInt(0), common.Address{}, common.Address{}, signatures)
+}
+
+// simulateExecution runs execTransaction for the proposal against the current
+// state, through tenderly when credentials are configured or eth_call with a
+// state override of the threshold otherwise
+func simulateExecution(rpcURL string, safe, to common.Address, value *big.Int, data []byte, operation uint8, safeTxGas, baseGas int64) (*simulationResult, error) {
+	if rpcURL == "" {
+		return nil, errors.New("-simulate requires an -rpc endpoint")
+	}
+
+	rpcClient, err := dialRawRPC(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rpcClient.Close()
+	client := ethclient.NewClient(rpcClient)
+
+	state, err := readSafeState(client, safe, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(state.Owners) == 0 {
+		return nil, fmt.Errorf("safe %s has no owners", safe.Hex())
+	}
+	owner := state.Owners[0]
+
+	call, err := stubExecution(owner, to, value, data, operation, safeTxGas, baseGas)
+	if err != nil {
+		return nil, err
+	}
+
+	tenderly, err := loadTenderlyConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var result *simulationResult
+	if tenderly != nil {
+		chainID, err := client.ChainID(opCtx)
+		if err != nil {
+			return nil, err
+		}
+		result, err = tenderly.simulate(chainID, owner, safe, call)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		result, err = simulateWithOverride(rpcClient, owner, safe, call)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// execTransaction swallows the revert reason of the inner call (or reverts
+	// with GS013), replay a plain call directly to recover it
+	if !result.Success && (result.Reason == "" || result.Reason == "GS013") && operation == 0 {
+		_, err := callFrom(client, safe, to, value, data)
+		if reason, ok := callError(err); ok {
+			result.Reason = reason
+		}
+	}
+	if !result.Success && result.Reason == "" {
+		result.Reason = "inner call failed"
+	}
+
+	return result, nil
+}
+
+func simulateWithOverride(client *rpc.Client, owner, safe common.Address, call []byte) (*simulationResult, error) {
+	args := map[string]interface{}{
+		"from": owner,
+		"to":   safe,
+		"gas":  hexutil.Uint64(SIMULATION_GAS),
+		"data": hexutil.Bytes(call),
+	}
+	overrides := map[common.Address]interface{}{
+		safe: map[string]interface{}{
+			"stateDiff": map[common.Hash]common.Hash{thresholdSlot: common.BigToHash(big.NewInt(1))},
+		},
+	}
+
+	var result hexutil.Bytes
+	err := client.CallContext(opCtx, &result, "eth_call", args, "latest", overrides)
+	if err != nil {
+		if reason, ok := callError(err); ok {
+			return &simulationResult{Reason: reason, Source: "eth_call"}, nil
+		}
+		return nil, err
+	}
+
+	// execTransaction returns whether the inner call succeeded
+	return &simulationResult{Success: new(big.Int).SetBytes(result).Sign() != 0, Source: "eth_call"}, nil
+}
+
+type tenderlySimulationRequest struct {
+	NetworkID    string                                 `json:"network_id"`
+	From         string                                 `json:"from"`
+	To           string                                 `json:"to"`
+	Input        string                                 `json:"input"`
+	Gas          int64                                  `json:"gas"`
+	Value        string                                 `json:"value"`
+	Save         bool                                   `json:"save"`
+	StateObjects map[string]tenderlyStateObjectOverride `json:"state_objects"`
+}
+
+type tenderlyStateObjectOverride struct {
+	Storage map[string]string `json:"storage"`
+}
+
+type tenderlySimulationResponse struct {
+	Transaction struct {
+		Status          bool   `json:"status"`
+		ErrorMessage    string `json:"error_message"`
+		TransactionInfo struct {
+			CallTrace struct {
+				Output string `json:"output"`
+			} `json:"call_trace"`
+		} `json:"transaction_info"`
+	} `json:"transaction"`
+}
+
+func (t *tenderlyConfig) simulate(chainID *big.Int, owner, safe common.Address, call []byte) (*simulationResult, error) {
+	request := tenderlySimulationRequest{
+		NetworkID: chainID.String(),
+		From:      owner.Hex(),
+		To:        safe.Hex(),
+		Input:     hexutil.Encode(call),
+		Gas:       SIMULATION_GAS,
+		Value:     "0",
+		StateObjects: map[string]tenderlyStateObjectOverride{
+			safe.Hex(): {Storage: map[string]string{thresholdSlot.Hex(): common.BigToHash(big.NewInt(1)).Hex()}},
+		},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	url := "https://api.tenderly.co/api/v1/account/" + t.Account + "/project/" + t.Project + "/simulate"
+	req, err := http.NewRequestWithContext(opCtx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Key", t.AccessKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tenderly simulation failed with status %d: %s", resp.StatusCode, content)
+	}
+
+	var data tenderlySimulationResponse
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+
+	tx := data.Transaction
+	if !tx.Status {
+		return &simulationResult{Reason: tx.ErrorMessage, Source: "tenderly"}, nil
+	}
+
+	output, _ := hexutil.Decode(tx.TransactionInfo.CallTrace.Output)
+	return &simulationResult{Success: new(big.Int).SetBytes(output).Sign() != 0, Source: "tenderly"}, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// createWithDurations of the Sablier v2.1 LockupLinear; its params tuple only
+// holds static types, so it encodes as its fields in order
+const (
+	SABLIER_CREATE_WITH_DURATIONS = "createWithDurations((address,address,uint128,address,bool,bool,(uint40,uint40),(address,uint256)))"
+	SABLIER_CREATE_FIELDS         = "(address,address,uint128,address,bool,bool,uint40,uint40,address,uint256)"
+)
+
+// statuses of a Sablier stream by statusOf
+var streamStatuses = []string{"pending", "streaming", "settled", "canceled", "depleted"}
+
+// streamParams is a linear stream funded by the safe, starting on execution
+type streamParams struct {
+	Lockup       common.Address
+	Asset        common.Address
+	Recipient    common.Address
+	Amount       *big.Int
+	Cliff        time.Duration
+	Duration     time.Duration
+	Cancelable   bool
+	Transferable bool
+}
+
+// parseStreamDuration accepts go durations and whole days, e.g. 90d
+func parseStreamDuration(value string) (time.Duration, error) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.ParseUint(days, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+func encodeStreamCreate(safe common.Address, p *streamParams) ([]byte, error) {
+	args, err := methodArguments(SABLIER_CREATE_FIELDS)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := args.Pack(safe, p.Recipient, p.Amount, p.Asset, p.Cancelable, p.Transferable,
+		big.NewInt(int64(p.Cliff/time.Second)), big.NewInt(int64(p.Duration/time.Second)),
+		common.Address{}, new(big.Int))
+	if err != nil {
+		return nil, err
+	}
+	return append(crypto.Keccak256([]byte(SABLIER_CREATE_WITH_DURATIONS))[:4], packed...), nil
+}
+
+// buildStreamCreate returns the approve of the deposit to the lockup and the
+// stream creation, after checking the stream is valid and the safe holds the
+// deposit
+func buildStreamCreate(client EthClient, safe common.Address, p *streamParams) ([]multiSendTx, error) {
+	if p.Amount.Sign() <= 0 || p.Amount.BitLen() > 128 {
+		return nil, fmt.Errorf("invalid stream amount %s", p.Amount)
+	}
+	if p.Duration < time.Second || p.Duration/time.Second >= 1<<40 {
+		return nil, fmt.Errorf("invalid stream duration %s", p.Duration)
+	}
+	if p.Cliff < 0 || p.Cliff >= p.Duration {
+		return nil, fmt.Errorf("the cliff %s must end before the stream, %s", p.Cliff, p.Duration)
+	}
+	if p.Recipient == safe {
+		return nil, errors.New("the recipient is the safe itself")
+	}
+	if code, err := client.CodeAt(opCtx, p.Lockup, nil); err != nil {
+		return nil, err
+	} else if len(code) == 0 {
+		return nil, fmt.Errorf("lockup %s is not a contract", p.Lockup.Hex())
+	}
+	balance, err := callUint(client, p.Asset, "balanceOf(address)", safe)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(p.Amount) < 0 {
+		return nil, fmt.Errorf("the safe holds %s of %s, less than the deposit of %s", balance, displayAddress(p.Asset), p.Amount)
+	}
+
+	approve, err := encodeCall("approve(address,uint256)", p.Lockup, p.Amount)
+	if err != nil {
+		return nil, err
+	}
+	create, err := encodeStreamCreate(safe, p)
+	if err != nil {
+		return nil, err
+	}
+	return []multiSendTx{
+		{To: p.Asset, Value: new(big.Int), Data: approve},
+		{To: p.Lockup, Value: new(big.Int), Data: create},
+	}, nil
+}
+
+// previewStreamCreate prints the stream as it will run from the execution of
+// the proposal
+func previewStreamCreate(p *streamParams, symbol string, decimals int) {
+	perDay := new(big.Int).Mul(p.Amount, big.NewInt(int64(24*time.Hour/time.Second)))
+	perDay.Div(perDay, big.NewInt(int64(p.Duration/time.Second)))
+
+	fmt.Println("stream of", formatUnits(p.Amount, decimals, display.Precision), symbol, "to", displayAddress(p.Recipient))
+	fmt.Println("  lockup:", displayAddress(p.Lockup))
+	fmt.Println("  starts on execution, ends", p.Duration, "later")
+	if p.Cliff > 0 {
+		fmt.Println("  nothing is withdrawable before the cliff,", p.Cliff, "after the start")
+	}
+	fmt.Println("  rate:", formatUnits(perDay, decimals, display.Precision), symbol, "per day")
+	fmt.Println("  cancelable:", p.Cancelable, "transferable:", p.Transferable)
+}
+
+// streamState is a stream read from its lockup
+type streamState struct {
+	Sender       common.Address
+	Recipient    common.Address
+	Asset        common.Address
+	Status       string
+	Cancelable   bool
+	Start        time.Time
+	Cliff        time.Time
+	End          time.Time
+	Deposited    *big.Int
+	Streamed     *big.Int
+	Withdrawn    *big.Int
+	Withdrawable *big.Int
+	Refundable   *big.Int
+}
+
+func readStream(client EthClient, lockup common.Address, id *big.Int) (*streamState, error) {
+	s := &streamState{}
+	addresses := []struct {
+		signature string
+		field     *common.Address
+	}{
+		{"getSender(uint256)", &s.Sender},
+		{"getRecipient(uint256)", &s.Recipient},
+		{"getAsset(uint256)", &s.Asset},
+	}
+	for _, a := range addresses {
+		values, err := callView(client, lockup, a.signature, "(address)", id)
+		if err != nil {
+			return nil, fmt.Errorf("reading stream %s of %s: %w", id, lockup.Hex(), err)
+		}
+		*a.field = values[0].(common.Address)
+	}
+
+	amounts := []struct {
+		signature string
+		field     **big.Int
+	}{
+		{"getDepositedAmount(uint256)", &s.Deposited},
+		{"streamedAmountOf(uint256)", &s.Streamed},
+		{"getWithdrawnAmount(uint256)", &s.Withdrawn},
+		{"withdrawableAmountOf(uint256)", &s.Withdrawable},
+		{"refundableAmountOf(uint256)", &s.Refundable},
+	}
+	for _, a := range amounts {
+		amount, err := callUint(client, lockup, a.signature, id)
+		if err != nil {
+			return nil, err
+		}
+		*a.field = amount
+	}
+
+	times := []struct {
+		signature string
+		field     *time.Time
+	}{
+		{"getStartTime(uint256)", &s.Start},
+		{"getCliffTime(uint256)", &s.Cliff},
+		{"getEndTime(uint256)", &s.End},
+	}
+	for _, t := range times {
+		seconds, err := callUint(client, lockup, t.signature, id)
+		if err != nil {
+			return nil, err
+		}
+		*t.field = time.Unix(seconds.Int64(), 0)
+	}
+
+	status, err := callUint(client, lockup, "statusOf(uint256)", id)
+	if err != nil {
+		return nil, err
+	}
+	s.Status = "unknown"
+	if status.IsInt64() && status.Int64() < int64(len(streamStatuses)) {
+		s.Status = streamStatuses[status.Int64()]
+	}
+	values, err := callView(client, lockup, "isCancelable(uint256)", "(bool)", id)
+	if err != nil {
+		return nil, err
+	}
+	s.Cancelable = values[0].(bool)
+	return s, nil
+}
+
+func printStream(client EthClient, id *big.Int, s *streamState) error {
+	symbol, decimals, err := tokenDecimals(client, s.Asset)
+	if err != nil {
+		return err
+	}
+	amount := func(a *big.Int) string {
+		return formatUnits(a, decimals, display.Precision) + " " + symbol
+	}
+
+	fmt.Printf("stream %s: %s\n", id, s.Status)
+	fmt.Println("  sender:", displayAddress(s.Sender))
+	fmt.Println("  recipient:", displayAddress(s.Recipient))
+	fmt.Println("  asset:", displayAddress(s.Asset))
+	fmt.Println("  period:", s.Start.UTC().Format(time.RFC3339), "to", s.End.UTC().Format(time.RFC3339))
+	if s.Cliff.After(s.Start) {
+		fmt.Println("  cliff:", s.Cliff.UTC().Format(time.RFC3339))
+	}
+	fmt.Println("  deposited:", amount(s.Deposited))
+	fmt.Println("  streamed:", amount(s.Streamed), "withdrawn:", amount(s.Withdrawn))
+	fmt.Println("  withdrawable:", amount(s.Withdrawable))
+	fmt.Println("  refundable:", amount(s.Refundable), "cancelable:", s.Cancelable)
+	return nil
+}
+
+// buildStreamCancel checks the safe can cancel the stream and returns the
+// cancel call, the recipient keeps what has streamed and the rest is refunded
+func buildStreamCancel(client EthClient, safe, lockup common.Address, id *big.Int) ([]byte, error) {
+	s, err := readStream(client, lockup, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := printStream(client, id, s); err != nil {
+		return nil, err
+	}
+	switch {
+	case s.Sender != safe:
+		return nil, fmt.Errorf("stream %s was created by %s, only its sender can cancel it", id, s.Sender.Hex())
+	case !s.Cancelable:
+		return nil, fmt.Errorf("stream %s is %s and can't be canceled", id, s.Status)
+	}
+	fmt.Println("canceling refunds the refundable amount to the safe, the recipient can still withdraw the withdrawable amount")
+	return encodeCall("cancel(uint256)", id)
+}
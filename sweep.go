@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// buildSweep returns the transfers moving every balance of the safe listed by
+// the service to dest, the native balance too unless skipNative; tokens in
+// exclude are left behind, e.g. spam tokens reverting on transfer
+func buildSweep(assets *safeAssets, dest common.Address, skipNative bool, exclude map[common.Address]bool) ([]multiSendTx, error) {
+	var txs []multiSendTx
+	for _, b := range assets.Balances {
+		amount, ok := new(big.Int).SetString(b.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid balance %q", b.Balance)
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+
+		if b.TokenAddress == nil {
+			if skipNative {
+				continue
+			}
+			fmt.Println("sweeping", formatWei(amount))
+			txs = append(txs, multiSendTx{To: dest, Value: amount, Data: []byte{}})
+			continue
+		}
+
+		token := common.HexToAddress(*b.TokenAddress)
+		if exclude[token] {
+			fmt.Println("leaving", balanceAmount(&b, amount), "behind")
+			continue
+		}
+		data, err := encodeCall("transfer(address,uint256)", dest, amount)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("sweeping", balanceAmount(&b, amount))
+		txs = append(txs, multiSendTx{To: token, Value: new(big.Int), Data: data})
+	}
+	return txs, nil
+}
+
+// balanceAmount formats a token balance with the token of the service listing
+func balanceAmount(b *tokenBalance, amount *big.Int) string {
+	token := common.HexToAddress(*b.TokenAddress)
+	if b.Token == nil || display.Numbers == NUMBERS_RAW {
+		return amount.String() + " of " + displayAddress(token)
+	}
+	return formatUnits(amount, b.Token.Decimals, display.Precision) + " " + b.Token.Symbol + " (" + displayAddress(token) + ")"
+}
+
+// buildNFTSweep returns the transfers of the collectibles of the safe to
+// dest, standards are detected from the token contracts
+func buildNFTSweep(client EthClient, safe, dest common.Address, collectibles []collectible, exclude map[common.Address]bool) ([]multiSendTx, error) {
+	standards := map[common.Address]string{}
+	var txs []multiSendTx
+	for _, c := range collectibles {
+		token := common.HexToAddress(c.Address)
+		if exclude[token] {
+			continue
+		}
+		id, ok := new(big.Int).SetString(c.ID, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid token id %q of %s", c.ID, token.Hex())
+		}
+
+		standard, ok := standards[token]
+		if !ok {
+			var err error
+			if standard, err = detectNFTStandard(client, token); err != nil {
+				return nil, err
+			}
+			standards[token] = standard
+		}
+
+		var data []byte
+		var err error
+		switch standard {
+		case NFT_ERC721:
+			data, err = encodeCall("safeTransferFrom(address,address,uint256)", safe, dest, id)
+		case NFT_ERC1155:
+			var balance *big.Int
+			if balance, err = callUint(client, token, "balanceOf(address,uint256)", safe, id); err != nil {
+				return nil, err
+			}
+			if balance.Sign() == 0 {
+				continue
+			}
+			data, err = encodeCall("safeTransferFrom(address,address,uint256,uint256,bytes)", safe, dest, id, balance, []byte{})
+		}
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("sweeping %s #%s %s\n", displayAddress(token), c.ID, c.Name)
+		txs = append(txs, multiSendTx{To: token, Value: new(big.Int), Data: data})
+	}
+	return txs, nil
+}
+
+// sweepTransaction is the proposal of the sweep
+func sweepTransaction(txs []multiSendTx) (common.Address, []byte, uint8, error) {
+	if len(txs) == 0 {
+		return common.Address{}, nil, 0, errors.New("nothing to sweep, the safe holds no balances")
+	}
+	to, data, operation := multiSendTransaction(txs)
+	return to, data, operation, nil
+}
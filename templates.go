@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"gopkg.in/yaml.v2"
+)
+
+// templateParam is a parameter of a template, referenced by its calls as
+// ${NAME}; a typed parameter is checked against its abi type before any call
+// is built
+type templateParam struct {
+	Name        string  `json:"name" yaml:"name"`
+	Type        string  `json:"type,omitempty" yaml:"type,omitempty"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Default     *string `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// actionTemplate is a batch file with declared parameters, dropped into the
+// templates directory as <name>.json or <name>.yaml and run by name
+type actionTemplate struct {
+	Name        string          `json:"-" yaml:"-"`
+	Description string          `json:"description,omitempty" yaml:"description,omitempty"`
+	Params      []templateParam `json:"params,omitempty" yaml:"params,omitempty"`
+	Calls       []batchCall     `json:"calls" yaml:"calls"`
+}
+
+func templatesDir() string {
+	return configPath("templates")
+}
+
+// listTemplates returns the templates of the templates directory by name,
+// unreadable ones are warned about and left out
+func listTemplates() ([]*actionTemplate, error) {
+	entries, err := ioutil.ReadDir(templatesDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*actionTemplate
+	for _, entry := range entries {
+		name := templateName(entry.Name())
+		if entry.IsDir() || name == "" {
+			continue
+		}
+		t, err := loadTemplate(name)
+		if err != nil {
+			logger.Warn("skipping template", "name", name, "err", err)
+			continue
+		}
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func templateName(file string) string {
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		if strings.HasSuffix(file, ext) {
+			return strings.TrimSuffix(file, ext)
+		}
+	}
+	return ""
+}
+
+// loadTemplate reads the template name from the templates directory and
+// checks its calls only reference declared parameters, SAFE or secrets
+func loadTemplate(name string) (*actionTemplate, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid template name %q", name)
+	}
+
+	var path string
+	var content []byte
+	var err error
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		path = filepath.Join(templatesDir(), name+ext)
+		if content, err = ioutil.ReadFile(path); !os.IsNotExist(err) {
+			break
+		}
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no template %s in %s", name, templatesDir())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := &actionTemplate{}
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(content, t)
+	} else {
+		err = yaml.UnmarshalStrict(content, t)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", path, err)
+	}
+	t.Name = name
+	if len(t.Calls) == 0 {
+		return nil, fmt.Errorf("template %s has no calls", path)
+	}
+
+	declared := map[string]bool{"SAFE": true}
+	for _, p := range t.Params {
+		if ref := "${" + p.Name + "}"; variablePattern.FindString(ref) != ref {
+			return nil, fmt.Errorf("template %s: invalid parameter name %q", path, p.Name)
+		}
+		if declared[p.Name] {
+			return nil, fmt.Errorf("template %s: parameter %s is declared twice", path, p.Name)
+		}
+		if p.Type != "" {
+			if _, err := abi.NewType(p.Type, "", nil); err != nil {
+				return nil, fmt.Errorf("template %s: parameter %s: %w", path, p.Name, err)
+			}
+		}
+		declared[p.Name] = true
+	}
+	for i, call := range t.Calls {
+		fields := append([]string{call.To, call.Value, call.Data}, call.Args...)
+		for _, field := range fields {
+			for _, match := range variablePattern.FindAllStringSubmatch(field, -1) {
+				if match[1] == "" && !declared[match[2]] {
+					return nil, fmt.Errorf("template %s: call %d references the undeclared parameter %s", path, i+1, match[2])
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// templateVariables resolves the -param values of the template, defaults
+// filling in those not given; typed parameters are checked against their type
+func templateVariables(t *actionTemplate, params map[string]string) (*variables, error) {
+	declared := map[string]bool{}
+	values := map[string]string{}
+	var missing []string
+	for _, p := range t.Params {
+		declared[p.Name] = true
+		value, ok := params[p.Name]
+		if !ok && p.Default != nil {
+			value, ok = *p.Default, true
+		}
+		if !ok {
+			missing = append(missing, p.Name)
+			continue
+		}
+		if p.Type != "" {
+			typ, _ := abi.NewType(p.Type, "", nil)
+			if _, err := parseArgument(typ, value); err != nil {
+				return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+			}
+		}
+		values[p.Name] = value
+	}
+	for name := range params {
+		if !declared[name] {
+			return nil, fmt.Errorf("template %s has no parameter %s", t.Name, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("template %s needs -param %s=<value>", t.Name, strings.Join(missing, "=<value> -param "))
+	}
+
+	return newVariables(values)
+}
+
+func printTemplate(t *actionTemplate) {
+	fmt.Println(t.Name+":", t.Description)
+	for _, p := range t.Params {
+		line := "  -param " + p.Name + "=<" + p.Type + ">"
+		if p.Type == "" {
+			line = "  -param " + p.Name + "=<value>"
+		}
+		if p.Description != "" {
+			line += "  " + p.Description
+		}
+		if p.Default != nil {
+			line += fmt.Sprintf(" (default %q)", *p.Default)
+		}
+		fmt.Println(line)
+	}
+}
+
+// batch returns the template as a batch file for buildCalls
+func (t *actionTemplate) batch() *batchFile {
+	return &batchFile{Description: t.Description, Calls: t.Calls}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, name, content string) {
+	dir := filepath.Join(os.Getenv("GNOSIS_TX_CONFIG_DIR"), "templates")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunTemplate(t *testing.T) {
+	t.Setenv("GNOSIS_TX_CONFIG_DIR", t.TempDir())
+	writeTemplate(t, "pay.yaml", `description: pay a contributor
+params:
+  - name: TO
+    type: address
+  - name: AMOUNT
+    type: uint256
+    default: "1000"
+calls:
+  - to: "`+testRecipient+`"
+    method: transfer(address,uint256)
+    args: ["${TO}", "${AMOUNT}"]
+`)
+	writeTemplate(t, "broken.json", `{"calls": [{"to": "${UNDECLARED}"}]}`)
+
+	tmpl, err := loadTemplate("pay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, err := templateVariables(tmpl, map[string]string{"TO": testSafe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, _, err := buildCalls(tmpl.batch(), vars, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := encodeCallArgs("transfer(address,uint256)", []string{testSafe, "1000"})
+	if len(txs) != 1 || string(txs[0].Data) != string(want) {
+		t.Errorf("template calls = %x, want %x", txs, want)
+	}
+
+	tests := []struct {
+		params map[string]string
+		want   string
+	}{
+		{map[string]string{}, "needs -param TO=<value>"},
+		{map[string]string{"TO": "0x12"}, "parameter TO: invalid address"},
+		{map[string]string{"TO": testSafe, "AMOUNT": "-1"}, "parameter AMOUNT"},
+		{map[string]string{"TO": testSafe, "OTHER": "1"}, "has no parameter OTHER"},
+	}
+	for _, tt := range tests {
+		if _, err := templateVariables(tmpl, tt.params); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("templateVariables(%v) = %v, want an error with %q", tt.params, err, tt.want)
+		}
+	}
+
+	if _, err := loadTemplate("broken"); err == nil || !strings.Contains(err.Error(), "undeclared parameter UNDECLARED") {
+		t.Errorf("loadTemplate(broken) = %v, want an undeclared parameter error", err)
+	}
+	if _, err := loadTemplate("../pay"); err == nil {
+		t.Errorf("loadTemplate(../pay) = nil error, want an invalid name error")
+	}
+}
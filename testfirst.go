@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// testTransfer is a small transfer proposed ahead of a payment to a new
+// recipient, the payment is proposed once the test is received
+type testTransfer struct {
+	Safe           string `json:"safe"`
+	To             string `json:"to"`
+	Amount         int64  `json:"amount"`
+	TestAmount     int64  `json:"testAmount"`
+	TestSafeTxHash string `json:"testSafeTxHash"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+func testTransferPath(safeTxHash string) string {
+	return filepath.Join(configPath("test-transfers"), common.HexToHash(safeTxHash).Hex()+".json")
+}
+
+// receiptMessage is what the recipient signs (personal_sign) to acknowledge
+// the test transfer arrived
+func receiptMessage(txHash string) string {
+	return "received test transfer " + txHash
+}
+
+func proposeTestTransfer(from, to, safe string, amount, testAmount int64, privKey string, opts *proposalOptions) error {
+	if testAmount <= 0 || testAmount >= amount {
+		return fmt.Errorf("the -test-amount %d must be positive and below the -amount %d", testAmount, amount)
+	}
+
+	fmt.Println("proposing a test transfer of", formatWei(big.NewInt(testAmount)), "to", common.HexToAddress(to).Hex())
+	if err := sendTransaction(from, to, safe, testAmount, nil, 0, privKey, opts); err != nil {
+		return err
+	}
+
+	test := testTransfer{
+		Safe:           common.HexToAddress(safe).Hex(),
+		To:             common.HexToAddress(to).Hex(),
+		Amount:         amount,
+		TestAmount:     testAmount,
+		TestSafeTxHash: currentOperation.SafeTxHash,
+		CreatedAt:      formatTime(time.Now()),
+	}
+	encoded, err := json.MarshalIndent(test, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := testTransferPath(test.TestSafeTxHash)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, encoded, 0600); err != nil {
+		return err
+	}
+
+	fmt.Println("once the test is executed and received, propose the payment of", formatWei(big.NewInt(amount)), "with:")
+	fmt.Println("  send -follow-up", test.TestSafeTxHash, "-received (or -receipt-signature <signature of the recipient>)")
+	return nil
+}
+
+// proposeFollowUp proposes the payment of a test transfer that was executed
+// and acknowledged by the recipient, by signature or manually
+func proposeFollowUp(testSafeTxHash string, received bool, receiptSignature, from, privKey string, opts *proposalOptions) error {
+	content, err := ioutil.ReadFile(testTransferPath(testSafeTxHash))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no test transfer %s, it was proposed with send -test-first", testSafeTxHash)
+	}
+	if err != nil {
+		return err
+	}
+	var test testTransfer
+	if err := json.Unmarshal(content, &test); err != nil {
+		return fmt.Errorf("invalid test transfer %s: %w", testSafeTxHash, err)
+	}
+
+	tx, err := getMultisigTransaction(test.TestSafeTxHash)
+	if err != nil {
+		return err
+	}
+	if !tx.IsExecuted || tx.TransactionHash == nil {
+		return fmt.Errorf("test transfer %s is not executed yet", test.TestSafeTxHash)
+	}
+	if common.HexToAddress(tx.To) != common.HexToAddress(test.To) || tx.Value != strconv.FormatInt(test.TestAmount, 10) {
+		return fmt.Errorf("transaction %s is not the recorded test transfer to %s", test.TestSafeTxHash, test.To)
+	}
+
+	switch {
+	case receiptSignature != "":
+		signature, err := hexutil.Decode(receiptSignature)
+		if err != nil {
+			return fmt.Errorf("invalid -receipt-signature: %w", err)
+		}
+		message := receiptMessage(*tx.TransactionHash)
+		signer, err := recoverSigner(common.BytesToHash(accounts.TextHash([]byte(message))), signature)
+		if err != nil {
+			return err
+		}
+		if signer != common.HexToAddress(test.To) {
+			return fmt.Errorf("the receipt is signed by %s, not the recipient %s; it must sign %q", signer.Hex(), test.To, message)
+		}
+		fmt.Println("recipient", test.To, "acknowledged the test transfer", *tx.TransactionHash)
+	case received:
+		fmt.Println("test transfer", *tx.TransactionHash, "acknowledged as received")
+	default:
+		return fmt.Errorf("confirm the recipient received the test transfer with -received, or pass its signature of %q with -receipt-signature", receiptMessage(*tx.TransactionHash))
+	}
+
+	if opts.origin == nil {
+		opts.origin = map[string]string{}
+	}
+	opts.origin["testTransfer"] = test.TestSafeTxHash
+
+	fmt.Println("proposing the payment of", formatWei(big.NewInt(test.Amount)), "to", test.To)
+	if err := sendTransaction(from, test.To, test.Safe, test.Amount, nil, 0, privKey, opts); err != nil {
+		return err
+	}
+	return os.Remove(testTransferPath(test.TestSafeTxHash))
+}
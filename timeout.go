@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// opCtx bounds every network call and polling loop of the current operation,
+// it carries the deadline set with the global -timeout flag
+var opCtx = context.Background()
+
+func setOperationTimeout(timeout time.Duration) context.CancelFunc {
+	if timeout <= 0 {
+		return func() {}
+	}
+
+	var cancel context.CancelFunc
+	opCtx, cancel = context.WithTimeout(context.Background(), timeout)
+	return cancel
+}
+
+// extractFlag removes a global -name/--name flag from anywhere in args,
+// returning its value and whether it was given
+func extractFlag(args []string, name string) ([]string, string, bool, error) {
+	var (
+		rest  []string
+		value string
+		found bool
+	)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		trimmed := strings.TrimLeft(arg, "-")
+		if !strings.HasPrefix(arg, "-") || (trimmed != name && !strings.HasPrefix(trimmed, name+"=")) {
+			rest = append(rest, arg)
+			continue
+		}
+
+		found = true
+		value = strings.TrimPrefix(trimmed, name+"=")
+		if trimmed == name {
+			if i+1 == len(args) {
+				return nil, "", false, fmt.Errorf("-%s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+	}
+
+	return rest, value, found, nil
+}
+
+// extractBoolFlag removes a global boolean -name/--name flag from anywhere in
+// args, returning whether it was given
+func extractBoolFlag(args []string, name string) ([]string, bool) {
+	var rest []string
+	found := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && strings.TrimLeft(arg, "-") == name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// extractTimeout removes a -timeout/--timeout flag from anywhere in args
+func extractTimeout(args []string) ([]string, time.Duration, error) {
+	rest, value, found, err := extractFlag(args, "timeout")
+	if err != nil {
+		return nil, 0, errMissingTimeout
+	}
+	if !found {
+		return rest, 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rest, timeout, nil
+}
+
+// sleep waits for d unless the operation deadline expires first
+func sleep(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-opCtx.Done():
+		return opCtx.Err()
+	}
+}
+
+func httpGet(url string) (*http.Response, error) {
+	return httpDo(http.MethodGet, url, "", nil)
+}
+
+func httpPost(url, contentType string, body io.Reader) (*http.Response, error) {
+	return httpDo(http.MethodPost, url, contentType, body)
+}
+
+func httpDo(method, url, contentType string, body io.Reader) (*http.Response, error) {
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	return httpDoHeaders(method, url, headers, body)
+}
+
+// httpDoHeaders sends the request, a transaction service request fails over
+// to the service mirrors
+func httpDoHeaders(method, url string, headers map[string]string, body io.Reader) (*http.Response, error) {
+	base, ok := serviceBase(url)
+	if !ok || len(serviceMirrors) == 0 {
+		return httpSend(method, url, headers, body)
+	}
+
+	var content []byte
+	if body != nil {
+		var err error
+		if content, err = ioutil.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+	path := url[len(base):]
+	candidates := serviceCandidates()
+	var resp *http.Response
+	var err error
+	for i, candidate := range candidates {
+		start := time.Now()
+		resp, err = httpSend(method, candidate+path, headers, bytes.NewReader(content))
+		healthy := err == nil && resp.StatusCode < 500
+		recordHealth(candidate, healthy, time.Since(start))
+		if healthy || !failOver(method, resp, err) {
+			return resp, err
+		}
+		if i == len(candidates)-1 {
+			break
+		}
+		if err == nil {
+			logger.Warn("service failed, trying the next mirror", "service", candidate, "status", resp.Status)
+			resp.Body.Close()
+		} else {
+			logger.Warn("service failed, trying the next mirror", "service", candidate, "err", err)
+		}
+	}
+	return resp, err
+}
+
+func httpSend(method, url string, headers map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(opCtx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range authHeaders(url) {
+		req.Header.Set(name, value)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// displayZone is the time zone timestamps are shown and written in, set with
+// the global -tz flag or $GNOSIS_TX_TZ
+var displayZone = time.UTC
+
+// setDisplayZone accepts an IANA zone name such as Europe/Berlin, "local" for
+// the host zone or "" for $GNOSIS_TX_TZ, falling back to UTC
+func setDisplayZone(name string) error {
+	if name == "" {
+		name = os.Getenv("GNOSIS_TX_TZ")
+	}
+
+	switch strings.ToLower(name) {
+	case "", "utc":
+		displayZone = time.UTC
+		return nil
+	case "local":
+		displayZone = time.Local
+		return nil
+	}
+
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q, expected an IANA name such as America/New_York: %w", name, err)
+	}
+	displayZone = zone
+	return nil
+}
+
+// formatTime renders t as ISO-8601 in the display zone, the offset is always
+// included so timestamps stay unambiguous when shared between signers
+func formatTime(t time.Time) string {
+	return t.In(displayZone).Format(time.RFC3339)
+}
+
+// parseServiceTime parses a transaction service timestamp, "" if unset
+func parseServiceTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// formatAge describes how long ago t was, e.g. "2d 3h", next to the absolute
+// timestamp since relative ages alone are ambiguous across zones
+func formatAge(t time.Time) string {
+	age := time.Since(t)
+	if age < 0 {
+		age = 0
+	}
+
+	days := int(age / (24 * time.Hour))
+	hours := int(age % (24 * time.Hour) / time.Hour)
+	minutes := int(age % time.Hour / time.Minute)
+
+	var s string
+	switch {
+	case days > 0:
+		s = fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		s = fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		s = fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%s ago (since %s)", s, formatTime(t))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// transportConfig is read from transport.json in the config directory, for
+// networks behind a proxy or TLS interception; $GNOSIS_TX_PROXY and
+// $GNOSIS_TX_CA_BUNDLE override the file, without either the standard
+// HTTPS_PROXY and NO_PROXY variables apply
+type transportConfig struct {
+	Proxy string `json:"proxy"`
+	// comma separated hosts and domains reached directly
+	NoProxy string `json:"noProxy"`
+	// PEM certificates trusted in addition to the system roots
+	CABundle   string `json:"caBundle"`
+	ClientCert string `json:"clientCert"`
+	ClientKey  string `json:"clientKey"`
+}
+
+func loadTransportConfig() (*transportConfig, error) {
+	path := configPath("transport.json")
+	config := &transportConfig{}
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(content, config); err != nil {
+			return nil, fmt.Errorf("invalid transport config %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if proxy := os.Getenv("GNOSIS_TX_PROXY"); proxy != "" {
+		config.Proxy = proxy
+	}
+	if bundle := os.Getenv("GNOSIS_TX_CA_BUNDLE"); bundle != "" {
+		config.CABundle = bundle
+	}
+	return config, nil
+}
+
+// setTransport applies the transport config to every outbound connection:
+// the transaction service, relays, webhooks and http RPC endpoints use
+// http.DefaultTransport and WalletConnect the default websocket dialer;
+// websocket RPC endpoints dial directly
+func setTransport() error {
+	config, err := loadTransportConfig()
+	if err != nil {
+		return err
+	}
+	if config.Proxy == "" && config.CABundle == "" && config.ClientCert == "" {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return err
+	}
+	transport.TLSClientConfig = tlsConfig
+	websocket.DefaultDialer.TLSClientConfig = tlsConfig
+
+	if config.Proxy != "" {
+		proxy, err := url.Parse(config.Proxy)
+		if err != nil || proxy.Host == "" {
+			return fmt.Errorf("invalid proxy %q", redactURL(config.Proxy))
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy %s has an unsupported scheme, use http, https or socks5", redactURL(config.Proxy))
+		}
+		noProxy := splitNoProxy(config.NoProxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(req.URL.Hostname(), noProxy) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+		websocket.DefaultDialer.Proxy = transport.Proxy
+		logger.Debug("using proxy", "proxy", redactURL(config.Proxy))
+	}
+
+	http.DefaultTransport = transport
+	return nil
+}
+
+func (c *transportConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CABundle != "" {
+		pem, err := ioutil.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading the CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s holds no PEM certificates", c.CABundle)
+		}
+		config.RootCAs = pool
+	}
+
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return nil, errors.New("a client certificate needs both clientCert and clientKey")
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func splitNoProxy(list string) []string {
+	var hosts []string
+	for _, host := range strings.Split(list, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, strings.TrimPrefix(host, "."))
+		}
+	}
+	return hosts
+}
+
+// bypassProxy reports whether host is reached directly: loopback addresses,
+// and the hosts of noProxy and their subdomains, * matching any
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, entry := range noProxy {
+		if entry == "*" || host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// the JSON export of the Safe Transaction Builder app
+type txBuilderFile struct {
+	Version      string        `json:"version"`
+	ChainID      string        `json:"chainId"`
+	CreatedAt    int64         `json:"createdAt"`
+	Meta         txBuilderMeta `json:"meta"`
+	Transactions []txBuilderTx `json:"transactions"`
+}
+
+type txBuilderMeta struct {
+	Name                    string `json:"name"`
+	Description             string `json:"description"`
+	TxBuilderVersion        string `json:"txBuilderVersion,omitempty"`
+	CreatedFromSafeAddress  string `json:"createdFromSafeAddress"`
+	CreatedFromOwnerAddress string `json:"createdFromOwnerAddress"`
+	Checksum                string `json:"checksum,omitempty"`
+}
+
+type txBuilderTx struct {
+	To                   string            `json:"to"`
+	Value                string            `json:"value"`
+	Data                 *string           `json:"data"`
+	ContractMethod       *txBuilderMethod  `json:"contractMethod,omitempty"`
+	ContractInputsValues map[string]string `json:"contractInputsValues,omitempty"`
+}
+
+type txBuilderMethod struct {
+	Inputs  []txBuilderInput `json:"inputs"`
+	Name    string           `json:"name"`
+	Payable bool             `json:"payable"`
+}
+
+type txBuilderInput struct {
+	InternalType string `json:"internalType,omitempty"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+}
+
+func (m *txBuilderMethod) signature() string {
+	types := make([]string, len(m.Inputs))
+	for i, input := range m.Inputs {
+		types[i] = input.Type
+	}
+	return m.Name + "(" + strings.Join(types, ",") + ")"
+}
+
+// isTxBuilderFile tells a Transaction Builder export from a batch file by
+// its transactions key
+func isTxBuilderFile(content []byte) bool {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return false
+	}
+	_, ok := keys["transactions"]
+	return ok
+}
+
+// parseTxBuilderFile converts a Transaction Builder export to a batch file,
+// calls with calldata are kept as data, the others encoded from their
+// method and input values
+func parseTxBuilderFile(content []byte) (*batchFile, error) {
+	var file txBuilderFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	if file.ChainID != "" {
+		chainID, err := serviceChain()
+		if err != nil {
+			return nil, err
+		}
+		if file.ChainID != strconv.FormatInt(chainID, 10) {
+			return nil, fmt.Errorf("the transactions were built for chain %s, not %d", file.ChainID, chainID)
+		}
+	}
+
+	batch := &batchFile{Description: file.Meta.Name, Safe: file.Meta.CreatedFromSafeAddress}
+	if file.Meta.Description != "" {
+		batch.Description = strings.TrimSpace(file.Meta.Name + "\n" + file.Meta.Description)
+	}
+
+	for i, tx := range file.Transactions {
+		call := batchCall{To: tx.To, Value: tx.Value}
+		switch {
+		case tx.Data != nil && *tx.Data != "" && *tx.Data != "0x":
+			call.Data = *tx.Data
+		case tx.ContractMethod != nil:
+			call.Method = tx.ContractMethod.signature()
+			for _, input := range tx.ContractMethod.Inputs {
+				value, ok := tx.ContractInputsValues[input.Name]
+				if !ok {
+					return nil, fmt.Errorf("transaction %d: no value for input %s of %s", i+1, input.Name, call.Method)
+				}
+				call.Args = append(call.Args, value)
+				call.Inputs = append(call.Inputs, input.Name)
+			}
+		}
+		batch.Calls = append(batch.Calls, call)
+	}
+
+	if len(batch.Calls) == 0 {
+		return nil, errors.New("no transactions")
+	}
+	return batch, nil
+}
+
+// txBuilderValue formats an unpacked argument the way the Transaction
+// Builder takes input values
+func txBuilderValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex(), true
+	case *big.Int:
+		return v.String(), true
+	case []byte:
+		return hexutil.Encode(v), true
+	case bool, string, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), true
+	}
+
+	// bytesN unpacks to a byte array
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return hexutil.Encode(b), true
+	}
+	return "", false
+}
+
+// exportCall converts a call to a Transaction Builder transaction, with the
+// method and input values when the signature is known and the arguments are
+// all of types the app takes as text, else as raw data
+func exportCall(call multiSendTx, signature string, names []string) (txBuilderTx, error) {
+	if call.Operation != 0 {
+		return txBuilderTx{}, fmt.Errorf("the Transaction Builder only makes calls, the delegatecall to %s can't be exported", call.To.Hex())
+	}
+
+	data := hexutil.Encode(call.Data)
+	tx := txBuilderTx{To: call.To.Hex(), Value: call.Value.String(), Data: &data}
+	if len(call.Data) == 0 {
+		tx.Data = nil
+	}
+
+	if signature == "" {
+		var ok bool
+		if signature, ok = lookupMethod(call.Data); !ok {
+			return tx, nil
+		}
+	}
+	if len(call.Data) < 4 || !bytes.Equal(crypto.Keccak256([]byte(signature))[:4], call.Data[:4]) {
+		return tx, nil
+	}
+	args, err := methodArguments(signature)
+	if err != nil {
+		return tx, nil
+	}
+	values, err := args.UnpackValues(call.Data[4:])
+	if err != nil {
+		return tx, nil
+	}
+
+	method := &txBuilderMethod{Name: signature[:strings.Index(signature, "(")], Payable: call.Value.Sign() > 0}
+	inputs := map[string]string{}
+	for i, arg := range args {
+		name := fmt.Sprintf("arg%d", i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		value, ok := txBuilderValue(values[i])
+		if !ok {
+			return tx, nil
+		}
+		method.Inputs = append(method.Inputs, txBuilderInput{InternalType: arg.Type.String(), Name: name, Type: arg.Type.String()})
+		inputs[name] = value
+	}
+
+	tx.Data, tx.ContractMethod, tx.ContractInputsValues = nil, method, inputs
+	return tx, nil
+}
+
+// decodedSignature returns the method signature and argument names of the
+// service decoding of a call, if any
+func decodedSignature(decoded *decodedData) (string, []string) {
+	if decoded == nil || decoded.Method == "" {
+		return "", nil
+	}
+	types := make([]string, len(decoded.Parameters))
+	names := make([]string, len(decoded.Parameters))
+	for i, param := range decoded.Parameters {
+		types[i], names[i] = param.Type, param.Name
+	}
+	return decoded.Method + "(" + strings.Join(types, ",") + ")", names
+}
+
+// exportProposal converts a proposed transaction to Transaction Builder
+// transactions, using the service decoding for the abi metadata
+func exportProposal(tx *multisigTxResponse) ([]txBuilderTx, error) {
+	var data []byte
+	if tx.Data != nil {
+		var err error
+		if data, err = hexutil.Decode(*tx.Data); err != nil {
+			return nil, err
+		}
+	}
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %q", tx.Value)
+	}
+
+	to := common.HexToAddress(tx.To)
+	calls, err := flattenTx(to, value, data, tx.Operation)
+	if err != nil {
+		return nil, err
+	}
+
+	var inner []decodedInnerTx
+	if isMultiSendBatch(to, data, tx.Operation) && tx.DataDecoded != nil && len(tx.DataDecoded.Parameters) == 1 {
+		inner = tx.DataDecoded.Parameters[0].ValueDecoded
+	}
+
+	txs := make([]txBuilderTx, len(calls))
+	for i, call := range calls {
+		var signature string
+		var names []string
+		switch {
+		case len(calls) == 1 && tx.Operation == 0:
+			signature, names = decodedSignature(tx.DataDecoded)
+		case i < len(inner):
+			signature, names = decodedSignature(inner[i].DataDecoded)
+		}
+		if txs[i], err = exportCall(call, signature, names); err != nil {
+			return nil, err
+		}
+	}
+	return txs, nil
+}
+
+// exportBatch converts the calls of a local batch file
+func exportBatch(calls []multiSendTx, entries []batchCall) ([]txBuilderTx, error) {
+	txs := make([]txBuilderTx, len(calls))
+	for i, call := range calls {
+		var err error
+		if txs[i], err = exportCall(call, entries[i].Method, entries[i].Inputs); err != nil {
+			return nil, err
+		}
+	}
+	return txs, nil
+}
+
+func newTxBuilderFile(safe common.Address, chainID int64, name, description string, txs []txBuilderTx) *txBuilderFile {
+	return &txBuilderFile{
+		Version:   "1.0",
+		ChainID:   strconv.FormatInt(chainID, 10),
+		CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+		Meta: txBuilderMeta{
+			Name:                   name,
+			Description:            description,
+			CreatedFromSafeAddress: safe.Hex(),
+		},
+		Transactions: txs,
+	}
+}
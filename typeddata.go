@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"regexp"
+
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+var safeTxHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// walletTypedData is the eth_signTypedData_v4 payload of typed data: the
+// domain only holds the fields its type declares and the chainId is a number,
+// as MetaMask checks it against the connected chain
+type walletTypedData struct {
+	Types       apitypes.Types         `json:"types"`
+	PrimaryType string                 `json:"primaryType"`
+	Domain      map[string]interface{} `json:"domain"`
+	Message     map[string]interface{} `json:"message"`
+}
+
+func newWalletTypedData(typedData apitypes.TypedData) *walletTypedData {
+	domain := typedData.Domain.Map()
+	if typedData.Domain.ChainId != nil {
+		domain["chainId"] = (*big.Int)(typedData.Domain.ChainId).Int64()
+	}
+	return &walletTypedData{
+		Types:       typedData.Types,
+		PrimaryType: typedData.PrimaryType,
+		Domain:      domain,
+		Message:     typedData.Message,
+	}
+}
+
+// loadTxArg reads the transaction of a safeTxHash from the transaction
+// service, or else from a transaction file
+func loadTxArg(arg string) (*multisigTxResponse, error) {
+	if safeTxHashPattern.MatchString(arg) {
+		return getMultisigTransaction(arg)
+	}
+	if _, err := os.Stat(arg); err != nil {
+		return nil, err
+	}
+	return loadSafeTxFile(arg)
+}
+
+// exportTypedData returns the typed data a wallet signs for tx on a safe of
+// the given version on chainID, which hashes to its safeTxHash
+func exportTypedData(tx *multisigTxResponse, chainID int64, version string) ([]byte, error) {
+	typedData, err := tx.typedData(chainID, version)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(newWalletTypedData(typedData), "", "  ")
+}
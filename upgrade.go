@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// upgradePlan is the migration of a safe to a newer singleton, the proposal
+// of the safe and what the verification expects once it is executed
+type upgradePlan struct {
+	From      string
+	To        string
+	Singleton common.Address
+	Handler   common.Address
+	Target    common.Address
+	Data      []byte
+	Operation uint8
+}
+
+func readVersion(client EthClient, contract common.Address) (string, error) {
+	values, err := callView(client, contract, "VERSION()", "(string)")
+	if err != nil {
+		return "", fmt.Errorf("reading the version of %s: %w", contract.Hex(), err)
+	}
+	return values[0].(string), nil
+}
+
+// planUpgrade picks the migration path of the safe version: safes before
+// 1.3.0 change their singleton and fallback handler to the bundled 1.3.0
+// ones, 1.3.x safes delegatecall the migrate function of a SafeMigration
+// contract, which needs the migration address
+func planUpgrade(client EthClient, safe common.Address, migration *common.Address, l2 bool) (*upgradePlan, error) {
+	info, err := readSafeInfoOnchain(client, safe)
+	if err != nil {
+		return nil, err
+	}
+	if info.Guard != (common.Address{}) {
+		logger.Warn("the safe has a guard, it has to allow the upgrade transaction", "guard", info.Guard.Hex())
+	}
+	plan := &upgradePlan{From: info.Version}
+
+	switch {
+	case !versionAtLeast(info.Version, 1, 1):
+		return nil, fmt.Errorf("safe version %s has no fallback handler support, upgrading it isn't supported, migrate the assets with sweep instead", info.Version)
+
+	case !versionAtLeast(info.Version, 1, 3):
+		plan.Singleton = contractAddress(CONTRACT_SAFE)
+		if l2 {
+			plan.Singleton = contractAddress(CONTRACT_SAFE_L2)
+		}
+		plan.Handler = contractAddress(CONTRACT_FALLBACK_HANDLER)
+		if plan.To, err = readVersion(client, plan.Singleton); err != nil {
+			return nil, err
+		}
+
+		changeSingleton, err := encodeCall("changeMasterCopy(address)", plan.Singleton)
+		if err != nil {
+			return nil, err
+		}
+		txs := []multiSendTx{{To: safe, Value: new(big.Int), Data: changeSingleton}}
+		if info.FallbackHandler != plan.Handler {
+			txs = append(txs, multiSendTx{To: safe, Value: new(big.Int), Data: encodeAddressCall(setFallbackHandlerSelector, plan.Handler)})
+		}
+		plan.Target, _, plan.Data, plan.Operation = batchTransaction(txs)
+
+	case !versionAtLeast(info.Version, 1, 4):
+		if migration == nil {
+			return nil, fmt.Errorf("safe version %s is upgraded through a SafeMigration contract, pass its address with -migration", info.Version)
+		}
+		if info.MasterCopy == contractAddress(CONTRACT_SAFE_L2) {
+			l2 = true
+		}
+
+		singleton, method := "SAFE_SINGLETON()", "migrateWithFallbackHandler()"
+		if l2 {
+			singleton, method = "SAFE_L2_SINGLETON()", "migrateL2WithFallbackHandler()"
+		}
+		values, err := callView(client, *migration, singleton, "(address)")
+		if err != nil {
+			return nil, fmt.Errorf("%s doesn't look like a SafeMigration contract: %w", migration.Hex(), err)
+		}
+		plan.Singleton = values[0].(common.Address)
+		if values, err = callView(client, *migration, "SAFE_FALLBACK_HANDLER()", "(address)"); err != nil {
+			return nil, fmt.Errorf("%s doesn't look like a SafeMigration contract: %w", migration.Hex(), err)
+		}
+		plan.Handler = values[0].(common.Address)
+		if plan.To, err = readVersion(client, plan.Singleton); err != nil {
+			return nil, err
+		}
+
+		if plan.Data, err = encodeCall(method); err != nil {
+			return nil, err
+		}
+		plan.Target, plan.Operation = *migration, 1
+
+	default:
+		return nil, fmt.Errorf("safe version %s is the latest supported, nothing to upgrade", info.Version)
+	}
+
+	if !versionAtLeast(plan.To, 1, 3) || plan.To == plan.From {
+		return nil, fmt.Errorf("singleton %s is version %s, not an upgrade of %s", plan.Singleton.Hex(), plan.To, plan.From)
+	}
+	if code, err := client.CodeAt(opCtx, plan.Handler, nil); err != nil {
+		return nil, err
+	} else if len(code) == 0 {
+		return nil, fmt.Errorf("fallback handler %s is not a contract", plan.Handler.Hex())
+	}
+	return plan, nil
+}
+
+// verifyUpgrade checks the executed upgrade: the singleton has code and the
+// safe reports the expected version, has a fallback handler and still reads
+// its owners and threshold
+func verifyUpgrade(client EthClient, safe common.Address, version string, singleton *common.Address) error {
+	info, err := readSafeInfoOnchain(client, safe)
+	if err != nil {
+		return fmt.Errorf("reading the upgraded safe failed: %w", err)
+	}
+
+	var failures []string
+	if code, err := client.CodeAt(opCtx, info.MasterCopy, nil); err != nil {
+		return err
+	} else if len(code) == 0 {
+		failures = append(failures, fmt.Sprintf("singleton %s has no code", info.MasterCopy.Hex()))
+	}
+	if singleton != nil && info.MasterCopy != *singleton {
+		failures = append(failures, fmt.Sprintf("singleton is %s, expected %s", info.MasterCopy.Hex(), singleton.Hex()))
+	}
+	if version != "" && info.Version != version {
+		failures = append(failures, fmt.Sprintf("version is %s, expected %s", info.Version, version))
+	}
+	if info.FallbackHandler == (common.Address{}) {
+		failures = append(failures, "no fallback handler is set")
+	}
+	if len(info.Owners) == 0 || info.Threshold == 0 {
+		failures = append(failures, "owners or threshold can't be read")
+	}
+
+	fmt.Println("version:", info.Version)
+	fmt.Println("singleton:", displayAddress(info.MasterCopy))
+	fmt.Println("fallback handler:", displayAddress(info.FallbackHandler))
+	fmt.Printf("threshold %d of %d owners, nonce %d\n", info.Threshold, len(info.Owners), info.Nonce)
+	for _, failure := range failures {
+		fmt.Println("FAILED:", failure)
+	}
+	if len(failures) > 0 {
+		return errors.New("upgrade verification failed")
+	}
+	fmt.Println("upgrade verified")
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ${NAME} or ${secret:NAME}, secrets are prompted without echo and never shown
+var variablePattern = regexp.MustCompile(`\$\{(secret:)?([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+type resolvedVariable struct {
+	value  string
+	source string
+	secret bool
+}
+
+// variables resolves template variables from the builtin ones (SAFE), -var
+// flags, the environment, vars.json in the config directory or, failing
+// those, a prompt
+type variables struct {
+	builtin  map[string]string
+	flags    map[string]string
+	config   map[string]string
+	resolved map[string]resolvedVariable
+}
+
+// varFlags collects repeated -var NAME=value flags
+type varFlags map[string]string
+
+func (v varFlags) String() string {
+	return ""
+}
+
+func (v varFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid variable %q, expected NAME=value", value)
+	}
+	v[parts[0]] = parts[1]
+	return nil
+}
+
+func newVariables(flags map[string]string) (*variables, error) {
+	v := &variables{builtin: map[string]string{}, flags: flags, config: map[string]string{}, resolved: map[string]resolvedVariable{}}
+
+	content, err := ioutil.ReadFile(configPath("vars.json"))
+	if err == nil {
+		if err := json.Unmarshal(content, &v.config); err != nil {
+			return nil, fmt.Errorf("invalid variables config: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *variables) resolve(name string, secret bool) (string, error) {
+	if r, ok := v.resolved[name]; ok {
+		return r.value, nil
+	}
+
+	r := resolvedVariable{secret: secret}
+	var ok bool
+	switch {
+	case secret:
+		// secrets never come from flags or files, they would end up in shell history or backups
+		if r.value, ok = os.LookupEnv(name); ok {
+			r.source = "environment"
+		}
+	default:
+		if r.value, ok = v.builtin[name]; ok {
+			r.source = "builtin"
+		} else if r.value, ok = v.flags[name]; ok {
+			r.source = "-var"
+		} else if r.value, ok = os.LookupEnv(name); ok {
+			r.source = "environment"
+		} else if r.value, ok = v.config[name]; ok {
+			r.source = "vars.json"
+		}
+	}
+
+	if !ok {
+		var err error
+		if secret {
+			r.value, err = prompt.Stdin.PromptPassword(name + ": ")
+		} else {
+			r.value, err = prompt.Stdin.PromptInput(name + ": ")
+		}
+		if err != nil {
+			return "", fmt.Errorf("variable %s is not set: %w", name, err)
+		}
+		if r.value == "" {
+			return "", fmt.Errorf("variable %s is not set", name)
+		}
+		r.source = "prompt"
+	}
+
+	v.resolved[name] = r
+	return r.value, nil
+}
+
+// interpolate replaces the variables referenced in text
+func (v *variables) interpolate(text string) (string, error) {
+	var resolveErr error
+	result := variablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := variablePattern.FindStringSubmatch(match)
+		value, err := v.resolve(groups[2], groups[1] != "")
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		return value
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	if strings.Contains(result, "${") {
+		return "", fmt.Errorf("invalid variable reference in %q", text)
+	}
+	return result, nil
+}
+
+func hasSecret(template string) bool {
+	return strings.Contains(template, "${secret:")
+}
+
+// quote quotes a value for an error message, or its template if the value
+// contains a secret
+func quote(template, value string) string {
+	if hasSecret(template) {
+		return strconv.Quote(template)
+	}
+	return strconv.Quote(value)
+}
+
+// summary lists the resolved variables for review, secrets by fingerprint only
+func (v *variables) summary() []string {
+	var names []string
+	for name := range v.resolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		r := v.resolved[name]
+		value := r.value
+		if r.secret {
+			value = fmt.Sprintf("<secret, keccak256 %x…>", crypto.Keccak256([]byte(r.value))[:4])
+		}
+		lines[i] = fmt.Sprintf("%s = %s (%s)", name, value, r.source)
+	}
+	return lines
+}
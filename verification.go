@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	SOURCIFY_API  = "https://sourcify.dev/server"
+	ETHERSCAN_API = "https://api-rinkeby.etherscan.io/api"
+)
+
+func getJSON(endpoint string, response interface{}) error {
+	resp, err := httpGet(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s: %s", endpoint, resp.Status, string(body))
+	}
+	return json.Unmarshal(body, response)
+}
+
+// sourcifyStatus returns "perfect" or "partial" for verified contracts
+func sourcifyStatus(addr common.Address) (string, error) {
+	var result []struct {
+		Status string `json:"status"`
+	}
+	chainID, err := serviceChain()
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("%s/check-by-addresses?addresses=%s&chainIds=%d", SOURCIFY_API, addr.Hex(), chainID)
+	if err := getJSON(endpoint, &result); err != nil {
+		return "", err
+	}
+	if len(result) == 0 || result[0].Status == "false" {
+		return "", nil
+	}
+	return result[0].Status, nil
+}
+
+func etherscanVerified(addr common.Address, apiKey string) (bool, error) {
+	var result struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Result  []struct {
+			SourceCode string `json:"SourceCode"`
+		} `json:"result"`
+	}
+	endpoint := ETHERSCAN_API + "?module=contract&action=getsourcecode&address=" + addr.Hex() + "&apikey=" + url.QueryEscape(apiKey)
+	if err := getJSON(endpoint, &result); err != nil {
+		return false, err
+	}
+	if result.Status != "1" {
+		return false, fmt.Errorf("etherscan: %s", result.Message)
+	}
+	return len(result.Result) > 0 && result.Result[0].SourceCode != "", nil
+}
+
+// contractVerification checks sourcify, then etherscan when $ETHERSCAN_API_KEY
+// is set, returning where the source is verified or "" if nowhere; verified
+// sources are cached
+func contractVerification(addr common.Address) (string, error) {
+	var source string
+	if cacheGet(CACHE_SOURCES, addr.Hex(), CACHE_TTL_VERIFIED, &source) {
+		return source, nil
+	}
+
+	status, err := sourcifyStatus(addr)
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		source = "sourcify (" + status + " match)"
+	} else if apiKey := os.Getenv("ETHERSCAN_API_KEY"); apiKey != "" {
+		verified, err := etherscanVerified(addr, apiKey)
+		if err != nil {
+			return "", err
+		}
+		if verified {
+			source = "etherscan"
+		}
+	}
+	if source != "" {
+		cachePut(CACHE_SOURCES, addr.Hex(), source)
+	}
+	return source, nil
+}
+
+// checkVerification warns about calls into contracts without verified
+// source, refusing them in strict mode; needs rpc to tell contracts apart
+func checkVerification(mode, rpc string, safe, to common.Address, value *big.Int, data []byte, operation uint8) error {
+	switch mode {
+	case CHECK_OFF:
+		return nil
+	case "", CHECK_WARN, CHECK_STRICT:
+	default:
+		return fmt.Errorf("unknown verification mode %q, expected %s, %s or %s", mode, CHECK_OFF, CHECK_WARN, CHECK_STRICT)
+	}
+	if rpc == "" {
+		return nil
+	}
+
+	calls, err := flattenTx(to, value, data, operation)
+	if err != nil {
+		return err
+	}
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	checked := map[common.Address]bool{}
+	var unverified []string
+	for _, call := range calls {
+		if call.To == safe || checked[call.To] {
+			continue
+		}
+		checked[call.To] = true
+
+		code, err := client.CodeAt(opCtx, call.To, nil)
+		if err != nil {
+			return err
+		}
+		if len(code) == 0 {
+			continue
+		}
+
+		source, err := contractVerification(call.To)
+		if err != nil {
+			return fmt.Errorf("checking the source verification of %s failed: %w", call.To.Hex(), err)
+		}
+		if source == "" {
+			logger.Warn("contract without verified source", "address", call.To.Hex())
+			unverified = append(unverified, call.To.Hex())
+			continue
+		}
+		fmt.Println(call.To.Hex(), "source verified on", source)
+	}
+
+	if mode == CHECK_STRICT && len(unverified) > 0 {
+		return fmt.Errorf("refusing to call unverified contracts: %s", strings.Join(unverified, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// the signature types reported by the transaction service
+var serviceSignatureTypes = map[string]string{
+	SIG_ECDSA:         "EOA",
+	SIG_ETH_SIGN:      "ETH_SIGN",
+	SIG_CONTRACT:      "CONTRACT_SIGNATURE",
+	SIG_APPROVED_HASH: "APPROVED_HASH",
+}
+
+// verifyProposal recomputes the hash of a proposal from the fields served by
+// the transaction service and checks every confirmation against the owners,
+// the version the hash depends on and the owners are read onchain when rpc is
+// given; returns the number of mismatches
+func verifyProposal(safeTxHash, rpc string) (int, error) {
+	tx, err := getMultisigTransaction(safeTxHash)
+	if err != nil {
+		return 0, err
+	}
+	safe := common.HexToAddress(tx.Safe)
+
+	mismatches := 0
+	check := func(ok bool, format string, args ...interface{}) {
+		status := "ok      "
+		if !ok {
+			status = "MISMATCH"
+			mismatches++
+		}
+		fmt.Printf("%s %s\n", status, fmt.Sprintf(format, args...))
+	}
+
+	var client EthClient
+	var owners []common.Address
+	if rpc != "" {
+		if client, err = dialRPC(rpc); err != nil {
+			return 0, err
+		}
+		defer client.Close()
+	}
+
+	// the service could lie about the version as well, so the domain is
+	// read from the safe's VERSION() whenever there is an rpc
+	chainID, version, err := safeTxDomain(tx.Safe, client)
+	if err != nil {
+		return 0, err
+	}
+	if client != nil {
+		fmt.Println("safe version", version, "read onchain")
+	} else {
+		logger.Warn("no -rpc, the safe version is taken from the transaction service", "version", version)
+	}
+
+	gnosisSafeTx, err := tx.gnosisSafeTx()
+	if err != nil {
+		return 0, err
+	}
+	encodedTx, err := encodeSafeTx(gnosisSafeTx, chainID, version)
+	if err != nil {
+		return 0, err
+	}
+	hash := crypto.Keccak256Hash(encodedTx)
+	check(hash == common.HexToHash(safeTxHash), "fields hash to %s", hash.Hex())
+	check(common.HexToHash(tx.SafeTxHash) == common.HexToHash(safeTxHash), "service reports safeTxHash %s", tx.SafeTxHash)
+
+	if client != nil {
+		state, err := readSafeState(client, safe, nil)
+		if err != nil {
+			return 0, err
+		}
+		owners = state.Owners
+		fmt.Println("owners read onchain at block", state.Block)
+	} else {
+		info, err := cachedSafeInfo(tx.Safe)
+		if err != nil {
+			return 0, err
+		}
+		for _, owner := range info.Owners {
+			owners = append(owners, common.HexToAddress(owner))
+		}
+		logger.Warn("no -rpc, owners are taken from the transaction service and contract signatures are not checked")
+	}
+	isOwner := map[common.Address]bool{}
+	for _, owner := range owners {
+		isOwner[owner] = true
+	}
+
+	seen := map[common.Address]bool{}
+	unverified := 0
+	for _, confirmation := range tx.Confirmations {
+		signature, err := hexutil.Decode(confirmation.Signature)
+		if err != nil {
+			check(false, "confirmation of %s has an undecodable signature", confirmation.Owner)
+			continue
+		}
+		sig, err := verifyOwnerSignature(safe, hash, encodedTx, signature, client)
+		if err != nil {
+			check(false, "confirmation of %s: %v", confirmation.Owner, err)
+			continue
+		}
+
+		check(sig.Owner == common.HexToAddress(confirmation.Owner), "confirmation of %s is signed by %s (%s)", confirmation.Owner, sig.Owner.Hex(), sig.Type)
+		check(isOwner[sig.Owner], "%s is a current owner", sig.Owner.Hex())
+		check(!seen[sig.Owner], "%s confirmed once", sig.Owner.Hex())
+		if confirmation.SignatureType != "" {
+			check(confirmation.SignatureType == serviceSignatureTypes[sig.Type], "service reports signature type %s for %s", confirmation.SignatureType, sig.Owner.Hex())
+		}
+		if unverifiedSignature(sig, client) && !seen[sig.Owner] {
+			unverified++
+		}
+		seen[sig.Owner] = true
+	}
+
+	if unverified > 0 {
+		fmt.Printf("%d of %d required confirmations verified, %d contract or approved-hash confirmations not verified without -rpc\n", len(seen)-unverified, tx.ConfirmationsRequired, unverified)
+	} else {
+		fmt.Printf("%d of %d required confirmations\n", len(seen), tx.ConfirmationsRequired)
+	}
+	var data []byte
+	if gnosisSafeTx.Data != nil {
+		data = *gnosisSafeTx.Data
+	}
+	for _, line := range describeTx(common.HexToAddress(tx.To), (*big.Int)(&gnosisSafeTx.Value), data, tx.Operation) {
+		fmt.Println("-", line)
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const WALLETCONNECT_RELAY = "wss://relay.walletconnect.com"
+
+// how long the wallet has to approve the pairing or a signature request
+const WALLETCONNECT_TIMEOUT = 5 * time.Minute
+
+// WalletConnect v2 relay message tags
+const (
+	WC_SESSION_PROPOSE         = 1100
+	WC_SESSION_SETTLE_RESPONSE = 1103
+	WC_SESSION_REQUEST         = 1108
+	WC_SESSION_DELETE          = 1112
+)
+
+type wcPayload struct {
+	ID      int64           `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *wcError        `json:"error,omitempty"`
+}
+
+type wcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type wcIncoming struct {
+	ID     int64           `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *wcError        `json:"error"`
+}
+
+type wcSubscription struct {
+	Topic   string `json:"topic"`
+	Message string `json:"message"`
+}
+
+// wcClient is a connection to the WalletConnect relay, messages on each
+// subscribed topic are encrypted with that topic's symmetric key
+type wcClient struct {
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	keys      map[string][]byte
+	messages  chan wcSubscription
+	responses chan wcIncoming
+	readErr   chan error
+}
+
+// wcPayloadID returns a JSON-RPC id in the WalletConnect format, the time in
+// milliseconds followed by three random digits
+func wcPayloadID() int64 {
+	var n [2]byte
+	rand.Read(n[:])
+	return time.Now().UnixNano()/int64(time.Millisecond)*1000 + int64(binary.BigEndian.Uint16(n[:])%1000)
+}
+
+// base58 encodes data with the bitcoin alphabet, as used by did:key
+func base58(data []byte) string {
+	const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+	n := new(big.Int).SetBytes(data)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// wcRelayAuth returns the JWT the relay requires, signed with a throwaway
+// ed25519 client key
+func wcRelayAuth() (string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	sub := make([]byte, 32)
+	if _, err := rand.Read(sub); err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "typ": "JWT"})
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": "did:key:z" + base58(append([]byte{0xed, 0x01}, pub...)),
+		"sub": hex.EncodeToString(sub),
+		"aud": WALLETCONNECT_RELAY,
+		"iat": now,
+		"exp": now + int64(WALLETCONNECT_TIMEOUT/time.Second)*2,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode(header) + "." + encode(claims)
+	return unsigned + "." + encode(ed25519.Sign(priv, []byte(unsigned))), nil
+}
+
+func dialWalletConnect(projectID string) (*wcClient, error) {
+	auth, err := wcRelayAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := WALLETCONNECT_RELAY + "/?auth=" + url.QueryEscape(auth) + "&projectId=" + url.QueryEscape(projectID)
+	conn, _, err := websocket.DefaultDialer.DialContext(opCtx, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the WalletConnect relay failed: %w", err)
+	}
+
+	c := &wcClient{
+		conn:      conn,
+		keys:      map[string][]byte{},
+		messages:  make(chan wcSubscription, 16),
+		responses: make(chan wcIncoming, 16),
+		readErr:   make(chan error, 1),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *wcClient) write(v interface{}) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+func (c *wcClient) readLoop() {
+	for {
+		var msg wcIncoming
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			c.readErr <- err
+			return
+		}
+
+		if msg.Method != "irn_subscription" {
+			select {
+			case c.responses <- msg:
+			default:
+			}
+			continue
+		}
+
+		var params struct {
+			Data wcSubscription `json:"data"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			continue
+		}
+		c.write(wcPayload{ID: msg.ID, JSONRPC: "2.0", Result: json.RawMessage("true")})
+		c.messages <- params.Data
+	}
+}
+
+// call sends a relay request and waits for its result
+func (c *wcClient) call(ctx context.Context, method string, params interface{}) error {
+	id := wcPayloadID()
+	if err := c.write(wcPayload{ID: id, JSONRPC: "2.0", Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case resp := <-c.responses:
+			if resp.ID != id {
+				continue
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("relay %s failed: %s", method, resp.Error.Message)
+			}
+			return nil
+		case err := <-c.readErr:
+			return fmt.Errorf("WalletConnect relay connection lost: %w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *wcClient) subscribe(ctx context.Context, symKey []byte) (string, error) {
+	sum := sha256.Sum256(symKey)
+	topic := hex.EncodeToString(sum[:])
+	c.keys[topic] = symKey
+	return topic, c.call(ctx, "irn_subscribe", map[string]string{"topic": topic})
+}
+
+// publish encrypts payload as a type 0 envelope with the topic key
+func (c *wcClient) publish(ctx context.Context, topic string, payload wcPayload, tag int, prompt bool) error {
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.New(c.keys[topic])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	envelope := append([]byte{0}, nonce...)
+	envelope = aead.Seal(envelope, nonce, plaintext, nil)
+
+	return c.call(ctx, "irn_publish", map[string]interface{}{
+		"topic":   topic,
+		"message": base64.StdEncoding.EncodeToString(envelope),
+		"ttl":     int64(WALLETCONNECT_TIMEOUT / time.Second),
+		"tag":     tag,
+		"prompt":  prompt,
+	})
+}
+
+func (c *wcClient) decrypt(msg wcSubscription) (*wcIncoming, error) {
+	key, ok := c.keys[msg.Topic]
+	if !ok {
+		return nil, fmt.Errorf("message on unknown topic %s", msg.Topic)
+	}
+	envelope, err := base64.StdEncoding.DecodeString(msg.Message)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope) < 1+chacha20poly1305.NonceSize || envelope[0] != 0 {
+		return nil, errors.New("unsupported WalletConnect envelope")
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := envelope[1 : 1+chacha20poly1305.NonceSize]
+	plaintext, err := aead.Open(nil, nonce, envelope[1+chacha20poly1305.NonceSize:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload wcIncoming
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// receive waits for a message on topic that match accepts, others are dropped
+func (c *wcClient) receive(ctx context.Context, topic string, match func(*wcIncoming) bool) (*wcIncoming, error) {
+	for {
+		select {
+		case msg := <-c.messages:
+			if msg.Topic != topic {
+				continue
+			}
+			payload, err := c.decrypt(msg)
+			if err != nil {
+				return nil, err
+			}
+			if match(payload) {
+				return payload, nil
+			}
+		case err := <-c.readErr:
+			return nil, fmt.Errorf("WalletConnect relay connection lost: %w", err)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no answer from the wallet: %w", ctx.Err())
+		}
+	}
+}
+
+func (c *wcClient) response(ctx context.Context, topic string, id int64) (json.RawMessage, error) {
+	payload, err := c.receive(ctx, topic, func(p *wcIncoming) bool { return p.Method == "" && p.ID == id })
+	if err != nil {
+		return nil, err
+	}
+	if payload.Error != nil {
+		return nil, fmt.Errorf("wallet rejected the request: %s", payload.Error.Message)
+	}
+	return payload.Result, nil
+}
+
+// walletConnectSigner signs with a mobile wallet connected over a
+// WalletConnect v2 session, the key never leaves the phone
+type walletConnectSigner struct {
+	client  *wcClient
+	topic   string
+	account common.Address
+	// the eip155 chain of the session
+	chain string
+}
+
+// openWalletConnect pairs with a wallet through a QR code and waits for the
+// session to be approved
+func openWalletConnect(projectID string) (signer, error) {
+	if projectID == "" {
+		return nil, errors.New("a WalletConnect projectId is required, see https://cloud.walletconnect.com")
+	}
+
+	ctx, cancel := context.WithTimeout(opCtx, WALLETCONNECT_TIMEOUT)
+	defer cancel()
+
+	client, err := dialWalletConnect(projectID)
+	if err != nil {
+		return nil, err
+	}
+	s, err := pairWalletConnect(ctx, client)
+	if err != nil {
+		client.conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func pairWalletConnect(ctx context.Context, client *wcClient) (*walletConnectSigner, error) {
+	pairingKey := make([]byte, 32)
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(pairingKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(private); err != nil {
+		return nil, err
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := serviceChain()
+	if err != nil {
+		return nil, err
+	}
+	pairingTopic, err := client.subscribe(ctx, pairingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := fmt.Sprintf("eip155:%d", chainID)
+	expiry := time.Now().Add(WALLETCONNECT_TIMEOUT).Unix()
+	proposal := wcPayload{ID: wcPayloadID(), JSONRPC: "2.0", Method: "wc_sessionPropose", Params: map[string]interface{}{
+		"requiredNamespaces": map[string]interface{}{
+			"eip155": map[string]interface{}{
+				"chains":  []string{chain},
+				"methods": []string{"eth_signTypedData_v4"},
+				"events":  []string{},
+			},
+		},
+		"relays": []map[string]string{{"protocol": "irn"}},
+		"proposer": map[string]interface{}{
+			"publicKey": hex.EncodeToString(public),
+			"metadata": map[string]interface{}{
+				"name":        "gnosis-tx",
+				"description": "Gnosis Safe transaction signing",
+				"url":         "https://github.com/revision-team/gnosis-tx",
+				"icons":       []string{},
+			},
+		},
+		"expiryTimestamp": expiry,
+		"pairingTopic":    pairingTopic,
+	}}
+	if err := client.publish(ctx, pairingTopic, proposal, WC_SESSION_PROPOSE, true); err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("wc:%s@2?relay-protocol=irn&symKey=%s&expiryTimestamp=%d", pairingTopic, hex.EncodeToString(pairingKey), expiry)
+	if qr, err := encodeQR(uri); err == nil {
+		fmt.Print(qr.terminal())
+	}
+	fmt.Println("scan the QR code with your wallet, or paste this URI:")
+	fmt.Println(uri)
+
+	result, err := client.response(ctx, pairingTopic, proposal.ID)
+	if err != nil {
+		return nil, err
+	}
+	var approval struct {
+		ResponderPublicKey string `json:"responderPublicKey"`
+	}
+	if err := json.Unmarshal(result, &approval); err != nil {
+		return nil, err
+	}
+	responder, err := hex.DecodeString(approval.ResponderPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wallet public key: %w", err)
+	}
+
+	shared, err := curve25519.X25519(private, responder)
+	if err != nil {
+		return nil, err
+	}
+	sessionKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, nil), sessionKey); err != nil {
+		return nil, err
+	}
+	sessionTopic, err := client.subscribe(ctx, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	settle, err := client.receive(ctx, sessionTopic, func(p *wcIncoming) bool { return p.Method == "wc_sessionSettle" })
+	if err != nil {
+		return nil, err
+	}
+	var session struct {
+		Namespaces map[string]struct {
+			Accounts []string `json:"accounts"`
+		} `json:"namespaces"`
+	}
+	if err := json.Unmarshal(settle.Params, &session); err != nil {
+		return nil, err
+	}
+	if err := client.publish(ctx, sessionTopic, wcPayload{ID: settle.ID, JSONRPC: "2.0", Result: json.RawMessage("true")}, WC_SESSION_SETTLE_RESPONSE, false); err != nil {
+		return nil, err
+	}
+
+	for _, account := range session.Namespaces["eip155"].Accounts {
+		// accounts are CAIP-10 ids, eip155:<chain>:<address>
+		if strings.HasPrefix(account, chain+":") {
+			address := strings.TrimPrefix(account, chain+":")
+			if err := checkAddress(address); err != nil {
+				return nil, fmt.Errorf("wallet returned an invalid account %q: %w", account, err)
+			}
+			fmt.Println("connected to", address)
+			return &walletConnectSigner{client: client, topic: sessionTopic, account: common.HexToAddress(address), chain: chain}, nil
+		}
+	}
+	return nil, fmt.Errorf("wallet approved no account on %s", chain)
+}
+
+func (s *walletConnectSigner) Address() common.Address {
+	return s.account
+}
+
+func (s *walletConnectSigner) SignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	encoded, err := encodeTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	// wallets expect the domain without the empty fields apitypes marshals
+	request, err := json.Marshal(map[string]interface{}{
+		"types":       typedData.Types,
+		"primaryType": typedData.PrimaryType,
+		"domain":      typedData.Domain.Map(),
+		"message":     typedData.Message,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(opCtx, WALLETCONNECT_TIMEOUT)
+	defer cancel()
+
+	payload := wcPayload{ID: wcPayloadID(), JSONRPC: "2.0", Method: "wc_sessionRequest", Params: map[string]interface{}{
+		"request": map[string]interface{}{
+			"method": "eth_signTypedData_v4",
+			"params": []string{s.account.Hex(), string(request)},
+		},
+		"chainId": s.chain,
+	}}
+	if err := s.client.publish(ctx, s.topic, payload, WC_SESSION_REQUEST, true); err != nil {
+		return nil, err
+	}
+	fmt.Println("approve the signature request in your wallet")
+
+	result, err := s.client.response(ctx, s.topic, payload.ID)
+	if err != nil {
+		return nil, err
+	}
+	var encodedSignature string
+	if err := json.Unmarshal(result, &encodedSignature); err != nil {
+		return nil, err
+	}
+	signature, err := hexutil.Decode(encodedSignature)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("wallet returned a signature of %d bytes", len(signature))
+	}
+	if signature, err = normalizeECDSA(signature); err != nil {
+		return nil, err
+	}
+
+	// the wallet may have signed something else than what was shown here
+	signer, err := recoverSigner(crypto.Keccak256Hash(encoded), signature)
+	if err != nil {
+		return nil, err
+	}
+	if signer != s.account {
+		return nil, fmt.Errorf("wallet signature recovers to %s, not the connected account %s", signer.Hex(), s.account.Hex())
+	}
+	return signature, nil
+}
+
+func (s *walletConnectSigner) Close() {
+	ctx, cancel := context.WithTimeout(opCtx, 5*time.Second)
+	defer cancel()
+
+	s.client.publish(ctx, s.topic, wcPayload{ID: wcPayloadID(), JSONRPC: "2.0", Method: "wc_sessionDelete", Params: map[string]interface{}{
+		"code":    6000,
+		"message": "User disconnected.",
+	}}, WC_SESSION_DELETE, false)
+	s.client.conn.Close()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	EVENT_PROPOSED       = "proposed"
+	EVENT_CONFIRMED      = "confirmed"
+	EVENT_EXECUTED       = "executed"
+	EVENT_AUTO_CONFIRMED = "auto-confirmed"
+	EVENT_REFUSED        = "refused"
+)
+
+// watchEvent is a queue change of a watched safe, POSTed as json to -webhook
+type watchEvent struct {
+	Type            string   `json:"type"`
+	Safe            string   `json:"safe"`
+	SafeTxHash      string   `json:"safeTxHash"`
+	Nonce           int64    `json:"nonce"`
+	Owner           string   `json:"owner,omitempty"`
+	Confirmations   int      `json:"confirmations"`
+	Required        int64    `json:"required"`
+	TransactionHash string   `json:"transactionHash,omitempty"`
+	Intent          []string `json:"intent"`
+	Origin          string   `json:"origin,omitempty"`
+	// why auto-confirm refused to sign
+	Reason string `json:"reason,omitempty"`
+}
+
+func (e *watchEvent) String() string {
+	var line string
+	switch e.Type {
+	case EVENT_PROPOSED:
+		line = fmt.Sprintf("new proposal on %s at nonce %d", e.Safe, e.Nonce)
+		if e.Origin != "" {
+			line += " from " + e.Origin
+		}
+	case EVENT_CONFIRMED:
+		line = fmt.Sprintf("%s confirmed nonce %d on %s", displayAddress(common.HexToAddress(e.Owner)), e.Nonce, e.Safe)
+	case EVENT_EXECUTED:
+		line = fmt.Sprintf("nonce %d on %s executed in %s", e.Nonce, e.Safe, e.TransactionHash)
+	case EVENT_AUTO_CONFIRMED:
+		line = fmt.Sprintf("auto-confirmed nonce %d on %s as %s", e.Nonce, e.Safe, e.Owner)
+	case EVENT_REFUSED:
+		line = fmt.Sprintf("refused to confirm nonce %d on %s: %s", e.Nonce, e.Safe, e.Reason)
+	}
+	line += fmt.Sprintf(" (%d/%d confirmations, %s)", e.Confirmations, e.Required, e.SafeTxHash)
+	for _, intent := range e.Intent {
+		line += "\n- " + intent
+	}
+	return line
+}
+
+type watchNotifier struct {
+	webhook       string
+	slackWebhook  string
+	telegramToken string
+	telegramChat  string
+}
+
+func postJSON(url string, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := httpPost(url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// notify prints the event and sends it to the configured destinations, a
+// failed notification doesn't stop the watch
+func (n *watchNotifier) notify(e *watchEvent) {
+	fmt.Printf("%s %s\n", formatTime(time.Now()), e)
+
+	if n.webhook != "" {
+		if err := postJSON(n.webhook, e); err != nil {
+			logger.Warn("webhook notification failed", "error", err)
+		}
+	}
+	if n.slackWebhook != "" {
+		if err := postJSON(n.slackWebhook, map[string]string{"text": e.String()}); err != nil {
+			logger.Warn("slack notification failed", "error", err)
+		}
+	}
+	if n.telegramToken != "" {
+		url := "https://api.telegram.org/bot" + n.telegramToken + "/sendMessage"
+		if err := postJSON(url, map[string]string{"chat_id": n.telegramChat, "text": e.String()}); err != nil {
+			// the error would contain the url and with it the bot token
+			logger.Warn("telegram notification failed", "error", strings.ReplaceAll(err.Error(), n.telegramToken, "<token>"))
+		}
+	}
+}
+
+// safeWatch is the last seen queue of a safe
+type safeWatch struct {
+	safe          string
+	nonce         int64
+	confirmations map[string]map[string]bool
+}
+
+func newWatchEvent(typ string, tx *multisigTxResponse) *watchEvent {
+	var data []byte
+	if tx.Data != nil {
+		data, _ = hexutil.Decode(*tx.Data)
+	}
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		value = new(big.Int)
+	}
+
+	e := &watchEvent{
+		Type:          typ,
+		Safe:          common.HexToAddress(tx.Safe).Hex(),
+		SafeTxHash:    tx.SafeTxHash,
+		Nonce:         tx.Nonce,
+		Confirmations: len(tx.Confirmations),
+		Required:      tx.ConfirmationsRequired,
+		Intent:        describeTx(common.HexToAddress(tx.To), value, data, tx.Operation),
+		Origin:        describeOrigin(tx.Origin),
+	}
+	if tx.TransactionHash != nil {
+		e.TransactionHash = *tx.TransactionHash
+	}
+	return e
+}
+
+// poll compares the queue of the safe with the last poll, notifying about
+// new proposals, confirmations and executions; the first poll only records
+// the queue
+func (w *safeWatch) poll(n *watchNotifier, first bool) error {
+	info, err := getSafeInfo(w.safe)
+	if err != nil {
+		return err
+	}
+
+	var executed []multisigTxResponse
+	if !first && info.Nonce > w.nonce {
+		url := serviceEndpoint("/safes/") + w.safe + "/multisig-transactions/?executed=true&nonce__gte=" + strconv.FormatInt(w.nonce, 10)
+		if executed, err = listMultisigTransactions(url); err != nil {
+			return err
+		}
+	}
+	pending, err := getPendingTransactions(w.safe, info.Nonce)
+	if err != nil {
+		return err
+	}
+
+	// oldest first, the listing is newest first
+	for i := len(executed) - 1; i >= 0; i-- {
+		tx := &executed[i]
+		if !tx.IsExecuted || tx.Nonce >= info.Nonce {
+			continue
+		}
+		n.notify(newWatchEvent(EVENT_EXECUTED, tx))
+		delete(w.confirmations, tx.SafeTxHash)
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		tx := &pending[i]
+		seen, known := w.confirmations[tx.SafeTxHash]
+		if !known {
+			seen = map[string]bool{}
+			w.confirmations[tx.SafeTxHash] = seen
+			if !first {
+				n.notify(newWatchEvent(EVENT_PROPOSED, tx))
+			}
+		}
+
+		for _, c := range tx.Confirmations {
+			owner := common.HexToAddress(c.Owner).Hex()
+			if seen[owner] {
+				continue
+			}
+			seen[owner] = true
+			// the proposer's own confirmation is part of the proposal
+			if !first && known {
+				e := newWatchEvent(EVENT_CONFIRMED, tx)
+				e.Owner = owner
+				n.notify(e)
+			}
+		}
+	}
+
+	// replaced proposals at executed nonces are dropped from the listing
+	current := map[string]bool{}
+	for _, tx := range pending {
+		current[tx.SafeTxHash] = true
+	}
+	for hash := range w.confirmations {
+		if !current[hash] {
+			delete(w.confirmations, hash)
+		}
+	}
+
+	w.nonce = info.Nonce
+	return nil
+}
+
+// watchSafes polls the queues of the safes until the operation deadline or
+// an interrupt, the transaction service has no push api to subscribe to
+func watchSafes(safes []string, workers int, interval time.Duration, n *watchNotifier) error {
+	watches := make([]*safeWatch, len(safes))
+	errs := forEachSafe(safes, workers, func(i int, safe string) error {
+		watches[i] = &safeWatch{safe: safe, confirmations: map[string]map[string]bool{}}
+		return watches[i].poll(n, true)
+	})
+	if err := safeErrors(safes, errs); err != nil {
+		return err
+	}
+	for _, w := range watches {
+		fmt.Printf("watching %s from nonce %d, %d queued\n", w.safe, w.nonce, len(w.confirmations))
+	}
+
+	for {
+		if err := sleep(interval); err != nil {
+			return err
+		}
+		errs := forEachSafe(safes, workers, func(i int, safe string) error {
+			return watches[i].poll(n, false)
+		})
+		for i, err := range errs {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: polling %s failed: %v\n", safes[i], err)
+			}
+		}
+	}
+}
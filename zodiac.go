@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// zodiac modifiers sit between modules and the safe: the delay modifier
+// queues what its modules execute for a cooldown, the roles modifier lets
+// members execute what their role permits
+
+// the delay modifier rejects expirations shorter than this
+const MIN_DELAY_EXPIRATION = 60 * time.Second
+
+var transactionAddedTopic = crypto.Keccak256Hash([]byte("TransactionAdded(uint256,bytes32,address,uint256,bytes,uint8)"))
+
+type delayState struct {
+	Avatar     common.Address
+	Target     common.Address
+	Owner      common.Address
+	Cooldown   time.Duration
+	Expiration time.Duration
+	TxNonce    uint64
+	QueueNonce uint64
+}
+
+// delayedTx is a transaction queued in the delay modifier
+type delayedTx struct {
+	Nonce     uint64
+	Hash      common.Hash
+	To        common.Address
+	Value     *big.Int
+	Data      []byte
+	Operation uint8
+	CreatedAt time.Time
+}
+
+func (tx *delayedTx) executable(d *delayState, now time.Time) bool {
+	return tx.Nonce >= d.TxNonce && !now.Before(tx.CreatedAt.Add(d.Cooldown)) && !tx.expired(d, now)
+}
+
+func (tx *delayedTx) expired(d *delayState, now time.Time) bool {
+	return d.Expiration > 0 && !now.Before(tx.CreatedAt.Add(d.Cooldown+d.Expiration))
+}
+
+// status tells whether the transaction can be executed yet
+func (tx *delayedTx) status(d *delayState, now time.Time) string {
+	ready := tx.CreatedAt.Add(d.Cooldown)
+	switch {
+	case tx.Nonce < d.TxNonce:
+		return "skipped or executed"
+	case now.Before(ready):
+		return "cooling down until " + formatTime(ready) + " (" + ready.Sub(now).Round(time.Second).String() + ")"
+	case tx.expired(d, now):
+		return "expired at " + formatTime(ready.Add(d.Expiration))
+	case d.Expiration > 0:
+		return "executable until " + formatTime(ready.Add(d.Expiration))
+	default:
+		return "executable"
+	}
+}
+
+func readDelay(client EthClient, delay common.Address) (*delayState, error) {
+	d := &delayState{}
+	for _, field := range []struct {
+		signature string
+		dest      interface{}
+	}{
+		{"avatar()", &d.Avatar}, {"target()", &d.Target}, {"owner()", &d.Owner},
+	} {
+		values, err := callView(client, delay, field.signature, "(address)")
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a delay modifier: %w", delay.Hex(), err)
+		}
+		*field.dest.(*common.Address) = values[0].(common.Address)
+	}
+
+	var numbers [4]uint64
+	for i, signature := range []string{"txCooldown()", "txExpiration()", "txNonce()", "queueNonce()"} {
+		values, err := callView(client, delay, signature, "(uint256)")
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a delay modifier: %w", delay.Hex(), err)
+		}
+		numbers[i] = values[0].(*big.Int).Uint64()
+	}
+	d.Cooldown = time.Duration(numbers[0]) * time.Second
+	d.Expiration = time.Duration(numbers[1]) * time.Second
+	d.TxNonce, d.QueueNonce = numbers[2], numbers[3]
+	return d, nil
+}
+
+// readModules lists the modules enabled on a safe or a modifier
+func readModules(client EthClient, target common.Address) ([]common.Address, error) {
+	values, err := callView(client, target, "getModulesPaginated(address,uint256)", "(address[],address)", sentinelOwner, big.NewInt(100))
+	if err != nil {
+		return nil, err
+	}
+	return values[0].([]common.Address), nil
+}
+
+// readDelayQueue recovers the transactions still queued in the delay from its
+// TransactionAdded events, the contract only stores their hashes
+func readDelayQueue(client EthClient, delay common.Address, d *delayState) ([]*delayedTx, error) {
+	if d.TxNonce >= d.QueueNonce {
+		return nil, nil
+	}
+	var nonces []common.Hash
+	for nonce := d.TxNonce; nonce < d.QueueNonce; nonce++ {
+		nonces = append(nonces, common.BigToHash(new(big.Int).SetUint64(nonce)))
+	}
+	logs, err := client.FilterLogs(opCtx, ethereum.FilterQuery{
+		FromBlock: common.Big0,
+		Addresses: []common.Address{delay},
+		Topics:    [][]common.Hash{{transactionAddedTopic}, nonces},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading the queue of %s: %w", delay.Hex(), err)
+	}
+
+	args, err := methodArguments("(address,uint256,bytes,uint8)")
+	if err != nil {
+		return nil, err
+	}
+	var queue []*delayedTx
+	for _, log := range logs {
+		if len(log.Topics) < 3 {
+			continue
+		}
+		values, err := args.UnpackValues(log.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TransactionAdded event in %s: %w", log.TxHash.Hex(), err)
+		}
+		tx := &delayedTx{
+			Nonce:     log.Topics[1].Big().Uint64(),
+			Hash:      log.Topics[2],
+			To:        values[0].(common.Address),
+			Value:     values[1].(*big.Int),
+			Data:      values[2].([]byte),
+			Operation: values[3].(uint8),
+		}
+		created, err := callView(client, delay, "getTxCreatedAt(uint256)", "(uint256)", new(big.Int).SetUint64(tx.Nonce))
+		if err != nil {
+			return nil, err
+		}
+		tx.CreatedAt = time.Unix(created[0].(*big.Int).Int64(), 0)
+		queue = append(queue, tx)
+	}
+	return queue, nil
+}
+
+// executeNextDelayed executes the next queued transaction of the delay once
+// its cooldown is over, any key can send it; expired transactions ahead of it
+// are skipped first with skipExpired
+func executeNextDelayed(rpc string, key *ecdsa.PrivateKey, delay common.Address, skipExpired bool, fees *feeOptions) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	d, err := readDelay(client, delay)
+	if err != nil {
+		return err
+	}
+	queue, err := readDelayQueue(client, delay, d)
+	if err != nil {
+		return err
+	}
+
+	var next *delayedTx
+	now := time.Now()
+	for _, tx := range queue {
+		if tx.Nonce == d.TxNonce && tx.expired(d, now) && skipExpired {
+			fmt.Println("skipping expired transaction", tx.Nonce)
+			d.TxNonce++
+			continue
+		}
+		if tx.Nonce == d.TxNonce {
+			next = tx
+			break
+		}
+	}
+	if next == nil {
+		return fmt.Errorf("nothing executable is queued in delay modifier %s", delay.Hex())
+	}
+	if !next.executable(d, now) {
+		status := next.status(d, now)
+		if next.expired(d, now) {
+			status += ", skip it with -skip-expired"
+		}
+		return fmt.Errorf("queued transaction %d is %s", next.Nonce, status)
+	}
+
+	suggested, err := suggestFees(rpc, fees)
+	if err != nil {
+		return err
+	}
+	if skipped := next.Nonce - queue[0].Nonce; skipped > 0 {
+		call, err := encodeCall("skipExpired()")
+		if err != nil {
+			return err
+		}
+		if _, err := sendEthTransaction(client, key, delay, common.Big0, call, suggested); err != nil {
+			return explainRevert(err, nil)
+		}
+	}
+
+	call, err := encodeCall("executeNextTx(address,uint256,bytes,uint8)", next.To, next.Value, next.Data, next.Operation)
+	if err != nil {
+		return err
+	}
+	if _, err := sendEthTransaction(client, key, delay, common.Big0, call, suggested); err != nil {
+		return explainRevert(err, nil)
+	}
+	fmt.Println("executed queued transaction", next.Nonce, "on", displayAddress(d.Target))
+	return nil
+}
+
+// buildDelayQueue returns the call queueing a transaction in the delay and
+// checks member is one of its modules
+func buildDelayQueue(client EthClient, delay, member, to common.Address, value *big.Int, data []byte, operation uint8) ([]byte, *delayState, error) {
+	d, err := readDelay(client, delay)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok, err := isModuleEnabled(client, delay, member); err != nil {
+		return nil, nil, err
+	} else if !ok {
+		return nil, nil, fmt.Errorf("%s is not a module of delay modifier %s", member.Hex(), delay.Hex())
+	}
+	call, err := encodeCall("execTransactionFromModule(address,uint256,bytes,uint8)", to, value, data, operation)
+	if err != nil {
+		return nil, nil, err
+	}
+	return call, d, nil
+}
+
+func printDelay(client EthClient, delay common.Address, d *delayState) error {
+	enabled, err := isModuleEnabled(client, d.Avatar, delay)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		logger.Warn("delay modifier is not enabled on its safe", "delay", delay.Hex(), "safe", d.Avatar.Hex())
+	}
+	expiration := "none"
+	if d.Expiration > 0 {
+		expiration = d.Expiration.String()
+	}
+	fmt.Println("delay modifier:", delay.Hex(), "target:", displayAddress(d.Target), "owner:", displayAddress(d.Owner))
+	fmt.Println("cooldown:", d.Cooldown, "expiration:", expiration)
+	return nil
+}
+
+func printDelayQueue(client EthClient, delay common.Address, d *delayState) error {
+	queue, err := readDelayQueue(client, delay, d)
+	if err != nil {
+		return err
+	}
+	if len(queue) == 0 {
+		fmt.Println("no transactions queued")
+		return nil
+	}
+	now := time.Now()
+	for _, tx := range queue {
+		summary := fmt.Sprintf("to %s value %s", displayAddress(tx.To), formatWei(tx.Value))
+		if method, ok := lookupMethod(tx.Data); ok {
+			summary += " " + method
+		}
+		if tx.Operation == 1 {
+			summary += " (delegatecall)"
+		}
+		fmt.Printf("queued %d: %s, queued at %s, %s\n", tx.Nonce, summary, formatTime(tx.CreatedAt), tx.status(d, now))
+	}
+	return nil
+}
+
+// showDelay prints the delay configuration, its modules and its queue
+func showDelay(rpc string, delay common.Address) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	d, err := readDelay(client, delay)
+	if err != nil {
+		return err
+	}
+	if err := printDelay(client, delay, d); err != nil {
+		return err
+	}
+	modules, err := readModules(client, delay)
+	if err != nil {
+		return err
+	}
+	for _, module := range modules {
+		fmt.Println("module:", displayAddress(module))
+	}
+	return printDelayQueue(client, delay, d)
+}
+
+// custom errors of the roles modifier, reverted when a call isn't permitted
+var rolesErrors = map[string]string{
+	"NoMembership()":                "the sender is not a member of the role",
+	"TargetAddressNotAllowed()":     "the role can't call this address",
+	"FunctionNotAllowed()":          "the role can't call this function of the address",
+	"SendNotAllowed()":              "the role can't send value to this address",
+	"DelegateCallNotAllowed()":      "the role can't delegatecall this address",
+	"ParameterNotAllowed()":         "a parameter is not the one the role allows",
+	"ParameterNotOneOfAllowed()":    "a parameter is not one of those the role allows",
+	"ParameterLessThanAllowed()":    "a parameter is below the minimum the role allows",
+	"ParameterGreaterThanAllowed()": "a parameter is above the maximum the role allows",
+	"UnacceptableMultiSendOffset()": "the multisend is not encoded as the role requires",
+	"UnsuitableMultiSendAddress()":  "multisend is not set up on the roles modifier for this address",
+	"ModuleTransactionFailed()":     "the call is permitted but failed in the safe",
+}
+
+// rolesError names the roles modifier error in revert data
+func rolesError(data []byte) (string, bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+	for signature, meaning := range rolesErrors {
+		if bytes.Equal(data[:4], crypto.Keccak256([]byte(signature))[:4]) {
+			return signature + ": " + meaning, true
+		}
+	}
+	return "", false
+}
+
+func buildRoleCall(to common.Address, value *big.Int, data []byte, operation uint8, role uint16) ([]byte, error) {
+	return encodeCall("execTransactionWithRole(address,uint256,bytes,uint8,uint16,bool)", to, value, data, operation, role, true)
+}
+
+// checkRolePermission simulates the call of member through the roles
+// modifier, failing with the permission it lacks
+func checkRolePermission(client EthClient, roles, member common.Address, call []byte) error {
+	_, err := callFrom(client, member, roles, nil, call)
+	if err == nil {
+		return nil
+	}
+	reason, ok := callError(err)
+	if !ok {
+		return err
+	}
+	if data, decodeErr := hexutil.Decode(reason); decodeErr == nil {
+		if name, ok := rolesError(data); ok {
+			reason = name
+		}
+	}
+	return fmt.Errorf("the roles modifier %s refuses the call of %s: %s", roles.Hex(), member.Hex(), reason)
+}
+
+// sendModuleCall sends a call to a modifier from a module key directly,
+// instead of proposing it from a member safe
+func sendModuleCall(rpc string, key *ecdsa.PrivateKey, modifier common.Address, call []byte, fees *feeOptions) error {
+	client, err := dialRPC(rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	suggested, err := suggestFees(rpc, fees)
+	if err != nil {
+		return err
+	}
+	if _, err := sendEthTransaction(client, key, modifier, common.Big0, call, suggested); err != nil {
+		return explainRevert(err, nil)
+	}
+	return nil
+}